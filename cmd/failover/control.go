@@ -0,0 +1,132 @@
+package failover
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/loopholelabs/cmdutils"
+
+	"github.com/loopholelabs/architect-networking/internal/config"
+	"github.com/loopholelabs/architect-networking/pkg/failover"
+)
+
+// controlConfig holds the flags shared by commands using the local control API
+type controlConfig struct {
+	socket  string
+	timeout time.Duration
+}
+
+func (cc *controlConfig) addFlags(c *cobra.Command, timeout time.Duration) {
+	c.Flags().StringVar(&cc.socket, "control-socket", failover.DefaultControlSocket(), "Control socket of the failover daemon on this node")
+	c.Flags().DurationVar(&cc.timeout, "timeout", timeout, "How long to wait for the daemon to respond")
+}
+
+func maintenanceCmd(ch *cmdutils.Helper[*config.Config]) *cobra.Command {
+	var cfg controlConfig
+
+	c := &cobra.Command{
+		Use:       "maintenance on|off",
+		Short:     "Enable or disable maintenance mode on this node",
+		Long:      "In maintenance mode the node keeps its current role: a secondary does not promote itself when heartbeats are missed and a primary keeps holding leadership. Planned switchovers are still allowed.",
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"on", "off"},
+		RunE: func(_ *cobra.Command, args []string) error {
+			var enabled bool
+			switch args[0] {
+			case "on":
+				enabled = true
+			case "off":
+				enabled = false
+			default:
+				return fmt.Errorf("maintenance mode must be 'on' or 'off', got: %s", args[0])
+			}
+
+			controlClient, err := failover.NewControlClient(cfg.socket)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+			defer cancel()
+
+			status, err := controlClient.SetMaintenance(ctx, enabled)
+			if err != nil {
+				return err
+			}
+
+			ch.Printer.Printf("Maintenance mode %s for %s node %s\n", args[0], status.Role, status.InstanceID)
+
+			return nil
+		},
+	}
+	cfg.addFlags(c, 10*time.Second)
+
+	return c
+}
+
+func metricsCmd(ch *cmdutils.Helper[*config.Config]) *cobra.Command {
+	var cfg controlConfig
+
+	c := &cobra.Command{
+		Use:   "metrics",
+		Short: "Show the metrics of the failover daemon on this node",
+		Long:  "Print the gauges, counters and samples the failover daemon aggregated over the last intervals, such as heartbeat suspicion levels and raft statistics",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			controlClient, err := failover.NewControlClient(cfg.socket)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+			defer cancel()
+
+			summary, err := controlClient.Metrics(ctx)
+			if err != nil {
+				return err
+			}
+
+			return ch.Printer.PrintJSON(summary)
+		},
+	}
+	cfg.addFlags(c, 10*time.Second)
+
+	return c
+}
+
+func resyncCmd(ch *cmdutils.Helper[*config.Config]) *cobra.Command {
+	var cfg controlConfig
+
+	c := &cobra.Command{
+		Use:   "resync",
+		Short: "Force a full NAT state resync from the primary",
+		Long:  "Make the secondary on this node discard its copy of the primary's NAT state and page the full state from the primary",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			controlClient, err := failover.NewControlClient(cfg.socket)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+			defer cancel()
+
+			ch.Printer.Printf("Resyncing NAT state from primary...\n")
+
+			status, err := controlClient.Resync(ctx)
+			if err != nil {
+				return err
+			}
+
+			if status.LastSync != nil {
+				ch.Printer.Printf("Resync complete: %d NAT entries at version %d\n", status.LastSync.Entries, status.LastSync.Version)
+			}
+
+			return nil
+		},
+	}
+	cfg.addFlags(c, 5*time.Minute)
+
+	return c
+}
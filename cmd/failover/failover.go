@@ -27,39 +27,163 @@ func Cmd() command.SetupCommand[*config.Config] {
 				return leaderCfg.Validate()
 			},
 			RunE: func(_ *cobra.Command, _ []string) error {
+				if leaderCfg.Mode == failover.ModeWitness {
+					ch.Printer.Printf("Starting Conduit failover witness...")
+					if leaderCfg.ElectionBackend == failover.ElectionBackendRaft {
+						ch.Printer.Printf("Node ID: %s", leaderCfg.NodeID)
+						ch.Printer.Printf("Cluster peers: %v", leaderCfg.ClusterPeers)
+					} else {
+						ch.Printer.Printf("Port: %d", leaderCfg.Port)
+						ch.Printer.Printf("Heartbeat interval: %s", leaderCfg.HeartbeatInterval)
+						ch.Printer.Printf("Heartbeat miss threshold: %d", leaderCfg.HeartbeatMissThreshold)
+					}
+					if leaderCfg.TLSCAFile != "" {
+						ch.Printer.Printf("Mutual TLS: %s (peer SANs: %v)", leaderCfg.TLSCertFile, leaderCfg.TLSPeerSANs)
+					}
+					ch.Printer.Printf("State directory: %s", leaderCfg.StateDir)
+
+					return runWitnessCmd(ch, &leaderCfg)
+				}
+
 				ch.Printer.Printf("Starting Conduit failover daemon...")
 				ch.Printer.Printf("ENI IP: %s", leaderCfg.ENIIP)
 				ch.Printer.Printf("Port: %d", leaderCfg.Port)
+				if len(leaderCfg.PeerAddrs) > 0 {
+					ch.Printer.Printf("Peer addresses: %v", leaderCfg.PeerAddrs)
+				}
 				ch.Printer.Printf("Local socket: %s", leaderCfg.LocalSocket)
 				ch.Printer.Printf("Destination CIDR: %s", leaderCfg.DestinationCIDR)
+				if len(leaderCfg.ResourceTags)+len(leaderCfg.ManagedENIs)+len(leaderCfg.FloatingIPs)+len(leaderCfg.RouteTables) > 0 {
+					ch.Printer.Printf("Managed resources: tags %v, ENIs %v, floating IPs %v, route tables %v", leaderCfg.ResourceTags, leaderCfg.ManagedENIs, leaderCfg.FloatingIPs, leaderCfg.RouteTables)
+				}
+				if leaderCfg.ReconcileInterval > 0 {
+					ch.Printer.Printf("Drift reconciliation: every %s", leaderCfg.ReconcileInterval)
+				}
 				ch.Printer.Printf("Leader check interval: %s", leaderCfg.LeaderCheckInterval)
 				ch.Printer.Printf("Sync interval: %s", leaderCfg.SyncInterval)
+				ch.Printer.Printf("Sync wire version: %d (compression: %t)", leaderCfg.SyncWireVersion, leaderCfg.SyncCompression)
 				ch.Printer.Printf("Heartbeat interval: %s", leaderCfg.HeartbeatInterval)
 				ch.Printer.Printf("Heartbeat miss threshold: %d", leaderCfg.HeartbeatMissThreshold)
+				if leaderCfg.FailureDetector == failover.FailureDetectorPhi {
+					ch.Printer.Printf("Failure detector: phi accrual (threshold: %.1f, window: %d, min std dev: %s)", leaderCfg.PhiThreshold, leaderCfg.PhiWindowSize, leaderCfg.PhiMinStdDev)
+				}
+				if leaderCfg.LivenessProtocol == failover.LivenessBFD {
+					ch.Printer.Printf("Liveness: BFD on UDP port %d, peer port %d (min tx: %s, min rx: %s, detect multiplier: %d, authentication: %t)", leaderCfg.BFDPort, leaderCfg.BFDPeerPort, leaderCfg.BFDDesiredMinTx, leaderCfg.BFDRequiredMinRx, leaderCfg.BFDDetectMultiplier, leaderCfg.BFDAuthKeyFile != "")
+				}
+				ch.Printer.Printf("Election backend: %s", leaderCfg.ElectionBackend)
+				if leaderCfg.ElectionBackend == failover.ElectionBackendStatic {
+					ch.Printer.Printf("Forced role: %s", leaderCfg.ForceRole)
+				}
+				ch.Printer.Printf("Priority: %d (preempt: %t, hold down: %s)", leaderCfg.Priority, leaderCfg.Preempt, leaderCfg.HoldDownTime)
+				if leaderCfg.FlapThreshold > 0 {
+					ch.Printer.Printf("Flap detection: %d transitions in %s freeze failover for %s", leaderCfg.FlapThreshold, leaderCfg.FlapWindow, leaderCfg.FlapFreezeDuration)
+				}
+				ch.Printer.Printf("Promotion: %d failover action attempts within %s", leaderCfg.PromotionAttempts, leaderCfg.PromotionTimeout)
+				if len(leaderCfg.PrePromoteHooks)+len(leaderCfg.PostPromoteHooks)+len(leaderCfg.PostDemoteHooks) > 0 {
+					ch.Printer.Printf("Transition hooks: %d pre-promote, %d post-promote, %d post-demote (timeout: %s)", len(leaderCfg.PrePromoteHooks), len(leaderCfg.PostPromoteHooks), len(leaderCfg.PostDemoteHooks), leaderCfg.HookTimeout)
+				}
+				if leaderCfg.ElectionBackend == failover.ElectionBackendLease {
+					ch.Printer.Printf("Lease: %s/%s (%s)", leaderCfg.LeaseTable, leaderCfg.LeaseKey, leaderCfg.LeaseDuration)
+				}
+				if leaderCfg.ElectionBackend == failover.ElectionBackendRaft {
+					ch.Printer.Printf("Raft node ID: %s", leaderCfg.NodeID)
+					ch.Printer.Printf("Cluster peers: %v", leaderCfg.ClusterPeers)
+				}
+				ch.Printer.Printf("State directory: %s", leaderCfg.StateDir)
+				ch.Printer.Printf("Control socket: %s", leaderCfg.ControlSocket)
+				if leaderCfg.HealthProbeInterval > 0 {
+					ch.Printer.Printf("Health probe: every %s, %d failures (checks: %v, max latency: %s)", leaderCfg.HealthProbeInterval, leaderCfg.HealthProbeFailureThreshold, leaderCfg.HealthChecks, leaderCfg.HealthMaxLatency)
+				}
+				if leaderCfg.WitnessAddr != "" {
+					ch.Printer.Printf("Witness: %s", leaderCfg.WitnessAddr)
+				}
+				if leaderCfg.TLSCAFile != "" {
+					ch.Printer.Printf("Mutual TLS: %s (peer SANs: %v)", leaderCfg.TLSCertFile, leaderCfg.TLSPeerSANs)
+				}
+				if leaderCfg.PeerInstanceID != "" {
+					ch.Printer.Printf("Peer instance ID: %s", leaderCfg.PeerInstanceID)
+				}
 
 				return runLeaderFailoverCmd(ch, &leaderCfg)
 			},
 		}
 
 		// Failover configuration flags
-		c.Flags().StringVar(&leaderCfg.ENIIP, "eni-ip", "", "ENI IP address to monitor for ownership (required)")
+		c.Flags().StringVar(&leaderCfg.Mode, "mode", failover.ModeNode, "Daemon mode: 'node' runs NAT failover, 'witness' only votes on which node is primary")
+		c.Flags().StringVar(&leaderCfg.ENIIP, "eni-ip", "", "ENI IP address to monitor for ownership (required in node mode)")
 		c.Flags().Uint16Var(&leaderCfg.Port, "port", 1022, "Port for fRPC communication between nodes")
-		c.Flags().StringVar(&leaderCfg.LocalSocket, "local-socket", "", "Local conduit server socket for API access (required)")
+		c.Flags().StringSliceVar(&leaderCfg.PeerAddrs, "peer-addr", nil, "Multiaddr of the other node, e.g. /ip4/10.0.1.10/tcp/1022 (repeatable, heartbeats are sent over every address; defaults to the ENI IP)")
+		c.Flags().StringVar(&leaderCfg.LocalSocket, "local-socket", "", "Local conduit server socket for API access (required in node mode)")
+		c.Flags().StringVar(&leaderCfg.ControlSocket, "control-socket", "", "Unix socket multiaddr serving the local control API (defaults to control.sock in the state directory)")
+		c.Flags().DurationVar(&leaderCfg.HealthProbeInterval, "health-probe-interval", 0, "Interval between health probes of the local conduit instance (disabled when zero)")
+		c.Flags().IntVar(&leaderCfg.HealthProbeFailureThreshold, "health-probe-failure-threshold", 3, "Consecutive failed health probes before conduit is considered unhealthy")
+		c.Flags().StringSliceVar(&leaderCfg.HealthChecks, "health-check", nil, "Conduit health check to run: 'router', 'outbound_nat', 'nat_ips' or 'state' (repeatable, all when unset)")
+		c.Flags().DurationVar(&leaderCfg.HealthMaxLatency, "health-max-latency", time.Second, "Maximum latency of a conduit API call before a health probe fails")
 		c.Flags().StringVar(&leaderCfg.DestinationCIDR, "destination-cidr", "", "Destination CIDR block for route table updates")
+		c.Flags().StringSliceVar(&leaderCfg.ResourceTags, "resource-tag", nil, "EC2 tag as key=value selecting the ENIs and route tables of this pair, e.g. architect:pair=nat-a (repeatable, resources must carry all tags)")
+		c.Flags().StringSliceVar(&leaderCfg.ManagedENIs, "managed-eni", nil, "ENI of this pair in addition to those selected by tags (repeatable, all ENIs in the subnet of this instance's ENI when no ENIs or tags are given, which is deprecated)")
+		c.Flags().StringSliceVar(&leaderCfg.FloatingIPs, "floating-ip", nil, "Floating IP or CIDR block of them moved to the primary (repeatable, all secondary IPs of the managed ENIs when unset)")
+		c.Flags().StringSliceVar(&leaderCfg.RouteTables, "route-table", nil, "Route table of this pair in addition to those selected by tags (repeatable, all in the ENI IP's VPC with a route to the destination CIDR when no route tables or tags are given, which is deprecated)")
+		c.Flags().DurationVar(&leaderCfg.ReconcileInterval, "reconcile-interval", 0, "Interval at which the primary repairs routes, floating IPs and EIPs that no longer point at it (disabled when zero, the default; requires --resource-tag, or --managed-eni and --route-table)")
+		c.Flags().Uint32Var(&leaderCfg.Priority, "priority", 0, "Priority of this node for the primary role, a higher value is preferred")
+		c.Flags().BoolVar(&leaderCfg.Preempt, "preempt", false, "Take the primary role back from a lower priority primary once this node has recovered (requires mutual TLS)")
+		c.Flags().DurationVar(&leaderCfg.HoldDownTime, "hold-down-time", 0, "Minimum time after a role transition before this node takes the primary role on its own again")
+		c.Flags().IntVar(&leaderCfg.FlapThreshold, "flap-threshold", 0, "Automatic role transitions within --flap-window that freeze automatic failover (disabled when zero)")
+		c.Flags().DurationVar(&leaderCfg.FlapWindow, "flap-window", 10*time.Minute, "Window in which role transitions count towards --flap-threshold")
+		c.Flags().DurationVar(&leaderCfg.FlapFreezeDuration, "flap-freeze-duration", 0, "How long automatic failover stays frozen once flapping is detected (defaults to --flap-window)")
+		c.Flags().DurationVar(&leaderCfg.PromotionTimeout, "promotion-timeout", 2*time.Minute, "Time allowed for claiming the epoch and running the failover actions when promoting")
+		c.Flags().IntVar(&leaderCfg.PromotionAttempts, "promotion-attempts", 3, "Attempts at the failover actions before a promotion fails and the node demotes again")
+		c.Flags().StringArrayVar(&leaderCfg.PrePromoteHooks, "pre-promote-hook", nil, "Command run with sh before promoting, a non-zero exit vetoes the promotion (repeatable)")
+		c.Flags().StringArrayVar(&leaderCfg.PostPromoteHooks, "post-promote-hook", nil, "Command run with sh once this node acts as primary (repeatable)")
+		c.Flags().StringArrayVar(&leaderCfg.PostDemoteHooks, "post-demote-hook", nil, "Command run with sh once this node acts as secondary (repeatable)")
+		c.Flags().DurationVar(&leaderCfg.HookTimeout, "hook-timeout", 10*time.Second, "Maximum run time of each transition hook")
 		c.Flags().DurationVar(&leaderCfg.LeaderCheckInterval, "leader-check-interval", 30*time.Second, "Leader election check interval")
 		c.Flags().DurationVar(&leaderCfg.SyncInterval, "sync-interval", 10*time.Second, "State sync interval when acting as secondary")
+		c.Flags().IntVar(&leaderCfg.SyncChunkSize, "sync-chunk-size", 16384, "Maximum number of NAT entries per message during a full state resync")
+		c.Flags().Uint32Var(&leaderCfg.SyncWireVersion, "sync-wire-version", 2, "Wire format requested for synced NAT state (1 = protocol messages, 2 = compact encoding)")
+		c.Flags().BoolVar(&leaderCfg.SyncCompression, "sync-compression", false, "Request zstd compression of compact encoded sync payloads")
 		c.Flags().DurationVar(&leaderCfg.HeartbeatInterval, "heartbeat-interval", 40*time.Millisecond, "Heartbeat interval (must be <50ms for 3 heartbeats in 150ms)")
 		c.Flags().IntVar(&leaderCfg.HeartbeatMissThreshold, "heartbeat-miss-threshold", 3, "Number of missed heartbeats before failover")
+		c.Flags().StringVar(&leaderCfg.FailureDetector, "failure-detector", failover.FailureDetectorCounter, "How the secondary decides the primary is down: 'counter' after --heartbeat-miss-threshold missed heartbeats, 'phi' once the phi accrual suspicion level reaches --phi-threshold")
+		c.Flags().Float64Var(&leaderCfg.PhiThreshold, "phi-threshold", 8, "Suspicion level at which the phi accrual detector considers the primary down")
+		c.Flags().IntVar(&leaderCfg.PhiWindowSize, "phi-window-size", 200, "Number of heartbeat inter-arrival times the phi accrual detector keeps")
+		c.Flags().DurationVar(&leaderCfg.PhiMinStdDev, "phi-min-std-dev", 0, "Lower bound of the heartbeat inter-arrival time deviation for the phi accrual detector (defaults to a quarter of --heartbeat-interval)")
+		c.Flags().StringVar(&leaderCfg.LivenessProtocol, "liveness", failover.LivenessFRPC, "How the nodes detect each other's failure: 'frpc' heartbeat requests every --heartbeat-interval, or 'bfd' BFD control packets over UDP (requires --peer-addr)")
+		c.Flags().Uint16Var(&leaderCfg.BFDPort, "bfd-port", 3784, "UDP port for BFD control packets")
+		c.Flags().Uint16Var(&leaderCfg.BFDPeerPort, "bfd-peer-port", 0, "UDP port for BFD control packets on the other node (defaults to --bfd-port)")
+		c.Flags().DurationVar(&leaderCfg.BFDDesiredMinTx, "bfd-min-tx", 10*time.Millisecond, "Minimum interval at which this node wants to send BFD control packets")
+		c.Flags().DurationVar(&leaderCfg.BFDRequiredMinRx, "bfd-min-rx", 10*time.Millisecond, "Minimum interval at which this node can receive BFD control packets")
+		c.Flags().Uint8Var(&leaderCfg.BFDDetectMultiplier, "bfd-detect-multiplier", 3, "BFD control packets the other node may miss before it is considered down")
+		c.Flags().StringVar(&leaderCfg.BFDAuthKeyFile, "bfd-auth-key-file", "", "File with a shared key of up to 20 bytes that authenticates BFD control packets (keyed SHA1)")
+		c.Flags().Uint8Var(&leaderCfg.BFDAuthKeyID, "bfd-auth-key-id", 1, "Key ID of --bfd-auth-key-file, both nodes must use the same")
+		c.Flags().Float64Var(&leaderCfg.BFDPacketLoss, "bfd-packet-loss", 0, "Fraction of received BFD control packets to drop, for testing failure detection under packet loss")
+		c.Flags().StringVar(&leaderCfg.MetricsSink, "metrics-sink", "", "Metrics sink URL in addition to the control API, e.g. statsd://127.0.0.1:8125")
 		c.Flags().BoolVar(&leaderCfg.DisableENICheck, "disable-eni-check", false, "Disable ENI ownership checks for testing")
-		c.Flags().StringVar(&leaderCfg.ForceRole, "force-role", "", "Force role to 'primary' or 'secondary' for testing")
-
-		// Mark required flags
-		if err := c.MarkFlagRequired("eni-ip"); err != nil {
-			panic(err) // This should never happen during command setup
-		}
-		if err := c.MarkFlagRequired("local-socket"); err != nil {
-			panic(err) // This should never happen during command setup
-		}
+		c.Flags().StringVar(&leaderCfg.ElectionBackend, "election-backend", "", "Leader election backend: 'eni', 'file', 'lease', 'raft' or 'static' (defaults to 'eni', 'static' with --force-role, or 'file' when ENI checks are disabled)")
+		c.Flags().StringVar(&leaderCfg.ForceRole, "force-role", "", "Force role to 'primary' or 'secondary' for testing, with the 'static' election backend")
+		c.Flags().StringVar(&leaderCfg.ElectorLockFile, "elector-lock-file", "", "Lock file used by the 'file' election backend, which both nodes must share (defaults to leader.lock in the state directory; required with --disable-eni-check unless --force-role is set)")
+		c.Flags().StringVar(&leaderCfg.LeaseTable, "lease-table", "", "DynamoDB table holding the lease for the 'lease' election backend")
+		c.Flags().StringVar(&leaderCfg.LeaseKey, "lease-key", "", "Key of the lease item shared by both nodes (defaults to the ENI IP)")
+		c.Flags().DurationVar(&leaderCfg.LeaseDuration, "lease-duration", 0, "How long a lease is valid without renewal, or a raft candidate campaigns for leadership (defaults to 3x the leader check interval)")
+		c.Flags().StringVar(&leaderCfg.LeaseEndpoint, "lease-endpoint", "", "DynamoDB endpoint override, e.g. for DynamoDB Local")
+		c.Flags().StringVar(&leaderCfg.NodeID, "node-id", "", "Stable ID of this node in the raft cluster (defaults to the hostname)")
+		c.Flags().StringSliceVar(&leaderCfg.ClusterPeers, "cluster-peers", nil, "Raft cluster members as id=host:port, including this node (port defaults to --port + 1)")
+		c.Flags().StringVar(&leaderCfg.WitnessAddr, "witness-addr", "", "Address of a heartbeat witness that must agree before the secondary promotes (port defaults to --port)")
+		c.Flags().StringVar(&leaderCfg.TLSCAFile, "tls-ca-file", "", "CA bundle used to verify peer certificates, enables mutual TLS between nodes on fRPC and the raft transport")
+		c.Flags().StringVar(&leaderCfg.TLSCertFile, "tls-cert-file", "", "Certificate presented to peers (reloaded when the file changes)")
+		c.Flags().StringVar(&leaderCfg.TLSKeyFile, "tls-key-file", "", "Private key for --tls-cert-file (reloaded when the file changes)")
+		c.Flags().StringSliceVar(&leaderCfg.TLSPeerSANs, "tls-peer-san", nil, "Subject alternative name accepted in peer certificates (repeatable, any certificate signed by the CA when unset)")
+		c.Flags().StringVar(&leaderCfg.PeerInstanceID, "peer-instance-id", "", "Instance ID the peer must report before it is trusted")
+		c.Flags().StringVar(&leaderCfg.StateDir, "state-dir", "", "Directory for persistent failover state such as the leadership epoch (defaults to the XDG state directory)")
+
+		// Planned switchover between the nodes of a running pair
+		c.AddCommand(promoteCmd(ch), demoteCmd(ch))
+
+		// Commands for the local control API of a running daemon
+		c.AddCommand(statusCmd(ch), maintenanceCmd(ch), resyncCmd(ch), metricsCmd(ch), historyCmd(ch))
+
+		// Commands that only talk to AWS
+		c.AddCommand(planCmd(ch))
 
 		cmd.AddCommand(c)
 	}
@@ -95,3 +219,34 @@ func runLeaderFailoverCmd(ch *cmdutils.Helper[*config.Config], cfg *failover.Lea
 
 	return lf.Start(ctx)
 }
+
+func runWitnessCmd(ch *cmdutils.Helper[*config.Config], cfg *failover.LeaderConfig) error {
+	logger := ch.Logger.SubLogger("FailoverWitnessCmd")
+	cfg.Logger = logger
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Handle graceful shutdown
+	go func() {
+		done := make(chan os.Signal, 1)
+		signal.Notify(done, os.Interrupt)
+
+		<-done
+
+		logger.Info().Msg("Exiting gracefully")
+		cancel()
+	}()
+
+	w, err := failover.NewWitness(cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := w.Stop(); err != nil {
+			logger.Error().Err(err).Msg("Failed to stop failover witness")
+		}
+	}()
+
+	return w.Start(ctx)
+}
@@ -0,0 +1,196 @@
+package failover
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/loopholelabs/cmdutils"
+	"github.com/loopholelabs/cmdutils/pkg/printer"
+
+	"github.com/loopholelabs/architect-networking/internal/config"
+	"github.com/loopholelabs/architect-networking/pkg/failover"
+)
+
+// historyConfig holds the flags of the history command
+type historyConfig struct {
+	journal string
+	limit   int
+	since   time.Duration
+	json    bool
+}
+
+func historyCmd(ch *cmdutils.Helper[*config.Config]) *cobra.Command {
+	var cfg historyConfig
+
+	c := &cobra.Command{
+		Use:   "history",
+		Short: "Show the role decisions recorded in the event journal of this node",
+		Long:  "Render the failover daemon's event journal as a timeline per role decision: what triggered it and the inputs it was based on, the state transitions and AWS actions with their durations, the outcome, the repairs of resources that drifted away from the primary, and the time from detection until the routes were updated. The journal is read from disk, so this works while the daemon is down.",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runHistoryCmd(ch, &cfg)
+		},
+	}
+	c.Flags().StringVar(&cfg.journal, "journal", failover.DefaultJournalFile(), "Event journal of the failover daemon (journal.jsonl in its state directory)")
+	c.Flags().IntVar(&cfg.limit, "limit", 20, "Number of most recent role decisions to show (all when zero)")
+	c.Flags().DurationVar(&cfg.since, "since", 0, "Only show role decisions from this long ago onwards")
+	c.Flags().BoolVar(&cfg.json, "json", false, "Print the timelines as JSON")
+
+	return c
+}
+
+func runHistoryCmd(ch *cmdutils.Helper[*config.Config], cfg *historyConfig) error {
+	entries, err := failover.ReadJournal(cfg.journal)
+	if err != nil {
+		return err
+	}
+
+	timelines := failover.BuildTimelines(entries)
+	if cfg.since > 0 {
+		cutoff := time.Now().Add(-cfg.since)
+		timelines = slices.DeleteFunc(timelines, func(t failover.FailoverTimeline) bool {
+			return t.Decision.Time.Before(cutoff)
+		})
+	}
+	if cfg.limit > 0 && len(timelines) > cfg.limit {
+		timelines = timelines[len(timelines)-cfg.limit:]
+	}
+
+	if cfg.json || ch.Printer.Format() == printer.JSON {
+		return ch.Printer.PrintJSON(timelines)
+	}
+
+	if len(timelines) == 0 {
+		ch.Printer.Printf("No role decisions recorded in %s\n", cfg.journal)
+		return nil
+	}
+	for i := range timelines {
+		printTimeline(ch, &timelines[i])
+	}
+	printHistorySummary(ch, timelines)
+
+	return nil
+}
+
+// printTimeline prints a role decision followed by its events relative to the detection
+func printTimeline(ch *cmdutils.Helper[*config.Config], t *failover.FailoverTimeline) {
+	decision := t.Decision
+	ch.Printer.Printf("#%d %s %s: to %s (%s)\n", decision.Decision, decision.Time.Format(time.RFC3339Nano), cmp.Or(decision.Trigger, "unknown"), decision.TargetRole, decision.Reason)
+	if inputs := formatInputs(decision.Inputs); inputs != "" {
+		ch.Printer.Printf("    inputs: %s\n", inputs)
+	}
+
+	for _, event := range t.Events {
+		offset := "+" + event.Time.Sub(decision.Time).Round(time.Millisecond).String()
+		switch event.Event {
+		case failover.JournalEventState:
+			ch.Printer.Printf("    %-10s state %s -> %s", offset, event.From, event.To)
+			if event.Error != "" {
+				ch.Printer.Printf(": %s", event.Error)
+			}
+			for _, key := range slices.Sorted(maps.Keys(event.Annotations)) {
+				ch.Printer.Printf(", %s=%s", key, event.Annotations[key])
+			}
+		case failover.JournalEventAction, failover.JournalEventDrift:
+			ch.Printer.Printf("    %-10s %s %s %s: ", offset, event.Event, event.Action, event.Resource)
+			switch {
+			case event.InPlace:
+				ch.Printer.Printf("already in place")
+			case event.Error != "":
+				ch.Printer.Printf("failed after %s", event.Duration.Round(time.Millisecond))
+			default:
+				ch.Printer.Printf("ok in %s", event.Duration.Round(time.Millisecond))
+			}
+			if event.Attempts > 1 {
+				ch.Printer.Printf(" (%d attempts)", event.Attempts)
+			}
+			if event.RolledBack {
+				ch.Printer.Printf(", rolled back")
+			}
+			if event.Error != "" {
+				ch.Printer.Printf(": %s", event.Error)
+			}
+		default:
+			ch.Printer.Printf("    %-10s %s", offset, event.Event)
+		}
+		ch.Printer.Printf("\n")
+	}
+
+	result := t.Result
+	if result == nil {
+		ch.Printer.Printf("    result: unfinished, the daemon stopped during the role change\n\n")
+		return
+	}
+	ch.Printer.Printf("    result: %s at epoch %d in %s", result.Role, result.Epoch, t.Duration().Round(time.Millisecond))
+	if result.Error != "" {
+		ch.Printer.Printf(", failed: %s", result.Error)
+	}
+	if t.DetectToRoutesUpdated > 0 {
+		ch.Printer.Printf(", detect to routes updated %s", t.DetectToRoutesUpdated.Round(time.Millisecond))
+	}
+	if t.LastHeartbeatToRoutesUpdated > 0 {
+		ch.Printer.Printf(" (last heartbeat to routes updated %s)", t.LastHeartbeatToRoutesUpdated.Round(time.Millisecond))
+	}
+	ch.Printer.Printf("\n\n")
+}
+
+// formatInputs lists the inputs a decision recorded as key=value pairs
+func formatInputs(inputs *failover.JournalInputs) string {
+	if inputs == nil {
+		return ""
+	}
+
+	var fields []string
+	if inputs.MissedHeartbeats > 0 {
+		fields = append(fields, "missed_heartbeats="+strconv.Itoa(inputs.MissedHeartbeats))
+	}
+	if inputs.LastHeartbeatAge > 0 {
+		fields = append(fields, "last_heartbeat_age="+inputs.LastHeartbeatAge.Round(time.Millisecond).String())
+	}
+	if inputs.Phi > 0 {
+		fields = append(fields, "phi="+strconv.FormatFloat(inputs.Phi, 'f', 2, 64))
+	}
+	if inputs.ElectionBackend != "" {
+		fields = append(fields, "election_backend="+inputs.ElectionBackend)
+	}
+	if inputs.Leader != "" {
+		fields = append(fields, "leader="+inputs.Leader)
+	}
+	if inputs.ENIOwner != "" {
+		fields = append(fields, "eni_owner="+inputs.ENIOwner)
+	}
+	if inputs.HealthError != "" {
+		fields = append(fields, "health_error="+inputs.HealthError)
+	}
+	return strings.Join(fields, ", ")
+}
+
+// printHistorySummary prints how many decisions were shown and how quickly routes moved
+func printHistorySummary(ch *cmdutils.Helper[*config.Config], timelines []failover.FailoverTimeline) {
+	var failed int
+	var routes []time.Duration
+	for _, t := range timelines {
+		if t.Result != nil && t.Result.Error != "" {
+			failed++
+		}
+		if t.DetectToRoutesUpdated > 0 {
+			routes = append(routes, t.DetectToRoutesUpdated)
+		}
+	}
+
+	ch.Printer.Printf("%d role decision(s), %d failed", len(timelines), failed)
+	if len(routes) > 0 {
+		var total time.Duration
+		for _, d := range routes {
+			total += d
+		}
+		mean := total / time.Duration(len(routes))
+		ch.Printer.Printf("; detect to routes updated over %d failover(s): min %s, mean %s, max %s", len(routes), slices.Min(routes).Round(time.Millisecond), mean.Round(time.Millisecond), slices.Max(routes).Round(time.Millisecond))
+	}
+	ch.Printer.Printf("\n")
+}
@@ -0,0 +1,150 @@
+package failover
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/loopholelabs/cmdutils"
+	"github.com/loopholelabs/cmdutils/pkg/printer"
+
+	"github.com/loopholelabs/architect-networking/internal/config"
+	"github.com/loopholelabs/architect-networking/pkg/failover"
+)
+
+// planConfig holds the flags of the plan command
+type planConfig struct {
+	eniIP           string
+	destinationCIDR string
+	resourceTags    []string
+	managedENIs     []string
+	floatingIPs     []string
+	routeTables     []string
+	targetENI       string
+	dryRun          bool
+	json            bool
+	timeout         time.Duration
+}
+
+func planCmd(ch *cmdutils.Helper[*config.Config]) *cobra.Command {
+	var cfg planConfig
+
+	c := &cobra.Command{
+		Use:   "plan",
+		Short: "Show the AWS changes a failover to this node would make, without making them",
+		Long:  "Discover the resources of the failover pair and print the changes promoting this node (or the ENI given with --target-eni) would make, in order: the ENI IP and its EIP moved, the epoch stamped, the routes rewritten and the floating IPs moved. With --dry-run each change is also validated with the EC2 DryRun parameter to prove the IAM permissions are in place; EC2 cannot dry run moving private IPs, so those are reported as not supported.",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runPlanCmd(ch, &cfg)
+		},
+	}
+	c.Flags().StringVar(&cfg.eniIP, "eni-ip", "", "ENI IP address that marks the primary (required)")
+	c.Flags().StringVar(&cfg.destinationCIDR, "destination-cidr", "", "Destination CIDR whose routes follow the primary (routes are not planned when unset)")
+	c.Flags().StringSliceVar(&cfg.resourceTags, "resource-tag", nil, "EC2 tag as key=value selecting the ENIs and route tables of this pair (repeatable, as for the daemon)")
+	c.Flags().StringSliceVar(&cfg.managedENIs, "managed-eni", nil, "ENI of this pair in addition to those selected by tags (repeatable, as for the daemon)")
+	c.Flags().StringSliceVar(&cfg.floatingIPs, "floating-ip", nil, "Floating IP or CIDR block of them moved to the primary (repeatable, as for the daemon)")
+	c.Flags().StringSliceVar(&cfg.routeTables, "route-table", nil, "Route table of this pair in addition to those selected by tags (repeatable, as for the daemon)")
+	c.Flags().StringVar(&cfg.targetENI, "target-eni", "", "ENI to plan moving the resources to (defaults to the first ENI of this instance)")
+	c.Flags().BoolVar(&cfg.dryRun, "dry-run", false, "Validate each change with an EC2 DryRun request")
+	c.Flags().BoolVar(&cfg.json, "json", false, "Print the plan as JSON")
+	c.Flags().DurationVar(&cfg.timeout, "timeout", 30*time.Second, "Timeout for the AWS requests")
+
+	return c
+}
+
+func runPlanCmd(ch *cmdutils.Helper[*config.Config], cfg *planConfig) error {
+	logger := ch.Logger.SubLogger("FailoverPlanCmd")
+
+	if cfg.eniIP == "" {
+		return errors.New("--eni-ip is required")
+	}
+	selector, err := failover.ParseResourceSelector(cfg.resourceTags, cfg.managedENIs, cfg.floatingIPs, cfg.routeTables)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+
+	cloud, err := failover.NewAWSClient(ctx, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create AWS client: %w", err)
+	}
+
+	plan, err := failover.PlanFailover(ctx, cloud, failover.PlanConfig{
+		ENIIP:           cfg.eniIP,
+		DestinationCIDR: cfg.destinationCIDR,
+		Selector:        selector,
+		TargetENI:       cfg.targetENI,
+		DryRun:          cfg.dryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	if cfg.json || ch.Printer.Format() == printer.JSON {
+		if err := ch.Printer.PrintJSON(plan); err != nil {
+			return err
+		}
+	} else {
+		printPlan(ch, plan)
+	}
+
+	if plan.DryRunFailed() {
+		return errors.New("dry run of the failover plan failed")
+	}
+
+	return nil
+}
+
+// printPlan prints the pair's resources followed by the numbered changes and any warnings
+func printPlan(ch *cmdutils.Helper[*config.Config], plan *failover.FailoverPlan) {
+	resources := plan.Resources
+	ch.Printer.Printf("Pair: ENI IP %s on %s in subnet %s (%s) of %s\n", plan.ENIIP, resources.PrimaryENI, resources.SubnetID, resources.SubnetCIDR, resources.VPCID)
+	ch.Printer.Printf("Target: %s attached to %s\n", plan.TargetENI, cmp.Or(plan.TargetInstanceID, "no instance"))
+	for _, eni := range resources.ENIs {
+		ch.Printer.Printf("Managed ENI: %s attached to %s\n", eni.ID, cmp.Or(eni.InstanceID, "no instance"))
+	}
+	for _, ip := range resources.FloatingIPs {
+		ch.Printer.Printf("Managed floating IP: %s\n", ip)
+	}
+	for _, routeTable := range resources.RouteTables {
+		ch.Printer.Printf("Managed route table: %s\n", routeTable)
+	}
+	for _, rejected := range resources.Rejected {
+		ch.Printer.Printf("Ignored %s %s: %s\n", rejected.Kind, rejected.ID, rejected.Reason)
+	}
+
+	ch.Printer.Printf("\n%d change(s):\n", len(plan.Changes))
+	for i, change := range plan.Changes {
+		ch.Printer.Printf("%3d. %s\n", i+1, describeChange(&change))
+		if change.DryRun != "" {
+			ch.Printer.Printf("     dry run: %s\n", change.DryRun)
+		}
+	}
+
+	for _, warning := range plan.Warnings {
+		ch.Printer.Printf("Warning: %s\n", warning)
+	}
+}
+
+// describeChange describes a planned change as the EC2 operation making it
+func describeChange(change *failover.PlannedChange) string {
+	switch change.Action {
+	case failover.ActionTakeOverENI:
+		return fmt.Sprintf("move ENI IP %s from %s to %s", change.Resource, change.From, change.To)
+	case failover.ActionMoveEIP:
+		return fmt.Sprintf("associate EIP %s (%s) on %s with %s, was on %s", change.PublicIP, change.Resource, change.PrivateIP, change.To, cmp.Or(change.From, "no ENI"))
+	case failover.ActionStampEpoch:
+		return fmt.Sprintf("tag %s with the new epoch", change.To)
+	case failover.ActionUpdateRoutes:
+		return fmt.Sprintf("replace route to %s in %s with %s, was %s", change.DestinationCIDR, change.Resource, change.To, cmp.Or(change.From, "no target"))
+	case failover.ActionReassignFloatingIPs:
+		return fmt.Sprintf("move floating IP %s from %s to %s", change.Resource, change.From, change.To)
+	default:
+		return fmt.Sprintf("%s %s to %s", change.Action, change.Resource, change.To)
+	}
+}
@@ -0,0 +1,208 @@
+package failover
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/loopholelabs/cmdutils"
+	"github.com/loopholelabs/cmdutils/pkg/printer"
+
+	"github.com/loopholelabs/architect-networking/internal/config"
+	"github.com/loopholelabs/architect-networking/pkg/failover"
+)
+
+// statusConfig holds the flags of the status command
+type statusConfig struct {
+	controlConfig
+	peerAddr     string
+	skipAWSCheck bool
+	json         bool
+	tlsCAFile    string
+	tlsCertFile  string
+	tlsKeyFile   string
+	tlsPeerSANs  []string
+}
+
+// statusRow is a node of the pair as shown in the status table
+type statusRow struct {
+	Node        string `json:"node"`
+	Role        string `json:"role"`
+	InstanceID  string `json:"instance_id"`
+	Epoch       uint64 `json:"epoch"`
+	Priority    uint32 `json:"priority"`
+	Heartbeat   string `json:"heartbeat"`
+	LastSyncAge string `json:"last_sync_age"`
+	Maintenance bool   `json:"maintenance"`
+	Addr        string `json:"addr"`
+}
+
+func statusCmd(ch *cmdutils.Helper[*config.Config]) *cobra.Command {
+	var cfg statusConfig
+
+	c := &cobra.Command{
+		Use:   "status",
+		Short: "Show the state of both nodes of the failover pair",
+		Long:  "Query the failover daemon on this node and its peer, and check whether AWS agrees with them about which node holds the ENI IP and the routes",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runStatusCmd(ch, &cfg)
+		},
+	}
+	cfg.addFlags(c, 10*time.Second)
+	c.Flags().StringVar(&cfg.peerAddr, "peer-addr", "", "fRPC address of the other node (defaults to the peer known to the local daemon)")
+	c.Flags().BoolVar(&cfg.skipAWSCheck, "skip-aws-check", false, "Do not check ENI ownership and routes with the AWS API")
+	c.Flags().BoolVar(&cfg.json, "json", false, "Print the status as JSON")
+	c.Flags().StringVar(&cfg.tlsCAFile, "tls-ca-file", "", "CA bundle used to verify the peer's certificate, when the daemons use mutual TLS")
+	c.Flags().StringVar(&cfg.tlsCertFile, "tls-cert-file", "", "Client certificate presented to the peer")
+	c.Flags().StringVar(&cfg.tlsKeyFile, "tls-key-file", "", "Private key for --tls-cert-file")
+	c.Flags().StringSliceVar(&cfg.tlsPeerSANs, "tls-peer-san", nil, "Subject alternative name accepted in the peer's certificate (repeatable)")
+
+	return c
+}
+
+func runStatusCmd(ch *cmdutils.Helper[*config.Config], cfg *statusConfig) error {
+	logger := ch.Logger.SubLogger("FailoverStatusCmd")
+
+	tlsConfig, err := failover.LoadClientTLSConfig(cfg.tlsCAFile, cfg.tlsCertFile, cfg.tlsKeyFile, cfg.tlsPeerSANs)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS configuration: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+
+	status := failover.InspectPair(ctx, &failover.PairStatusConfig{
+		ControlSocket: cfg.socket,
+		PeerAddr:      cfg.peerAddr,
+		TLSConfig:     tlsConfig,
+		CheckAWS:      !cfg.skipAWSCheck,
+		Logger:        logger,
+	})
+
+	if cfg.json || ch.Printer.Format() == printer.JSON {
+		if err := ch.Printer.PrintJSON(status); err != nil {
+			return err
+		}
+	} else if err := printStatus(ch, status); err != nil {
+		return err
+	}
+
+	if len(status.Problems) > 0 {
+		return fmt.Errorf("failover pair has %d problem(s)", len(status.Problems))
+	}
+
+	return nil
+}
+
+// printStatus prints the nodes as a table followed by the AWS state and any problems
+func printStatus(ch *cmdutils.Helper[*config.Config], status *failover.PairStatus) error {
+	rows := make([]statusRow, 0, len(status.Nodes))
+	for _, node := range status.Nodes {
+		row := statusRow{
+			Node:        node.Name,
+			Role:        "unreachable",
+			InstanceID:  "n/a",
+			Heartbeat:   "n/a",
+			LastSyncAge: "n/a",
+			Addr:        cmp.Or(node.Addr, "n/a"),
+		}
+		if !node.Reachable() {
+			rows = append(rows, row)
+			continue
+		}
+
+		row.Role = node.Role
+		row.InstanceID = node.InstanceID
+		row.Epoch = node.Epoch
+		row.Priority = node.Priority
+		row.Heartbeat = ageSince(status.Time, node.LastHeartbeat)
+		if node.MissedHeartbeats > 0 {
+			row.Heartbeat += fmt.Sprintf(" (%d missed)", node.MissedHeartbeats)
+		}
+		if node.Role == failover.RoleStringSecondary {
+			row.LastSyncAge = ageSince(status.Time, node.LastSync)
+		}
+		row.Maintenance = node.Maintenance
+		rows = append(rows, row)
+	}
+
+	if err := ch.Printer.PrintResource(rows); err != nil {
+		return err
+	}
+
+	for _, node := range status.Nodes {
+		if transition := node.LastTransition; transition != nil {
+			ch.Printer.Printf("State (%s): %s, last transition %s to %s %s: %s", node.Name, node.State, transition.From, transition.To, ageSince(status.Time, transition.Time), transition.Reason)
+			if transition.Error != "" {
+				ch.Printer.Printf(" (%s)", transition.Error)
+			}
+			for _, key := range slices.Sorted(maps.Keys(transition.Annotations)) {
+				ch.Printer.Printf(", %s=%s", key, transition.Annotations[key])
+			}
+			ch.Printer.Printf("\n")
+		}
+		if phi := node.Phi; phi != nil {
+			ch.Printer.Printf("Failure detector (%s): phi %.2f of %.2f, heartbeat interval %s ± %s over %d samples\n", node.Name, phi.Phi, phi.Threshold, phi.Mean.Round(time.Microsecond), phi.StdDev.Round(time.Microsecond), phi.Samples)
+		}
+		for _, path := range node.HeartbeatPaths {
+			if path.Healthy() {
+				ch.Printer.Printf("Heartbeat path %s (%s): up, last heartbeat %s", path.Addr, node.Name, ageSince(status.Time, path.LastHeartbeat))
+				if path.LastRTT > 0 {
+					ch.Printer.Printf(", rtt %s", path.LastRTT)
+				}
+				ch.Printer.Printf("\n")
+				continue
+			}
+			ch.Printer.Printf("Heartbeat path %s (%s): down, %d missed, last heartbeat %s", path.Addr, node.Name, path.MissedHeartbeats, ageSince(status.Time, path.LastHeartbeat))
+			if path.LastError != "" {
+				ch.Printer.Printf(": %s", path.LastError)
+			}
+			ch.Printer.Printf("\n")
+		}
+		for _, session := range node.BFDSessions {
+			ch.Printer.Printf("BFD session %s (%s): %s (peer %s), tx every %s, detect time %s, last packet %s", session.Peer, node.Name, session.State, session.RemoteState, session.TxInterval, session.DetectTime, ageSince(status.Time, session.LastReceived))
+			if session.Diagnostic != "" {
+				ch.Printer.Printf(": %s", session.Diagnostic)
+			}
+			ch.Printer.Printf("\n")
+		}
+		if n := len(node.DriftCorrections); n > 0 {
+			last := node.DriftCorrections[n-1]
+			ch.Printer.Printf("Drift (%s): %d recent correction(s), last %s %s %s", node.Name, n, last.Action, last.Resource, ageSince(status.Time, last.Time))
+			if last.Error != "" {
+				ch.Printer.Printf(" failed: %s", last.Error)
+			}
+			ch.Printer.Printf("\n")
+		}
+	}
+
+	if aws := status.AWS; aws != nil {
+		if aws.Error != "" {
+			ch.Printer.Printf("AWS: %s\n", aws.Error)
+		} else {
+			ch.Printer.Printf("AWS: ENI IP %s on %s attached to %s\n", aws.ENIIP, aws.ENI, aws.ENIOwner)
+			for _, routeTable := range slices.Sorted(maps.Keys(aws.Routes)) {
+				ch.Printer.Printf("AWS: route to %s in %s targets %s\n", aws.DestinationCIDR, routeTable, aws.Routes[routeTable])
+			}
+		}
+	}
+
+	for _, problem := range status.Problems {
+		ch.Printer.Printf("Problem: %s\n", problem)
+	}
+
+	return nil
+}
+
+// ageSince formats how long before now t was, or "never" for the zero time
+func ageSince(now, t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return now.Sub(t).Round(time.Millisecond).String() + " ago"
+}
@@ -0,0 +1,66 @@
+package failover
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/loopholelabs/cmdutils"
+
+	"github.com/loopholelabs/architect-networking/internal/config"
+	"github.com/loopholelabs/architect-networking/pkg/failover"
+)
+
+func promoteCmd(ch *cmdutils.Helper[*config.Config]) *cobra.Command {
+	var cfg controlConfig
+
+	c := &cobra.Command{
+		Use:   "promote",
+		Short: "Make this node the primary with a planned switchover",
+		Long:  "Ask the primary to hand over to this node: the primary demotes, this node performs a final NAT state sync and runs the failover actions, and both roles are confirmed. The daemons must use mutual TLS between them.",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runSwitchoverCmd(ch, &cfg, failover.RolePrimary)
+		},
+	}
+	cfg.addFlags(c, 2*time.Minute)
+
+	return c
+}
+
+func demoteCmd(ch *cmdutils.Helper[*config.Config]) *cobra.Command {
+	var cfg controlConfig
+
+	c := &cobra.Command{
+		Use:   "demote",
+		Short: "Hand the primary role on this node over to its secondary",
+		Long:  "Hand over from this node to its secondary: the secondary performs a final NAT state sync and runs the failover actions, and both roles are confirmed. The daemons must use mutual TLS between them.",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runSwitchoverCmd(ch, &cfg, failover.RoleSecondary)
+		},
+	}
+	cfg.addFlags(c, 2*time.Minute)
+
+	return c
+}
+
+func runSwitchoverCmd(ch *cmdutils.Helper[*config.Config], cfg *controlConfig, role failover.NodeRole) error {
+	controlClient, err := failover.NewControlClient(cfg.socket)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+
+	ch.Printer.Printf("Requesting switchover of this node to %s role...", role)
+
+	result, err := controlClient.Switchover(ctx, role)
+	if err != nil {
+		return err
+	}
+
+	ch.Printer.Printf("Switchover complete: %s is primary at epoch %d", result.PrimaryInstanceID, result.Epoch)
+
+	return nil
+}
@@ -2,8 +2,10 @@ package failover
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -12,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
 	logging "github.com/loopholelabs/logging/types"
 )
 
@@ -22,8 +25,16 @@ type AWSClient struct {
 	instanceID   string
 	instanceMeta *imds.GetInstanceIdentityDocumentOutput
 	logger       logging.Logger
+
+	vpcMu sync.Mutex
+	vpcID string
 }
 
+var (
+	_ CloudProvider = (*AWSClient)(nil)
+	_ DryRunner     = (*AWSClient)(nil)
+)
+
 // NewAWSClient creates a new AWS client with EC2 and IMDS capabilities
 func NewAWSClient(ctx context.Context, logger logging.Logger) (*AWSClient, error) {
 	cfg, err := config.LoadDefaultConfig(ctx)
@@ -54,6 +65,53 @@ func (a *AWSClient) GetInstanceID() string {
 	return a.instanceID
 }
 
+// instanceVPC returns the VPC of this instance, looked up from its ENIs on first use
+func (a *AWSClient) instanceVPC(ctx context.Context) (string, error) {
+	a.vpcMu.Lock()
+	defer a.vpcMu.Unlock()
+	if a.vpcID != "" {
+		return a.vpcID, nil
+	}
+
+	result, err := a.EC2Client.DescribeNetworkInterfaces(ctx, &ec2.DescribeNetworkInterfacesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("attachment.instance-id"),
+				Values: []string{a.instanceID},
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to find ENI for instance %s: %w", a.instanceID, err)
+	}
+	if len(result.NetworkInterfaces) == 0 || result.NetworkInterfaces[0].VpcId == nil {
+		return "", fmt.Errorf("no ENI found for instance %s", a.instanceID)
+	}
+
+	a.vpcID = *result.NetworkInterfaces[0].VpcId
+	return a.vpcID, nil
+}
+
+// privateIPFilters returns the filters selecting the ENIs that hold the private IP in this
+// instance's VPC. Private IPs are only unique within a VPC, so a pair built from the same
+// template elsewhere in the account may hold the same one.
+func (a *AWSClient) privateIPFilters(ctx context.Context, ip string) ([]types.Filter, error) {
+	vpcID, err := a.instanceVPC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []types.Filter{
+		{
+			Name:   aws.String("addresses.private-ip-address"),
+			Values: []string{ip},
+		},
+		{
+			Name:   aws.String("vpc-id"),
+			Values: []string{vpcID},
+		},
+	}, nil
+}
+
 // CheckENIOwnership checks if the current instance owns the given ENI IP address
 func (a *AWSClient) CheckENIOwnership(ctx context.Context, eniIP string) (bool, error) {
 	// Parse the IP to ensure it's valid
@@ -62,16 +120,13 @@ func (a *AWSClient) CheckENIOwnership(ctx context.Context, eniIP string) (bool,
 		return false, fmt.Errorf("invalid IP address: %s", eniIP)
 	}
 
-	// Describe network interfaces to find the one with this IP
+	// Describe network interfaces in our VPC to find the one with this IP
 	// Use addresses.private-ip-address to find both primary and secondary IPs
-	input := &ec2.DescribeNetworkInterfacesInput{
-		Filters: []types.Filter{
-			{
-				Name:   &[]string{"addresses.private-ip-address"}[0],
-				Values: []string{eniIP},
-			},
-		},
+	filters, err := a.privateIPFilters(ctx, eniIP)
+	if err != nil {
+		return false, err
 	}
+	input := &ec2.DescribeNetworkInterfacesInput{Filters: filters}
 
 	result, err := a.EC2Client.DescribeNetworkInterfaces(ctx, input)
 	if err != nil {
@@ -126,16 +181,13 @@ func (a *AWSClient) GetENIOwner(ctx context.Context, eniIP string) (string, erro
 		return "", fmt.Errorf("invalid IP address: %s", eniIP)
 	}
 
-	// Describe network interfaces to find the one with this IP
+	// Describe network interfaces in our VPC to find the one with this IP
 	// Use addresses.private-ip-address to find both primary and secondary IPs
-	input := &ec2.DescribeNetworkInterfacesInput{
-		Filters: []types.Filter{
-			{
-				Name:   &[]string{"addresses.private-ip-address"}[0],
-				Values: []string{eniIP},
-			},
-		},
+	filters, err := a.privateIPFilters(ctx, eniIP)
+	if err != nil {
+		return "", err
 	}
+	input := &ec2.DescribeNetworkInterfacesInput{Filters: filters}
 
 	result, err := a.EC2Client.DescribeNetworkInterfaces(ctx, input)
 	if err != nil {
@@ -204,16 +256,13 @@ func (a *AWSClient) GetENIFloatingIPs(ctx context.Context, eniID string) ([]stri
 	return floatingIPs, nil
 }
 
-// GetENIByIP returns the ENI ID that owns the given IP address
+// GetENIByIP returns the ENI ID that owns the given IP address in this instance's VPC
 func (a *AWSClient) GetENIByIP(ctx context.Context, ip string) (string, error) {
-	input := &ec2.DescribeNetworkInterfacesInput{
-		Filters: []types.Filter{
-			{
-				Name:   aws.String("addresses.private-ip-address"),
-				Values: []string{ip},
-			},
-		},
+	filters, err := a.privateIPFilters(ctx, ip)
+	if err != nil {
+		return "", err
 	}
+	input := &ec2.DescribeNetworkInterfacesInput{Filters: filters}
 
 	result, err := a.EC2Client.DescribeNetworkInterfaces(ctx, input)
 	if err != nil {
@@ -229,189 +278,195 @@ func (a *AWSClient) GetENIByIP(ctx context.Context, ip string) (string, error) {
 
 // FilterFloatingIPs filters IPs to only include those matching the pattern (e.g., x.x.x.20 onwards)
 func (a *AWSClient) FilterFloatingIPs(ips []string, baseIP string) []string {
-	// Parse the base IP to determine the pattern
-	parts := strings.Split(baseIP, ".")
-	if len(parts) != 4 {
-		return ips // Return all if we can't parse
+	return filterFloatingIPs(ips, baseIP)
+}
+
+// DescribeENIs returns the network interfaces matching the filter
+func (a *AWSClient) DescribeENIs(ctx context.Context, filter ENIFilter) ([]CloudENI, error) {
+	filters := tagFilters(filter.Tags)
+	if len(filter.IDs) > 0 {
+		// A filter, unlike NetworkInterfaceIds, does not fail on IDs that do not exist
+		filters = append(filters, types.Filter{Name: aws.String("network-interface-id"), Values: filter.IDs})
+	}
+	if filter.VPCID != "" {
+		filters = append(filters, types.Filter{Name: aws.String("vpc-id"), Values: []string{filter.VPCID}})
+	}
+	if filter.SubnetID != "" {
+		filters = append(filters, types.Filter{Name: aws.String("subnet-id"), Values: []string{filter.SubnetID}})
+	}
+	if filter.PrivateIP != "" {
+		filters = append(filters, types.Filter{Name: aws.String("addresses.private-ip-address"), Values: []string{filter.PrivateIP}})
+	}
+	if filter.InstanceID != "" {
+		filters = append(filters, types.Filter{Name: aws.String("attachment.instance-id"), Values: []string{filter.InstanceID}})
 	}
 
-	var filtered []string
-	for _, ip := range ips {
-		ipParts := strings.Split(ip, ".")
-		if len(ipParts) != 4 {
-			continue
+	var enis []CloudENI
+	paginator := ec2.NewDescribeNetworkInterfacesPaginator(a.EC2Client, &ec2.DescribeNetworkInterfacesInput{Filters: filters})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe network interfaces: %w", err)
 		}
-
-		// Check if first 3 octets match
-		if ipParts[0] == parts[0] && ipParts[1] == parts[1] && ipParts[2] == parts[2] {
-			// Parse last octet
-			var lastOctet int
-			if _, err := fmt.Sscanf(ipParts[3], "%d", &lastOctet); err == nil {
-				// Check if it's 20 or higher
-				if lastOctet >= 20 {
-					filtered = append(filtered, ip)
+		for _, nic := range page.NetworkInterfaces {
+			eni := CloudENI{
+				ID:        aws.ToString(nic.NetworkInterfaceId),
+				VPCID:     aws.ToString(nic.VpcId),
+				SubnetID:  aws.ToString(nic.SubnetId),
+				PrimaryIP: aws.ToString(nic.PrivateIpAddress),
+				Tags:      tagMap(nic.TagSet),
+			}
+			if nic.Attachment != nil {
+				eni.InstanceID = aws.ToString(nic.Attachment.InstanceId)
+			}
+			for _, privateIP := range nic.PrivateIpAddresses {
+				if !aws.ToBool(privateIP.Primary) && privateIP.PrivateIpAddress != nil {
+					eni.SecondaryIPs = append(eni.SecondaryIPs, *privateIP.PrivateIpAddress)
 				}
 			}
+			enis = append(enis, eni)
 		}
 	}
 
-	return filtered
+	return enis, nil
 }
 
-// ReassignFloatingIPs moves floating IPs from source ENI to destination ENI
-func (a *AWSClient) ReassignFloatingIPs(ctx context.Context, sourceENI, destENI string, ips []string) error {
-	if len(ips) == 0 {
-		return nil
+// DescribeSubnet returns a subnet
+func (a *AWSClient) DescribeSubnet(ctx context.Context, subnetID string) (*CloudSubnet, error) {
+	result, err := a.EC2Client.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{
+		SubnetIds: []string{subnetID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe subnet %s: %w", subnetID, err)
+	}
+	if len(result.Subnets) == 0 {
+		return nil, fmt.Errorf("subnet %s not found", subnetID)
 	}
 
-	var wg sync.WaitGroup
-	errCh := make(chan error, len(ips)*2) // Buffer for unassign and assign operations
+	subnet := result.Subnets[0]
+	return &CloudSubnet{
+		ID:    subnetID,
+		VPCID: aws.ToString(subnet.VpcId),
+		CIDR:  aws.ToString(subnet.CidrBlock),
+	}, nil
+}
 
-	// Unassign IPs from source ENI in parallel
-	for _, ip := range ips {
-		wg.Add(1)
-		go func(ipAddr string) {
-			defer wg.Done()
+// DescribeRouteTables returns the route tables matching the filter
+func (a *AWSClient) DescribeRouteTables(ctx context.Context, filter RouteTableFilter) ([]CloudRouteTable, error) {
+	filters := tagFilters(filter.Tags)
+	if len(filter.IDs) > 0 {
+		filters = append(filters, types.Filter{Name: aws.String("route-table-id"), Values: filter.IDs})
+	}
+	if filter.VPCID != "" {
+		filters = append(filters, types.Filter{Name: aws.String("vpc-id"), Values: []string{filter.VPCID}})
+	}
+	if filter.DestinationCIDR != "" {
+		filters = append(filters, types.Filter{Name: aws.String("route.destination-cidr-block"), Values: []string{filter.DestinationCIDR}})
+	}
 
-			unassignInput := &ec2.UnassignPrivateIpAddressesInput{
-				NetworkInterfaceId: aws.String(sourceENI),
-				PrivateIpAddresses: []string{ipAddr},
+	var routeTables []CloudRouteTable
+	paginator := ec2.NewDescribeRouteTablesPaginator(a.EC2Client, &ec2.DescribeRouteTablesInput{Filters: filters})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe route tables: %w", err)
+		}
+		for _, rt := range page.RouteTables {
+			routeTable := CloudRouteTable{
+				ID:     aws.ToString(rt.RouteTableId),
+				VPCID:  aws.ToString(rt.VpcId),
+				Tags:   tagMap(rt.Tags),
+				Routes: make(map[string]string, len(rt.Routes)),
 			}
-
-			_, err := a.EC2Client.UnassignPrivateIpAddresses(ctx, unassignInput)
-			if err != nil {
-				errCh <- fmt.Errorf("failed to unassign IP %s from ENI %s: %w", ipAddr, sourceENI, err)
-				return
+			for _, route := range rt.Routes {
+				if route.DestinationCidrBlock != nil {
+					routeTable.Routes[*route.DestinationCidrBlock] = routeTarget(route)
+				}
 			}
-		}(ip)
+			routeTables = append(routeTables, routeTable)
+		}
 	}
 
-	// Wait for all unassign operations to complete
-	wg.Wait()
-
-	// Assign IPs to destination ENI in parallel
-	for _, ip := range ips {
-		wg.Add(1)
-		go func(ipAddr string) {
-			defer wg.Done()
+	return routeTables, nil
+}
 
-			assignInput := &ec2.AssignPrivateIpAddressesInput{
-				NetworkInterfaceId: aws.String(destENI),
-				PrivateIpAddresses: []string{ipAddr},
-			}
+// tagFilters returns filters matching resources that carry all of the tags
+func tagFilters(tags map[string]string) []types.Filter {
+	filters := make([]types.Filter, 0, len(tags))
+	for key, value := range tags {
+		filters = append(filters, types.Filter{Name: aws.String("tag:" + key), Values: []string{value}})
+	}
+	return filters
+}
 
-			_, err := a.EC2Client.AssignPrivateIpAddresses(ctx, assignInput)
-			if err != nil {
-				errCh <- fmt.Errorf("failed to assign IP %s to ENI %s: %w", ipAddr, destENI, err)
-				return
-			}
-		}(ip)
+// tagMap converts EC2 tags to a map
+func tagMap(tags []types.Tag) map[string]string {
+	if len(tags) == 0 {
+		return nil
 	}
+	m := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		m[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return m
+}
 
-	wg.Wait()
-	close(errCh)
+// routeTarget describes the target of a route: the ENI ID, or the target prefixed by its kind
+func routeTarget(route types.Route) string {
+	switch {
+	case route.NetworkInterfaceId != nil:
+		return *route.NetworkInterfaceId
+	case route.GatewayId != nil:
+		return "gw:" + *route.GatewayId
+	case route.InstanceId != nil:
+		return "instance:" + *route.InstanceId
+	}
+	return "none"
+}
 
-	// Collect any errors
-	var errs []string
-	for err := range errCh {
-		errs = append(errs, err.Error())
+// ReassignFloatingIPs moves floating IPs from source ENI to destination ENI. The IPs are
+// reassigned in a single call, which takes them from whichever ENI holds them without
+// unassigning them first, so a failure never leaves an IP on neither ENI.
+func (a *AWSClient) ReassignFloatingIPs(ctx context.Context, sourceENI, destENI string, ips []string) error {
+	if len(ips) == 0 {
+		return nil
 	}
 
-	if len(errs) > 0 {
-		return fmt.Errorf("floating IP reassignment errors: %s", strings.Join(errs, "; "))
+	a.logger.Info().
+		Str("source_eni", sourceENI).
+		Str("dest_eni", destENI).
+		Str("ips", strings.Join(ips, ",")).
+		Msg("Reassigning floating IPs")
+
+	_, err := a.EC2Client.AssignPrivateIpAddresses(ctx, &ec2.AssignPrivateIpAddressesInput{
+		NetworkInterfaceId: aws.String(destENI),
+		PrivateIpAddresses: ips,
+		AllowReassignment:  aws.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reassign IPs %s from ENI %s to ENI %s: %w", strings.Join(ips, ","), sourceENI, destENI, err)
 	}
 
 	return nil
 }
 
-// UpdateRouteTables updates all route tables to point to the new ENI
-func (a *AWSClient) UpdateRouteTables(ctx context.Context, destinationCIDR, newENI string) error {
+// UpdateRouteTables points the route to the destination CIDR in the route tables at the new ENI
+func (a *AWSClient) UpdateRouteTables(ctx context.Context, destinationCIDR, newENI string, routeTableIDs []string) error {
 	a.logger.Info().
 		Str("destination_cidr", destinationCIDR).
 		Str("new_eni", newENI).
+		Str("route_tables", strings.Join(routeTableIDs, ",")).
 		Msg("Starting route table update")
 
-	// First, find all route tables with routes to the destination CIDR
-	describeInput := &ec2.DescribeRouteTablesInput{
-		Filters: []types.Filter{
-			{
-				Name:   aws.String("route.destination-cidr-block"),
-				Values: []string{destinationCIDR},
-			},
-		},
-	}
-
-	a.logger.Debug().
-		Str("filter", "route.destination-cidr-block").
-		Str("value", destinationCIDR).
-		Msg("Searching for route tables with filter")
-
-	routeTables, err := a.EC2Client.DescribeRouteTables(ctx, describeInput)
-	if err != nil {
-		return fmt.Errorf("failed to describe route tables: %w", err)
-	}
-
-	a.logger.Info().
-		Int("route_tables_found", len(routeTables.RouteTables)).
-		Str("destination_cidr", destinationCIDR).
-		Msg("Route tables search result")
-
-	// Let's also search without filters to see what route tables exist
-	if len(routeTables.RouteTables) == 0 {
-		a.logger.Warn().Msg("No route tables found with filter, searching all route tables to debug")
-
-		allRouteTables, err := a.EC2Client.DescribeRouteTables(ctx, &ec2.DescribeRouteTablesInput{})
-		if err != nil {
-			a.logger.Error().Err(err).Msg("Failed to describe all route tables")
-		} else {
-			a.logger.Info().Int("total_route_tables", len(allRouteTables.RouteTables)).Msg("Total route tables in VPC")
-
-			// Log details about routes in each table
-			for _, rt := range allRouteTables.RouteTables {
-				rtID := "unknown"
-				if rt.RouteTableId != nil {
-					rtID = *rt.RouteTableId
-				}
-
-				a.logger.Debug().
-					Str("route_table_id", rtID).
-					Int("route_count", len(rt.Routes)).
-					Msg("Route table details")
-
-				for i, route := range rt.Routes {
-					destCIDR := "none"
-					if route.DestinationCidrBlock != nil {
-						destCIDR = *route.DestinationCidrBlock
-					}
-
-					target := "none"
-					switch {
-					case route.NetworkInterfaceId != nil:
-						target = "eni:" + *route.NetworkInterfaceId
-					case route.GatewayId != nil:
-						target = "gw:" + *route.GatewayId
-					case route.InstanceId != nil:
-						target = "instance:" + *route.InstanceId
-					}
-
-					a.logger.Debug().
-						Str("route_table_id", rtID).
-						Int("route_index", i).
-						Str("destination_cidr", destCIDR).
-						Str("target", target).
-						Msg("Route details")
-				}
-			}
-		}
-
+	if len(routeTableIDs) == 0 {
 		return fmt.Errorf("no route tables found with routes to %s", destinationCIDR)
 	}
 
 	var wg sync.WaitGroup
-	errCh := make(chan error, len(routeTables.RouteTables))
+	errCh := make(chan error, len(routeTableIDs))
 
 	// Update routes in parallel
-	for _, rt := range routeTables.RouteTables {
+	for _, routeTableID := range routeTableIDs {
 		wg.Add(1)
 		go func(routeTableID string) {
 			defer wg.Done()
@@ -427,7 +482,7 @@ func (a *AWSClient) UpdateRouteTables(ctx context.Context, destinationCIDR, newE
 				errCh <- fmt.Errorf("failed to update route in table %s: %w", routeTableID, err)
 				return
 			}
-		}(*rt.RouteTableId)
+		}(routeTableID)
 	}
 
 	wg.Wait()
@@ -446,6 +501,74 @@ func (a *AWSClient) UpdateRouteTables(ctx context.Context, destinationCIDR, newE
 	return nil
 }
 
+// GetRouteTargets returns the target of the route to the destination CIDR in each route table
+// of the VPC that has one, keyed by route table ID. ENI targets are the ENI ID, others are
+// prefixed by kind.
+func (a *AWSClient) GetRouteTargets(ctx context.Context, vpcID, destinationCIDR string) (map[string]string, error) {
+	routeTables, err := a.EC2Client.DescribeRouteTables(ctx, &ec2.DescribeRouteTablesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("vpc-id"),
+				Values: []string{vpcID},
+			},
+			{
+				Name:   aws.String("route.destination-cidr-block"),
+				Values: []string{destinationCIDR},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe route tables: %w", err)
+	}
+
+	targets := make(map[string]string, len(routeTables.RouteTables))
+	for _, rt := range routeTables.RouteTables {
+		if rt.RouteTableId == nil {
+			continue
+		}
+		for _, route := range rt.Routes {
+			if route.DestinationCidrBlock == nil || *route.DestinationCidrBlock != destinationCIDR {
+				continue
+			}
+
+			targets[*rt.RouteTableId] = routeTarget(route)
+		}
+	}
+
+	return targets, nil
+}
+
+// DescribeEIPs returns the Elastic IPs matching the filter
+func (a *AWSClient) DescribeEIPs(ctx context.Context, filter EIPFilter) ([]CloudEIP, error) {
+	var filters []types.Filter
+	if len(filter.AllocationIDs) > 0 {
+		// A filter, unlike AllocationIds, does not fail on IDs that do not exist
+		filters = append(filters, types.Filter{Name: aws.String("allocation-id"), Values: filter.AllocationIDs})
+	}
+	if len(filter.PrivateIPs) > 0 {
+		filters = append(filters, types.Filter{Name: aws.String("private-ip-address"), Values: filter.PrivateIPs})
+	}
+	if len(filter.ENIs) > 0 {
+		filters = append(filters, types.Filter{Name: aws.String("network-interface-id"), Values: filter.ENIs})
+	}
+
+	addresses, err := a.EC2Client.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{Filters: filters})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe addresses: %w", err)
+	}
+
+	eips := make([]CloudEIP, 0, len(addresses.Addresses))
+	for _, address := range addresses.Addresses {
+		eips = append(eips, CloudEIP{
+			AllocationID: aws.ToString(address.AllocationId),
+			PublicIP:     aws.ToString(address.PublicIp),
+			PrivateIP:    aws.ToString(address.PrivateIpAddress),
+			ENI:          aws.ToString(address.NetworkInterfaceId),
+		})
+	}
+	return eips, nil
+}
+
 // MoveEIPToENI moves an Elastic IP from its current ENI to a new ENI
 func (a *AWSClient) MoveEIPToENI(ctx context.Context, privateIP, newENI string) error {
 	a.logger.Info().
@@ -483,35 +606,15 @@ func (a *AWSClient) MoveEIPToENI(ctx context.Context, privateIP, newENI string)
 		Str("new_eni", newENI).
 		Msg("Moving EIP to new ENI")
 
-	// Disassociate from current ENI (if associated)
-	if address.AssociationId != nil {
-		a.logger.Debug().
-			Str("association_id", *address.AssociationId).
-			Msg("Disassociating EIP from current ENI")
-
-		_, err = a.EC2Client.DisassociateAddress(ctx, &ec2.DisassociateAddressInput{
-			AssociationId: address.AssociationId,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to disassociate EIP %s: %w", allocationID, err)
-		}
-	}
-
-	// Associate with new ENI
+	// Associate with new ENI, reassociating it from its current ENI in the same call
 	a.logger.Debug().
 		Str("allocation_id", allocationID).
 		Str("new_eni", newENI).
 		Str("private_ip", privateIP).
 		Msg("Associating EIP with new ENI")
 
-	_, err = a.EC2Client.AssociateAddress(ctx, &ec2.AssociateAddressInput{
-		AllocationId:       aws.String(allocationID),
-		NetworkInterfaceId: aws.String(newENI),
-		PrivateIpAddress:   aws.String(privateIP),
-		AllowReassociation: aws.Bool(true),
-	})
-	if err != nil {
-		return fmt.Errorf("failed to associate EIP %s to ENI %s: %w", allocationID, newENI, err)
+	if err := a.AssociateEIP(ctx, allocationID, newENI, privateIP); err != nil {
+		return err
 	}
 
 	a.logger.Info().
@@ -524,14 +627,23 @@ func (a *AWSClient) MoveEIPToENI(ctx context.Context, privateIP, newENI string)
 	return nil
 }
 
-// TakeOverENI assigns the ENI IP to the current instance by moving it from another ENI
-func (a *AWSClient) TakeOverENI(ctx context.Context, eniIP string) error {
-	// First, find which ENI currently owns this IP
-	currentENI, err := a.GetENIByIP(ctx, eniIP)
+// AssociateEIP associates the EIP with the private IP of the ENI, reassociating it from its
+// current ENI in the same call
+func (a *AWSClient) AssociateEIP(ctx context.Context, allocationID, eniID, privateIP string) error {
+	_, err := a.EC2Client.AssociateAddress(ctx, &ec2.AssociateAddressInput{
+		AllocationId:       aws.String(allocationID),
+		NetworkInterfaceId: aws.String(eniID),
+		PrivateIpAddress:   aws.String(privateIP),
+		AllowReassociation: aws.Bool(true),
+	})
 	if err != nil {
-		return fmt.Errorf("failed to find current owner of IP %s: %w", eniIP, err)
+		return fmt.Errorf("failed to associate EIP %s to ENI %s: %w", allocationID, eniID, err)
 	}
+	return nil
+}
 
+// TakeOverENI assigns the ENI IP to the current instance by moving it from another ENI
+func (a *AWSClient) TakeOverENI(ctx context.Context, eniIP string) error {
 	// Get the ENI attached to this instance
 	myENIResult, err := a.EC2Client.DescribeNetworkInterfaces(ctx, &ec2.DescribeNetworkInterfacesInput{
 		Filters: []types.Filter{
@@ -551,32 +663,47 @@ func (a *AWSClient) TakeOverENI(ctx context.Context, eniIP string) error {
 
 	myENI := *myENIResult.NetworkInterfaces[0].NetworkInterfaceId
 
+	// Find which ENI currently owns this IP. Private IPs are only unique within a VPC, so
+	// the owner is looked up in ours.
+	ownerResult, err := a.EC2Client.DescribeNetworkInterfaces(ctx, &ec2.DescribeNetworkInterfacesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("addresses.private-ip-address"),
+				Values: []string{eniIP},
+			},
+			{
+				Name:   aws.String("vpc-id"),
+				Values: []string{aws.ToString(myENIResult.NetworkInterfaces[0].VpcId)},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find current owner of IP %s: %w", eniIP, err)
+	}
+	if len(ownerResult.NetworkInterfaces) == 0 {
+		return fmt.Errorf("failed to find current owner of IP %s: no ENI found with IP %s", eniIP, eniIP)
+	}
+	currentENI := *ownerResult.NetworkInterfaces[0].NetworkInterfaceId
+
 	// If we already own it, nothing to do
 	if currentENI == myENI {
 		return nil
 	}
 
-	// Unassign from current owner
-	_, err = a.EC2Client.UnassignPrivateIpAddresses(ctx, &ec2.UnassignPrivateIpAddressesInput{
-		NetworkInterfaceId: aws.String(currentENI),
-		PrivateIpAddresses: []string{eniIP},
-	})
-	if err != nil {
-		return fmt.Errorf("failed to unassign IP %s from ENI %s: %w", eniIP, currentENI, err)
-	}
-
-	// Assign to our ENI
+	// Reassign to our ENI in one call, so a failure cannot leave the IP on neither ENI
 	a.logger.Info().
 		Str("eni_ip", eniIP).
+		Str("current_eni", currentENI).
 		Str("target_eni", myENI).
-		Msg("Assigning private IP to our ENI")
+		Msg("Reassigning private IP to our ENI")
 
 	_, err = a.EC2Client.AssignPrivateIpAddresses(ctx, &ec2.AssignPrivateIpAddressesInput{
 		NetworkInterfaceId: aws.String(myENI),
 		PrivateIpAddresses: []string{eniIP},
+		AllowReassignment:  aws.Bool(true),
 	})
 	if err != nil {
-		return fmt.Errorf("failed to assign IP %s to ENI %s: %w", eniIP, myENI, err)
+		return fmt.Errorf("failed to reassign IP %s from ENI %s to ENI %s: %w", eniIP, currentENI, myENI, err)
 	}
 
 	// Verify the IP was actually moved by checking ownership again
@@ -599,12 +726,140 @@ func (a *AWSClient) TakeOverENI(ctx context.Context, eniIP string) error {
 		Str("new_eni", myENI).
 		Msg("Private IP move verified successful")
 
-	// Move any associated EIP to our ENI
-	err = a.MoveEIPToENI(ctx, eniIP, myENI)
-	if err != nil {
+	// Move any EIP associated with the IP on the previous owner to our ENI, leaving EIPs of
+	// the same private IP in other VPCs alone
+	if err := a.moveEIPsToENI(ctx, eniIP, currentENI, myENI); err != nil {
 		a.logger.Error().Err(err).Str("eni_ip", eniIP).Str("my_eni", myENI).Msg("Failed to move EIP, but private IP was moved successfully")
 		// Don't return error here since the private IP move succeeded - EIP move is supplementary
 	}
 
 	return nil
 }
+
+// moveEIPsToENI associates the EIPs of the private IP on the old ENI with the new ENI
+func (a *AWSClient) moveEIPsToENI(ctx context.Context, privateIP, oldENI, newENI string) error {
+	eips, err := a.DescribeEIPs(ctx, EIPFilter{PrivateIPs: []string{privateIP}, ENIs: []string{oldENI}})
+	if err != nil {
+		return fmt.Errorf("failed to find EIP for private IP %s: %w", privateIP, err)
+	}
+
+	var errs []error
+	for _, eip := range eips {
+		a.logger.Info().
+			Str("allocation_id", eip.AllocationID).
+			Str("public_ip", eip.PublicIP).
+			Str("private_ip", privateIP).
+			Str("new_eni", newENI).
+			Msg("Moving EIP to new ENI")
+		if err := a.AssociateEIP(ctx, eip.AllocationID, newENI, privateIP); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// EpochTagKey is the EC2 tag used to stamp the leadership epoch on the primary ENI
+const EpochTagKey = "architect-networking:epoch"
+
+// GetEpochTag returns the leadership epoch stamped on the ENI that holds the given IP in this
+// instance's VPC along with that ENI's ID. The epoch is 0 if no epoch has been stamped yet.
+func (a *AWSClient) GetEpochTag(ctx context.Context, eniIP string) (uint64, string, error) {
+	filters, err := a.privateIPFilters(ctx, eniIP)
+	if err != nil {
+		return 0, "", err
+	}
+	result, err := a.EC2Client.DescribeNetworkInterfaces(ctx, &ec2.DescribeNetworkInterfacesInput{Filters: filters})
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to describe network interfaces: %w", err)
+	}
+
+	var epoch uint64
+	var eniID string
+	for _, nic := range result.NetworkInterfaces {
+		if nic.NetworkInterfaceId != nil && eniID == "" {
+			eniID = *nic.NetworkInterfaceId
+		}
+		for _, tag := range nic.TagSet {
+			if tag.Key == nil || *tag.Key != EpochTagKey || tag.Value == nil {
+				continue
+			}
+			tagEpoch, err := strconv.ParseUint(*tag.Value, 10, 64)
+			if err != nil {
+				a.logger.Warn().Err(err).Str("value", *tag.Value).Msg("Ignoring invalid epoch tag")
+				continue
+			}
+			if tagEpoch > epoch {
+				epoch = tagEpoch
+				eniID = *nic.NetworkInterfaceId
+			}
+		}
+	}
+
+	return epoch, eniID, nil
+}
+
+// SetEpochTag stamps the leadership epoch on the given ENI
+func (a *AWSClient) SetEpochTag(ctx context.Context, eniID string, epoch uint64) error {
+	_, err := a.EC2Client.CreateTags(ctx, &ec2.CreateTagsInput{
+		Resources: []string{eniID},
+		Tags: []types.Tag{
+			{
+				Key:   aws.String(EpochTagKey),
+				Value: aws.String(strconv.FormatUint(epoch, 10)),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to tag ENI %s with epoch %d: %w", eniID, epoch, err)
+	}
+
+	return nil
+}
+
+// DryRun makes the EC2 call behind a planned change with DryRun set, which checks the
+// caller is permitted to make it without making it. EC2 cannot dry run moving private IPs
+// between ENIs, so those return ErrDryRunUnsupported.
+func (a *AWSClient) DryRun(ctx context.Context, change PlannedChange) error {
+	var err error
+	switch change.Action {
+	case ActionUpdateRoutes:
+		_, err = a.EC2Client.ReplaceRoute(ctx, &ec2.ReplaceRouteInput{
+			DryRun:               aws.Bool(true),
+			RouteTableId:         aws.String(change.Resource),
+			DestinationCidrBlock: aws.String(change.DestinationCIDR),
+			NetworkInterfaceId:   aws.String(change.To),
+		})
+	case ActionMoveEIP:
+		// The private IP is not on the ENI until the ENI IP moves, so only the
+		// association with the ENI is checked
+		_, err = a.EC2Client.AssociateAddress(ctx, &ec2.AssociateAddressInput{
+			DryRun:             aws.Bool(true),
+			AllocationId:       aws.String(change.Resource),
+			NetworkInterfaceId: aws.String(change.To),
+			AllowReassociation: aws.Bool(true),
+		})
+	case ActionStampEpoch:
+		_, err = a.EC2Client.CreateTags(ctx, &ec2.CreateTagsInput{
+			DryRun:    aws.Bool(true),
+			Resources: []string{change.To},
+			Tags: []types.Tag{
+				{
+					Key:   aws.String(EpochTagKey),
+					Value: aws.String("0"),
+				},
+			},
+		})
+	default:
+		return ErrDryRunUnsupported
+	}
+
+	// A permitted dry run fails with DryRunOperation
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "DryRunOperation" {
+		return nil
+	}
+	if err == nil {
+		return fmt.Errorf("dry run of %s on %s unexpectedly succeeded", change.Action, change.Resource)
+	}
+	return err
+}
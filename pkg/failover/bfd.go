@@ -0,0 +1,621 @@
+package failover
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	metrics "github.com/hashicorp/go-metrics/compat"
+	"github.com/loopholelabs/logging/types"
+)
+
+// bfdSlowInterval is the slowest transmit interval a session advertises while it is not
+// up, as RFC 5880 requires at least one second until the session is established
+const bfdSlowInterval = time.Second
+
+// BFDConfig configures the BFD sessions of an endpoint
+type BFDConfig struct {
+	// Minimum interval at which this side wants to send control packets
+	DesiredMinTx time.Duration
+
+	// Minimum interval at which this side can receive control packets
+	RequiredMinRx time.Duration
+
+	// Control packets the peer may miss before the session goes down
+	DetectMultiplier uint8
+
+	// Key for meticulous keyed SHA1 authentication, packets are not authenticated when empty
+	AuthKeyID uint8
+	AuthKey   []byte
+
+	// Fraction of received control packets dropped, to test detection under packet loss
+	PacketLoss float64
+}
+
+// BFDSessionStats describes a BFD session with one peer address
+type BFDSessionStats struct {
+	Peer        string `json:"peer"`
+	State       string `json:"state"`
+	RemoteState string `json:"remote_state"`
+	Diagnostic  string `json:"diagnostic,omitempty"`
+
+	LocalDiscriminator  uint32 `json:"local_discriminator"`
+	RemoteDiscriminator uint32 `json:"remote_discriminator"`
+
+	// Negotiated interval between sent control packets, and how long the peer may stay silent
+	TxInterval time.Duration `json:"tx_interval_ns"`
+	DetectTime time.Duration `json:"detect_time_ns"`
+
+	// LastReceived is the time the last valid control packet arrived
+	LastReceived time.Time `json:"last_received,omitzero"`
+
+	// Control packets received, and dropped because they were invalid or by loss injection
+	Received  uint64 `json:"received"`
+	Discarded uint64 `json:"discarded"`
+}
+
+// Up reports whether the session is established
+func (s *BFDSessionStats) Up() bool {
+	return s.State == BFDStateUp.String()
+}
+
+// BFDEndpoint runs asynchronous mode BFD (RFC 5880) sessions over UDP, one with each
+// peer address, on a single socket. Control packets are sent from and received on the
+// endpoint's port.
+type BFDEndpoint struct {
+	conn     net.PacketConn
+	config   BFDConfig
+	logger   types.Logger
+	sessions []*bfdSession
+
+	// Set while the endpoint tells its peers it is administratively down
+	adminDown atomic.Bool
+
+	// Notified when a session changes state
+	changes chan struct{}
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewBFDEndpoint listens for control packets on addr and creates a session with each
+// peer, given as host:port
+func NewBFDEndpoint(addr string, peers []string, config BFDConfig, logger types.Logger) (*BFDEndpoint, error) {
+	if config.DetectMultiplier == 0 {
+		return nil, errors.New("BFD detect multiplier must be at least 1")
+	}
+	if len(config.AuthKey) > bfdAuthKeyLen {
+		return nil, fmt.Errorf("BFD authentication key must be at most %d bytes, got %d", bfdAuthKeyLen, len(config.AuthKey))
+	}
+
+	e := &BFDEndpoint{
+		config:  config,
+		logger:  logger,
+		changes: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	for _, peer := range peers {
+		peerAddr, err := net.ResolveUDPAddr("udp", peer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve BFD peer %s: %w", peer, err)
+		}
+		if slices.ContainsFunc(e.sessions, func(s *bfdSession) bool { return sameUDPAddr(s.peer, peerAddr) }) {
+			return nil, fmt.Errorf("duplicate BFD peer %s", peer)
+		}
+		e.sessions = append(e.sessions, newBFDSession(e, peerAddr))
+	}
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for BFD on %s: %w", addr, err)
+	}
+	e.conn = conn
+
+	return e, nil
+}
+
+// Start receives control packets and starts sending them to every peer
+func (e *BFDEndpoint) Start() {
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		e.receiveLoop()
+	}()
+
+	for _, s := range e.sessions {
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+			s.transmitLoop()
+		}()
+	}
+
+	e.logger.Info().
+		Str("addr", e.conn.LocalAddr().String()).
+		Int("sessions", len(e.sessions)).
+		Str("desired_min_tx", e.config.DesiredMinTx.String()).
+		Str("required_min_rx", e.config.RequiredMinRx.String()).
+		Int("detect_multiplier", int(e.config.DetectMultiplier)).
+		Bool("authentication", e.config.AuthKey != nil).
+		Msg("BFD endpoint started")
+}
+
+// Close tells the peers the sessions are administratively down and stops the endpoint
+func (e *BFDEndpoint) Close() error {
+	var err error
+	e.closeOnce.Do(func() {
+		e.SetAdminDown(true)
+		for _, s := range e.sessions {
+			s.send()
+		}
+
+		close(e.done)
+		err = e.conn.Close()
+		e.wg.Wait()
+		for _, s := range e.sessions {
+			s.detectTimer.Stop()
+		}
+	})
+	return err
+}
+
+// SetAdminDown takes the sessions administratively down, which the peers see as this side
+// going down, or brings them back up
+func (e *BFDEndpoint) SetAdminDown(down bool) {
+	if e.adminDown.Swap(down) == down {
+		return
+	}
+	for _, s := range e.sessions {
+		s.setAdminDown(down)
+	}
+}
+
+// Up reports whether a session with any peer address is up
+func (e *BFDEndpoint) Up() bool {
+	for _, s := range e.sessions {
+		if s.up() {
+			return true
+		}
+	}
+	return false
+}
+
+// LastReceived returns when a valid control packet last arrived on any session from a
+// peer that was not administratively down
+func (e *BFDEndpoint) LastReceived() time.Time {
+	var last time.Time
+	for _, s := range e.sessions {
+		if received := s.aliveAt(); received.After(last) {
+			last = received
+		}
+	}
+	return last
+}
+
+// DetectTime returns the longest time a peer may stay silent before its session goes down
+func (e *BFDEndpoint) DetectTime() time.Duration {
+	var detect time.Duration
+	for _, s := range e.sessions {
+		detect = max(detect, s.stats().DetectTime)
+	}
+	return detect
+}
+
+// Changes is notified when a session changes state
+func (e *BFDEndpoint) Changes() <-chan struct{} {
+	return e.changes
+}
+
+// Stats returns the state of every session
+func (e *BFDEndpoint) Stats() []BFDSessionStats {
+	stats := make([]BFDSessionStats, 0, len(e.sessions))
+	for _, s := range e.sessions {
+		stats = append(stats, s.stats())
+	}
+	return stats
+}
+
+// receiveLoop reads control packets and hands them to their session
+func (e *BFDEndpoint) receiveLoop() {
+	buf := make([]byte, bfdMaxPacketLen)
+	for {
+		n, from, err := e.conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-e.done:
+				return
+			default:
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			e.logger.Debug().Err(err).Msg("Failed to read BFD packet")
+			continue
+		}
+
+		udpAddr, ok := from.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		s := e.session(udpAddr)
+		if s == nil {
+			e.logger.Debug().Str("from", from.String()).Msg("Discarded BFD packet from unknown peer")
+			continue
+		}
+
+		if e.config.PacketLoss > 0 && rand.Float64() < e.config.PacketLoss { //nolint:gosec // loss injection needs no secure randomness
+			s.discard()
+			continue
+		}
+
+		packet, err := unmarshalBFDPacket(buf[:n], e.config.AuthKeyID, e.config.AuthKey)
+		if err != nil {
+			s.discard()
+			e.logger.Debug().Err(err).Str("from", from.String()).Msg("Discarded BFD packet")
+			continue
+		}
+		s.receive(packet)
+	}
+}
+
+// session finds the session with the peer a packet came from
+func (e *BFDEndpoint) session(from *net.UDPAddr) *bfdSession {
+	for _, s := range e.sessions {
+		if sameUDPAddr(s.peer, from) {
+			return s
+		}
+	}
+	return nil
+}
+
+// notifyChange wakes a waiter on Changes without blocking
+func (e *BFDEndpoint) notifyChange() {
+	select {
+	case e.changes <- struct{}{}:
+	default:
+	}
+}
+
+// sameUDPAddr compares UDP addresses, treating IPv4-mapped IPv6 addresses as IPv4
+func sameUDPAddr(a, b *net.UDPAddr) bool {
+	return a.Port == b.Port && a.IP.Equal(b.IP)
+}
+
+// bfdSession is the state of the BFD session with one peer address (RFC 5880 section 6.8.1)
+type bfdSession struct {
+	endpoint *BFDEndpoint
+	peer     *net.UDPAddr
+
+	mu          sync.Mutex
+	state       BFDState
+	remoteState BFDState
+	diag        BFDDiagnostic
+	localDiscr  uint32
+	remoteDiscr uint32
+
+	// Timers the peer last advertised, zero until it has been heard
+	remoteMinRx      time.Duration
+	remoteDesiredTx  time.Duration
+	remoteDetectMult uint8
+
+	// Poll sequence for changed timers, and a Final owed to the peer's poll
+	polling   bool
+	sendFinal bool
+
+	// Meticulous keyed SHA1 sequence numbers sent and received
+	authSeq      uint32
+	rcvAuthSeq   uint32
+	authSeqKnown bool
+
+	lastReceived time.Time
+	lastAlive    time.Time
+	received     uint64
+	discarded    uint64
+
+	// Runs out when the peer stayed silent for the detection time
+	detectTimer *time.Timer
+
+	// Wakes the transmit loop to send a packet right away
+	sendNow chan struct{}
+}
+
+// newBFDSession creates a session in the down state
+func newBFDSession(e *BFDEndpoint, peer *net.UDPAddr) *bfdSession {
+	s := &bfdSession{
+		endpoint:    e,
+		peer:        peer,
+		state:       BFDStateDown,
+		remoteState: BFDStateDown,
+		localDiscr:  max(rand.Uint32(), 1), //nolint:gosec // discriminators only need to be unique
+		authSeq:     rand.Uint32(),         //nolint:gosec // sequence numbers only need to be unpredictable across restarts
+		sendNow:     make(chan struct{}, 1),
+	}
+	s.detectTimer = time.AfterFunc(time.Hour, s.detectionTimeExpired)
+	s.detectTimer.Stop()
+	return s
+}
+
+// transmitLoop sends control packets at the negotiated interval
+func (s *bfdSession) transmitLoop() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-s.endpoint.done:
+			return
+		case <-s.sendNow:
+		case <-timer.C:
+		}
+
+		s.send()
+		timer.Reset(s.jitteredTxInterval())
+	}
+}
+
+// send transmits one control packet reflecting the session state
+func (s *bfdSession) send() {
+	config := &s.endpoint.config
+
+	s.mu.Lock()
+	packet := &bfdPacket{
+		diag:          s.diag,
+		state:         s.state,
+		poll:          s.polling && !s.sendFinal,
+		final:         s.sendFinal,
+		detectMult:    config.DetectMultiplier,
+		myDiscr:       s.localDiscr,
+		yourDiscr:     s.remoteDiscr,
+		desiredMinTx:  s.desiredMinTxLocked(),
+		requiredMinRx: config.RequiredMinRx,
+	}
+	s.sendFinal = false
+	if config.AuthKey != nil {
+		s.authSeq++
+		packet.auth = true
+		packet.authKeyID = config.AuthKeyID
+		packet.authSeq = s.authSeq
+	}
+	s.mu.Unlock()
+
+	if _, err := s.endpoint.conn.WriteTo(packet.marshal(config.AuthKey), s.peer); err != nil {
+		s.endpoint.logger.Trace().Err(err).Str("peer", s.peer.String()).Msg("Failed to send BFD packet")
+	}
+}
+
+// receive processes a valid control packet from the peer (RFC 5880 section 6.8.6)
+func (s *bfdSession) receive(p *bfdPacket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p.yourDiscr != 0 && p.yourDiscr != s.localDiscr {
+		s.discarded++
+		return
+	}
+
+	// Meticulous authentication requires the sequence number to increase with every packet
+	if p.auth {
+		window := 3 * uint32(max(p.detectMult, s.endpoint.config.DetectMultiplier))
+		if s.authSeqKnown && p.authSeq-s.rcvAuthSeq-1 >= window {
+			s.discarded++
+			return
+		}
+		s.rcvAuthSeq = p.authSeq
+		s.authSeqKnown = true
+	}
+
+	now := time.Now()
+	s.received++
+	s.lastReceived = now
+	s.remoteDiscr = p.myDiscr
+	s.remoteState = p.state
+	s.remoteMinRx = p.requiredMinRx
+	s.remoteDesiredTx = p.desiredMinTx
+	s.remoteDetectMult = p.detectMult
+
+	if p.final {
+		s.polling = false
+	}
+	if p.poll {
+		s.sendFinal = true
+		s.wakeLocked()
+	}
+
+	if s.state == BFDStateAdminDown {
+		return
+	}
+
+	if p.state == BFDStateAdminDown {
+		if s.state != BFDStateDown {
+			s.setStateLocked(BFDStateDown, BFDDiagNeighborSignaledDown)
+		}
+		return
+	}
+
+	s.lastAlive = now
+	s.detectTimer.Reset(s.detectTimeLocked())
+
+	switch s.state {
+	case BFDStateDown:
+		switch p.state {
+		case BFDStateDown:
+			s.setStateLocked(BFDStateInit, BFDDiagNone)
+		case BFDStateInit:
+			s.setStateLocked(BFDStateUp, BFDDiagNone)
+		}
+	case BFDStateInit:
+		if p.state == BFDStateInit || p.state == BFDStateUp {
+			s.setStateLocked(BFDStateUp, BFDDiagNone)
+		}
+	case BFDStateUp:
+		if p.state == BFDStateDown {
+			s.setStateLocked(BFDStateDown, BFDDiagNeighborSignaledDown)
+		}
+	}
+}
+
+// detectionTimeExpired takes the session down when the peer stayed silent for too long
+func (s *bfdSession) detectionTimeExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state != BFDStateInit && s.state != BFDStateUp {
+		return
+	}
+	if time.Since(s.lastAlive) < s.detectTimeLocked() {
+		return
+	}
+
+	s.setStateLocked(BFDStateDown, BFDDiagDetectionTimeExpired)
+	s.remoteDiscr = 0
+	s.remoteState = BFDStateDown
+	s.authSeqKnown = false
+}
+
+// setAdminDown moves the session in or out of the administratively down state
+func (s *bfdSession) setAdminDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if down {
+		s.setStateLocked(BFDStateAdminDown, BFDDiagAdminDown)
+	} else if s.state == BFDStateAdminDown {
+		s.setStateLocked(BFDStateDown, BFDDiagNone)
+	}
+}
+
+// setStateLocked changes the session state and tells the peer right away, the caller holds mu
+func (s *bfdSession) setStateLocked(state BFDState, diag BFDDiagnostic) {
+	old := s.state
+	s.state = state
+	s.diag = diag
+	if old == state {
+		return
+	}
+
+	switch {
+	case state == BFDStateUp:
+		// Leaving the slow start interval changes the advertised timers
+		s.polling = true
+	case old == BFDStateUp:
+		s.detectTimer.Stop()
+		s.polling = false
+	}
+
+	logEvent := s.endpoint.logger.Info()
+	if old == BFDStateUp {
+		logEvent = s.endpoint.logger.Warn()
+	}
+	logEvent.
+		Str("peer", s.peer.String()).
+		Str("old_state", old.String()).
+		Str("new_state", state.String()).
+		Str("diagnostic", diag.String()).
+		Msg("BFD session state changed")
+
+	metrics.IncrCounter([]string{"bfd", "state_changes"}, 1)
+	s.wakeLocked()
+	s.endpoint.notifyChange()
+}
+
+// wakeLocked makes the transmit loop send a packet right away, the caller holds mu
+func (s *bfdSession) wakeLocked() {
+	select {
+	case s.sendNow <- struct{}{}:
+	default:
+	}
+}
+
+// discard counts a packet from the peer that was dropped
+func (s *bfdSession) discard() {
+	s.mu.Lock()
+	s.discarded++
+	s.mu.Unlock()
+}
+
+// up reports whether the session is established
+func (s *bfdSession) up() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state == BFDStateUp
+}
+
+// aliveAt returns when the peer last sent a packet without being administratively down
+func (s *bfdSession) aliveAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastAlive
+}
+
+// desiredMinTxLocked is the transmit interval this side advertises, the caller holds mu
+func (s *bfdSession) desiredMinTxLocked() time.Duration {
+	if s.state != BFDStateUp {
+		return max(s.endpoint.config.DesiredMinTx, bfdSlowInterval)
+	}
+	return s.endpoint.config.DesiredMinTx
+}
+
+// txIntervalLocked is the interval between sent packets: no faster than this side wants to
+// send or the peer wants to receive, the caller holds mu
+func (s *bfdSession) txIntervalLocked() time.Duration {
+	interval := max(s.desiredMinTxLocked(), s.remoteMinRx)
+	if s.remoteDetectMult != 0 && s.remoteMinRx == 0 {
+		// The peer asked for no periodic packets, keep it informed at the slow rate
+		interval = bfdSlowInterval
+	}
+	return interval
+}
+
+// jitteredTxInterval reduces the transmit interval by up to 25% (10% to 25% with a detect
+// multiplier of 1), so packets of both sides do not synchronise
+func (s *bfdSession) jitteredTxInterval() time.Duration {
+	s.mu.Lock()
+	interval := s.txIntervalLocked()
+	s.mu.Unlock()
+
+	jitter := 0.75 + 0.25*rand.Float64() //nolint:gosec // jitter needs no secure randomness
+	if s.endpoint.config.DetectMultiplier == 1 {
+		jitter = 0.75 + 0.15*rand.Float64() //nolint:gosec // jitter needs no secure randomness
+	}
+	return time.Duration(float64(interval) * jitter)
+}
+
+// detectTimeLocked is how long the peer may stay silent: its detect multiplier times the
+// slower of its transmit interval and what this side can receive, the caller holds mu
+func (s *bfdSession) detectTimeLocked() time.Duration {
+	if s.remoteDetectMult == 0 {
+		return time.Duration(s.endpoint.config.DetectMultiplier) * bfdSlowInterval
+	}
+	return time.Duration(s.remoteDetectMult) * max(s.endpoint.config.RequiredMinRx, s.remoteDesiredTx)
+}
+
+// stats returns the session state
+func (s *bfdSession) stats() BFDSessionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := BFDSessionStats{
+		Peer:                s.peer.String(),
+		State:               s.state.String(),
+		RemoteState:         s.remoteState.String(),
+		LocalDiscriminator:  s.localDiscr,
+		RemoteDiscriminator: s.remoteDiscr,
+		TxInterval:          s.txIntervalLocked(),
+		DetectTime:          s.detectTimeLocked(),
+		LastReceived:        s.lastReceived,
+		Received:            s.received,
+		Discarded:           s.discarded,
+	}
+	if s.diag != BFDDiagNone {
+		stats.Diagnostic = s.diag.String()
+	}
+	return stats
+}
@@ -0,0 +1,246 @@
+package failover
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // RFC 5880 defines keyed SHA1 authentication
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrBFDPacket = errors.New("invalid BFD packet")
+	ErrBFDAuth   = errors.New("BFD authentication failed")
+)
+
+// BFDState is the state of a BFD session (RFC 5880 section 4.1)
+type BFDState uint8
+
+const (
+	BFDStateAdminDown BFDState = iota
+	BFDStateDown
+	BFDStateInit
+	BFDStateUp
+)
+
+func (s BFDState) String() string {
+	switch s {
+	case BFDStateAdminDown:
+		return "admin_down"
+	case BFDStateDown:
+		return "down"
+	case BFDStateInit:
+		return "init"
+	case BFDStateUp:
+		return "up"
+	default:
+		return fmt.Sprintf("state_%d", uint8(s))
+	}
+}
+
+// BFDDiagnostic is the reason for the last change of a session's state (RFC 5880 section 4.1)
+type BFDDiagnostic uint8
+
+const (
+	BFDDiagNone BFDDiagnostic = iota
+	BFDDiagDetectionTimeExpired
+	BFDDiagEchoFailed
+	BFDDiagNeighborSignaledDown
+	BFDDiagForwardingPlaneReset
+	BFDDiagPathDown
+	BFDDiagConcatenatedPathDown
+	BFDDiagAdminDown
+	BFDDiagReverseConcatenatedPathDown
+)
+
+func (d BFDDiagnostic) String() string {
+	switch d {
+	case BFDDiagNone:
+		return "none"
+	case BFDDiagDetectionTimeExpired:
+		return "control detection time expired"
+	case BFDDiagEchoFailed:
+		return "echo function failed"
+	case BFDDiagNeighborSignaledDown:
+		return "neighbor signaled session down"
+	case BFDDiagForwardingPlaneReset:
+		return "forwarding plane reset"
+	case BFDDiagPathDown:
+		return "path down"
+	case BFDDiagConcatenatedPathDown:
+		return "concatenated path down"
+	case BFDDiagAdminDown:
+		return "administratively down"
+	case BFDDiagReverseConcatenatedPathDown:
+		return "reverse concatenated path down"
+	default:
+		return fmt.Sprintf("diagnostic %d", uint8(d))
+	}
+}
+
+// Wire format of BFD control packets
+const (
+	bfdVersion        = 1
+	bfdHeaderLen      = 24
+	bfdMaxPacketLen   = 64
+	bfdAuthTypeMKSHA1 = 5 // meticulous keyed SHA1
+	bfdAuthLenSHA1    = 28
+	bfdAuthKeyLen     = 20
+
+	bfdFlagPoll       = 0x20
+	bfdFlagFinal      = 0x10
+	bfdFlagAuth       = 0x04
+	bfdFlagDemand     = 0x02
+	bfdFlagMultipoint = 0x01
+)
+
+// bfdPacket is a BFD control packet
+type bfdPacket struct {
+	diag          BFDDiagnostic
+	state         BFDState
+	poll          bool
+	final         bool
+	detectMult    uint8
+	myDiscr       uint32
+	yourDiscr     uint32
+	desiredMinTx  time.Duration
+	requiredMinRx time.Duration
+
+	// Meticulous keyed SHA1 authentication, present when the packet is authenticated
+	auth      bool
+	authKeyID uint8
+	authSeq   uint32
+}
+
+// bfdMicros encodes an interval in microseconds as BFD packets carry them
+func bfdMicros(d time.Duration) uint32 {
+	us := d.Microseconds()
+	if us > int64(^uint32(0)) {
+		return ^uint32(0)
+	}
+	return uint32(us) //nolint:gosec // clamped above
+}
+
+// marshal encodes the packet, signing it with key when it is authenticated
+func (p *bfdPacket) marshal(key []byte) []byte {
+	length := bfdHeaderLen
+	if p.auth {
+		length += bfdAuthLenSHA1
+	}
+
+	b := make([]byte, length)
+	b[0] = bfdVersion<<5 | byte(p.diag)&0x1f
+	b[1] = byte(p.state) << 6
+	if p.poll {
+		b[1] |= bfdFlagPoll
+	}
+	if p.final {
+		b[1] |= bfdFlagFinal
+	}
+	if p.auth {
+		b[1] |= bfdFlagAuth
+	}
+	b[2] = p.detectMult
+	b[3] = byte(length)
+	binary.BigEndian.PutUint32(b[4:], p.myDiscr)
+	binary.BigEndian.PutUint32(b[8:], p.yourDiscr)
+	binary.BigEndian.PutUint32(b[12:], bfdMicros(p.desiredMinTx))
+	binary.BigEndian.PutUint32(b[16:], bfdMicros(p.requiredMinRx))
+	// Required min echo RX interval stays zero, the echo function is not supported
+
+	if p.auth {
+		a := b[bfdHeaderLen:]
+		a[0] = bfdAuthTypeMKSHA1
+		a[1] = bfdAuthLenSHA1
+		a[2] = p.authKeyID
+		binary.BigEndian.PutUint32(a[4:], p.authSeq)
+		copy(a[8:], bfdDigest(b, key))
+	}
+
+	return b
+}
+
+// bfdDigest computes the keyed SHA1 digest of an authenticated packet: the SHA1 of the
+// packet with the key, zero padded, in place of the digest
+func bfdDigest(b, key []byte) []byte {
+	signed := make([]byte, len(b))
+	copy(signed, b)
+	digest := signed[bfdHeaderLen+8 : bfdHeaderLen+bfdAuthLenSHA1]
+	clear(digest)
+	copy(digest, key)
+
+	sum := sha1.Sum(signed) //nolint:gosec // RFC 5880 defines keyed SHA1 authentication
+	return sum[:]
+}
+
+// unmarshalBFDPacket decodes and validates a control packet (RFC 5880 section 6.8.6). When
+// a key is given the packet must be authenticated with it, otherwise it must not be.
+func unmarshalBFDPacket(b []byte, keyID uint8, key []byte) (*bfdPacket, error) {
+	if len(b) < bfdHeaderLen {
+		return nil, fmt.Errorf("%w: %d bytes is too short", ErrBFDPacket, len(b))
+	}
+	if version := b[0] >> 5; version != bfdVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrBFDPacket, version)
+	}
+	length := int(b[3])
+	if length < bfdHeaderLen || length > len(b) {
+		return nil, fmt.Errorf("%w: length %d does not match %d bytes received", ErrBFDPacket, length, len(b))
+	}
+	b = b[:length]
+
+	flags := b[1]
+	p := &bfdPacket{
+		diag:          BFDDiagnostic(b[0] & 0x1f),
+		state:         BFDState(flags >> 6),
+		poll:          flags&bfdFlagPoll != 0,
+		final:         flags&bfdFlagFinal != 0,
+		auth:          flags&bfdFlagAuth != 0,
+		detectMult:    b[2],
+		myDiscr:       binary.BigEndian.Uint32(b[4:]),
+		yourDiscr:     binary.BigEndian.Uint32(b[8:]),
+		desiredMinTx:  time.Duration(binary.BigEndian.Uint32(b[12:])) * time.Microsecond,
+		requiredMinRx: time.Duration(binary.BigEndian.Uint32(b[16:])) * time.Microsecond,
+	}
+
+	switch {
+	case p.detectMult == 0:
+		return nil, fmt.Errorf("%w: zero detect multiplier", ErrBFDPacket)
+	case flags&bfdFlagMultipoint != 0:
+		return nil, fmt.Errorf("%w: multipoint bit set", ErrBFDPacket)
+	case flags&bfdFlagDemand != 0:
+		return nil, fmt.Errorf("%w: demand mode is not supported", ErrBFDPacket)
+	case p.myDiscr == 0:
+		return nil, fmt.Errorf("%w: zero my discriminator", ErrBFDPacket)
+	case p.yourDiscr == 0 && p.state != BFDStateDown && p.state != BFDStateAdminDown:
+		return nil, fmt.Errorf("%w: zero your discriminator in state %s", ErrBFDPacket, p.state)
+	}
+
+	if key == nil {
+		if p.auth {
+			return nil, fmt.Errorf("%w: authenticated packet, but no key is configured", ErrBFDAuth)
+		}
+		return p, nil
+	}
+	if !p.auth {
+		return nil, fmt.Errorf("%w: packet is not authenticated", ErrBFDAuth)
+	}
+	if length != bfdHeaderLen+bfdAuthLenSHA1 {
+		return nil, fmt.Errorf("%w: length %d does not fit keyed SHA1 authentication", ErrBFDPacket, length)
+	}
+
+	a := b[bfdHeaderLen:]
+	if a[0] != bfdAuthTypeMKSHA1 || a[1] != bfdAuthLenSHA1 {
+		return nil, fmt.Errorf("%w: unsupported authentication type %d", ErrBFDAuth, a[0])
+	}
+	p.authKeyID = a[2]
+	p.authSeq = binary.BigEndian.Uint32(a[4:])
+	if p.authKeyID != keyID {
+		return nil, fmt.Errorf("%w: unknown key ID %d", ErrBFDAuth, p.authKeyID)
+	}
+	if !hmac.Equal(a[8:], bfdDigest(b, key)) {
+		return nil, fmt.Errorf("%w: digest mismatch", ErrBFDAuth)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,215 @@
+package failover
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/loopholelabs/logging"
+)
+
+// bfdTestTimeout bounds waiting for a session, which starts at the one second slow interval
+const bfdTestTimeout = 10 * time.Second
+
+// freeUDPAddr returns a loopback address with a UDP port no one listens on
+func freeUDPAddr(t *testing.T) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := conn.LocalAddr().String()
+	_ = conn.Close()
+
+	return addr
+}
+
+// newTestBFDPair starts two endpoints on loopback with each other as their only peer
+func newTestBFDPair(t *testing.T, configA, configB BFDConfig) (*BFDEndpoint, *BFDEndpoint) {
+	t.Helper()
+
+	addrA, addrB := freeUDPAddr(t), freeUDPAddr(t)
+	a, err := NewBFDEndpoint(addrA, []string{addrB}, configA, logging.Test(t, logging.Zerolog, "bfd-a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = a.Close() })
+	b, err := NewBFDEndpoint(addrB, []string{addrA}, configB, logging.Test(t, logging.Zerolog, "bfd-b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+
+	a.Start()
+	b.Start()
+
+	return a, b
+}
+
+// waitForBFD waits until the endpoint's session with its single peer satisfies cond
+func waitForBFD(t *testing.T, e *BFDEndpoint, what string, cond func(BFDSessionStats) bool) BFDSessionStats {
+	t.Helper()
+
+	deadline := time.Now().Add(bfdTestTimeout)
+	for time.Now().Before(deadline) {
+		if stats := e.Stats()[0]; cond(stats) {
+			return stats
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("BFD session never %s: %+v", what, e.Stats()[0])
+	return BFDSessionStats{}
+}
+
+func TestBFDPacketRoundTrip(t *testing.T) {
+	key := []byte("0123456789abcdef")
+
+	tests := map[string]struct {
+		packet bfdPacket
+		key    []byte
+	}{
+		"down": {
+			packet: bfdPacket{state: BFDStateDown, detectMult: 3, myDiscr: 1, desiredMinTx: time.Second, requiredMinRx: time.Second},
+		},
+		"up with poll": {
+			packet: bfdPacket{state: BFDStateUp, poll: true, detectMult: 5, myDiscr: 7, yourDiscr: 9, desiredMinTx: 50 * time.Millisecond, requiredMinRx: 20 * time.Millisecond},
+		},
+		"signaled down with final": {
+			packet: bfdPacket{diag: BFDDiagAdminDown, state: BFDStateAdminDown, final: true, detectMult: 1, myDiscr: 3, yourDiscr: 4},
+		},
+		"authenticated": {
+			packet: bfdPacket{state: BFDStateInit, detectMult: 3, myDiscr: 11, yourDiscr: 12, desiredMinTx: 300 * time.Millisecond, requiredMinRx: 300 * time.Millisecond, auth: true, authKeyID: 2, authSeq: 1 << 31},
+			key:    key,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			b := tt.packet.marshal(tt.key)
+			if want := bfdHeaderLen; !tt.packet.auth && len(b) != want {
+				t.Fatalf("got %d bytes, want %d", len(b), want)
+			}
+
+			decoded, err := unmarshalBFDPacket(b, tt.packet.authKeyID, tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *decoded != tt.packet {
+				t.Fatalf("got %+v, want %+v", *decoded, tt.packet)
+			}
+		})
+	}
+}
+
+func TestUnmarshalBFDPacketRejects(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	valid := bfdPacket{state: BFDStateUp, detectMult: 3, myDiscr: 1, yourDiscr: 2, desiredMinTx: time.Second, requiredMinRx: time.Second}
+	signed := valid
+	signed.auth, signed.authKeyID, signed.authSeq = true, 1, 42
+
+	tampered := signed.marshal(key)
+	tampered[len(tampered)-1] ^= 0xff
+	wrongVersion := valid.marshal(nil)
+	wrongVersion[0] = 2<<5 | wrongVersion[0]&0x1f
+	demand := valid.marshal(nil)
+	demand[1] |= bfdFlagDemand
+
+	tests := map[string]struct {
+		b     []byte
+		keyID uint8
+		key   []byte
+		want  error
+	}{
+		"short":                     {b: valid.marshal(nil)[:bfdHeaderLen-1], want: ErrBFDPacket},
+		"unsupported version":       {b: wrongVersion, want: ErrBFDPacket},
+		"demand mode":               {b: demand, want: ErrBFDPacket},
+		"zero detect multiplier":    {b: (&bfdPacket{state: BFDStateDown, myDiscr: 1}).marshal(nil), want: ErrBFDPacket},
+		"zero my discriminator":     {b: (&bfdPacket{state: BFDStateDown, detectMult: 3}).marshal(nil), want: ErrBFDPacket},
+		"zero your discriminator":   {b: (&bfdPacket{state: BFDStateUp, detectMult: 3, myDiscr: 1}).marshal(nil), want: ErrBFDPacket},
+		"unauthenticated with key":  {b: valid.marshal(nil), keyID: 1, key: key, want: ErrBFDAuth},
+		"authenticated without key": {b: signed.marshal(key), want: ErrBFDAuth},
+		"wrong key ID":              {b: signed.marshal(key), keyID: 2, key: key, want: ErrBFDAuth},
+		"wrong key":                 {b: signed.marshal(key), keyID: 1, key: []byte("another key"), want: ErrBFDAuth},
+		"tampered digest":           {b: tampered, keyID: 1, key: key, want: ErrBFDAuth},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := unmarshalBFDPacket(tt.b, tt.keyID, tt.key); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBFDLoopback(t *testing.T) {
+	if testing.Short() {
+		t.Skip("BFD sessions start at the one second slow interval")
+	}
+
+	config := BFDConfig{
+		DesiredMinTx:     20 * time.Millisecond,
+		RequiredMinRx:    20 * time.Millisecond,
+		DetectMultiplier: 3,
+		AuthKeyID:        1,
+		AuthKey:          []byte("loopback"),
+	}
+	a, b := newTestBFDPair(t, config, config)
+
+	waitForBFD(t, a, "came up", func(s BFDSessionStats) bool { return s.Up() })
+	stats := waitForBFD(t, b, "came up", func(s BFDSessionStats) bool { return s.Up() })
+	if stats.TxInterval != config.DesiredMinTx || stats.DetectTime != 3*config.RequiredMinRx {
+		t.Fatalf("got tx interval %s and detect time %s once up, want the fast timers", stats.TxInterval, stats.DetectTime)
+	}
+
+	// Closing an endpoint tells the peer right away
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	stats = waitForBFD(t, a, "went down", func(s BFDSessionStats) bool { return !s.Up() })
+	if stats.Diagnostic != BFDDiagNeighborSignaledDown.String() {
+		t.Fatalf("got diagnostic %q, want %q", stats.Diagnostic, BFDDiagNeighborSignaledDown)
+	}
+}
+
+func TestBFDPacketLoss(t *testing.T) {
+	if testing.Short() {
+		t.Skip("BFD sessions start at the one second slow interval")
+	}
+
+	// A detect multiplier of 10 rides out a 30% loss: ten losses in a row are rare
+	config := BFDConfig{
+		DesiredMinTx:     10 * time.Millisecond,
+		RequiredMinRx:    10 * time.Millisecond,
+		DetectMultiplier: 10,
+	}
+	lossy := config
+	lossy.PacketLoss = 0.3
+	a, b := newTestBFDPair(t, lossy, config)
+
+	waitForBFD(t, a, "came up", func(s BFDSessionStats) bool { return s.Up() })
+	waitForBFD(t, b, "came up", func(s BFDSessionStats) bool { return s.Up() })
+
+	time.Sleep(time.Second)
+	stats := a.Stats()[0]
+	if !stats.Up() || !b.Up() {
+		t.Fatalf("session went down under 30%% loss: %+v", stats)
+	}
+	if stats.Discarded == 0 || stats.Received == 0 {
+		t.Fatalf("got %d packets received and %d discarded, want both", stats.Received, stats.Discarded)
+	}
+
+	// A peer that goes silent without signaling is detected once its detect time passes
+	if err := b.conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	silent := time.Now()
+	stats = waitForBFD(t, a, "went down", func(s BFDSessionStats) bool { return !s.Up() })
+	if stats.Diagnostic != BFDDiagDetectionTimeExpired.String() {
+		t.Fatalf("got diagnostic %q, want %q", stats.Diagnostic, BFDDiagDetectionTimeExpired)
+	}
+	if elapsed := time.Since(silent); elapsed < stats.DetectTime/2 {
+		t.Fatalf("session went down %s after the peer went silent, before the %s detect time", elapsed, stats.DetectTime)
+	}
+}
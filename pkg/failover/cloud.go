@@ -0,0 +1,186 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// CloudProvider moves the resources of a failover pair between its nodes: the ENI IP that
+// marks the primary, the floating IPs and EIPs behind it, and the routes to the pair.
+// Each provider acts on behalf of the instance it runs on.
+type CloudProvider interface {
+	// GetInstanceID returns the ID of the instance the provider acts for
+	GetInstanceID() string
+
+	// CheckENIOwnership reports whether this instance owns the ENI IP in its VPC
+	CheckENIOwnership(ctx context.Context, eniIP string) (bool, error)
+
+	// GetENIOwner returns the ID of the instance that owns the ENI IP in this instance's VPC
+	GetENIOwner(ctx context.Context, eniIP string) (string, error)
+
+	// GetENIByIP returns the ID of the ENI holding the IP in this instance's VPC
+	GetENIByIP(ctx context.Context, ip string) (string, error)
+
+	// TakeOverENI moves the ENI IP from the ENI holding it in this instance's VPC, and any EIP
+	// associated with it there, to this instance's ENI
+	TakeOverENI(ctx context.Context, eniIP string) error
+
+	// DescribeENIs returns the network interfaces matching the filter
+	DescribeENIs(ctx context.Context, filter ENIFilter) ([]CloudENI, error)
+
+	// DescribeSubnet returns a subnet
+	DescribeSubnet(ctx context.Context, subnetID string) (*CloudSubnet, error)
+
+	// DescribeRouteTables returns the route tables matching the filter
+	DescribeRouteTables(ctx context.Context, filter RouteTableFilter) ([]CloudRouteTable, error)
+
+	// ReassignFloatingIPs moves floating IPs from the source ENI to the destination ENI
+	ReassignFloatingIPs(ctx context.Context, sourceENI, destENI string, ips []string) error
+
+	// UpdateRouteTables points the route to the destination CIDR in the route tables at the ENI
+	UpdateRouteTables(ctx context.Context, destinationCIDR, newENI string, routeTableIDs []string) error
+
+	// GetRouteTargets returns the target of the route to the destination CIDR by route table
+	// ID, for the route tables of the VPC
+	GetRouteTargets(ctx context.Context, vpcID, destinationCIDR string) (map[string]string, error)
+
+	// DescribeEIPs returns the Elastic IPs matching the filter
+	DescribeEIPs(ctx context.Context, filter EIPFilter) ([]CloudEIP, error)
+
+	// AssociateEIP associates the EIP with the private IP of the ENI, taking it from any
+	// ENI it is associated with
+	AssociateEIP(ctx context.Context, allocationID, eniID, privateIP string) error
+
+	// MoveEIPToENI associates the EIP of the private IP with the ENI, doing nothing if there is
+	// none. The private IP is looked up in every VPC, so use DescribeEIPs with the ENIs of the
+	// pair to find EIPs of private IPs other VPCs may use too.
+	MoveEIPToENI(ctx context.Context, privateIP, newENI string) error
+
+	// GetEpochTag returns the leadership epoch stamped on the ENI holding the IP in this
+	// instance's VPC and that ENI's ID
+	GetEpochTag(ctx context.Context, eniIP string) (uint64, string, error)
+
+	// SetEpochTag stamps the leadership epoch on the ENI
+	SetEpochTag(ctx context.Context, eniID string, epoch uint64) error
+}
+
+// CloudENI is a network interface as described by a CloudProvider
+type CloudENI struct {
+	ID string `json:"id"`
+
+	// Instance the ENI is attached to, empty when detached
+	InstanceID string `json:"instance_id,omitempty"`
+
+	VPCID        string            `json:"vpc_id"`
+	SubnetID     string            `json:"subnet_id"`
+	PrimaryIP    string            `json:"primary_ip"`
+	SecondaryIPs []string          `json:"secondary_ips,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+}
+
+// HasIP reports whether the IP is the primary or a secondary IP of the ENI
+func (e *CloudENI) HasIP(ip string) bool {
+	return e.PrimaryIP == ip || slices.Contains(e.SecondaryIPs, ip)
+}
+
+// CloudSubnet is a subnet as described by a CloudProvider
+type CloudSubnet struct {
+	ID    string `json:"id"`
+	VPCID string `json:"vpc_id"`
+	CIDR  string `json:"cidr"`
+}
+
+// CloudRouteTable is a route table as described by a CloudProvider
+type CloudRouteTable struct {
+	ID    string            `json:"id"`
+	VPCID string            `json:"vpc_id"`
+	Tags  map[string]string `json:"tags,omitempty"`
+
+	// Target of the route to each destination CIDR: an ENI ID, or prefixed by kind for other targets
+	Routes map[string]string `json:"routes,omitempty"`
+}
+
+// CloudEIP is an Elastic IP as described by a CloudProvider
+type CloudEIP struct {
+	AllocationID string `json:"allocation_id"`
+	PublicIP     string `json:"public_ip"`
+
+	// Private IP and ENI the EIP is associated with, empty when unassociated
+	PrivateIP string `json:"private_ip,omitempty"`
+	ENI       string `json:"eni,omitempty"`
+}
+
+// ENIFilter selects network interfaces. An ENI must match every field that is set, and
+// one of the IDs if any are given.
+type ENIFilter struct {
+	IDs        []string
+	Tags       map[string]string
+	VPCID      string
+	SubnetID   string
+	PrivateIP  string
+	InstanceID string
+}
+
+// RouteTableFilter selects route tables. A route table must match every field that is
+// set, and one of the IDs if any are given.
+type RouteTableFilter struct {
+	IDs             []string
+	Tags            map[string]string
+	VPCID           string
+	DestinationCIDR string
+}
+
+// EIPFilter selects Elastic IPs. An EIP must match one of the values of every field that
+// is set.
+type EIPFilter struct {
+	AllocationIDs []string
+	PrivateIPs    []string
+
+	// Network interfaces the EIP is associated with. Private IPs are only unique within a
+	// VPC, so this tells the EIPs of the pair from those of the same IPs elsewhere.
+	ENIs []string
+}
+
+// ErrDryRunUnsupported is returned by a DryRunner for changes it cannot validate
+var ErrDryRunUnsupported = errors.New("dry run not supported")
+
+// DryRunner is implemented by cloud providers that can check a planned change would be
+// permitted without making it, such as with the EC2 DryRun parameter
+type DryRunner interface {
+	DryRun(ctx context.Context, change PlannedChange) error
+}
+
+// filterFloatingIPs keeps the IPs in the base IP's /24 from x.x.x.20 onwards, which are
+// the floating IPs of a failover pair
+func filterFloatingIPs(ips []string, baseIP string) []string {
+	// Parse the base IP to determine the pattern
+	parts := strings.Split(baseIP, ".")
+	if len(parts) != 4 {
+		return ips // Return all if we can't parse
+	}
+
+	var filtered []string
+	for _, ip := range ips {
+		ipParts := strings.Split(ip, ".")
+		if len(ipParts) != 4 {
+			continue
+		}
+
+		// Check if first 3 octets match
+		if ipParts[0] == parts[0] && ipParts[1] == parts[1] && ipParts[2] == parts[2] {
+			// Parse last octet
+			var lastOctet int
+			if _, err := fmt.Sscanf(ipParts[3], "%d", &lastOctet); err == nil {
+				// Check if it's 20 or higher
+				if lastOctet >= 20 {
+					filtered = append(filtered, ip)
+				}
+			}
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,764 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryCloud is an in-process cloud for tests, modelling subnets, ENIs with their secondary
+// IPs, route tables and EIPs. Each node acts on it through its own MemoryCloudProvider. The
+// latency and failures of an operation, named after the CloudProvider method such as
+// "UpdateRouteTables", can be injected to exercise slow and failing failovers.
+type MemoryCloud struct {
+	mu          sync.Mutex
+	subnets     map[string]*CloudSubnet
+	enis        map[string]*CloudENI
+	routeTables map[string]*CloudRouteTable
+	eips        map[string]*CloudEIP
+
+	latency  map[string]time.Duration
+	errs     map[string]error   // returned by every call until cleared
+	failures map[string][]error // returned by the next calls, in order
+	calls    map[string]int
+}
+
+// NewMemoryCloud creates an empty in-process cloud
+func NewMemoryCloud() *MemoryCloud {
+	return &MemoryCloud{
+		subnets:     make(map[string]*CloudSubnet),
+		enis:        make(map[string]*CloudENI),
+		routeTables: make(map[string]*CloudRouteTable),
+		eips:        make(map[string]*CloudEIP),
+		latency:     make(map[string]time.Duration),
+		errs:        make(map[string]error),
+		failures:    make(map[string][]error),
+		calls:       make(map[string]int),
+	}
+}
+
+// AddSubnet adds a subnet, replacing any with the same ID
+func (m *MemoryCloud) AddSubnet(subnet CloudSubnet) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.subnets[subnet.ID] = &subnet
+}
+
+// AddENI adds a network interface, replacing any with the same ID. An ENI without a VPC
+// is placed in the VPC of its subnet.
+func (m *MemoryCloud) AddENI(eni CloudENI) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if subnet, ok := m.subnets[eni.SubnetID]; ok && eni.VPCID == "" {
+		eni.VPCID = subnet.VPCID
+	}
+	eni.SecondaryIPs = slices.Clone(eni.SecondaryIPs)
+	eni.Tags = maps.Clone(eni.Tags)
+	if eni.Tags == nil {
+		eni.Tags = make(map[string]string)
+	}
+	m.enis[eni.ID] = &eni
+}
+
+// AddRouteTable adds a route table, replacing any with the same ID
+func (m *MemoryCloud) AddRouteTable(routeTable CloudRouteTable) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	routeTable.Tags = maps.Clone(routeTable.Tags)
+	routeTable.Routes = maps.Clone(routeTable.Routes)
+	if routeTable.Routes == nil {
+		routeTable.Routes = make(map[string]string)
+	}
+	m.routeTables[routeTable.ID] = &routeTable
+}
+
+// AddRoute adds or replaces the route to the destination CIDR in a route table, adding
+// the route table if it does not exist
+func (m *MemoryCloud) AddRoute(routeTableID, destinationCIDR, target string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	routeTable, ok := m.routeTables[routeTableID]
+	if !ok {
+		routeTable = &CloudRouteTable{ID: routeTableID, Routes: make(map[string]string)}
+		m.routeTables[routeTableID] = routeTable
+	}
+	routeTable.Routes[destinationCIDR] = target
+}
+
+// AddEIP adds an Elastic IP. An EIP with a private IP but no ENI is associated with
+// the ENI holding that IP.
+func (m *MemoryCloud) AddEIP(eip CloudEIP) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if eip.PrivateIP != "" && eip.ENI == "" {
+		if eni := m.eniWithIPLocked(eip.PrivateIP); eni != nil {
+			eip.ENI = eni.ID
+		}
+	}
+	m.eips[eip.AllocationID] = &eip
+}
+
+// ReleaseEIP removes an Elastic IP, as releasing it back to AWS does
+func (m *MemoryCloud) ReleaseEIP(allocationID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.eips, allocationID)
+}
+
+// SetLatency delays every call of an operation, zero removes the delay
+func (m *MemoryCloud) SetLatency(op string, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.latency[op] = latency
+}
+
+// SetError fails every call of an operation with err until it is cleared with nil
+func (m *MemoryCloud) SetError(op string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err == nil {
+		delete(m.errs, op)
+		return
+	}
+	m.errs[op] = err
+}
+
+// FailNext fails the next calls of an operation with errs, one call per error
+func (m *MemoryCloud) FailNext(op string, errs ...error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.failures[op] = append(m.failures[op], errs...)
+}
+
+// Calls returns how often an operation has been called
+func (m *MemoryCloud) Calls(op string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.calls[op]
+}
+
+// ENI returns a copy of a network interface
+func (m *MemoryCloud) ENI(id string) (CloudENI, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	eni, ok := m.enis[id]
+	if !ok {
+		return CloudENI{}, false
+	}
+	return cloneENI(eni), true
+}
+
+// cloneENI copies an ENI so callers cannot modify the cloud
+func cloneENI(eni *CloudENI) CloudENI {
+	clone := *eni
+	clone.SecondaryIPs = slices.Clone(eni.SecondaryIPs)
+	clone.Tags = maps.Clone(eni.Tags)
+	return clone
+}
+
+// ENIWithIP returns the ID of the ENI holding the IP, empty if none does
+func (m *MemoryCloud) ENIWithIP(ip string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if eni := m.eniWithIPLocked(ip); eni != nil {
+		return eni.ID
+	}
+	return ""
+}
+
+// RouteTarget returns the target of the route to the destination CIDR in a route table
+func (m *MemoryCloud) RouteTarget(routeTableID, destinationCIDR string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if routeTable, ok := m.routeTables[routeTableID]; ok {
+		return routeTable.Routes[destinationCIDR]
+	}
+	return ""
+}
+
+// EIP returns a copy of an Elastic IP
+func (m *MemoryCloud) EIP(allocationID string) (CloudEIP, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	eip, ok := m.eips[allocationID]
+	if !ok {
+		return CloudEIP{}, false
+	}
+	return *eip, true
+}
+
+// call counts a call of an operation, waits out its latency and returns its injected error
+func (m *MemoryCloud) call(ctx context.Context, op string) error {
+	m.mu.Lock()
+	m.calls[op]++
+	latency := m.latency[op]
+	err := m.errs[op]
+	if queued := m.failures[op]; len(queued) > 0 {
+		err = queued[0]
+		m.failures[op] = queued[1:]
+	}
+	m.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// sortedENIsLocked returns the ENIs ordered by ID, so lookups are deterministic
+func (m *MemoryCloud) sortedENIsLocked() []*CloudENI {
+	enis := slices.Collect(maps.Values(m.enis))
+	slices.SortFunc(enis, func(a, b *CloudENI) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return enis
+}
+
+// eniWithIPLocked returns the first ENI holding the IP as its primary or a secondary IP,
+// in any VPC
+func (m *MemoryCloud) eniWithIPLocked(ip string) *CloudENI {
+	return m.vpcENIWithIPLocked("", ip)
+}
+
+// vpcENIWithIPLocked returns the ENI of the VPC holding the IP, or the first in any VPC if
+// vpcID is empty. Like in EC2, a private IP is only unique within its VPC.
+func (m *MemoryCloud) vpcENIWithIPLocked(vpcID, ip string) *CloudENI {
+	for _, eni := range m.sortedENIsLocked() {
+		if eni.HasIP(ip) && (vpcID == "" || eni.VPCID == vpcID) {
+			return eni
+		}
+	}
+	return nil
+}
+
+// instanceENILocked returns the first ENI attached to the instance
+func (m *MemoryCloud) instanceENILocked(instanceID string) *CloudENI {
+	for _, eni := range m.sortedENIsLocked() {
+		if eni.InstanceID == instanceID {
+			return eni
+		}
+	}
+	return nil
+}
+
+// unassignLocked removes a secondary IP from an ENI, which disassociates any EIP from it
+func (m *MemoryCloud) unassignLocked(eni *CloudENI, ip string) error {
+	if eni.PrimaryIP == ip {
+		return fmt.Errorf("cannot unassign primary IP %s of ENI %s", ip, eni.ID)
+	}
+	i := slices.Index(eni.SecondaryIPs, ip)
+	if i < 0 {
+		return fmt.Errorf("IP %s is not assigned to ENI %s", ip, eni.ID)
+	}
+	eni.SecondaryIPs = slices.Delete(eni.SecondaryIPs, i, i+1)
+
+	for _, eip := range m.eips {
+		if eip.ENI == eni.ID && eip.PrivateIP == ip {
+			eip.ENI = ""
+		}
+	}
+	return nil
+}
+
+// assignLocked adds a secondary IP to an ENI, failing if another ENI of its VPC holds it
+func (m *MemoryCloud) assignLocked(eni *CloudENI, ip string) error {
+	if holder := m.vpcENIWithIPLocked(eni.VPCID, ip); holder != nil {
+		if holder == eni {
+			return nil
+		}
+		return fmt.Errorf("IP %s is already assigned to ENI %s", ip, holder.ID)
+	}
+	eni.SecondaryIPs = append(eni.SecondaryIPs, ip)
+	return nil
+}
+
+// MemoryCloudProvider is the CloudProvider of an instance in a MemoryCloud
+type MemoryCloudProvider struct {
+	cloud      *MemoryCloud
+	instanceID string
+}
+
+var (
+	_ CloudProvider = (*MemoryCloudProvider)(nil)
+	_ DryRunner     = (*MemoryCloudProvider)(nil)
+)
+
+// NewMemoryCloudProvider creates a provider that acts for the given instance in the cloud
+func NewMemoryCloudProvider(cloud *MemoryCloud, instanceID string) *MemoryCloudProvider {
+	return &MemoryCloudProvider{
+		cloud:      cloud,
+		instanceID: instanceID,
+	}
+}
+
+// GetInstanceID returns the ID of the instance the provider acts for
+func (p *MemoryCloudProvider) GetInstanceID() string {
+	return p.instanceID
+}
+
+// eniWithIPLocked returns the ENI holding the IP in this instance's VPC, or nil if none does
+func (p *MemoryCloudProvider) eniWithIPLocked(ip string) (*CloudENI, error) {
+	mine := p.cloud.instanceENILocked(p.instanceID)
+	if mine == nil {
+		return nil, fmt.Errorf("no ENI found for instance %s", p.instanceID)
+	}
+	return p.cloud.vpcENIWithIPLocked(mine.VPCID, ip), nil
+}
+
+// CheckENIOwnership reports whether the ENI holding the IP in this instance's VPC is attached
+// to this instance
+func (p *MemoryCloudProvider) CheckENIOwnership(ctx context.Context, eniIP string) (bool, error) {
+	if net.ParseIP(eniIP) == nil {
+		return false, fmt.Errorf("invalid IP address: %s", eniIP)
+	}
+	if err := p.cloud.call(ctx, "CheckENIOwnership"); err != nil {
+		return false, fmt.Errorf("failed to describe network interfaces: %w", err)
+	}
+
+	p.cloud.mu.Lock()
+	defer p.cloud.mu.Unlock()
+
+	eni, err := p.eniWithIPLocked(eniIP)
+	if err != nil {
+		return false, err
+	}
+	return eni != nil && eni.InstanceID == p.instanceID, nil
+}
+
+// GetENIOwner returns the instance the ENI holding the IP in this instance's VPC is attached to
+func (p *MemoryCloudProvider) GetENIOwner(ctx context.Context, eniIP string) (string, error) {
+	if net.ParseIP(eniIP) == nil {
+		return "", fmt.Errorf("invalid IP address: %s", eniIP)
+	}
+	if err := p.cloud.call(ctx, "GetENIOwner"); err != nil {
+		return "", fmt.Errorf("failed to describe network interfaces: %w", err)
+	}
+
+	p.cloud.mu.Lock()
+	defer p.cloud.mu.Unlock()
+
+	eni, err := p.eniWithIPLocked(eniIP)
+	if err != nil {
+		return "", err
+	}
+	if eni == nil || eni.InstanceID == "" {
+		return "", fmt.Errorf("no instance found owning ENI IP %s", eniIP)
+	}
+	return eni.InstanceID, nil
+}
+
+// GetENIByIP returns the ID of the ENI holding the IP in this instance's VPC
+func (p *MemoryCloudProvider) GetENIByIP(ctx context.Context, ip string) (string, error) {
+	if err := p.cloud.call(ctx, "GetENIByIP"); err != nil {
+		return "", fmt.Errorf("failed to describe network interfaces: %w", err)
+	}
+
+	p.cloud.mu.Lock()
+	defer p.cloud.mu.Unlock()
+
+	eni, err := p.eniWithIPLocked(ip)
+	if err != nil {
+		return "", err
+	}
+	if eni == nil {
+		return "", fmt.Errorf("no ENI found with IP %s", ip)
+	}
+	return eni.ID, nil
+}
+
+// TakeOverENI moves the ENI IP to this instance's ENI, followed by its EIP
+func (p *MemoryCloudProvider) TakeOverENI(ctx context.Context, eniIP string) error {
+	if err := p.cloud.call(ctx, "TakeOverENI"); err != nil {
+		return fmt.Errorf("failed to take over IP %s: %w", eniIP, err)
+	}
+
+	myENI, eips, err := p.moveENIIP(eniIP)
+	if err != nil || myENI == "" {
+		return err
+	}
+
+	// As with AWS, the private IP has moved even if its EIP cannot follow
+	for _, allocationID := range eips {
+		_ = p.AssociateEIP(ctx, allocationID, myENI, eniIP)
+	}
+	return nil
+}
+
+// moveENIIP moves the ENI IP to this instance's ENI from the ENI holding it in the same VPC.
+// It returns that ENI's ID, or an empty ID if it already held the IP, and the EIPs that were
+// associated with the IP on the ENI it moved from.
+func (p *MemoryCloudProvider) moveENIIP(eniIP string) (string, []string, error) {
+	p.cloud.mu.Lock()
+	defer p.cloud.mu.Unlock()
+
+	mine := p.cloud.instanceENILocked(p.instanceID)
+	if mine == nil {
+		return "", nil, fmt.Errorf("no ENI found for instance %s", p.instanceID)
+	}
+	current := p.cloud.vpcENIWithIPLocked(mine.VPCID, eniIP)
+	if current == nil {
+		return "", nil, fmt.Errorf("failed to find current owner of IP %s: no ENI found with IP %s", eniIP, eniIP)
+	}
+	if current == mine {
+		return "", nil, nil
+	}
+
+	var eips []string
+	for _, id := range slices.Sorted(maps.Keys(p.cloud.eips)) {
+		if eip := p.cloud.eips[id]; eip.ENI == current.ID && eip.PrivateIP == eniIP {
+			eips = append(eips, id)
+		}
+	}
+
+	if err := p.cloud.unassignLocked(current, eniIP); err != nil {
+		return "", nil, fmt.Errorf("failed to unassign IP %s from ENI %s: %w", eniIP, current.ID, err)
+	}
+	if err := p.cloud.assignLocked(mine, eniIP); err != nil {
+		return "", nil, fmt.Errorf("failed to assign IP %s to ENI %s: %w", eniIP, mine.ID, err)
+	}
+	return mine.ID, eips, nil
+}
+
+// DescribeENIs returns the network interfaces matching the filter, ordered by ID
+func (p *MemoryCloudProvider) DescribeENIs(ctx context.Context, filter ENIFilter) ([]CloudENI, error) {
+	if err := p.cloud.call(ctx, "DescribeENIs"); err != nil {
+		return nil, fmt.Errorf("failed to describe network interfaces: %w", err)
+	}
+
+	p.cloud.mu.Lock()
+	defer p.cloud.mu.Unlock()
+
+	var enis []CloudENI
+	for _, eni := range p.cloud.sortedENIsLocked() {
+		switch {
+		case len(filter.IDs) > 0 && !slices.Contains(filter.IDs, eni.ID):
+		case !hasTags(eni.Tags, filter.Tags):
+		case filter.VPCID != "" && eni.VPCID != filter.VPCID:
+		case filter.SubnetID != "" && eni.SubnetID != filter.SubnetID:
+		case filter.PrivateIP != "" && !eni.HasIP(filter.PrivateIP):
+		case filter.InstanceID != "" && eni.InstanceID != filter.InstanceID:
+		default:
+			enis = append(enis, cloneENI(eni))
+		}
+	}
+	return enis, nil
+}
+
+// DescribeSubnet returns a subnet
+func (p *MemoryCloudProvider) DescribeSubnet(ctx context.Context, subnetID string) (*CloudSubnet, error) {
+	if err := p.cloud.call(ctx, "DescribeSubnet"); err != nil {
+		return nil, fmt.Errorf("failed to describe subnet %s: %w", subnetID, err)
+	}
+
+	p.cloud.mu.Lock()
+	defer p.cloud.mu.Unlock()
+
+	subnet, ok := p.cloud.subnets[subnetID]
+	if !ok {
+		return nil, fmt.Errorf("subnet %s not found", subnetID)
+	}
+	clone := *subnet
+	return &clone, nil
+}
+
+// DescribeRouteTables returns the route tables matching the filter, ordered by ID
+func (p *MemoryCloudProvider) DescribeRouteTables(ctx context.Context, filter RouteTableFilter) ([]CloudRouteTable, error) {
+	if err := p.cloud.call(ctx, "DescribeRouteTables"); err != nil {
+		return nil, fmt.Errorf("failed to describe route tables: %w", err)
+	}
+
+	p.cloud.mu.Lock()
+	defer p.cloud.mu.Unlock()
+
+	var routeTables []CloudRouteTable
+	for _, id := range slices.Sorted(maps.Keys(p.cloud.routeTables)) {
+		routeTable := p.cloud.routeTables[id]
+		_, hasRoute := routeTable.Routes[filter.DestinationCIDR]
+		switch {
+		case len(filter.IDs) > 0 && !slices.Contains(filter.IDs, id):
+		case !hasTags(routeTable.Tags, filter.Tags):
+		case filter.VPCID != "" && routeTable.VPCID != filter.VPCID:
+		case filter.DestinationCIDR != "" && !hasRoute:
+		default:
+			clone := *routeTable
+			clone.Tags = maps.Clone(routeTable.Tags)
+			clone.Routes = maps.Clone(routeTable.Routes)
+			routeTables = append(routeTables, clone)
+		}
+	}
+	return routeTables, nil
+}
+
+// hasTags reports whether tags contains all of the wanted tags
+func hasTags(tags, wanted map[string]string) bool {
+	for key, value := range wanted {
+		if v, ok := tags[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ReassignFloatingIPs moves each floating IP to the destination ENI from whichever ENI of its
+// VPC holds it, carrying on past IPs that cannot be moved. Like EC2 reassignment, an IP is never left
+// on neither ENI.
+func (p *MemoryCloudProvider) ReassignFloatingIPs(ctx context.Context, sourceENI, destENI string, ips []string) error {
+	if len(ips) == 0 {
+		return nil
+	}
+	if err := p.cloud.call(ctx, "ReassignFloatingIPs"); err != nil {
+		return fmt.Errorf("failed to reassign IPs %s from ENI %s to ENI %s: %w", strings.Join(ips, ","), sourceENI, destENI, err)
+	}
+
+	p.cloud.mu.Lock()
+	defer p.cloud.mu.Unlock()
+
+	dest := p.cloud.enis[destENI]
+	if dest == nil {
+		return fmt.Errorf("network interface %s not found", destENI)
+	}
+
+	var errs []string
+	for _, ip := range ips {
+		if holder := p.cloud.vpcENIWithIPLocked(dest.VPCID, ip); holder != nil && holder != dest {
+			if err := p.cloud.unassignLocked(holder, ip); err != nil {
+				errs = append(errs, fmt.Sprintf("failed to reassign IP %s to ENI %s: %s", ip, destENI, err))
+				continue
+			}
+		}
+		if err := p.cloud.assignLocked(dest, ip); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to reassign IP %s to ENI %s: %s", ip, destENI, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("floating IP reassignment errors: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// UpdateRouteTables points the route to the destination CIDR in the route tables at the
+// ENI, carrying on past route tables that cannot be updated
+func (p *MemoryCloudProvider) UpdateRouteTables(ctx context.Context, destinationCIDR, newENI string, routeTableIDs []string) error {
+	if len(routeTableIDs) == 0 {
+		return fmt.Errorf("no route tables found with routes to %s", destinationCIDR)
+	}
+	if err := p.cloud.call(ctx, "UpdateRouteTables"); err != nil {
+		return fmt.Errorf("route table update errors: %w", err)
+	}
+
+	p.cloud.mu.Lock()
+	defer p.cloud.mu.Unlock()
+
+	if _, ok := p.cloud.enis[newENI]; !ok {
+		return fmt.Errorf("network interface %s not found", newENI)
+	}
+
+	var errs []string
+	for _, routeTableID := range routeTableIDs {
+		routeTable, ok := p.cloud.routeTables[routeTableID]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("failed to update route in table %s: route table not found", routeTableID))
+			continue
+		}
+		if _, ok := routeTable.Routes[destinationCIDR]; !ok {
+			errs = append(errs, fmt.Sprintf("failed to update route in table %s: no route to %s", routeTableID, destinationCIDR))
+			continue
+		}
+		routeTable.Routes[destinationCIDR] = newENI
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("route table update errors: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// GetRouteTargets returns the target of the route to the destination CIDR by route table ID,
+// for the route tables of the VPC
+func (p *MemoryCloudProvider) GetRouteTargets(ctx context.Context, vpcID, destinationCIDR string) (map[string]string, error) {
+	if err := p.cloud.call(ctx, "GetRouteTargets"); err != nil {
+		return nil, fmt.Errorf("failed to describe route tables: %w", err)
+	}
+
+	p.cloud.mu.Lock()
+	defer p.cloud.mu.Unlock()
+
+	targets := make(map[string]string)
+	for routeTableID, routeTable := range p.cloud.routeTables {
+		if routeTable.VPCID != vpcID {
+			continue
+		}
+		if target, ok := routeTable.Routes[destinationCIDR]; ok {
+			targets[routeTableID] = target
+		}
+	}
+	return targets, nil
+}
+
+// DescribeEIPs returns the Elastic IPs matching the filter, ordered by allocation ID
+func (p *MemoryCloudProvider) DescribeEIPs(ctx context.Context, filter EIPFilter) ([]CloudEIP, error) {
+	if err := p.cloud.call(ctx, "DescribeEIPs"); err != nil {
+		return nil, fmt.Errorf("failed to describe addresses: %w", err)
+	}
+
+	p.cloud.mu.Lock()
+	defer p.cloud.mu.Unlock()
+
+	var eips []CloudEIP
+	for _, id := range slices.Sorted(maps.Keys(p.cloud.eips)) {
+		eip := p.cloud.eips[id]
+		switch {
+		case len(filter.AllocationIDs) > 0 && !slices.Contains(filter.AllocationIDs, id):
+		case len(filter.PrivateIPs) > 0 && (eip.PrivateIP == "" || !slices.Contains(filter.PrivateIPs, eip.PrivateIP)):
+		case len(filter.ENIs) > 0 && (eip.ENI == "" || !slices.Contains(filter.ENIs, eip.ENI)):
+		default:
+			eips = append(eips, *eip)
+		}
+	}
+	return eips, nil
+}
+
+// AssociateEIP associates the EIP with the private IP of the ENI, which must hold that IP
+func (p *MemoryCloudProvider) AssociateEIP(ctx context.Context, allocationID, eniID, privateIP string) error {
+	if err := p.cloud.call(ctx, "AssociateEIP"); err != nil {
+		return fmt.Errorf("failed to associate EIP %s to ENI %s: %w", allocationID, eniID, err)
+	}
+
+	p.cloud.mu.Lock()
+	defer p.cloud.mu.Unlock()
+
+	eip, ok := p.cloud.eips[allocationID]
+	if !ok {
+		return fmt.Errorf("failed to associate EIP %s to ENI %s: EIP not found", allocationID, eniID)
+	}
+	eni := p.cloud.enis[eniID]
+	if eni == nil || !eni.HasIP(privateIP) {
+		return fmt.Errorf("failed to associate EIP %s to ENI %s: private IP %s is not assigned to it", allocationID, eniID, privateIP)
+	}
+	eip.PrivateIP = privateIP
+	eip.ENI = eniID
+	return nil
+}
+
+// MoveEIPToENI associates the EIP of the private IP with the ENI, which must hold that IP
+func (p *MemoryCloudProvider) MoveEIPToENI(ctx context.Context, privateIP, newENI string) error {
+	if err := p.cloud.call(ctx, "MoveEIPToENI"); err != nil {
+		return fmt.Errorf("failed to find EIP for private IP %s: %w", privateIP, err)
+	}
+
+	p.cloud.mu.Lock()
+	defer p.cloud.mu.Unlock()
+
+	for _, eip := range p.cloud.eips {
+		if eip.PrivateIP != privateIP {
+			continue
+		}
+		eni := p.cloud.enis[newENI]
+		if eni == nil || !eni.HasIP(privateIP) {
+			return fmt.Errorf("failed to associate EIP %s to ENI %s: private IP %s is not assigned to it", eip.AllocationID, newENI, privateIP)
+		}
+		eip.ENI = newENI
+		return nil
+	}
+	return nil
+}
+
+// GetEpochTag returns the epoch stamped on the ENI holding the IP in this instance's VPC and
+// that ENI's ID
+func (p *MemoryCloudProvider) GetEpochTag(ctx context.Context, eniIP string) (uint64, string, error) {
+	if err := p.cloud.call(ctx, "GetEpochTag"); err != nil {
+		return 0, "", fmt.Errorf("failed to describe network interfaces: %w", err)
+	}
+
+	p.cloud.mu.Lock()
+	defer p.cloud.mu.Unlock()
+
+	eni, err := p.eniWithIPLocked(eniIP)
+	if err != nil {
+		return 0, "", err
+	}
+	if eni == nil {
+		return 0, "", nil
+	}
+	epoch, err := strconv.ParseUint(eni.Tags[EpochTagKey], 10, 64)
+	if err != nil {
+		return 0, eni.ID, nil
+	}
+	return epoch, eni.ID, nil
+}
+
+// SetEpochTag stamps the leadership epoch on the ENI
+func (p *MemoryCloudProvider) SetEpochTag(ctx context.Context, eniID string, epoch uint64) error {
+	err := p.cloud.call(ctx, "SetEpochTag")
+	if err == nil {
+		p.cloud.mu.Lock()
+		if eni, ok := p.cloud.enis[eniID]; ok {
+			eni.Tags[EpochTagKey] = strconv.FormatUint(epoch, 10)
+		} else {
+			err = errors.New("network interface not found")
+		}
+		p.cloud.mu.Unlock()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to tag ENI %s with epoch %d: %w", eniID, epoch, err)
+	}
+	return nil
+}
+
+// DryRun checks the resources of a change exist. Like EC2, it cannot validate moving
+// private IPs between ENIs.
+func (p *MemoryCloudProvider) DryRun(ctx context.Context, change PlannedChange) error {
+	if err := p.cloud.call(ctx, "DryRun"); err != nil {
+		return err
+	}
+
+	p.cloud.mu.Lock()
+	defer p.cloud.mu.Unlock()
+
+	if _, ok := p.cloud.enis[change.To]; !ok {
+		return fmt.Errorf("network interface %s not found", change.To)
+	}
+	switch change.Action {
+	case ActionTakeOverENI, ActionReassignFloatingIPs:
+		return ErrDryRunUnsupported
+	case ActionMoveEIP:
+		if _, ok := p.cloud.eips[change.Resource]; !ok {
+			return fmt.Errorf("EIP %s not found", change.Resource)
+		}
+	case ActionUpdateRoutes:
+		routeTable, ok := p.cloud.routeTables[change.Resource]
+		if !ok {
+			return fmt.Errorf("route table %s not found", change.Resource)
+		}
+		if _, ok := routeTable.Routes[change.DestinationCIDR]; !ok {
+			return fmt.Errorf("route table %s has no route to %s", change.Resource, change.DestinationCIDR)
+		}
+	}
+	return nil
+}
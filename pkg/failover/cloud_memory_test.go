@@ -0,0 +1,340 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMemoryCloudInjectedErrors(t *testing.T) {
+	cloud := newTestCloud()
+	provider := NewMemoryCloudProvider(cloud, "i-b")
+	ctx := context.Background()
+
+	errStuck := errors.New("stuck")
+	errFirst := errors.New("first")
+	errSecond := errors.New("second")
+
+	// Queued failures are returned before the persistent error, one call each
+	cloud.SetError("GetENIByIP", errStuck)
+	cloud.FailNext("GetENIByIP", errFirst, errSecond)
+	for i, want := range []error{errFirst, errSecond, errStuck, errStuck} {
+		if _, err := provider.GetENIByIP(ctx, testENIIP); !errors.Is(err, want) {
+			t.Fatalf("call %d: got error %v, want %v", i+1, err, want)
+		}
+	}
+
+	// Clearing the persistent error lets calls through again
+	cloud.SetError("GetENIByIP", nil)
+	eni, err := provider.GetENIByIP(ctx, testENIIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eni != "eni-a" {
+		t.Fatalf("got ENI %s, want eni-a", eni)
+	}
+
+	// Failed calls are counted, and errors only apply to their own operation
+	if calls := cloud.Calls("GetENIByIP"); calls != 5 {
+		t.Fatalf("got %d calls, want 5", calls)
+	}
+	if _, err := provider.GetENIOwner(ctx, testENIIP); err != nil {
+		t.Fatalf("other operation failed: %v", err)
+	}
+}
+
+func TestMemoryCloudLatency(t *testing.T) {
+	cloud := newTestCloud()
+	provider := NewMemoryCloudProvider(cloud, "i-b")
+
+	const latency = 50 * time.Millisecond
+	cloud.SetLatency("GetENIByIP", latency)
+
+	start := time.Now()
+	if _, err := provider.GetENIByIP(context.Background(), testENIIP); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < latency {
+		t.Fatalf("call returned after %s, want at least %s", elapsed, latency)
+	}
+
+	// A call gives up waiting once its context is done, without touching the cloud
+	cloud.SetLatency("ReassignFloatingIPs", time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start = time.Now()
+	err := provider.ReassignFloatingIPs(ctx, "eni-a", "eni-b", []string{testENIIP})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("call returned after %s despite its deadline", elapsed)
+	}
+	if holder := cloud.ENIWithIP(testENIIP); holder != "eni-a" {
+		t.Fatalf("IP moved to %s by a cancelled call", holder)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := provider.GetENIByIP(cancelled, testENIIP); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+
+	// Zero removes the delay
+	cloud.SetLatency("GetENIByIP", 0)
+	if _, err := provider.GetENIByIP(cancelled, testENIIP); err != nil {
+		t.Fatalf("call without latency failed: %v", err)
+	}
+}
+
+func TestMemoryCloudReassignFloatingIPs(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		dest    string
+		ips     []string
+		wantErr bool
+
+		// ENI holding each IP afterwards
+		want map[string]string
+	}{
+		{
+			name:   "moves from source",
+			source: "eni-a",
+			dest:   "eni-b",
+			ips:    []string{testENIIP, "10.0.1.20"},
+			want:   map[string]string{testENIIP: "eni-b", "10.0.1.20": "eni-b", "10.0.1.21": "eni-c"},
+		},
+		{
+			name:   "moves from any holder",
+			source: "eni-a",
+			dest:   "eni-b",
+			ips:    []string{"10.0.1.21"},
+			want:   map[string]string{testENIIP: "eni-a", "10.0.1.21": "eni-b"},
+		},
+		{
+			name:   "keeps IPs already moved",
+			source: "eni-b",
+			dest:   "eni-a",
+			ips:    []string{testENIIP, "10.0.1.20"},
+			want:   map[string]string{testENIIP: "eni-a", "10.0.1.20": "eni-a"},
+		},
+		{
+			name:   "assigns unheld IPs",
+			source: "eni-a",
+			dest:   "eni-b",
+			ips:    []string{"10.0.1.30"},
+			want:   map[string]string{"10.0.1.30": "eni-b"},
+		},
+		{
+			name:    "carries on past primary IPs",
+			source:  "eni-a",
+			dest:    "eni-b",
+			ips:     []string{"10.0.1.10", testENIIP},
+			wantErr: true,
+			want:    map[string]string{"10.0.1.10": "eni-a", testENIIP: "eni-b"},
+		},
+		{
+			name:    "unknown destination",
+			source:  "eni-a",
+			dest:    "eni-missing",
+			ips:     []string{testENIIP},
+			wantErr: true,
+			want:    map[string]string{testENIIP: "eni-a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloud := newTestCloud()
+			cloud.AddENI(CloudENI{ID: "eni-a", InstanceID: "i-a", SubnetID: "subnet-1", PrimaryIP: "10.0.1.10", SecondaryIPs: []string{testENIIP, "10.0.1.20"}})
+			cloud.AddENI(CloudENI{ID: "eni-c", SubnetID: "subnet-1", PrimaryIP: "10.0.1.12", SecondaryIPs: []string{"10.0.1.21"}})
+			provider := NewMemoryCloudProvider(cloud, "i-b")
+
+			err := provider.ReassignFloatingIPs(context.Background(), tt.source, tt.dest, tt.ips)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			for ip, want := range tt.want {
+				if holder := cloud.ENIWithIP(ip); holder != want {
+					t.Fatalf("IP %s is on %q, want %q", ip, holder, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryCloudReassignDisassociatesEIP(t *testing.T) {
+	cloud := newTestCloud()
+	cloud.AddEIP(CloudEIP{AllocationID: "eipalloc-1", PublicIP: "203.0.113.1", PrivateIP: testENIIP})
+	provider := NewMemoryCloudProvider(cloud, "i-b")
+
+	// Reassigning the private IP leaves its EIP behind, as in EC2
+	if err := provider.ReassignFloatingIPs(context.Background(), "eni-a", "eni-b", []string{testENIIP}); err != nil {
+		t.Fatal(err)
+	}
+	eip, _ := cloud.EIP("eipalloc-1")
+	if eip.ENI != "" || eip.PrivateIP != testENIIP {
+		t.Fatalf("got EIP on ENI %q for %s, want disassociated from %s", eip.ENI, eip.PrivateIP, testENIIP)
+	}
+
+	// Taking over the ENI IP brings the EIP associated with it along
+	if err := provider.AssociateEIP(context.Background(), "eipalloc-1", "eni-b", testENIIP); err != nil {
+		t.Fatal(err)
+	}
+	back := NewMemoryCloudProvider(cloud, "i-a")
+	if err := back.TakeOverENI(context.Background(), testENIIP); err != nil {
+		t.Fatal(err)
+	}
+	if holder := cloud.ENIWithIP(testENIIP); holder != "eni-a" {
+		t.Fatalf("IP is on %s after take over, want eni-a", holder)
+	}
+	if eip, _ := cloud.EIP("eipalloc-1"); eip.ENI != "eni-a" {
+		t.Fatalf("EIP is on %q after take over, want eni-a", eip.ENI)
+	}
+}
+
+func TestMemoryCloudLookupsStayInVPC(t *testing.T) {
+	cloud := newTestCloud()
+	cloud.AddSubnet(CloudSubnet{ID: "subnet-9", VPCID: "vpc-9", CIDR: "10.0.1.0/24"})
+	cloud.AddENI(CloudENI{ID: "eni-0", InstanceID: "i-z", SubnetID: "subnet-9", PrimaryIP: "10.0.1.10", SecondaryIPs: []string{testENIIP}, Tags: map[string]string{EpochTagKey: "9"}})
+	ctx := context.Background()
+
+	// eni-0 sorts first, but holds the ENI IP in another VPC
+	tests := []struct {
+		instance string
+		eni      string
+		owner    string
+		epoch    uint64
+	}{
+		{instance: "i-b", eni: "eni-a", owner: "i-a"},
+		{instance: "i-z", eni: "eni-0", owner: "i-z", epoch: 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.instance, func(t *testing.T) {
+			provider := NewMemoryCloudProvider(cloud, tt.instance)
+
+			if eni, err := provider.GetENIByIP(ctx, testENIIP); err != nil || eni != tt.eni {
+				t.Fatalf("got ENI %s (%v), want %s", eni, err, tt.eni)
+			}
+			if owner, err := provider.GetENIOwner(ctx, testENIIP); err != nil || owner != tt.owner {
+				t.Fatalf("got owner %s (%v), want %s", owner, err, tt.owner)
+			}
+			if owns, err := provider.CheckENIOwnership(ctx, testENIIP); err != nil || owns != (tt.owner == tt.instance) {
+				t.Fatalf("got ownership %t (%v), want %t", owns, err, tt.owner == tt.instance)
+			}
+			if epoch, eni, err := provider.GetEpochTag(ctx, testENIIP); err != nil || epoch != tt.epoch || eni != tt.eni {
+				t.Fatalf("got epoch %d on %s (%v), want %d on %s", epoch, eni, err, tt.epoch, tt.eni)
+			}
+		})
+	}
+
+	// Without an ENI of its own, an instance has no VPC to look in
+	if _, err := NewMemoryCloudProvider(cloud, "i-missing").GetENIByIP(ctx, testENIIP); err == nil {
+		t.Fatal("expected error for instance without an ENI")
+	}
+}
+
+func TestMemoryCloudFilters(t *testing.T) {
+	cloud := newTestCloud()
+	cloud.AddSubnet(CloudSubnet{ID: "subnet-2", VPCID: "vpc-2", CIDR: "10.0.1.0/24"})
+	cloud.AddENI(CloudENI{ID: "eni-c", InstanceID: "i-c", SubnetID: "subnet-2", PrimaryIP: "10.0.1.10", SecondaryIPs: []string{testENIIP}, Tags: map[string]string{"role": "failover"}})
+	cloud.AddRouteTable(CloudRouteTable{ID: "rtb-2", VPCID: "vpc-2", Tags: map[string]string{"role": "failover"}, Routes: map[string]string{"0.0.0.0/0": "eni-c"}})
+	cloud.AddEIP(CloudEIP{AllocationID: "eipalloc-1", PublicIP: "203.0.113.1", PrivateIP: testENIIP, ENI: "eni-a"})
+	cloud.AddEIP(CloudEIP{AllocationID: "eipalloc-2", PublicIP: "203.0.113.2", PrivateIP: "10.0.1.11"})
+	cloud.AddEIP(CloudEIP{AllocationID: "eipalloc-3", PublicIP: "203.0.113.3"})
+	cloud.AddEIP(CloudEIP{AllocationID: "eipalloc-4", PublicIP: "203.0.113.4", PrivateIP: testENIIP, ENI: "eni-c"})
+	provider := NewMemoryCloudProvider(cloud, "i-b")
+	ctx := context.Background()
+
+	enis := []struct {
+		name   string
+		filter ENIFilter
+		want   []string
+	}{
+		{name: "all", filter: ENIFilter{}, want: []string{"eni-a", "eni-b", "eni-c"}},
+		{name: "ids", filter: ENIFilter{IDs: []string{"eni-c", "eni-b"}}, want: []string{"eni-b", "eni-c"}},
+		{name: "tags", filter: ENIFilter{Tags: map[string]string{"role": "failover"}}, want: []string{"eni-c"}},
+		{name: "tag value", filter: ENIFilter{Tags: map[string]string{"role": "other"}}},
+		{name: "vpc", filter: ENIFilter{VPCID: "vpc-2"}, want: []string{"eni-c"}},
+		{name: "subnet", filter: ENIFilter{SubnetID: "subnet-1"}, want: []string{"eni-a", "eni-b"}},
+		{name: "primary IP", filter: ENIFilter{PrivateIP: "10.0.1.11"}, want: []string{"eni-b"}},
+		{name: "secondary IP", filter: ENIFilter{PrivateIP: testENIIP}, want: []string{"eni-a", "eni-c"}},
+		{name: "instance", filter: ENIFilter{InstanceID: "i-c"}, want: []string{"eni-c"}},
+		{name: "every field", filter: ENIFilter{SubnetID: "subnet-1", PrivateIP: testENIIP, InstanceID: "i-b"}},
+	}
+	for _, tt := range enis {
+		t.Run("enis "+tt.name, func(t *testing.T) {
+			got, err := provider.DescribeENIs(ctx, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := make([]string, 0, len(got))
+			for _, eni := range got {
+				ids = append(ids, eni.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Fatalf("got ENIs %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	routeTables := []struct {
+		name   string
+		filter RouteTableFilter
+		want   []string
+	}{
+		{name: "all", filter: RouteTableFilter{}, want: []string{"rtb-1", "rtb-2"}},
+		{name: "ids", filter: RouteTableFilter{IDs: []string{"rtb-2"}}, want: []string{"rtb-2"}},
+		{name: "tags", filter: RouteTableFilter{Tags: map[string]string{"role": "failover"}}, want: []string{"rtb-2"}},
+		{name: "vpc", filter: RouteTableFilter{VPCID: "vpc-1"}, want: []string{"rtb-1"}},
+		{name: "destination", filter: RouteTableFilter{DestinationCIDR: testDestinationCIDR}, want: []string{"rtb-1"}},
+		{name: "every field", filter: RouteTableFilter{VPCID: "vpc-2", DestinationCIDR: testDestinationCIDR}},
+	}
+	for _, tt := range routeTables {
+		t.Run("route tables "+tt.name, func(t *testing.T) {
+			got, err := provider.DescribeRouteTables(ctx, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := make([]string, 0, len(got))
+			for _, routeTable := range got {
+				ids = append(ids, routeTable.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Fatalf("got route tables %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	eips := []struct {
+		name   string
+		filter EIPFilter
+		want   []string
+	}{
+		{name: "all", filter: EIPFilter{}, want: []string{"eipalloc-1", "eipalloc-2", "eipalloc-3", "eipalloc-4"}},
+		{name: "allocation ids", filter: EIPFilter{AllocationIDs: []string{"eipalloc-3", "eipalloc-1"}}, want: []string{"eipalloc-1", "eipalloc-3"}},
+		{name: "private ips", filter: EIPFilter{PrivateIPs: []string{testENIIP, "10.0.1.11"}}, want: []string{"eipalloc-1", "eipalloc-2", "eipalloc-4"}},
+		{name: "enis", filter: EIPFilter{ENIs: []string{"eni-b", "eni-c"}}, want: []string{"eipalloc-2", "eipalloc-4"}},
+		{name: "private ip in vpc", filter: EIPFilter{PrivateIPs: []string{testENIIP}, ENIs: []string{"eni-a", "eni-b"}}, want: []string{"eipalloc-1"}},
+		{name: "every field", filter: EIPFilter{AllocationIDs: []string{"eipalloc-2", "eipalloc-3"}, PrivateIPs: []string{testENIIP, "10.0.1.11"}}, want: []string{"eipalloc-2"}},
+	}
+	for _, tt := range eips {
+		t.Run("eips "+tt.name, func(t *testing.T) {
+			got, err := provider.DescribeEIPs(ctx, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := make([]string, 0, len(got))
+			for _, eip := range got {
+				ids = append(ids, eip.AllocationID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Fatalf("got EIPs %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,636 @@
+package failover
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"strconv"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/loopholelabs/architect-networking/pkg/client"
+)
+
+// Wire formats of the NAT state carried in sync responses
+const (
+	// WireVersionV1 sends the NAT state as protocol messages with string addresses and timestamps
+	WireVersionV1 uint32 = 1
+
+	// WireVersionV2 sends the NAT state in the payload field using the compact binary encoding
+	WireVersionV2 uint32 = 2
+)
+
+// compactFormatVersion is the first byte of every compact encoded payload
+const compactFormatVersion = 2
+
+// zstdMaxDecodedSize bounds the memory a compressed payload may expand to
+const zstdMaxDecodedSize = 1 << 30
+
+var ErrInvalidCompactEncoding = errors.New("invalid compact NAT encoding")
+
+// The compact encoding of a NAT state is laid out as
+//
+//	version   byte (2)
+//	ips       uvarint count, addr...
+//	tables    4 x (uvarint count, entry...) in natTable order
+//	nat_ports uvarint count, bitmap pair...
+//
+// where an addr is a length byte (0, 4 or 16) followed by the address bytes, an entry is
+// destination addr, destination port, source addr, source port, last seen, translate addr
+// and translate port, ports are big endian uint16, last seen is big endian int64 nanoseconds,
+// and a bitmap pair is NAT addr, destination addr, last chunk and bitmap. Bitmaps are a
+// uvarint bit count followed by the bits packed most significant first.
+//
+// A delta is laid out the same way, except each table holds inserted entries, touched keys
+// with their last seen, and deleted keys, and the port bitmaps are followed by the
+// (NAT addr, destination addr) keys of deleted bitmaps.
+
+// MarshalNATStateV2 encodes a NAT state with the compact encoding. It fails if the state
+// holds a value that cannot be encoded losslessly, such as a non-numeric LastSeen.
+func MarshalNATStateV2(state *client.NATState) ([]byte, error) {
+	w := compactWriter{buf: make([]byte, 0, compactStateSizeHint(state))}
+	w.buf = append(w.buf, compactFormatVersion)
+
+	w.uvarint(uint64(len(state.IPs)))
+	for _, ip := range state.IPs {
+		w.addr(ip)
+	}
+	for _, table := range natTables(state) {
+		w.uvarint(uint64(len(*table)))
+		for _, kv := range *table {
+			w.entry(kv)
+		}
+	}
+	w.uvarint(uint64(len(state.NATPorts)))
+	for _, bp := range state.NATPorts {
+		w.bitmapPair(bp)
+	}
+
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w.buf, nil
+}
+
+// UnmarshalNATStateV2 decodes a NAT state encoded with MarshalNATStateV2
+func UnmarshalNATStateV2(data []byte) (*client.NATState, error) {
+	r := compactReader{buf: data}
+	r.header()
+
+	state := &client.NATState{}
+	state.IPs = make([]string, r.count(1))
+	for i := range state.IPs {
+		state.IPs[i] = r.addr()
+	}
+	for _, table := range natTables(state) {
+		*table = make([]client.NATKeyValuePair, r.count(compactEntryMinSize))
+		for i := range *table {
+			(*table)[i] = r.entry()
+		}
+	}
+	state.NATPorts = make([]client.NATBitmapPair, r.count(compactBitmapPairMinSize))
+	for i := range state.NATPorts {
+		state.NATPorts[i] = r.bitmapPair()
+	}
+
+	if err := r.finish(); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// marshalNATDeltaV2 encodes a delta with the compact encoding
+func marshalNATDeltaV2(d *natDelta) ([]byte, error) {
+	w := compactWriter{}
+	w.buf = append(w.buf, compactFormatVersion)
+
+	w.uvarint(uint64(len(d.ips)))
+	for _, ip := range d.ips {
+		w.addr(ip)
+	}
+
+	for i := range d.tables {
+		var inserts, touches, deletes []client.NATKey
+		for key, change := range d.tables[i] {
+			switch change.op {
+			case natChangeInsert:
+				inserts = append(inserts, key)
+			case natChangeTouch:
+				touches = append(touches, key)
+			case natChangeDelete:
+				deletes = append(deletes, key)
+			}
+		}
+
+		w.uvarint(uint64(len(inserts)))
+		for _, key := range inserts {
+			w.entry(client.NATKeyValuePair{Key: key, Value: d.tables[i][key].value})
+		}
+		w.uvarint(uint64(len(touches)))
+		for _, key := range touches {
+			w.key(key)
+			w.lastSeen(d.tables[i][key].value.LastSeen)
+		}
+		w.uvarint(uint64(len(deletes)))
+		for _, key := range deletes {
+			w.key(key)
+		}
+	}
+
+	var updates []client.NATBitmapPair
+	var deletes []natPortKey
+	for key, bp := range d.ports {
+		if bp == nil {
+			deletes = append(deletes, key)
+		} else {
+			updates = append(updates, *bp)
+		}
+	}
+	w.uvarint(uint64(len(updates)))
+	for _, bp := range updates {
+		w.bitmapPair(bp)
+	}
+	w.uvarint(uint64(len(deletes)))
+	for _, key := range deletes {
+		w.addr(key.natIP)
+		w.addr(key.destinationIP)
+	}
+
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w.buf, nil
+}
+
+// unmarshalNATDeltaV2 decodes a delta encoded with marshalNATDeltaV2
+func unmarshalNATDeltaV2(data []byte) (*natDelta, error) {
+	r := compactReader{buf: data}
+	r.header()
+
+	d := newNATDelta()
+	d.ips = make([]string, r.count(1))
+	for i := range d.ips {
+		d.ips[i] = r.addr()
+	}
+
+	for i := range d.tables {
+		for n := r.count(compactEntryMinSize); n > 0; n-- {
+			kv := r.entry()
+			d.tables[i][kv.Key] = natChange{op: natChangeInsert, value: kv.Value}
+		}
+		for n := r.count(compactKeyMinSize + 8); n > 0; n-- {
+			key := r.key()
+			d.tables[i][key] = natChange{op: natChangeTouch, value: client.NATValue{LastSeen: r.lastSeen()}}
+		}
+		for n := r.count(compactKeyMinSize); n > 0; n-- {
+			d.tables[i][r.key()] = natChange{op: natChangeDelete}
+		}
+	}
+
+	for n := r.count(compactBitmapPairMinSize); n > 0; n-- {
+		bp := r.bitmapPair()
+		d.ports[natPortKeyOf(bp)] = &bp
+	}
+	for n := r.count(2); n > 0; n-- {
+		key := natPortKey{natIP: r.addr()}
+		key.destinationIP = r.addr()
+		d.ports[key] = nil
+	}
+
+	if err := r.finish(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+var (
+	zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+		// Options are static, so creating the encoder cannot fail
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		return enc
+	})
+	zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+		dec, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(zstdMaxDecodedSize))
+		return dec
+	})
+)
+
+// compressPayload zstd compresses an encoded payload
+func compressPayload(data []byte) []byte {
+	return zstdEncoder().EncodeAll(data, make([]byte, 0, len(data)/4))
+}
+
+// decompressPayload reverses compressPayload
+func decompressPayload(data []byte) ([]byte, error) {
+	out, err := zstdDecoder().DecodeAll(data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress payload: %w", err)
+	}
+	return out, nil
+}
+
+// encodeNATStatePayload encodes a NAT state for a v2 response, compressing it if asked
+func encodeNATStatePayload(state *client.NATState, compress bool) ([]byte, error) {
+	data, err := MarshalNATStateV2(state)
+	if err != nil {
+		return nil, err
+	}
+	if compress {
+		data = compressPayload(data)
+	}
+	return data, nil
+}
+
+// decodeNATStatePayload decodes the NAT state in a v2 response payload
+func decodeNATStatePayload(data []byte, compressed bool) (*client.NATState, error) {
+	if compressed {
+		var err error
+		if data, err = decompressPayload(data); err != nil {
+			return nil, err
+		}
+	}
+	return UnmarshalNATStateV2(data)
+}
+
+// encodeNATDeltaPayload encodes a delta for a v2 response, compressing it if asked
+func encodeNATDeltaPayload(d *natDelta, compress bool) ([]byte, error) {
+	data, err := marshalNATDeltaV2(d)
+	if err != nil {
+		return nil, err
+	}
+	if compress {
+		data = compressPayload(data)
+	}
+	return data, nil
+}
+
+// decodeNATDeltaPayload decodes the delta in a v2 response payload
+func decodeNATDeltaPayload(data []byte, compressed bool) (*natDelta, error) {
+	if compressed {
+		var err error
+		if data, err = decompressPayload(data); err != nil {
+			return nil, err
+		}
+	}
+	return unmarshalNATDeltaV2(data)
+}
+
+// setSyncState fills in the full state of a sync response in the wire format the secondary
+// asked for. If the compact encoding cannot represent the state it falls back to v1 and
+// returns the encoding error.
+func setSyncState(response *FailoverSyncStateResponse, req *FailoverSyncStateRequest, state *client.NATState) error {
+	var err error
+	if req.WireVersion == WireVersionV2 {
+		var payload []byte
+		if payload, err = encodeNATStatePayload(state, req.Compress); err == nil {
+			response.WireVersion = WireVersionV2
+			response.Compressed = req.Compress
+			response.Payload = payload
+			return nil
+		}
+	}
+
+	response.WireVersion = WireVersionV1
+	response.State = natStateToFRPC(state)
+	return err
+}
+
+// setSyncDelta fills in the delta of a sync response in the wire format the secondary asked for,
+// falling back to v1 like setSyncState
+func setSyncDelta(response *FailoverSyncStateResponse, req *FailoverSyncStateRequest, d *natDelta) error {
+	var err error
+	if req.WireVersion == WireVersionV2 {
+		var payload []byte
+		if payload, err = encodeNATDeltaPayload(d, req.Compress); err == nil {
+			response.WireVersion = WireVersionV2
+			response.Compressed = req.Compress
+			response.Payload = payload
+			return nil
+		}
+	}
+
+	response.WireVersion = WireVersionV1
+	response.Delta = d.frpc()
+	return err
+}
+
+// setSyncChunkPage fills in the contents of a resync page in the wire format the secondary
+// asked for, falling back to v1 like setSyncState
+func setSyncChunkPage(response *FailoverSyncStateChunkResponse, req *FailoverSyncStateChunkRequest, page *client.NATState) error {
+	var err error
+	if req.WireVersion == WireVersionV2 {
+		var payload []byte
+		if payload, err = encodeNATStatePayload(page, req.Compress); err == nil {
+			response.WireVersion = WireVersionV2
+			response.Compressed = req.Compress
+			response.Payload = payload
+			return nil
+		}
+	}
+
+	response.WireVersion = WireVersionV1
+	response.Ips = page.IPs
+	for _, table := range natTables(page) {
+		for _, kv := range *table {
+			response.Entries = append(response.Entries, natKeyValueToFRPC(kv))
+		}
+	}
+	for _, bp := range page.NATPorts {
+		response.NatPorts = append(response.NatPorts, natBitmapPairToFRPC(bp))
+	}
+	return err
+}
+
+// syncResponseState returns the full state carried in a sync response
+func syncResponseState(response *FailoverSyncStateResponse) (*client.NATState, error) {
+	if response.WireVersion == WireVersionV2 {
+		return decodeNATStatePayload(response.Payload, response.Compressed)
+	}
+	if response.State == nil {
+		return nil, errors.New("primary returned empty state")
+	}
+	return natStateFromFRPC(response.State), nil
+}
+
+// syncResponseDelta returns the delta carried in a sync response
+func syncResponseDelta(response *FailoverSyncStateResponse) (*natDelta, error) {
+	if response.WireVersion == WireVersionV2 {
+		return decodeNATDeltaPayload(response.Payload, response.Compressed)
+	}
+	if response.Delta == nil {
+		return nil, errors.New("primary returned empty delta")
+	}
+	return natDeltaFromFRPC(response.Delta), nil
+}
+
+// syncChunkPage returns the contents of a resync page as a partial NAT state
+func syncChunkPage(chunk *FailoverSyncStateChunkResponse) (*client.NATState, error) {
+	if chunk.WireVersion == WireVersionV2 {
+		return decodeNATStatePayload(chunk.Payload, chunk.Compressed)
+	}
+
+	page := &client.NATState{IPs: chunk.Ips}
+	if chunk.Table < natTableCount {
+		table := natTables(page)[chunk.Table]
+		*table = make([]client.NATKeyValuePair, len(chunk.Entries))
+		for i, kv := range chunk.Entries {
+			(*table)[i] = natKeyValueFromFRPC(kv)
+		}
+	}
+	page.NATPorts = make([]client.NATBitmapPair, len(chunk.NatPorts))
+	for i, bp := range chunk.NatPorts {
+		page.NATPorts[i] = natBitmapPairFromFRPC(bp)
+	}
+	return page, nil
+}
+
+// Minimum encoded sizes, used to reject counts larger than the remaining input
+const (
+	compactKeyMinSize        = 1 + 2 + 1 + 2
+	compactEntryMinSize      = compactKeyMinSize + 8 + 1 + 2
+	compactBitmapPairMinSize = 1 + 1 + 2 + 1
+)
+
+// compactStateSizeHint estimates the encoded size of a state with IPv4 addresses
+func compactStateSizeHint(state *client.NATState) int {
+	entries := len(state.TCPInbound) + len(state.TCPOutbound) + len(state.UDPInbound) + len(state.UDPOutbound)
+	return 64 + 5*len(state.IPs) + (compactEntryMinSize+12)*entries + 16*len(state.NATPorts)
+}
+
+// compactWriter appends values in the compact encoding, keeping the first error
+type compactWriter struct {
+	buf []byte
+	err error
+}
+
+func (w *compactWriter) fail(format string, args ...any) {
+	if w.err == nil {
+		w.err = fmt.Errorf("%w: "+format, append([]any{ErrInvalidCompactEncoding}, args...)...)
+	}
+}
+
+func (w *compactWriter) uvarint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *compactWriter) uint16(v uint16) {
+	w.buf = binary.BigEndian.AppendUint16(w.buf, v)
+}
+
+// addr writes an IPv4 address as 4 bytes, an IPv6 address as 16 and an empty one as none
+func (w *compactWriter) addr(s string) {
+	if s == "" {
+		w.buf = append(w.buf, 0)
+		return
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil || addr.Zone() != "" || addr.String() != s {
+		// Only canonical addresses survive the round trip unchanged
+		w.fail("address %q is not canonical", s)
+		return
+	}
+
+	if addr.Is4() {
+		b := addr.As4()
+		w.buf = append(append(w.buf, 4), b[:]...)
+	} else {
+		b := addr.As16()
+		w.buf = append(append(w.buf, 16), b[:]...)
+	}
+}
+
+// lastSeen writes a decimal nanosecond timestamp as an int64
+func (w *compactWriter) lastSeen(s string) {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || strconv.FormatInt(v, 10) != s {
+		w.fail("last seen %q is not a canonical integer", s)
+		return
+	}
+	w.buf = binary.BigEndian.AppendUint64(w.buf, uint64(v))
+}
+
+// bitmap packs a string of '0' and '1' characters into bits
+func (w *compactWriter) bitmap(s string) {
+	w.uvarint(uint64(len(s)))
+	start := len(w.buf)
+	w.buf = append(w.buf, make([]byte, (len(s)+7)/8)...)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '1':
+			w.buf[start+i/8] |= 0x80 >> (i % 8)
+		case '0':
+		default:
+			w.fail("bitmap contains %q", s[i])
+			return
+		}
+	}
+}
+
+func (w *compactWriter) key(key client.NATKey) {
+	w.addr(key.DestinationIP)
+	w.uint16(key.DestinationPort)
+	w.addr(key.SourceIP)
+	w.uint16(key.SourcePort)
+}
+
+func (w *compactWriter) entry(kv client.NATKeyValuePair) {
+	w.key(kv.Key)
+	w.lastSeen(kv.Value.LastSeen)
+	w.addr(kv.Value.TranslateIP)
+	w.uint16(kv.Value.TranslatePort)
+}
+
+func (w *compactWriter) bitmapPair(bp client.NATBitmapPair) {
+	w.addr(bp.NATIP)
+	w.addr(natPortKeyOf(bp).destinationIP)
+	w.uint16(bp.LastChunk)
+	w.bitmap(bp.Bitmap)
+}
+
+// compactReader reads values in the compact encoding, keeping the first error.
+// Reads after an error return zero values.
+type compactReader struct {
+	buf []byte
+	err error
+}
+
+func (r *compactReader) fail(format string, args ...any) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: "+format, append([]any{ErrInvalidCompactEncoding}, args...)...)
+	}
+	r.buf = nil
+}
+
+func (r *compactReader) next(n int) []byte {
+	if len(r.buf) < n {
+		r.fail("unexpected end of data")
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *compactReader) header() {
+	if b := r.next(1); b != nil && b[0] != compactFormatVersion {
+		r.fail("unsupported format version %d", b[0])
+	}
+}
+
+// finish reports the first error, or trailing data left after decoding
+func (r *compactReader) finish() error {
+	if r.err == nil && len(r.buf) > 0 {
+		r.fail("%d trailing bytes", len(r.buf))
+	}
+	return r.err
+}
+
+func (r *compactReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.fail("invalid varint")
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+// count reads a collection length, rejecting lengths the remaining data cannot hold
+func (r *compactReader) count(minSize int) int {
+	n := r.uvarint()
+	if n > uint64(len(r.buf)/minSize) {
+		r.fail("count %d exceeds remaining data", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (r *compactReader) uint16() uint16 {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (r *compactReader) addr() string {
+	n := r.next(1)
+	if n == nil {
+		return ""
+	}
+	switch n[0] {
+	case 0:
+		return ""
+	case 4:
+		if b := r.next(4); b != nil {
+			return netip.AddrFrom4([4]byte(b)).String()
+		}
+	case 16:
+		if b := r.next(16); b != nil {
+			return netip.AddrFrom16([16]byte(b)).String()
+		}
+	default:
+		r.fail("invalid address length %d", n[0])
+	}
+	return ""
+}
+
+func (r *compactReader) lastSeen() string {
+	b := r.next(8)
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatInt(int64(binary.BigEndian.Uint64(b)), 10)
+}
+
+func (r *compactReader) bitmap() string {
+	bits := r.uvarint()
+	if bits > math.MaxInt32 || (bits+7)/8 > uint64(len(r.buf)) {
+		r.fail("bitmap length %d exceeds remaining data", bits)
+		return ""
+	}
+	packed := r.next(int((bits + 7) / 8))
+
+	s := make([]byte, bits)
+	for i := range s {
+		s[i] = '0'
+		if packed[i/8]&(0x80>>(i%8)) != 0 {
+			s[i] = '1'
+		}
+	}
+	return string(s)
+}
+
+func (r *compactReader) key() client.NATKey {
+	return client.NATKey{
+		DestinationIP:   r.addr(),
+		DestinationPort: r.uint16(),
+		SourceIP:        r.addr(),
+		SourcePort:      r.uint16(),
+	}
+}
+
+func (r *compactReader) entry() client.NATKeyValuePair {
+	return client.NATKeyValuePair{
+		Key: r.key(),
+		Value: client.NATValue{
+			LastSeen:      r.lastSeen(),
+			TranslateIP:   r.addr(),
+			TranslatePort: r.uint16(),
+		},
+	}
+}
+
+func (r *compactReader) bitmapPair() client.NATBitmapPair {
+	bp := client.NATBitmapPair{NATIP: r.addr()}
+	if dest := r.addr(); dest != "" {
+		bp.DestinationIP = &dest
+	}
+	bp.LastChunk = r.uint16()
+	bp.Bitmap = r.bitmap()
+	return bp
+}
@@ -0,0 +1,314 @@
+package failover
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/loopholelabs/polyglot/v2"
+
+	"github.com/loopholelabs/architect-networking/pkg/client"
+)
+
+// testNATState builds a NAT state with entries spread over the four tables, a few of them
+// with IPv6 addresses, and port bitmaps with and without a destination
+func testNATState(entries int) *client.NATState {
+	state := &client.NATState{
+		IPs: []string{"203.0.113.1", "203.0.113.2", "2001:db8::1"},
+	}
+
+	tables := natTables(state)
+	for i := range entries {
+		destination := fmt.Sprintf("198.51.%d.%d", i/250%250, i%250+1)
+		source := fmt.Sprintf("10.0.%d.%d", i/250%250, i%250+1)
+		translate := state.IPs[i%2]
+		if i%100 == 99 {
+			destination, source, translate = "2001:db8:1::"+strconv.Itoa(i), "fd00::"+strconv.Itoa(i), state.IPs[2]
+		}
+
+		table := tables[i%natTableCount]
+		*table = append(*table, client.NATKeyValuePair{
+			Key: client.NATKey{
+				DestinationIP:   destination,
+				DestinationPort: uint16(443 + i%3),
+				SourceIP:        source,
+				SourcePort:      uint16(1024 + i%60000),
+			},
+			Value: client.NATValue{
+				LastSeen:      strconv.FormatInt(1_760_000_000_000_000_000+int64(i)*1_000_003, 10),
+				TranslateIP:   translate,
+				TranslatePort: uint16(20000 + i%40000),
+			},
+		})
+	}
+
+	destination := "198.51.100.7"
+	state.NATPorts = []client.NATBitmapPair{
+		{NATIP: state.IPs[0], Bitmap: strings.Repeat("1100101", 147), LastChunk: 3},
+		{NATIP: state.IPs[1], DestinationIP: &destination, Bitmap: strings.Repeat("0", 63) + "1", LastChunk: 1},
+	}
+
+	return state
+}
+
+// natStatesEqual compares two NAT states, treating empty and missing lists alike
+func natStatesEqual(a, b *client.NATState) bool {
+	if !slices.Equal(a.IPs, b.IPs) {
+		return false
+	}
+	tablesA, tablesB := natTables(a), natTables(b)
+	for i := range tablesA {
+		if !slices.Equal(*tablesA[i], *tablesB[i]) {
+			return false
+		}
+	}
+	return slices.EqualFunc(a.NATPorts, b.NATPorts, func(x, y client.NATBitmapPair) bool {
+		return natPortKeyOf(x) == natPortKeyOf(y) && x.Bitmap == y.Bitmap && x.LastChunk == y.LastChunk
+	})
+}
+
+// natDeltasEqual compares two deltas, treating empty and missing lists alike
+func natDeltasEqual(a, b *natDelta) bool {
+	if !slices.Equal(a.ips, b.ips) {
+		return false
+	}
+	for i := range a.tables {
+		if !maps.Equal(a.tables[i], b.tables[i]) {
+			return false
+		}
+	}
+	return maps.EqualFunc(a.ports, b.ports, func(x, y *client.NATBitmapPair) bool {
+		if x == nil || y == nil {
+			return x == y
+		}
+		return natPortKeyOf(*x) == natPortKeyOf(*y) && x.Bitmap == y.Bitmap && x.LastChunk == y.LastChunk
+	})
+}
+
+// testNATDelta builds a delta holding every kind of change
+func testNATDelta() *natDelta {
+	state := testNATState(40)
+	d := newNATDelta()
+	d.ips = state.IPs
+
+	for i, table := range natTables(state) {
+		for j, kv := range *table {
+			switch j % 3 {
+			case 0:
+				d.tables[i][kv.Key] = natChange{op: natChangeInsert, value: kv.Value}
+			case 1:
+				d.tables[i][kv.Key] = natChange{op: natChangeTouch, value: client.NATValue{LastSeen: kv.Value.LastSeen}}
+			case 2:
+				d.tables[i][kv.Key] = natChange{op: natChangeDelete}
+			}
+		}
+	}
+
+	d.ports[natPortKeyOf(state.NATPorts[0])] = &state.NATPorts[0]
+	d.ports[natPortKeyOf(state.NATPorts[1])] = nil
+
+	return d
+}
+
+// roundTripSyncResponse sends a sync response through its wire encoding
+func roundTripSyncResponse(t *testing.T, response *FailoverSyncStateResponse) *FailoverSyncStateResponse {
+	t.Helper()
+
+	buf := polyglot.NewBuffer()
+	response.Encode(buf)
+
+	decoded := &FailoverSyncStateResponse{}
+	if err := decoded.Decode(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+// testWireFormats are the wire formats a secondary may ask for
+var testWireFormats = []struct {
+	name     string
+	version  uint32
+	compress bool
+}{
+	{name: "v1", version: WireVersionV1},
+	{name: "v2", version: WireVersionV2},
+	{name: "v2 zstd", version: WireVersionV2, compress: true},
+}
+
+func TestSyncStateRoundTrip(t *testing.T) {
+	state := testNATState(1000)
+
+	for _, format := range testWireFormats {
+		t.Run(format.name, func(t *testing.T) {
+			req := &FailoverSyncStateRequest{WireVersion: format.version, Compress: format.compress}
+			response := &FailoverSyncStateResponse{}
+			if err := setSyncState(response, req, state); err != nil {
+				t.Fatal(err)
+			}
+			if response.WireVersion != format.version || response.Compressed != format.compress {
+				t.Fatalf("got wire version %d compressed %t", response.WireVersion, response.Compressed)
+			}
+
+			decoded, err := syncResponseState(roundTripSyncResponse(t, response))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !natStatesEqual(decoded, state) {
+				t.Fatal("decoded state differs from the original")
+			}
+		})
+	}
+}
+
+func TestSyncStateCrossVersion(t *testing.T) {
+	state := testNATState(200)
+
+	// A state decoded from either version encodes to the same bytes in the other
+	v1 := &FailoverSyncStateResponse{}
+	if err := setSyncState(v1, &FailoverSyncStateRequest{WireVersion: WireVersionV1}, state); err != nil {
+		t.Fatal(err)
+	}
+	fromV1, err := syncResponseState(roundTripSyncResponse(t, v1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := MarshalNATStateV2(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := MarshalNATStateV2(fromV1); err != nil || string(got) != string(want) {
+		t.Fatalf("v2 encoding of the state decoded from v1 differs: %v", err)
+	}
+
+	fromV2, err := UnmarshalNATStateV2(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !natStatesEqual(natStateFromFRPC(natStateToFRPC(fromV2)), natStateFromFRPC(v1.State)) {
+		t.Fatal("v1 representation of the state decoded from v2 differs")
+	}
+}
+
+func TestSyncStateFallsBackToV1(t *testing.T) {
+	state := testNATState(8)
+	state.TCPInbound[0].Value.LastSeen = "2025-10-16T00:00:00Z"
+
+	response := &FailoverSyncStateResponse{}
+	if err := setSyncState(response, &FailoverSyncStateRequest{WireVersion: WireVersionV2, Compress: true}, state); err == nil {
+		t.Fatal("encoding a non-numeric last seen in v2 succeeded")
+	}
+	if response.WireVersion != WireVersionV1 || response.Compressed {
+		t.Fatalf("got wire version %d compressed %t, want uncompressed v1", response.WireVersion, response.Compressed)
+	}
+
+	decoded, err := syncResponseState(roundTripSyncResponse(t, response))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !natStatesEqual(decoded, state) {
+		t.Fatal("decoded state differs from the original")
+	}
+}
+
+func TestSyncDeltaRoundTrip(t *testing.T) {
+	d := testNATDelta()
+
+	for _, format := range testWireFormats {
+		t.Run(format.name, func(t *testing.T) {
+			req := &FailoverSyncStateRequest{WireVersion: format.version, Compress: format.compress}
+			response := &FailoverSyncStateResponse{}
+			if err := setSyncDelta(response, req, d); err != nil {
+				t.Fatal(err)
+			}
+
+			decoded, err := syncResponseDelta(roundTripSyncResponse(t, response))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !natDeltasEqual(decoded, d) {
+				t.Fatal("decoded delta differs from the original")
+			}
+		})
+	}
+}
+
+func TestUnmarshalNATStateV2Rejects(t *testing.T) {
+	data, err := MarshalNATStateV2(testNATState(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]byte{
+		"empty":           nil,
+		"unknown version": append([]byte{compactFormatVersion + 1}, data[1:]...),
+		"truncated":       data[:len(data)-1],
+		"trailing data":   append(slices.Clone(data), 0),
+		"oversized count": {compactFormatVersion, 0xff, 0xff, 0xff, 0xff, 0x0f},
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := UnmarshalNATStateV2(input); err == nil {
+				t.Fatal("decoding succeeded")
+			}
+		})
+	}
+
+	// A payload flagged as compressed that is not zstd
+	if _, err := decodeNATStatePayload(data, true); err == nil {
+		t.Fatal("decoding an uncompressed payload as zstd succeeded")
+	}
+}
+
+func BenchmarkSyncStateEncoding(b *testing.B) {
+	const entries = 10000
+	state := testNATState(entries)
+
+	for _, format := range testWireFormats {
+		b.Run(format.name, func(b *testing.B) {
+			req := &FailoverSyncStateRequest{WireVersion: format.version, Compress: format.compress}
+			buf := polyglot.NewBuffer()
+
+			b.ReportAllocs()
+			for b.Loop() {
+				response := &FailoverSyncStateResponse{}
+				if err := setSyncState(response, req, state); err != nil {
+					b.Fatal(err)
+				}
+				buf.Reset()
+				response.Encode(buf)
+			}
+			b.ReportMetric(float64(buf.Len())/entries, "bytes/entry")
+		})
+	}
+}
+
+func BenchmarkSyncStateDecoding(b *testing.B) {
+	const entries = 10000
+	state := testNATState(entries)
+
+	for _, format := range testWireFormats {
+		b.Run(format.name, func(b *testing.B) {
+			response := &FailoverSyncStateResponse{}
+			if err := setSyncState(response, &FailoverSyncStateRequest{WireVersion: format.version, Compress: format.compress}, state); err != nil {
+				b.Fatal(err)
+			}
+			buf := polyglot.NewBuffer()
+			response.Encode(buf)
+
+			b.ReportAllocs()
+			for b.Loop() {
+				decoded := &FailoverSyncStateResponse{}
+				if err := decoded.Decode(buf.Bytes()); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := syncResponseState(decoded); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(buf.Len())/entries, "bytes/entry")
+		})
+	}
+}
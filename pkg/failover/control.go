@@ -0,0 +1,477 @@
+package failover
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	metrics "github.com/hashicorp/go-metrics/compat"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// controlShutdownTimeout bounds how long in-flight control requests may take when the daemon stops
+const controlShutdownTimeout = 5 * time.Second
+
+var ErrControlRequest = errors.New("control request failed")
+
+// DefaultControlSocket returns the control socket of a daemon using the default state directory
+func DefaultControlSocket() string {
+	return controlSocketIn(defaultStateDir())
+}
+
+// controlSocketIn returns the control socket multiaddr for a state directory
+func controlSocketIn(stateDir string) string {
+	return "/unix" + filepath.Join(stateDir, "control.sock")
+}
+
+// ControlStatus is the state of a running failover daemon as served by the control API
+type ControlStatus struct {
+	Role        string `json:"role"`
+	InstanceID  string `json:"instance_id"`
+	ENI         string `json:"eni,omitempty"`
+	Epoch       uint64 `json:"epoch"`
+	Maintenance bool   `json:"maintenance"`
+
+	// Role transition state machine and its recent transitions, oldest first
+	State        string            `json:"state"`
+	StateHistory []StateTransition `json:"state_history,omitempty"`
+
+	// Role transition policy and damping state
+	Priority       uint32    `json:"priority"`
+	Preempt        bool      `json:"preempt"`
+	LastTransition time.Time `json:"last_transition,omitzero"`
+	FrozenUntil    time.Time `json:"frozen_until,omitzero"`
+
+	// Failover configuration, so tooling can check AWS agrees with the daemon
+	ENIIP           string           `json:"eni_ip"`
+	DestinationCIDR string           `json:"destination_cidr,omitempty"`
+	Selector        ResourceSelector `json:"selector"`
+
+	// Heartbeats sent (primary) or received (secondary)
+	LastHeartbeat    time.Time `json:"last_heartbeat,omitzero"`
+	MissedHeartbeats int       `json:"missed_heartbeats"`
+
+	// fRPC address of the other node: the registered secondary (primary) or the primary (secondary)
+	PeerAddr string `json:"peer_addr,omitempty"`
+
+	// Heartbeats over each path to the other node, when peer addresses are configured
+	HeartbeatPaths []PathStats `json:"heartbeat_paths,omitempty"`
+
+	// Phi accrual failure detector state, when it is used (secondary only)
+	Phi *PhiStats `json:"phi,omitempty"`
+
+	// BFD sessions with each path to the other node, when BFD liveness is used
+	BFDSessions []BFDSessionStats `json:"bfd_sessions,omitempty"`
+
+	// Last successful NAT state sync from the primary (secondary only)
+	LastSync *SyncResult `json:"last_sync,omitempty"`
+
+	// Result of the last run of the failover actions (primary only)
+	LastFailoverAction *FailoverActionResult `json:"last_failover_action,omitempty"`
+
+	// When the primary last checked its routes, floating IPs and EIPs for drift, and the
+	// recent corrections, oldest first
+	LastReconcile    time.Time         `json:"last_reconcile,omitzero"`
+	DriftCorrections []DriftCorrection `json:"drift_corrections,omitempty"`
+
+	// Result of the last Conduit health probe, when the probe is enabled
+	Health *HealthResult `json:"health,omitempty"`
+}
+
+// SyncResult describes a successful NAT state sync
+type SyncResult struct {
+	Time    time.Time `json:"time"`
+	Full    bool      `json:"full"`
+	Version uint64    `json:"version"`
+	Entries int       `json:"entries"`
+}
+
+// FailoverActionResult describes a run of the AWS failover actions
+type FailoverActionResult struct {
+	Time    time.Time `json:"time"`
+	Success bool      `json:"success"`
+	ENI     string    `json:"eni,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// controlMaintenanceRequest is the body of a maintenance mode command
+type controlMaintenanceRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// controlSwitchoverRequest is the body of a planned switchover command
+type controlSwitchoverRequest struct {
+	Role string `json:"role"`
+}
+
+// SwitchoverResult is the outcome of a planned switchover
+type SwitchoverResult struct {
+	PrimaryInstanceID string `json:"primary_instance_id"`
+	Epoch             uint64 `json:"epoch"`
+}
+
+// controlError is the body of a failed control request
+type controlError struct {
+	Error string `json:"error"`
+}
+
+// controlServer serves the control API on a local unix socket
+type controlServer struct {
+	lf       *LeaderFailover
+	server   *http.Server
+	listener net.Listener
+}
+
+// startControlServer listens on the configured control socket and serves the control API
+func (lf *LeaderFailover) startControlServer() error {
+	maddr, err := multiaddr.NewMultiaddr(lf.config.ControlSocket)
+	if err != nil {
+		return fmt.Errorf("%w %s: %w", ErrParsingMultiaddr, lf.config.ControlSocket, err)
+	}
+
+	// Remove a socket left behind by a previous run
+	path, err := maddr.ValueForProtocol(multiaddr.P_UNIX)
+	if err == nil {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return fmt.Errorf("failed to create control socket directory: %w", err)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale control socket: %w", err)
+		}
+	}
+
+	// Control commands change how the daemon fails over, only the owner may use them, from
+	// the moment the socket exists
+	listener, err := listenPrivate(maddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on control socket %s: %w", lf.config.ControlSocket, err)
+	}
+	if path != "" {
+		if err := os.Chmod(path, 0o600); err != nil {
+			_ = listener.Close()
+			return fmt.Errorf("failed to restrict control socket permissions: %w", err)
+		}
+	}
+
+	cs := &controlServer{
+		lf:       lf,
+		listener: manet.NetListener(listener),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/status", cs.handleStatus)
+	mux.HandleFunc("POST /v1/maintenance", cs.handleMaintenance)
+	mux.HandleFunc("POST /v1/resync", cs.handleResync)
+	mux.HandleFunc("POST /v1/switchover", cs.handleSwitchover)
+	mux.HandleFunc("GET /v1/metrics", cs.handleMetrics)
+	cs.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		if err := cs.server.Serve(cs.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			lf.logger.Error().Err(err).Msg("Control server failed")
+		}
+	}()
+
+	lf.control = cs
+
+	lf.logger.Info().Str("control_socket", lf.config.ControlSocket).Msg("Control API listening")
+
+	return nil
+}
+
+// stopControlServer stops serving the control API
+func (lf *LeaderFailover) stopControlServer() error {
+	if lf.control == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), controlShutdownTimeout)
+	defer cancel()
+
+	err := lf.control.server.Shutdown(ctx)
+	lf.control = nil
+	if err != nil {
+		return fmt.Errorf("failed to stop control server: %w", err)
+	}
+	return nil
+}
+
+// Status returns the current state of the daemon
+func (lf *LeaderFailover) Status() ControlStatus {
+	heartbeats := lf.GetHeartbeatStats()
+
+	status := ControlStatus{
+		Role:             lf.currentRole.Load().String(),
+		InstanceID:       lf.instanceID(),
+		ENI:              lf.currentENI.Load(),
+		Epoch:            lf.epochs.current(),
+		Maintenance:      lf.maintenance.Load(),
+		State:            lf.currentState().String(),
+		StateHistory:     lf.stateHistorySnapshot(),
+		Priority:         lf.config.Priority,
+		Preempt:          lf.config.Preempt,
+		LastTransition:   lf.lastTransitionTime(),
+		FrozenUntil:      lf.frozenUntilTime(),
+		ENIIP:            lf.config.ENIIP,
+		DestinationCIDR:  lf.config.DestinationCIDR,
+		LastHeartbeat:    heartbeats.LastHeartbeat,
+		MissedHeartbeats: heartbeats.MissedHeartbeats,
+		PeerAddr:         cmp.Or(heartbeats.PeerAddr, lf.preferredPeerPath()),
+		HeartbeatPaths:   heartbeats.Paths,
+		Phi:              heartbeats.Phi,
+		BFDSessions:      lf.bfdSessionStats(),
+	}
+	if lf.currentRole.Load() == RoleSecondary {
+		status.PeerAddr = lf.primaryAddr()
+	}
+	status.Selector, _ = lf.config.ResourceSelector() // checked by Validate
+	status.LastReconcile, status.DriftCorrections = lf.reconcileStatus()
+
+	lf.statusMutex.Lock()
+	if lf.lastSync != nil {
+		lastSync := *lf.lastSync
+		status.LastSync = &lastSync
+	}
+	if lf.lastFailoverAction != nil {
+		lastAction := *lf.lastFailoverAction
+		status.LastFailoverAction = &lastAction
+	}
+	if lf.lastHealth != nil {
+		health := *lf.lastHealth
+		status.Health = &health
+	}
+	lf.statusMutex.Unlock()
+
+	return status
+}
+
+// SetMaintenance enables or disables maintenance mode. In maintenance mode the node keeps its
+// current role: a secondary does not promote itself and a primary keeps holding leadership.
+// Planned switchovers are still allowed.
+func (lf *LeaderFailover) SetMaintenance(enabled bool) {
+	if lf.maintenance.Swap(enabled) == enabled {
+		return
+	}
+	lf.logger.Warn().
+		Bool("maintenance", enabled).
+		Str("role", lf.currentRole.Load().String()).
+		Msg("Maintenance mode changed")
+}
+
+// ForceResync discards the mirrored NAT state and pages the full state from the primary
+func (lf *LeaderFailover) ForceResync(ctx context.Context) error {
+	if lf.currentRole.Load() != RoleSecondary {
+		return fmt.Errorf("node is %s, only a secondary syncs from the primary", lf.currentRole.Load())
+	}
+
+	lf.syncMutex.Lock()
+	lf.mirror.reset()
+	lf.syncMutex.Unlock()
+
+	lf.logger.Info().Msg("Forcing full NAT state resync")
+
+	return lf.syncFromPrimary(ctx)
+}
+
+// recordSync records a successful sync of the mirror, the caller holds syncMutex
+func (lf *LeaderFailover) recordSync(full bool) {
+	result := &SyncResult{
+		Time:    time.Now(),
+		Full:    full,
+		Version: lf.mirror.version,
+	}
+	if lf.mirror.snapshot != nil {
+		result.Entries = lf.mirror.snapshot.entries()
+	}
+
+	lf.statusMutex.Lock()
+	lf.lastSync = result
+	lf.statusMutex.Unlock()
+}
+
+// recordFailoverAction records the outcome of the failover actions
+func (lf *LeaderFailover) recordFailoverAction(err error) {
+	result := &FailoverActionResult{
+		Time:    time.Now(),
+		Success: err == nil,
+		ENI:     lf.currentENI.Load(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	lf.statusMutex.Lock()
+	lf.lastFailoverAction = result
+	lf.statusMutex.Unlock()
+}
+
+func (cs *controlServer) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	writeControlJSON(w, http.StatusOK, cs.lf.Status())
+}
+
+func (cs *controlServer) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req controlMaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeControlJSON(w, http.StatusBadRequest, controlError{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	cs.lf.SetMaintenance(req.Enabled)
+	writeControlJSON(w, http.StatusOK, cs.lf.Status())
+}
+
+func (cs *controlServer) handleResync(w http.ResponseWriter, r *http.Request) {
+	if err := cs.lf.ForceResync(r.Context()); err != nil {
+		writeControlJSON(w, http.StatusConflict, controlError{Error: err.Error()})
+		return
+	}
+
+	writeControlJSON(w, http.StatusOK, cs.lf.Status())
+}
+
+func (cs *controlServer) handleSwitchover(w http.ResponseWriter, r *http.Request) {
+	var req controlSwitchoverRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeControlJSON(w, http.StatusBadRequest, controlError{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+	if req.Role != RoleStringPrimary && req.Role != RoleStringSecondary {
+		writeControlJSON(w, http.StatusBadRequest, controlError{Error: fmt.Sprintf("role must be '%s' or '%s', got: %s", RoleStringPrimary, RoleStringSecondary, req.Role)})
+		return
+	}
+
+	primaryInstanceID, epoch, err := cs.lf.SwitchRole(r.Context(), req.Role)
+	if err != nil {
+		writeControlJSON(w, http.StatusConflict, controlError{Error: err.Error()})
+		return
+	}
+
+	writeControlJSON(w, http.StatusOK, SwitchoverResult{PrimaryInstanceID: primaryInstanceID, Epoch: epoch})
+}
+
+func (cs *controlServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	summary, err := cs.lf.metrics.DisplayMetrics(w, r)
+	if err != nil {
+		writeControlJSON(w, http.StatusInternalServerError, controlError{Error: err.Error()})
+		return
+	}
+
+	writeControlJSON(w, http.StatusOK, summary)
+}
+
+func writeControlJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// ControlClient talks to the control API of a failover daemon on this host
+type ControlClient struct {
+	http *http.Client
+}
+
+// NewControlClient creates a client for the control API on the given unix socket multiaddr
+func NewControlClient(socket string) (*ControlClient, error) {
+	httpClient, err := createUnixSocketClient(socket)
+	if err != nil {
+		return nil, err
+	}
+	// A forced resync pages the whole NAT table and a switchover waits for the roles to flip,
+	// callers bound requests with their context
+	httpClient.Timeout = 0
+
+	return &ControlClient{http: httpClient}, nil
+}
+
+// Status returns the state of the daemon
+func (c *ControlClient) Status(ctx context.Context) (*ControlStatus, error) {
+	return c.do(ctx, http.MethodGet, "/v1/status", nil)
+}
+
+// SetMaintenance enables or disables maintenance mode on the daemon
+func (c *ControlClient) SetMaintenance(ctx context.Context, enabled bool) (*ControlStatus, error) {
+	return c.do(ctx, http.MethodPost, "/v1/maintenance", controlMaintenanceRequest{Enabled: enabled})
+}
+
+// Resync makes the daemon discard its NAT state mirror and resync in full from the primary
+func (c *ControlClient) Resync(ctx context.Context) (*ControlStatus, error) {
+	return c.do(ctx, http.MethodPost, "/v1/resync", nil)
+}
+
+// Switchover asks the daemon to take over (RolePrimary) or hand over (RoleSecondary) the
+// primary role, returning once the roles have flipped
+func (c *ControlClient) Switchover(ctx context.Context, role NodeRole) (*SwitchoverResult, error) {
+	var result SwitchoverResult
+	if err := c.doJSON(ctx, http.MethodPost, "/v1/switchover", controlSwitchoverRequest{Role: role.String()}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Metrics returns the metrics the daemon aggregated over the last intervals
+func (c *ControlClient) Metrics(ctx context.Context) (*metrics.MetricsSummary, error) {
+	var summary metrics.MetricsSummary
+	if err := c.doJSON(ctx, http.MethodGet, "/v1/metrics", nil, &summary); err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+func (c *ControlClient) do(ctx context.Context, method, path string, body any) (*ControlStatus, error) {
+	var status ControlStatus
+	if err := c.doJSON(ctx, method, path, body, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (c *ControlClient) doJSON(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode control request: %w", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, "http://localhost"+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create control request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrControlRequest, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure controlError
+		if err := json.NewDecoder(resp.Body).Decode(&failure); err != nil || failure.Error == "" {
+			return fmt.Errorf("%w: status %d", ErrControlRequest, resp.StatusCode)
+		}
+		return fmt.Errorf("%w: %s", ErrControlRequest, failure.Error)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode control response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package failover
+
+import (
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// listenPrivate listens on the multiaddr, leaving the socket to be restricted afterwards on
+// platforms without a umask
+func listenPrivate(maddr multiaddr.Multiaddr) (manet.Listener, error) {
+	return manet.Listen(maddr)
+}
@@ -0,0 +1,137 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// startTestControl serves the control API of lf on a socket in a temporary directory and
+// returns a client for it and the socket path
+func startTestControl(t *testing.T, lf *LeaderFailover) (*ControlClient, string) {
+	t.Helper()
+
+	path := filepath.Join(socketDir(t), "control.sock")
+	lf.config.ControlSocket = "/unix" + path
+	if err := lf.startControlServer(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = lf.stopControlServer() })
+
+	c, err := NewControlClient(lf.config.ControlSocket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c, path
+}
+
+func TestControlSocketPermissions(t *testing.T) {
+	lf := newTestFailover(t, newTestCloud(), "i-a", nil)
+	_, path := startTestControl(t, lf)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		t.Fatalf("control socket %s is not a socket: %s", path, info.Mode())
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Fatalf("control socket mode: got %o, want 600", mode)
+	}
+
+	// A socket left behind by a previous run is replaced
+	if err := lf.stopControlServer(); err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.startControlServer(); err != nil {
+		t.Fatalf("restart over a stale socket: %v", err)
+	}
+}
+
+func TestControlStatusAndMaintenance(t *testing.T) {
+	ctx := context.Background()
+	lf := newTestFailover(t, newTestCloud(), "i-a", func(config *LeaderConfig) {
+		config.Priority = 200
+	})
+	lf.currentRole.Store(RolePrimary)
+	lf.currentENI.Store("eni-a")
+	c, _ := startTestControl(t, lf)
+
+	status, err := c.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Role != RoleStringPrimary || status.InstanceID != "i-a" || status.ENI != "eni-a" || status.ENIIP != testENIIP || status.Priority != 200 || status.Maintenance {
+		t.Fatalf("status: got %+v", status)
+	}
+
+	status, err = c.SetMaintenance(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Maintenance || !lf.maintenance.Load() {
+		t.Fatalf("maintenance: status reports %t and node has %t, want enabled", status.Maintenance, lf.maintenance.Load())
+	}
+
+	status, err = c.SetMaintenance(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Maintenance || lf.maintenance.Load() {
+		t.Fatal("maintenance still enabled after disabling it")
+	}
+}
+
+func TestControlResync(t *testing.T) {
+	ctx := context.Background()
+	pair := newSwitchoverPair(t, nil)
+
+	// Only a secondary syncs from the primary
+	c, _ := startTestControl(t, pair.primary)
+	if _, err := c.Resync(ctx); !errors.Is(err, ErrControlRequest) || !strings.Contains(err.Error(), "only a secondary") {
+		t.Fatalf("resync on the primary: got %v, want a refusal", err)
+	}
+	resp, err := c.http.Post("http://localhost/v1/resync", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("resync on the primary: got status %d, want %d", resp.StatusCode, http.StatusConflict)
+	}
+
+	c, _ = startTestControl(t, pair.secondary)
+	status, err := c.Resync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.LastSync == nil || !status.LastSync.Full || status.LastSync.Entries != 1 {
+		t.Fatalf("last sync after a resync: got %+v, want a full sync of 1 entry", status.LastSync)
+	}
+	requireFlows(t, pair.secondaryNAT.NATState(), 0)
+}
+
+func TestControlSwitchover(t *testing.T) {
+	ctx := context.Background()
+	pair := newSwitchoverPair(t, nil)
+	c, _ := startTestControl(t, pair.secondary)
+
+	if _, err := c.Switchover(ctx, RoleUnknown); !errors.Is(err, ErrControlRequest) || !strings.Contains(err.Error(), "role must be") {
+		t.Fatalf("switchover to an unknown role: got %v, want a refusal", err)
+	}
+
+	result, err := c.Switchover(ctx, RolePrimary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.PrimaryInstanceID != "i-b" || result.Epoch != pair.secondary.epochs.leader() {
+		t.Fatalf("switchover reports primary %s at epoch %d, want i-b at %d", result.PrimaryInstanceID, result.Epoch, pair.secondary.epochs.leader())
+	}
+	pair.requireRoles(t, RoleSecondary, RolePrimary)
+}
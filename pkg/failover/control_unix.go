@@ -0,0 +1,26 @@
+//go:build unix
+
+package failover
+
+import (
+	"sync"
+	"syscall"
+
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// umaskMu serialises changes to the process umask
+var umaskMu sync.Mutex
+
+// listenPrivate listens on the multiaddr with a umask that keeps a unix socket from ever
+// being accessible to anyone but the owner. The umask is process wide, so files created
+// meanwhile by other goroutines are at most more restricted than they would have been.
+func listenPrivate(maddr multiaddr.Multiaddr) (manet.Listener, error) {
+	umaskMu.Lock()
+	defer umaskMu.Unlock()
+
+	umask := syscall.Umask(0o077)
+	defer syscall.Umask(umask)
+	return manet.Listen(maddr)
+}
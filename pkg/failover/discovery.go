@@ -0,0 +1,370 @@
+package failover
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// Kinds of resources a failover pair manages
+const (
+	ResourceENI        = "eni"
+	ResourceFloatingIP = "floating_ip"
+	ResourceRouteTable = "route_table"
+)
+
+// ResourceSelector picks the ENIs, floating IPs and route tables a failover pair manages.
+// The pair's VPC and subnet are those of this instance's ENI, the one listed here if the
+// instance has several. ENIs and route tables carrying all of the tags are selected along
+// with those listed by ID. Without tags or ENIs every ENI in the pair's subnet is managed
+// and floating IPs are recognised as x.x.x.20 onwards in the ENI IP's /24; without tags or
+// route tables every route table in the pair's VPC with a route to the destination CIDR is.
+// This default discovery is deprecated, pairs should select their resources explicitly.
+type ResourceSelector struct {
+	Tags        map[string]string `json:"tags,omitempty"`
+	ENIs        []string          `json:"enis,omitempty"`
+	FloatingIPs []netip.Prefix    `json:"floating_ips,omitempty"` // single IPs are /32 prefixes
+	RouteTables []string          `json:"route_tables,omitempty"`
+}
+
+// ParseResourceSelector parses tags as key=value and floating IPs as IPs or CIDR blocks
+func ParseResourceSelector(tags, enis, floatingIPs, routeTables []string) (ResourceSelector, error) {
+	selector := ResourceSelector{
+		ENIs:        enis,
+		RouteTables: routeTables,
+	}
+
+	for _, tag := range tags {
+		key, value, ok := strings.Cut(tag, "=")
+		if !ok || key == "" {
+			return ResourceSelector{}, fmt.Errorf("invalid resource tag %q, expected key=value", tag)
+		}
+		if selector.Tags == nil {
+			selector.Tags = make(map[string]string)
+		}
+		selector.Tags[key] = value
+	}
+
+	for _, s := range floatingIPs {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(s)
+			if addrErr != nil {
+				return ResourceSelector{}, fmt.Errorf("invalid floating IP %q, expected an IP or CIDR block", s)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		selector.FloatingIPs = append(selector.FloatingIPs, prefix.Masked())
+	}
+
+	return selector, nil
+}
+
+// selectsENIs reports whether the managed ENIs are chosen explicitly
+func (s *ResourceSelector) selectsENIs() bool {
+	return len(s.Tags) > 0 || len(s.ENIs) > 0
+}
+
+// selectsRouteTables reports whether the managed route tables are chosen explicitly
+func (s *ResourceSelector) selectsRouteTables() bool {
+	return len(s.Tags) > 0 || len(s.RouteTables) > 0
+}
+
+// DefaultDiscovery returns the kinds of resources the selector leaves to the deprecated
+// default discovery, route tables only when there is a destination CIDR to route
+func (s *ResourceSelector) DefaultDiscovery(destinationCIDR string) []string {
+	var kinds []string
+	if !s.selectsENIs() {
+		kinds = append(kinds, ResourceENI)
+		if len(s.FloatingIPs) == 0 {
+			kinds = append(kinds, ResourceFloatingIP)
+		}
+	}
+	if destinationCIDR != "" && !s.selectsRouteTables() {
+		kinds = append(kinds, ResourceRouteTable)
+	}
+	return kinds
+}
+
+// isFloatingIP reports whether a secondary IP of a managed ENI is a floating IP
+func (s *ResourceSelector) isFloatingIP(ip, eniIP string) bool {
+	if ip == eniIP {
+		return false
+	}
+	if len(s.FloatingIPs) > 0 {
+		addr, err := netip.ParseAddr(ip)
+		return err == nil && slices.ContainsFunc(s.FloatingIPs, func(prefix netip.Prefix) bool {
+			return prefix.Contains(addr)
+		})
+	}
+	if s.selectsENIs() {
+		return true
+	}
+	return len(filterFloatingIPs([]string{ip}, eniIP)) > 0
+}
+
+// RejectedResource is a selected resource the failover pair does not touch
+type RejectedResource struct {
+	Kind   string `json:"kind"`
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// PairResources are the resources a failover pair manages, all within the VPC and subnet
+// of the ENI holding the ENI IP
+type PairResources struct {
+	VPCID      string `json:"vpc_id"`
+	SubnetID   string `json:"subnet_id"`
+	SubnetCIDR string `json:"subnet_cidr"`
+
+	// ENI holding the ENI IP
+	PrimaryENI string `json:"primary_eni"`
+
+	// Managed ENIs, including the one holding the ENI IP, ordered by ID
+	ENIs []CloudENI `json:"enis"`
+
+	// Floating IPs assigned to the managed ENIs, sorted
+	FloatingIPs []string `json:"floating_ips"`
+
+	// Route tables whose route to the destination CIDR follows the primary, sorted
+	RouteTables []string `json:"route_tables"`
+
+	// Selected resources outside the pair's VPC or subnet, or otherwise unusable
+	Rejected []RejectedResource `json:"rejected,omitempty"`
+}
+
+// ENIIDs returns the IDs of the managed ENIs, ordered
+func (r *PairResources) ENIIDs() []string {
+	ids := make([]string, len(r.ENIs))
+	for i, eni := range r.ENIs {
+		ids[i] = eni.ID
+	}
+	return ids
+}
+
+// FloatingIPMoves returns the floating IPs held by managed ENIs other than destENI, by ENI
+func (r *PairResources) FloatingIPMoves(destENI string) map[string][]string {
+	moves := make(map[string][]string)
+	for _, eni := range r.ENIs {
+		if eni.ID == destENI {
+			continue
+		}
+		for _, ip := range eni.SecondaryIPs {
+			if _, found := slices.BinarySearch(r.FloatingIPs, ip); found {
+				moves[eni.ID] = append(moves[eni.ID], ip)
+			}
+		}
+	}
+	return moves
+}
+
+// reject records a selected resource that will not be touched
+func (r *PairResources) reject(kind, id, reason string, args ...any) {
+	r.Rejected = append(r.Rejected, RejectedResource{
+		Kind:   kind,
+		ID:     id,
+		Reason: fmt.Sprintf(reason, args...),
+	})
+}
+
+// DiscoverResources finds the resources of the failover pair whose primary holds the ENI
+// IP. The pair's VPC and subnet are those of this instance's ENI, as other VPCs may reuse
+// the ENI IP, and the ENI holding it must be in them. Selected resources outside them are
+// rejected, as are route tables without a route to the destination CIDR. Route tables are
+// not looked up without a destination CIDR.
+func DiscoverResources(ctx context.Context, cloud CloudProvider, eniIP, destinationCIDR string, selector ResourceSelector) (*PairResources, error) {
+	mine, err := pairENI(ctx, cloud, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	holders, err := cloud.DescribeENIs(ctx, ENIFilter{VPCID: mine.VPCID, PrivateIP: eniIP})
+	if err != nil {
+		return nil, err
+	}
+	if len(holders) == 0 {
+		return nil, fmt.Errorf("no ENI found with IP %s in VPC %s", eniIP, mine.VPCID)
+	}
+	holder := holders[0]
+	if holder.SubnetID != mine.SubnetID {
+		return nil, fmt.Errorf("IP %s is held by ENI %s in subnet %s, not the pair's subnet %s of ENI %s", eniIP, holder.ID, holder.SubnetID, mine.SubnetID, mine.ID)
+	}
+
+	subnet, err := cloud.DescribeSubnet(ctx, mine.SubnetID)
+	if err != nil {
+		return nil, err
+	}
+	subnetPrefix, err := netip.ParsePrefix(subnet.CIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR block %q of subnet %s: %w", subnet.CIDR, subnet.ID, err)
+	}
+
+	resources := &PairResources{
+		VPCID:      subnet.VPCID,
+		SubnetID:   subnet.ID,
+		SubnetCIDR: subnet.CIDR,
+		PrimaryENI: holder.ID,
+	}
+
+	candidates, err := selectENIs(ctx, cloud, resources, selector)
+	if err != nil {
+		return nil, err
+	}
+	candidates[holder.ID] = holder
+
+	for _, id := range slices.Sorted(maps.Keys(candidates)) {
+		eni := candidates[id]
+		switch {
+		case eni.VPCID != resources.VPCID:
+			resources.reject(ResourceENI, id, "in VPC %s, not the pair's VPC %s", eni.VPCID, resources.VPCID)
+		case eni.SubnetID != resources.SubnetID:
+			resources.reject(ResourceENI, id, "in subnet %s, not the pair's subnet %s", eni.SubnetID, resources.SubnetID)
+		default:
+			resources.ENIs = append(resources.ENIs, eni)
+		}
+	}
+
+	// Floating IPs can only be secondary IPs of managed ENIs, which are in the subnet
+	for _, prefix := range selector.FloatingIPs {
+		if !subnetPrefix.Contains(prefix.Addr()) || prefix.Bits() < subnetPrefix.Bits() {
+			id := prefix.String()
+			if prefix.IsSingleIP() {
+				id = prefix.Addr().String()
+			}
+			resources.reject(ResourceFloatingIP, id, "outside the pair's subnet %s", subnet.CIDR)
+		}
+	}
+	for _, eni := range resources.ENIs {
+		for _, ip := range eni.SecondaryIPs {
+			if selector.isFloatingIP(ip, eniIP) {
+				resources.FloatingIPs = append(resources.FloatingIPs, ip)
+			}
+		}
+	}
+	slices.Sort(resources.FloatingIPs)
+	for _, prefix := range selector.FloatingIPs {
+		ip := prefix.Addr().String()
+		if prefix.IsSingleIP() && subnetPrefix.Contains(prefix.Addr()) && !slices.Contains(resources.FloatingIPs, ip) {
+			resources.reject(ResourceFloatingIP, ip, "not assigned to a managed ENI")
+		}
+	}
+
+	if destinationCIDR != "" {
+		if err := discoverRouteTables(ctx, cloud, resources, destinationCIDR, selector); err != nil {
+			return nil, err
+		}
+	}
+
+	slices.SortFunc(resources.Rejected, func(a, b RejectedResource) int {
+		return cmp.Or(strings.Compare(a.Kind, b.Kind), strings.Compare(a.ID, b.ID))
+	})
+	return resources, nil
+}
+
+// pairENI returns this instance's ENI in the pair's subnet: the first listed by the
+// selector, or its first ENI if none is listed
+func pairENI(ctx context.Context, cloud CloudProvider, selector ResourceSelector) (*CloudENI, error) {
+	enis, err := cloud.DescribeENIs(ctx, ENIFilter{InstanceID: cloud.GetInstanceID()})
+	if err != nil {
+		return nil, err
+	}
+	if len(enis) == 0 {
+		return nil, fmt.Errorf("no ENI found for instance %s", cloud.GetInstanceID())
+	}
+	for _, id := range selector.ENIs {
+		if i := slices.IndexFunc(enis, func(eni CloudENI) bool { return eni.ID == id }); i >= 0 {
+			return &enis[i], nil
+		}
+	}
+	return &enis[0], nil
+}
+
+// selectENIs returns the candidate ENIs by ID, rejecting listed ENIs that do not exist
+func selectENIs(ctx context.Context, cloud CloudProvider, resources *PairResources, selector ResourceSelector) (map[string]CloudENI, error) {
+	candidates := make(map[string]CloudENI)
+	add := func(filter ENIFilter) error {
+		enis, err := cloud.DescribeENIs(ctx, filter)
+		if err != nil {
+			return err
+		}
+		for _, eni := range enis {
+			candidates[eni.ID] = eni
+		}
+		return nil
+	}
+
+	if !selector.selectsENIs() {
+		return candidates, add(ENIFilter{SubnetID: resources.SubnetID})
+	}
+	if len(selector.Tags) > 0 {
+		if err := add(ENIFilter{Tags: selector.Tags}); err != nil {
+			return nil, err
+		}
+	}
+	if len(selector.ENIs) > 0 {
+		if err := add(ENIFilter{IDs: selector.ENIs}); err != nil {
+			return nil, err
+		}
+		for _, id := range selector.ENIs {
+			if _, ok := candidates[id]; !ok {
+				resources.reject(ResourceENI, id, "not found")
+			}
+		}
+	}
+	return candidates, nil
+}
+
+// discoverRouteTables adds the selected route tables in the pair's VPC with a route to the
+// destination CIDR
+func discoverRouteTables(ctx context.Context, cloud CloudProvider, resources *PairResources, destinationCIDR string, selector ResourceSelector) error {
+	candidates := make(map[string]CloudRouteTable)
+	add := func(filter RouteTableFilter) error {
+		routeTables, err := cloud.DescribeRouteTables(ctx, filter)
+		if err != nil {
+			return err
+		}
+		for _, routeTable := range routeTables {
+			candidates[routeTable.ID] = routeTable
+		}
+		return nil
+	}
+
+	if !selector.selectsRouteTables() {
+		if err := add(RouteTableFilter{VPCID: resources.VPCID, DestinationCIDR: destinationCIDR}); err != nil {
+			return err
+		}
+	}
+	if len(selector.Tags) > 0 {
+		if err := add(RouteTableFilter{Tags: selector.Tags}); err != nil {
+			return err
+		}
+	}
+	if len(selector.RouteTables) > 0 {
+		if err := add(RouteTableFilter{IDs: selector.RouteTables}); err != nil {
+			return err
+		}
+		for _, id := range selector.RouteTables {
+			if _, ok := candidates[id]; !ok {
+				resources.reject(ResourceRouteTable, id, "not found")
+			}
+		}
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(candidates)) {
+		routeTable := candidates[id]
+		if routeTable.VPCID != resources.VPCID {
+			resources.reject(ResourceRouteTable, id, "in VPC %s, not the pair's VPC %s", routeTable.VPCID, resources.VPCID)
+			continue
+		}
+		if _, ok := routeTable.Routes[destinationCIDR]; !ok {
+			resources.reject(ResourceRouteTable, id, "no route to %s", destinationCIDR)
+			continue
+		}
+		resources.RouteTables = append(resources.RouteTables, id)
+	}
+	return nil
+}
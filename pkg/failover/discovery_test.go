@@ -0,0 +1,102 @@
+package failover
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestDiscoverRouteTablesInPairVPC(t *testing.T) {
+	ctx := context.Background()
+	cloud := newTestCloud()
+	// A route table of another VPC routing the same CIDR
+	cloud.AddRouteTable(CloudRouteTable{ID: "rtb-2", VPCID: "vpc-2", Routes: map[string]string{testDestinationCIDR: "eni-x"}})
+	provider := NewMemoryCloudProvider(cloud, "i-b")
+
+	resources, err := DiscoverResources(ctx, provider, testENIIP, testDestinationCIDR, ResourceSelector{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(resources.RouteTables, []string{"rtb-1"}) || len(resources.Rejected) != 0 {
+		t.Fatalf("got route tables %v, rejected %v, want only rtb-1", resources.RouteTables, resources.Rejected)
+	}
+
+	targets, err := provider.GetRouteTargets(ctx, resources.VPCID, testDestinationCIDR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 || targets["rtb-1"] != "eni-a" {
+		t.Fatalf("got route targets %v, want rtb-1 to eni-a", targets)
+	}
+
+	// A route table of another VPC listed explicitly is rejected
+	resources, err = DiscoverResources(ctx, provider, testENIIP, testDestinationCIDR, ResourceSelector{RouteTables: []string{"rtb-1", "rtb-2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(resources.RouteTables, []string{"rtb-1"}) || len(resources.Rejected) != 1 || resources.Rejected[0].ID != "rtb-2" {
+		t.Fatalf("got route tables %v, rejected %v, want rtb-1 and rtb-2 rejected", resources.RouteTables, resources.Rejected)
+	}
+}
+
+func TestDiscoverResourcesInPairSubnet(t *testing.T) {
+	cloud := newTestCloud()
+	// i-b has a second ENI in another subnet of the VPC, which sorts before eni-b
+	cloud.AddSubnet(CloudSubnet{ID: "subnet-2", VPCID: "vpc-1", CIDR: "10.0.2.0/24"})
+	cloud.AddENI(CloudENI{ID: "eni-0", InstanceID: "i-b", SubnetID: "subnet-2", PrimaryIP: "10.0.2.10"})
+	provider := NewMemoryCloudProvider(cloud, "i-b")
+
+	// Anchored on eni-0, the ENI IP is held outside the pair's subnet
+	if _, err := DiscoverResources(context.Background(), provider, testENIIP, "", ResourceSelector{}); err == nil {
+		t.Fatal("expected error for the ENI IP held outside the pair's subnet")
+	}
+
+	// Listing the pair's ENIs anchors it on eni-b
+	resources, err := DiscoverResources(context.Background(), provider, testENIIP, "", ResourceSelector{ENIs: []string{"eni-a", "eni-b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resources.SubnetID != "subnet-1" || resources.PrimaryENI != "eni-a" || !slices.Equal(resources.ENIIDs(), []string{"eni-a", "eni-b"}) {
+		t.Fatalf("got ENIs %v with %s primary in %s, want eni-a and eni-b with eni-a primary in subnet-1", resources.ENIIDs(), resources.PrimaryENI, resources.SubnetID)
+	}
+}
+
+func TestResourceSelectorDefaultDiscovery(t *testing.T) {
+	tests := map[string]struct {
+		tags, enis, floatingIPs, routeTables []string
+		destinationCIDR                      string
+		want                                 []string
+	}{
+		"nothing selected": {
+			destinationCIDR: testDestinationCIDR,
+			want:            []string{ResourceENI, ResourceFloatingIP, ResourceRouteTable},
+		},
+		"no destination CIDR": {
+			want: []string{ResourceENI, ResourceFloatingIP},
+		},
+		"floating IPs listed": {
+			floatingIPs: []string{"10.0.1.32/28"},
+			want:        []string{ResourceENI},
+		},
+		"ENIs and route tables listed": {
+			enis:            []string{"eni-a", "eni-b"},
+			routeTables:     []string{"rtb-1"},
+			destinationCIDR: testDestinationCIDR,
+		},
+		"tags": {
+			tags:            []string{"architect:pair=nat-a"},
+			destinationCIDR: testDestinationCIDR,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			selector, err := ParseResourceSelector(tt.tags, tt.enis, tt.floatingIPs, tt.routeTables)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := selector.DefaultDiscovery(tt.destinationCIDR); !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
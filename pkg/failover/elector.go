@@ -0,0 +1,192 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Election backend names
+const (
+	ElectionBackendENI    = "eni"
+	ElectionBackendFile   = "file"
+	ElectionBackendLease  = "lease"
+	ElectionBackendRaft   = "raft"
+	ElectionBackendMemory = "memory"
+	ElectionBackendStatic = "static"
+)
+
+var ErrNoLeader = errors.New("no leader elected")
+
+// Elector decides which node is entitled to act as primary
+type Elector interface {
+	// Campaign attempts to acquire or confirm leadership and reports whether this node is the leader
+	Campaign(ctx context.Context) (bool, error)
+
+	// Resign gives up leadership if this node holds it
+	Resign(ctx context.Context) error
+
+	// Observe returns the identity of the current leader, or ErrNoLeader if there is none
+	Observe(ctx context.Context) (string, error)
+}
+
+// ElectionNotifier is implemented by electors that signal leadership changes as they happen
+type ElectionNotifier interface {
+	Changes() <-chan struct{}
+}
+
+// localNodeID identifies this process for backends that do not use the EC2 instance ID
+func localNodeID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// ENIElector elects the node whose instance owns the ENI IP address
+type ENIElector struct {
+	cloud CloudProvider
+	eniIP string
+}
+
+var _ Elector = (*ENIElector)(nil)
+
+// NewENIElector creates an elector based on ENI IP ownership in the cloud
+func NewENIElector(cloud CloudProvider, eniIP string) *ENIElector {
+	return &ENIElector{
+		cloud: cloud,
+		eniIP: eniIP,
+	}
+}
+
+// Campaign reports whether this instance currently owns the ENI IP. Ownership is
+// only ever acquired by moving the IP during failover, so campaigning is passive.
+func (e *ENIElector) Campaign(ctx context.Context) (bool, error) {
+	return e.cloud.CheckENIOwnership(ctx, e.eniIP)
+}
+
+// Resign is a no-op, the ENI IP is released when the new primary takes it over
+func (e *ENIElector) Resign(_ context.Context) error {
+	return nil
+}
+
+// Observe returns the instance ID that owns the ENI IP
+func (e *ENIElector) Observe(ctx context.Context) (string, error) {
+	owner, err := e.cloud.GetENIOwner(ctx, e.eniIP)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrNoLeader, err)
+	}
+	return owner, nil
+}
+
+// StaticElector holds a role fixed by configuration, for tests on hosts that cannot share
+// an election: a forced primary always leads and a forced secondary never campaigns for it
+type StaticElector struct {
+	id      string
+	primary bool
+}
+
+var _ Elector = (*StaticElector)(nil)
+
+// NewStaticElector creates an elector that reports this node as leader only when it is
+// forced to be primary
+func NewStaticElector(id string, primary bool) *StaticElector {
+	return &StaticElector{
+		id:      id,
+		primary: primary,
+	}
+}
+
+// Campaign reports whether this node is forced to be primary
+func (e *StaticElector) Campaign(_ context.Context) (bool, error) {
+	return e.primary, nil
+}
+
+// Resign is a no-op, the forced role does not change
+func (e *StaticElector) Resign(_ context.Context) error {
+	return nil
+}
+
+// Observe returns this node when it is forced to be primary, the other node is not known
+func (e *StaticElector) Observe(_ context.Context) (string, error) {
+	if !e.primary {
+		return "", ErrNoLeader
+	}
+	return e.id, nil
+}
+
+// MemoryElection is an in-process election shared by MemoryElector instances
+type MemoryElection struct {
+	mu     sync.Mutex
+	leader string
+}
+
+// NewMemoryElection creates an empty in-process election
+func NewMemoryElection() *MemoryElection {
+	return new(MemoryElection)
+}
+
+// SetLeader forces the leader of the election, an empty ID clears it
+func (m *MemoryElection) SetLeader(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.leader = id
+}
+
+// Leader returns the current leader of the election
+func (m *MemoryElection) Leader() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.leader
+}
+
+// MemoryElector is an in-process elector for unit tests, the first
+// candidate to campaign wins until it resigns
+type MemoryElector struct {
+	election *MemoryElection
+	id       string
+}
+
+var _ Elector = (*MemoryElector)(nil)
+
+// NewMemoryElector creates an elector that campaigns in the given election under the given ID
+func NewMemoryElector(election *MemoryElection, id string) *MemoryElector {
+	return &MemoryElector{
+		election: election,
+		id:       id,
+	}
+}
+
+// Campaign wins the election if there is no leader or this elector already leads
+func (e *MemoryElector) Campaign(_ context.Context) (bool, error) {
+	e.election.mu.Lock()
+	defer e.election.mu.Unlock()
+
+	if e.election.leader == "" {
+		e.election.leader = e.id
+	}
+	return e.election.leader == e.id, nil
+}
+
+// Resign clears the leader if this elector holds leadership
+func (e *MemoryElector) Resign(_ context.Context) error {
+	e.election.mu.Lock()
+	defer e.election.mu.Unlock()
+
+	if e.election.leader == e.id {
+		e.election.leader = ""
+	}
+	return nil
+}
+
+// Observe returns the current leader of the election
+func (e *MemoryElector) Observe(_ context.Context) (string, error) {
+	leader := e.election.Leader()
+	if leader == "" {
+		return "", ErrNoLeader
+	}
+	return leader, nil
+}
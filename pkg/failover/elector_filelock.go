@@ -0,0 +1,129 @@
+//go:build unix
+
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// FileLockElector elects the process holding an exclusive lock on a local file,
+// which lets two daemons on a single host fail over between each other
+type FileLockElector struct {
+	path string
+	id   string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+var _ Elector = (*FileLockElector)(nil)
+
+// NewFileLockElector creates an elector that campaigns for the lock file at path under the given ID
+func NewFileLockElector(path, id string) *FileLockElector {
+	return &FileLockElector{
+		path: path,
+		id:   id,
+	}
+}
+
+// Campaign tries to take the lock without blocking, and reports whether this elector holds it
+func (e *FileLockElector) Campaign(_ context.Context) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.file != nil {
+		return true, nil
+	}
+
+	file, err := os.OpenFile(e.path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return false, fmt.Errorf("failed to open lock file %s: %w", e.path, err)
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to lock %s: %w", e.path, err)
+	}
+
+	// Record our identity so other candidates can observe the leader
+	if err := file.Truncate(0); err != nil {
+		_ = file.Close()
+		return false, fmt.Errorf("failed to truncate lock file %s: %w", e.path, err)
+	}
+	if _, err := file.WriteAt([]byte(e.id), 0); err != nil {
+		_ = file.Close()
+		return false, fmt.Errorf("failed to write lock file %s: %w", e.path, err)
+	}
+
+	e.file = file
+	return true, nil
+}
+
+// Resign releases the lock if this elector holds it
+func (e *FileLockElector) Resign(_ context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.file == nil {
+		return nil
+	}
+
+	file := e.file
+	e.file = nil
+
+	if err := file.Truncate(0); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to truncate lock file %s: %w", e.path, err)
+	}
+
+	// Closing the file releases the lock
+	return file.Close()
+}
+
+// Observe returns the identity recorded in the lock file by the current holder
+func (e *FileLockElector) Observe(_ context.Context) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.file != nil {
+		return e.id, nil
+	}
+
+	file, err := os.Open(e.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrNoLeader
+		}
+		return "", fmt.Errorf("failed to open lock file %s: %w", e.path, err)
+	}
+	defer file.Close()
+
+	// If a shared lock can be taken nobody holds the exclusive lock, and the
+	// recorded identity belongs to a holder that exited without resigning
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err == nil {
+		return "", ErrNoLeader
+	} else if !errors.Is(err, syscall.EWOULDBLOCK) {
+		return "", fmt.Errorf("failed to probe lock %s: %w", e.path, err)
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read lock file %s: %w", e.path, err)
+	}
+
+	leader := strings.TrimSpace(string(data))
+	if leader == "" {
+		return "", ErrNoLeader
+	}
+	return leader, nil
+}
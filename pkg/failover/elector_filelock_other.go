@@ -0,0 +1,35 @@
+//go:build !unix
+
+package failover
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrFileLockUnsupported = errors.New("file lock election is not supported on this platform")
+
+// FileLockElector is unavailable on platforms without flock
+type FileLockElector struct{}
+
+var _ Elector = (*FileLockElector)(nil)
+
+// NewFileLockElector creates an elector that always fails on this platform
+func NewFileLockElector(_, _ string) *FileLockElector {
+	return new(FileLockElector)
+}
+
+// Campaign always fails on this platform
+func (e *FileLockElector) Campaign(_ context.Context) (bool, error) {
+	return false, ErrFileLockUnsupported
+}
+
+// Resign is a no-op on this platform
+func (e *FileLockElector) Resign(_ context.Context) error {
+	return nil
+}
+
+// Observe always fails on this platform
+func (e *FileLockElector) Observe(_ context.Context) (string, error) {
+	return "", ErrFileLockUnsupported
+}
@@ -0,0 +1,44 @@
+//go:build unix
+
+package failover
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileLockElector(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "leader.lock")
+	a := NewFileLockElector(path, "a")
+	b := NewFileLockElector(path, "b")
+
+	if _, err := b.Observe(ctx); !errors.Is(err, ErrNoLeader) {
+		t.Fatalf("observe without lock file: got %v, want ErrNoLeader", err)
+	}
+
+	if leader, err := a.Campaign(ctx); err != nil || !leader {
+		t.Fatalf("first campaign: got %t, %v, want leader", leader, err)
+	}
+	if leader, err := b.Campaign(ctx); err != nil || leader {
+		t.Fatalf("second candidate: got %t, %v, want not leader", leader, err)
+	}
+	if observed, err := b.Observe(ctx); err != nil || observed != "a" {
+		t.Fatalf("observe: got %q, %v, want a", observed, err)
+	}
+
+	if err := a.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Observe(ctx); !errors.Is(err, ErrNoLeader) {
+		t.Fatalf("observe after resign: got %v, want ErrNoLeader", err)
+	}
+	if leader, err := b.Campaign(ctx); err != nil || !leader {
+		t.Fatalf("campaign after leader resigned: got %t, %v, want leader", leader, err)
+	}
+	if err := b.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
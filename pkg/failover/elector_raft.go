@@ -0,0 +1,391 @@
+package failover
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+	"github.com/loopholelabs/logging/types"
+)
+
+// Raft storage layout inside the state directory
+const (
+	RaftDirName        = "raft"
+	raftStoreFileName  = "raft.db"
+	raftSnapshotRetain = 2
+)
+
+// Witness leadership transfer timing
+const (
+	raftBarrierTimeout        = 10 * time.Second
+	raftTransferRetryInterval = time.Second
+)
+
+var ErrInvalidClusterPeer = errors.New("invalid cluster peer")
+
+// RaftPeer is a member of the Raft cluster
+type RaftPeer struct {
+	// ID uniquely and stably identifies the node across restarts
+	ID string
+
+	// Addr is the host:port the node's Raft transport listens on
+	Addr string
+}
+
+// ParseRaftPeer parses a cluster peer of the form id=host:port. The port
+// defaults to defaultPort when omitted.
+func ParseRaftPeer(s string, defaultPort uint16) (RaftPeer, error) {
+	id, addr, ok := strings.Cut(s, "=")
+	if !ok || id == "" || addr == "" {
+		return RaftPeer{}, fmt.Errorf("%w %q: expected id=host:port", ErrInvalidClusterPeer, s)
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, strconv.Itoa(int(defaultPort)))
+	}
+
+	return RaftPeer{ID: id, Addr: addr}, nil
+}
+
+// RaftElectorConfig configures a RaftElector
+type RaftElectorConfig struct {
+	// NodeID is this node's ID, which must be one of Peers
+	NodeID string
+
+	// Peers lists every voter in the cluster, including this node
+	Peers []RaftPeer
+
+	// Dir holds the Raft log, stable store and snapshots
+	Dir string
+
+	// Witness nodes vote in elections but hand leadership to another node if elected
+	Witness bool
+
+	// ServerTLS and ClientTLS secure the Raft transport with mutual TLS. The transport
+	// is plain TCP when they are nil.
+	ServerTLS *tls.Config
+	ClientTLS *tls.Config
+
+	// Logger instance
+	Logger types.Logger
+}
+
+// RaftElector elects the leader of an embedded Raft group. Three or more nodes
+// tolerate a partition between any two of them, unlike an ENI-based pair.
+type RaftElector struct {
+	raft      *raft.Raft
+	transport *raft.NetworkTransport
+	store     *raftboltdb.BoltStore
+	id        string
+	witness   bool
+	logger    types.Logger
+
+	notifyCh  chan bool
+	changesCh chan struct{}
+	closeOnce sync.Once
+}
+
+var (
+	_ Elector          = (*RaftElector)(nil)
+	_ LeaseGuard       = (*RaftElector)(nil)
+	_ ElectionNotifier = (*RaftElector)(nil)
+)
+
+// NewRaftElector starts the Raft node, bootstrapping the cluster from the peer list on first start
+func NewRaftElector(config RaftElectorConfig) (*RaftElector, error) {
+	var self *RaftPeer
+	servers := make([]raft.Server, 0, len(config.Peers))
+	for i, peer := range config.Peers {
+		if peer.ID == config.NodeID {
+			self = &config.Peers[i]
+		}
+		servers = append(servers, raft.Server{
+			Suffrage: raft.Voter,
+			ID:       raft.ServerID(peer.ID),
+			Address:  raft.ServerAddress(peer.Addr),
+		})
+	}
+	if self == nil {
+		return nil, fmt.Errorf("node ID %s is not in the cluster peer list", config.NodeID)
+	}
+
+	if err := os.MkdirAll(config.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create raft directory %s: %w", config.Dir, err)
+	}
+
+	hcLogger := hclog.New(&hclog.LoggerOptions{
+		Name:        "raft",
+		Level:       hclog.Info,
+		Output:      &raftLogWriter{logger: config.Logger},
+		DisableTime: true,
+	})
+
+	advertise, err := net.ResolveTCPAddr("tcp", self.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve raft address %s: %w", self.Addr, err)
+	}
+	_, port, _ := net.SplitHostPort(self.Addr)
+
+	var transport *raft.NetworkTransport
+	if config.ServerTLS != nil {
+		listener, listenErr := net.Listen("tcp", net.JoinHostPort("", port))
+		if listenErr != nil {
+			return nil, fmt.Errorf("failed to create raft transport: %w", listenErr)
+		}
+		layer := &raftTLSLayer{listener: listener, advertise: advertise, server: config.ServerTLS, client: config.ClientTLS}
+		transport = raft.NewNetworkTransportWithLogger(layer, 3, 10*time.Second, hcLogger)
+	} else {
+		transport, err = raft.NewTCPTransportWithLogger(net.JoinHostPort("", port), advertise, 3, 10*time.Second, hcLogger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create raft transport: %w", err)
+		}
+	}
+
+	store, err := raftboltdb.NewBoltStore(filepath.Join(config.Dir, raftStoreFileName))
+	if err != nil {
+		_ = transport.Close()
+		return nil, fmt.Errorf("failed to open raft store: %w", err)
+	}
+
+	snapshots, err := raft.NewFileSnapshotStoreWithLogger(config.Dir, raftSnapshotRetain, hcLogger)
+	if err != nil {
+		_ = store.Close()
+		_ = transport.Close()
+		return nil, fmt.Errorf("failed to create raft snapshot store: %w", err)
+	}
+
+	notifyCh := make(chan bool, 1)
+	raftConfig := raft.DefaultConfig()
+	raftConfig.LocalID = raft.ServerID(config.NodeID)
+	raftConfig.Logger = hcLogger
+	raftConfig.NotifyCh = notifyCh
+
+	hasState, err := raft.HasExistingState(store, store, snapshots)
+	if err != nil {
+		_ = store.Close()
+		_ = transport.Close()
+		return nil, fmt.Errorf("failed to check raft state: %w", err)
+	}
+	if !hasState {
+		// Every node bootstraps with the same static configuration
+		err = raft.BootstrapCluster(raftConfig, store, store, snapshots, transport, raft.Configuration{Servers: servers})
+		if err != nil {
+			_ = store.Close()
+			_ = transport.Close()
+			return nil, fmt.Errorf("failed to bootstrap raft cluster: %w", err)
+		}
+	}
+
+	r, err := raft.NewRaft(raftConfig, raftFSM{}, store, store, snapshots, transport)
+	if err != nil {
+		_ = store.Close()
+		_ = transport.Close()
+		return nil, fmt.Errorf("failed to start raft: %w", err)
+	}
+
+	e := &RaftElector{
+		raft:      r,
+		transport: transport,
+		store:     store,
+		id:        config.NodeID,
+		witness:   config.Witness,
+		logger:    config.Logger,
+		notifyCh:  notifyCh,
+		changesCh: make(chan struct{}, 1),
+	}
+	go e.notifyLoop()
+
+	return e, nil
+}
+
+// newRaftElectorFromConfig starts a raft elector for the failover configuration, its
+// transport secured with the fRPC certificates when mutual TLS is configured
+func newRaftElectorFromConfig(config *LeaderConfig, witness bool, tlsCerts *tlsReloader) (*RaftElector, error) {
+	peers, err := config.RaftPeers()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRaftElector(RaftElectorConfig{
+		NodeID:    config.NodeID,
+		Peers:     peers,
+		Dir:       filepath.Join(config.StateDir, RaftDirName),
+		Witness:   witness,
+		ServerTLS: tlsCerts.serverConfig(),
+		ClientTLS: tlsCerts.clientConfig(),
+		Logger:    config.Logger,
+	})
+}
+
+// notifyLoop forwards Raft leadership changes, handing off leadership if this node is a witness
+func (e *RaftElector) notifyLoop() {
+	for leader := range e.notifyCh {
+		if leader && e.witness {
+			e.logger.Info().Str("node_id", e.id).Msg("Witness elected raft leader, transferring leadership")
+			e.transferWitnessLeadership()
+		}
+
+		select {
+		case e.changesCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// transferWitnessLeadership hands leadership to another voter until one takes it. Raft
+// picks the most up to date voter, so a barrier is committed first to rule out a voter
+// that is down, such as the node whose loss elected the witness.
+func (e *RaftElector) transferWitnessLeadership() {
+	for e.raft.State() == raft.Leader {
+		err := e.raft.Barrier(raftBarrierTimeout).Error()
+		if err == nil {
+			err = e.raft.LeadershipTransfer().Error()
+		}
+		if err == nil {
+			return
+		}
+
+		e.logger.Warn().Err(err).Msg("Failed to transfer raft leadership from witness")
+		time.Sleep(raftTransferRetryInterval)
+	}
+}
+
+// Campaign reports whether this node is the Raft leader. Raft runs its own
+// elections, so campaigning is passive; witnesses never lead.
+func (e *RaftElector) Campaign(_ context.Context) (bool, error) {
+	return !e.witness && e.raft.State() == raft.Leader, nil
+}
+
+// Resign transfers Raft leadership to another voter if this node leads
+func (e *RaftElector) Resign(_ context.Context) error {
+	if e.raft.State() != raft.Leader {
+		return nil
+	}
+	if err := e.raft.LeadershipTransfer().Error(); err != nil {
+		return fmt.Errorf("failed to transfer raft leadership: %w", err)
+	}
+	return nil
+}
+
+// Observe returns the ID of the current Raft leader
+func (e *RaftElector) Observe(_ context.Context) (string, error) {
+	_, id := e.raft.LeaderWithID()
+	if id == "" {
+		return "", ErrNoLeader
+	}
+	return string(id), nil
+}
+
+// HoldsLease confirms with a quorum that this node is still the Raft leader
+func (e *RaftElector) HoldsLease() bool {
+	return !e.witness && e.raft.VerifyLeader().Error() == nil
+}
+
+// Changes is signalled whenever this node gains or loses Raft leadership
+func (e *RaftElector) Changes() <-chan struct{} {
+	return e.changesCh
+}
+
+// Close shuts down the Raft node
+func (e *RaftElector) Close() error {
+	var err error
+	e.closeOnce.Do(func() {
+		if shutdownErr := e.raft.Shutdown().Error(); shutdownErr != nil {
+			err = fmt.Errorf("failed to shut down raft: %w", shutdownErr)
+		}
+		close(e.notifyCh)
+		_ = e.transport.Close()
+		if closeErr := e.store.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close raft store: %w", closeErr)
+		}
+	})
+	return err
+}
+
+// raftTLSLayer carries the Raft transport over mutual TLS
+type raftTLSLayer struct {
+	listener  net.Listener
+	advertise net.Addr
+	server    *tls.Config
+	client    *tls.Config
+}
+
+var _ raft.StreamLayer = (*raftTLSLayer)(nil)
+
+// Accept waits for the next connection from a peer. The handshake runs on its first read,
+// so a peer without a certificate from the CA fails before Raft reads a message from it.
+func (l *raftTLSLayer) Accept() (net.Conn, error) {
+	conn, err := l.listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return tls.Server(conn, l.server), nil
+}
+
+func (l *raftTLSLayer) Close() error { return l.listener.Close() }
+
+// Addr is the address peers dial to reach this node
+func (l *raftTLSLayer) Addr() net.Addr { return l.advertise }
+
+// Dial connects to a peer and completes the handshake within timeout
+func (l *raftTLSLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", string(address), l.client)
+}
+
+// raftFSM is an empty state machine, the Raft group is only used for leader election
+type raftFSM struct{}
+
+func (raftFSM) Apply(*raft.Log) interface{} { return nil }
+
+func (raftFSM) Snapshot() (raft.FSMSnapshot, error) { return raftFSMSnapshot{}, nil }
+
+func (raftFSM) Restore(r io.ReadCloser) error { return r.Close() }
+
+type raftFSMSnapshot struct{}
+
+func (raftFSMSnapshot) Persist(sink raft.SnapshotSink) error { return sink.Close() }
+
+func (raftFSMSnapshot) Release() {}
+
+// raftLogWriter forwards hclog output from Raft to the failover logger
+type raftLogWriter struct {
+	logger types.Logger
+}
+
+func (w *raftLogWriter) Write(p []byte) (int, error) {
+	line := strings.TrimSpace(string(p))
+
+	level, msg := "", line
+	if strings.HasPrefix(line, "[") {
+		if end := strings.Index(line, "]"); end > 0 {
+			level, msg = line[1:end], strings.TrimSpace(line[end+1:])
+		}
+	}
+
+	switch level {
+	case "ERROR":
+		w.logger.Error().Msg(msg)
+	case "WARN":
+		w.logger.Warn().Msg(msg)
+	case "INFO":
+		w.logger.Info().Msg(msg)
+	case "DEBUG":
+		w.logger.Debug().Msg(msg)
+	default:
+		w.logger.Trace().Msg(msg)
+	}
+
+	return len(p), nil
+}
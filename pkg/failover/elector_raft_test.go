@@ -0,0 +1,295 @@
+package failover
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/loopholelabs/logging"
+)
+
+// raftTestTimeout bounds waiting for a raft election with the default raft timeouts
+const raftTestTimeout = 20 * time.Second
+
+// raftCluster is three failover daemons on loopback forming a raft group, on instances
+// i-a, i-b and i-c of one MemoryCloud
+type raftCluster struct {
+	cloud    *MemoryCloud
+	nodes    map[string]*LeaderFailover
+	conduits map[string]*fakeConduit
+	stop     map[string]func()
+}
+
+// newRaftCluster starts the three daemons, their dataplanes holding no flows
+func newRaftCluster(t *testing.T) *raftCluster {
+	t.Helper()
+
+	cluster := &raftCluster{
+		cloud:    newTestCloud(),
+		nodes:    make(map[string]*LeaderFailover),
+		conduits: make(map[string]*fakeConduit),
+		stop:     make(map[string]func()),
+	}
+	cluster.cloud.AddENI(CloudENI{ID: "eni-c", InstanceID: "i-c", SubnetID: "subnet-1", PrimaryIP: "10.0.1.12"})
+
+	instances := []string{"i-a", "i-b", "i-c"}
+	ports := make(map[string]uint16)
+	var clusterPeers []string
+	for _, instance := range instances {
+		ports[instance] = freeTCPPort(t)
+		clusterPeers = append(clusterPeers, instance+"=127.0.0.1:"+strconv.Itoa(int(freeTCPPort(t))))
+	}
+
+	for _, instance := range instances {
+		conduit, socket := newFakeConduit(t, testNATEntries())
+		cluster.conduits[instance] = conduit
+
+		var peerAddrs []string
+		for _, peer := range instances {
+			if peer != instance {
+				peerAddrs = append(peerAddrs, "/ip4/127.0.0.1/tcp/"+strconv.Itoa(int(ports[peer])))
+			}
+		}
+
+		cluster.nodes[instance] = newTestFailover(t, cluster.cloud, instance, func(config *LeaderConfig) {
+			config.ElectionBackend = ElectionBackendRaft
+			config.NodeID = instance
+			config.ClusterPeers = clusterPeers
+			config.Port = ports[instance]
+			config.PeerAddrs = peerAddrs
+			config.LocalSocket = socket
+			config.LeaderCheckInterval = 100 * time.Millisecond
+			config.HeartbeatInterval = 100 * time.Millisecond
+			config.SyncInterval = 100 * time.Millisecond
+		})
+	}
+
+	// Daemons stop as the command stops them: Start returns once cancelled, then Stop
+	// closes the raft node
+	for instance, lf := range cluster.nodes {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_ = lf.Start(ctx)
+		}()
+		cluster.stop[instance] = sync.OnceFunc(func() {
+			cancel()
+			<-done
+			_ = lf.Stop()
+		})
+		t.Cleanup(cluster.stop[instance])
+	}
+
+	return cluster
+}
+
+// waitForPrimary waits until one of the running daemons is primary with the others as its
+// secondaries and the cloud resources point at its ENI
+func (c *raftCluster) waitForPrimary(t *testing.T, running ...string) string {
+	t.Helper()
+
+	deadline := time.Now().Add(raftTestTimeout)
+	for time.Now().Before(deadline) {
+		var primaries, secondaries []string
+		for _, instance := range running {
+			switch c.nodes[instance].currentRole.Load() {
+			case RolePrimary:
+				primaries = append(primaries, instance)
+			case RoleSecondary:
+				secondaries = append(secondaries, instance)
+			}
+		}
+
+		if len(primaries) == 1 && len(secondaries) == len(running)-1 {
+			eni := "eni-" + strings.TrimPrefix(primaries[0], "i-")
+			if c.cloud.ENIWithIP(testENIIP) == eni && c.cloud.RouteTarget("rtb-1", testDestinationCIDR) == eni {
+				return primaries[0]
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	t.Fatal("cluster did not settle on a primary")
+	return ""
+}
+
+// waitForFlows waits until the dataplanes of instances each hold the given number of outbound flows
+func (c *raftCluster) waitForFlows(t *testing.T, flows int, instances ...string) {
+	t.Helper()
+
+	deadline := time.Now().Add(raftTestTimeout)
+	for time.Now().Before(deadline) {
+		synced := true
+		for _, instance := range instances {
+			synced = synced && len(c.conduits[instance].NATState().TCPOutbound) == flows
+		}
+		if synced {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	t.Fatalf("dataplanes of %v did not sync %d flows", instances, flows)
+}
+
+func TestRaftClusterLoopback(t *testing.T) {
+	if testing.Short() {
+		t.Skip("raft elections take seconds with the default timeouts")
+	}
+
+	cluster := newRaftCluster(t)
+
+	// The raft leader becomes primary and moves the ENI IP and route to itself. Its
+	// secondaries find it among their peers and sync the flows it forwards.
+	instances := []string{"i-a", "i-b", "i-c"}
+	primary := cluster.waitForPrimary(t, instances...)
+	epoch := cluster.nodes[primary].epochs.leader()
+	survivors := slices.DeleteFunc(slices.Clone(instances), func(instance string) bool { return instance == primary })
+	cluster.conduits[primary].SetNATState(testNATEntries(testNATEntry(0, "1", 20000)))
+	cluster.waitForFlows(t, 1, survivors...)
+
+	// The two others still form a quorum once the primary is gone, and elect a new one
+	// that takes over the resources under a higher epoch
+	cluster.stop[primary]()
+	newPrimary := cluster.waitForPrimary(t, survivors...)
+	if newEpoch := cluster.nodes[newPrimary].epochs.leader(); newEpoch <= epoch {
+		t.Fatalf("new primary leads epoch %d, want more than %d", newEpoch, epoch)
+	}
+	cluster.waitForFlows(t, 1, survivors...)
+}
+
+// electedAfter is a quorum elector that wins the election on its campaigns-th campaign
+type electedAfter struct {
+	campaigns int
+	calls     int
+}
+
+func (e *electedAfter) Campaign(context.Context) (bool, error) {
+	e.calls++
+	return e.HoldsLease(), nil
+}
+
+func (e *electedAfter) Resign(context.Context) error { return nil }
+
+func (e *electedAfter) Observe(context.Context) (string, error) { return "", ErrNoLeader }
+
+func (e *electedAfter) HoldsLease() bool { return e.calls >= e.campaigns }
+
+func TestAcquireLeaseRaftCampaignsUntilElected(t *testing.T) {
+	elector := &electedAfter{campaigns: 3}
+	lf := newTestFailover(t, newTestCloud(), "i-a", func(config *LeaderConfig) {
+		config.ElectionBackend = ElectionBackendRaft
+		config.Elector = elector
+		config.NodeID = "a"
+		config.ClusterPeers = []string{"a=127.0.0.1:1023", "b=127.0.0.2:1023", "c=127.0.0.3:1023"}
+		config.LeaderCheckInterval = 20 * time.Millisecond
+	})
+
+	if lf.config.LeaseDuration != 60*time.Millisecond {
+		t.Fatalf("raft lease duration: got %s, want 3x the leader check interval", lf.config.LeaseDuration)
+	}
+	if err := lf.acquireLease(context.Background()); err != nil {
+		t.Fatalf("acquire after %d campaigns: %v", elector.calls, err)
+	}
+	if elector.calls != 3 {
+		t.Fatalf("campaigns: got %d, want 3", elector.calls)
+	}
+}
+
+func TestRaftTLSLayer(t *testing.T) {
+	ca := newTestCA(t)
+	newReloader := func(ca *testCA, san string) *tlsReloader {
+		cert, key := ca.issue(t, 10, san)
+		reloader, err := newTLSReloader(newTestTLSConfig(t, ca, cert, key), logging.Test(t, logging.Zerolog, san))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = reloader.Close() })
+		return reloader
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newReloader(ca, "node-a")
+	layer := &raftTLSLayer{listener: listener, advertise: listener.Addr(), server: server.serverConfig(), client: server.clientConfig()}
+	t.Cleanup(func() { _ = layer.Close() })
+
+	// receive accepts the next connection and returns what the server read from it
+	receive := func() (string, error) {
+		conn, err := layer.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = conn.Close() }()
+		_ = conn.SetDeadline(time.Now().Add(time.Second))
+
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(conn, buf)
+		return string(buf), err
+	}
+
+	tests := []struct {
+		name string
+		dial func() (net.Conn, error)
+		ok   bool
+	}{
+		{
+			name: "peer from the CA",
+			dial: func() (net.Conn, error) {
+				peer := &raftTLSLayer{client: newReloader(ca, "node-b").clientConfig()}
+				return peer.Dial(raft.ServerAddress(listener.Addr().String()), time.Second)
+			},
+			ok: true,
+		},
+		{
+			name: "peer from another CA",
+			dial: func() (net.Conn, error) {
+				return tls.Dial("tcp", listener.Addr().String(), newReloader(newTestCA(t), "node-b").clientConfig())
+			},
+		},
+		{
+			name: "plain TCP",
+			dial: func() (net.Conn, error) {
+				return net.Dial("tcp", listener.Addr().String())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := make(chan error, 1)
+			go func() {
+				got, err := receive()
+				if err == nil && got != "raft" {
+					t.Errorf("received %q, want raft", got)
+				}
+				received <- err
+			}()
+
+			conn, err := tt.dial()
+			if err == nil {
+				_, _ = conn.Write([]byte("raft"))
+				defer func() { _ = conn.Close() }()
+			}
+
+			err = <-received
+			if tt.ok && err != nil {
+				t.Fatalf("raft transport refused a peer from the CA: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("raft transport accepted a peer without a certificate from the CA")
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMemoryElector(t *testing.T) {
+	ctx := context.Background()
+	election := NewMemoryElection()
+	a := NewMemoryElector(election, "a")
+	b := NewMemoryElector(election, "b")
+
+	if _, err := a.Observe(ctx); !errors.Is(err, ErrNoLeader) {
+		t.Fatalf("observe before any campaign: got %v, want ErrNoLeader", err)
+	}
+
+	if leader, err := a.Campaign(ctx); err != nil || !leader {
+		t.Fatalf("first campaign: got %t, %v, want leader", leader, err)
+	}
+	if leader, err := b.Campaign(ctx); err != nil || leader {
+		t.Fatalf("second candidate: got %t, %v, want not leader", leader, err)
+	}
+	if leader, err := a.Campaign(ctx); err != nil || !leader {
+		t.Fatalf("leader campaigning again: got %t, %v, want leader", leader, err)
+	}
+	if observed, err := b.Observe(ctx); err != nil || observed != "a" {
+		t.Fatalf("observe: got %q, %v, want a", observed, err)
+	}
+
+	// Resigning as a non-leader leaves the leader in place
+	if err := b.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if election.Leader() != "a" {
+		t.Fatalf("leader after non-leader resigned: got %q, want a", election.Leader())
+	}
+
+	if err := a.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if leader, err := b.Campaign(ctx); err != nil || !leader {
+		t.Fatalf("campaign after leader resigned: got %t, %v, want leader", leader, err)
+	}
+
+	election.SetLeader("a")
+	if leader, err := b.Campaign(ctx); err != nil || leader {
+		t.Fatalf("campaign after forced leader: got %t, %v, want not leader", leader, err)
+	}
+}
+
+func TestStaticElector(t *testing.T) {
+	ctx := context.Background()
+
+	primary := NewStaticElector("a", true)
+	if leader, err := primary.Campaign(ctx); err != nil || !leader {
+		t.Fatalf("forced primary: got %t, %v, want leader", leader, err)
+	}
+	if err := primary.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if leader, err := primary.Campaign(ctx); err != nil || !leader {
+		t.Fatalf("forced primary after resigning: got %t, %v, want leader", leader, err)
+	}
+	if observed, err := primary.Observe(ctx); err != nil || observed != "a" {
+		t.Fatalf("observe forced primary: got %q, %v, want a", observed, err)
+	}
+
+	secondary := NewStaticElector("b", false)
+	if leader, err := secondary.Campaign(ctx); err != nil || leader {
+		t.Fatalf("forced secondary: got %t, %v, want not leader", leader, err)
+	}
+	if _, err := secondary.Observe(ctx); !errors.Is(err, ErrNoLeader) {
+		t.Fatalf("observe forced secondary: got %v, want ErrNoLeader", err)
+	}
+}
+
+func TestValidateElectionBackend(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  LeaderConfig
+		backend string
+		wantErr bool
+	}{
+		{
+			name:    "eni by default",
+			config:  LeaderConfig{},
+			backend: ElectionBackendENI,
+		},
+		{
+			name:    "force role selects static",
+			config:  LeaderConfig{DisableENICheck: true, ForceRole: RoleStringPrimary},
+			backend: ElectionBackendStatic,
+		},
+		{
+			name:    "disabled ENI checks with a shared lock file",
+			config:  LeaderConfig{DisableENICheck: true, ElectorLockFile: "/shared/leader.lock"},
+			backend: ElectionBackendFile,
+		},
+		{
+			name:    "disabled ENI checks without a shared lock file",
+			config:  LeaderConfig{DisableENICheck: true},
+			wantErr: true,
+		},
+		{
+			name:    "invalid forced role",
+			config:  LeaderConfig{DisableENICheck: true, ForceRole: "leader"},
+			wantErr: true,
+		},
+		{
+			name:    "forced role with another backend",
+			config:  LeaderConfig{DisableENICheck: true, ForceRole: RoleStringSecondary, ElectionBackend: ElectionBackendFile},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.ENIIP = "10.0.1.5"
+			config.LocalSocket = "/unix/tmp/conduit.sock"
+			config.StateDir = t.TempDir()
+
+			err := config.Validate()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got backend %s, want an error", config.ElectionBackend)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.ElectionBackend != tt.backend {
+				t.Fatalf("got backend %s, want %s", config.ElectionBackend, tt.backend)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EpochFileName is the name of the file in the state directory that holds the leadership epoch
+const EpochFileName = "epoch"
+
+// ErrStaleEpoch is returned when this node's leadership epoch has been superseded
+var ErrStaleEpoch = errors.New("leadership epoch is stale")
+
+// epochStore persists the highest leadership epoch this node has seen
+type epochStore struct {
+	path string
+
+	mu          sync.Mutex
+	epoch       uint64 // highest epoch seen from any source
+	leaderEpoch uint64 // epoch under which this node became primary, 0 when not primary
+}
+
+// newEpochStore loads the persisted epoch from the state directory
+func newEpochStore(stateDir string) (*epochStore, error) {
+	if err := os.MkdirAll(stateDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create state directory %s: %w", stateDir, err)
+	}
+
+	s := &epochStore{
+		path: filepath.Join(stateDir, EpochFileName),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to read epoch file %s: %w", s.path, err)
+	}
+
+	s.epoch, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse epoch file %s: %w", s.path, err)
+	}
+
+	return s, nil
+}
+
+// current returns the highest epoch seen
+func (s *epochStore) current() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.epoch
+}
+
+// leader returns the epoch this node leads under, or 0 if it is not primary
+func (s *epochStore) leader() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.leaderEpoch
+}
+
+// observe records an epoch seen from a peer or the cloud, and reports whether
+// it supersedes the epoch this node is leading under
+func (s *epochStore) observe(epoch uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stale := s.leaderEpoch != 0 && epoch > s.leaderEpoch
+	if epoch <= s.epoch {
+		return stale, nil
+	}
+
+	// A higher epoch seen only in memory still fences, so record it even if the write fails
+	s.epoch = epoch
+	return stale, s.persist(epoch)
+}
+
+// advance claims a new epoch greater than both the local epoch and the given floor. The
+// epoch is only led once it is durable, so a failed write leaves this node not leading.
+func (s *epochStore) advance(floor uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	epoch := max(s.epoch, floor) + 1
+	if err := s.persist(epoch); err != nil {
+		return 0, err
+	}
+
+	s.epoch = epoch
+	s.leaderEpoch = epoch
+	return epoch, nil
+}
+
+// resign stops leading under the current epoch
+func (s *epochStore) resign() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leaderEpoch = 0
+}
+
+// persist atomically and durably writes epoch to disk, so it cannot roll back after a
+// crash; callers must hold s.mu
+func (s *epochStore) persist(epoch uint64) error {
+	tmp := s.path + ".tmp"
+	if err := writeFileSync(tmp, []byte(strconv.FormatUint(epoch, 10)+"\n")); err != nil {
+		return fmt.Errorf("failed to write epoch file %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to rename epoch file %s: %w", tmp, err)
+	}
+	if err := syncDir(filepath.Dir(s.path)); err != nil {
+		return fmt.Errorf("failed to sync state directory of %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// writeFileSync writes a file and flushes it to disk before returning
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir flushes a directory to disk, making a rename into it durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		_ = d.Close()
+		return err
+	}
+	return d.Close()
+}
+
+// GetEpoch returns the highest leadership epoch this node has seen
+func (lf *LeaderFailover) GetEpoch() uint64 {
+	return lf.epochs.current()
+}
+
+// claimEpoch starts a new leadership epoch before this node acts as primary. The
+// new epoch is higher than anything seen locally, from the peer, or stamped in the cloud.
+// A promotion fails when the epoch in the cloud cannot be read, as the claimed epoch
+// could then be lower than one a newer primary holds.
+func (lf *LeaderFailover) claimEpoch(ctx context.Context) (uint64, error) {
+	var floor uint64
+	if lf.cloud != nil {
+		cloudEpoch, _, err := lf.cloud.GetEpochTag(ctx, lf.config.ENIIP)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read cloud epoch: %w", err)
+		}
+		floor = cloudEpoch
+	}
+
+	epoch, err := lf.epochs.advance(floor)
+	if err != nil {
+		return 0, err
+	}
+
+	lf.logger.Info().
+		Uint64("epoch", epoch).
+		Uint64("cloud_epoch", floor).
+		Msg("Claimed new leadership epoch")
+
+	return epoch, nil
+}
+
+// observeEpoch records an epoch received from the peer and steps down if it
+// supersedes ours. It returns true if this node's leadership is stale.
+func (lf *LeaderFailover) observeEpoch(epoch uint64, source string) bool {
+	stale, err := lf.epochs.observe(epoch)
+	if err != nil {
+		lf.logger.Error().Err(err).Uint64("epoch", epoch).Msg("Failed to persist observed epoch")
+	}
+
+	if stale {
+		lf.stepDown(fmt.Sprintf("higher epoch %d observed via %s", epoch, source))
+	}
+
+	return stale
+}
+
+// checkFence verifies this node still holds the current epoch, and the leadership
+// lease if the elector uses one, before mutating AWS state
+func (lf *LeaderFailover) checkFence(ctx context.Context) error {
+	if err := lf.checkLease(); err != nil {
+		lf.stepDown("leadership lease lapsed")
+		return err
+	}
+
+	leaderEpoch := lf.epochs.leader()
+	if leaderEpoch == 0 {
+		return fmt.Errorf("%w: node is not leading an epoch", ErrStaleEpoch)
+	}
+
+	if lf.epochs.current() > leaderEpoch {
+		return fmt.Errorf("%w: leading epoch %d, seen %d", ErrStaleEpoch, leaderEpoch, lf.epochs.current())
+	}
+
+	if lf.cloud == nil {
+		return nil
+	}
+
+	cloudEpoch, holderENI, err := lf.cloud.GetEpochTag(ctx, lf.config.ENIIP)
+	if err != nil {
+		return fmt.Errorf("failed to read cloud epoch: %w", err)
+	}
+
+	if lf.observeEpoch(cloudEpoch, "cloud tag") {
+		return fmt.Errorf("%w: leading epoch %d, cloud has %d", ErrStaleEpoch, leaderEpoch, cloudEpoch)
+	}
+
+	// Two nodes that claimed the same epoch concurrently are told apart by
+	// which of them ended up holding the ENI IP
+	if currentENI := lf.currentENI.Load(); cloudEpoch == leaderEpoch && currentENI != "" && holderENI != currentENI {
+		lf.stepDown(fmt.Sprintf("epoch %d is held by ENI %s", cloudEpoch, holderENI))
+		return fmt.Errorf("%w: epoch %d is held by ENI %s", ErrStaleEpoch, cloudEpoch, holderENI)
+	}
+
+	return nil
+}
+
+// stepDown relinquishes the primary role because this node's epoch is stale
+func (lf *LeaderFailover) stepDown(reason string) {
+	lf.epochs.resign()
+
+	// A node that is still promoting has not set its role yet but must step down too
+	if lf.currentRole.Load() == RoleSecondary {
+		return
+	}
+
+	lf.logger.Warn().
+		Str("reason", reason).
+		Uint64("epoch", lf.epochs.current()).
+		Msg("Stepping down from primary role")
+
+	// A planned switchover steps the primary down once its secondary claimed a newer epoch
+	trigger := TriggerStepDown
+	if switchover, ok := lf.switchoverTrigger.Load().(string); ok && lf.switchingOver.Load() {
+		trigger = switchover
+	}
+
+	// Step downs have their own channel so a pending role request cannot crowd them out;
+	// one already waiting demotes the node just the same
+	select {
+	case lf.stepDownCh <- newRoleRequest(RoleSecondary, trigger, "step down: "+reason, nil):
+	default:
+		lf.logger.Debug().Str("reason", reason).Msg("Step down already pending")
+	}
+}
@@ -0,0 +1,319 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEpochStorePersistsAcrossRestarts(t *testing.T) {
+	stateDir := t.TempDir()
+
+	s, err := newEpochStore(stateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epoch, err := s.advance(4); err != nil || epoch != 5 {
+		t.Fatalf("advance: got %d, %v, want 5", epoch, err)
+	}
+	if _, err := s.observe(9); err != nil {
+		t.Fatal(err)
+	}
+
+	// The epoch is renamed into place, leaving no temporary file behind
+	if _, err := os.Stat(filepath.Join(stateDir, EpochFileName+".tmp")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("temporary epoch file left behind: %v", err)
+	}
+
+	restarted, err := newEpochStore(stateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epoch := restarted.current(); epoch != 9 {
+		t.Fatalf("epoch after restart: got %d, want 9", epoch)
+	}
+	if epoch := restarted.leader(); epoch != 0 {
+		t.Fatalf("leading epoch after restart: got %d, want 0", epoch)
+	}
+	if epoch, err := restarted.advance(0); err != nil || epoch != 10 {
+		t.Fatalf("advance after restart: got %d, %v, want 10", epoch, err)
+	}
+}
+
+func TestEpochStoreIgnoresInterruptedWrite(t *testing.T) {
+	stateDir := t.TempDir()
+
+	s, err := newEpochStore(stateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.advance(0); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash before the rename leaves a partial temporary file, never a partial epoch
+	tmp := filepath.Join(stateDir, EpochFileName+".tmp")
+	if err := os.WriteFile(tmp, []byte("12"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, err := newEpochStore(stateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epoch := restarted.current(); epoch != 1 {
+		t.Fatalf("epoch after an interrupted write: got %d, want 1", epoch)
+	}
+	if epoch, err := restarted.advance(0); err != nil || epoch != 2 {
+		t.Fatalf("advance after an interrupted write: got %d, %v, want 2", epoch, err)
+	}
+
+	reloaded, err := newEpochStore(stateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epoch := reloaded.current(); epoch != 2 {
+		t.Fatalf("epoch after overwriting the temporary file: got %d, want 2", epoch)
+	}
+}
+
+func TestEpochStoreAdvanceFailedWrite(t *testing.T) {
+	stateDir := t.TempDir()
+
+	s, err := newEpochStore(stateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.advance(0); err != nil {
+		t.Fatal(err)
+	}
+	s.resign()
+
+	// A directory in place of the temporary file makes the write fail, even as root
+	if err := os.Mkdir(filepath.Join(stateDir, EpochFileName+".tmp"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.advance(0); err == nil {
+		t.Fatal("advanced to an epoch that was never written")
+	}
+	if epoch := s.current(); epoch != 1 {
+		t.Fatalf("epoch after a failed write: got %d, want 1", epoch)
+	}
+	if epoch := s.leader(); epoch != 0 {
+		t.Fatalf("leading epoch after a failed write: got %d, want 0", epoch)
+	}
+}
+
+func TestEpochStoreRejectsCorruptFile(t *testing.T) {
+	stateDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(stateDir, EpochFileName), []byte("not an epoch\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newEpochStore(stateDir); err == nil {
+		t.Fatal("loaded a corrupt epoch file")
+	}
+}
+
+func TestEpochStoreObserve(t *testing.T) {
+	tests := []struct {
+		name      string
+		leading   bool
+		observed  uint64
+		wantStale bool
+		wantEpoch uint64
+	}{
+		{name: "lower epoch while leading", leading: true, observed: 2, wantStale: false, wantEpoch: 3},
+		{name: "same epoch while leading", leading: true, observed: 3, wantStale: false, wantEpoch: 3},
+		{name: "higher epoch while leading", leading: true, observed: 4, wantStale: true, wantEpoch: 4},
+		{name: "higher epoch while not leading", leading: false, observed: 4, wantStale: false, wantEpoch: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newEpochStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.advance(2); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.leading {
+				s.resign()
+			}
+
+			stale, err := s.observe(tt.observed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stale != tt.wantStale {
+				t.Fatalf("stale: got %t, want %t", stale, tt.wantStale)
+			}
+			if epoch := s.current(); epoch != tt.wantEpoch {
+				t.Fatalf("epoch: got %d, want %d", epoch, tt.wantEpoch)
+			}
+		})
+	}
+}
+
+// pendingStepDown returns the step down waiting for the role management loop, if any
+func pendingStepDown(lf *LeaderFailover) *roleRequest {
+	select {
+	case request := <-lf.stepDownCh:
+		return &request
+	default:
+		return nil
+	}
+}
+
+func TestCheckFence(t *testing.T) {
+	tests := []struct {
+		name         string
+		fence        func(t *testing.T, lf *LeaderFailover, epoch uint64)
+		wantStale    bool
+		wantStepDown bool
+	}{
+		{
+			name:  "current epoch",
+			fence: func(*testing.T, *LeaderFailover, uint64) {},
+		},
+		{
+			name: "not leading",
+			fence: func(_ *testing.T, lf *LeaderFailover, _ uint64) {
+				lf.epochs.resign()
+			},
+			wantStale: true,
+		},
+		{
+			name: "higher epoch seen from the peer",
+			fence: func(_ *testing.T, lf *LeaderFailover, epoch uint64) {
+				// Recorded by a peer before the step down it causes resigned the epoch
+				lf.epochs.mu.Lock()
+				lf.epochs.epoch = epoch + 1
+				lf.epochs.mu.Unlock()
+			},
+			wantStale: true,
+		},
+		{
+			name: "higher epoch stamped in the cloud",
+			fence: func(t *testing.T, lf *LeaderFailover, epoch uint64) {
+				if err := lf.cloud.SetEpochTag(context.Background(), "eni-a", epoch+1); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantStale:    true,
+			wantStepDown: true,
+		},
+		{
+			name: "same epoch held by another ENI",
+			fence: func(_ *testing.T, lf *LeaderFailover, _ uint64) {
+				lf.currentENI.Store("eni-b")
+			},
+			wantStale:    true,
+			wantStepDown: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lf, epoch := newTestPrimary(t, newTestCloud())
+			tt.fence(t, lf, epoch)
+
+			err := lf.checkFence(context.Background())
+			if stale := errors.Is(err, ErrStaleEpoch); stale != tt.wantStale {
+				t.Fatalf("fence: got %v, want stale %t", err, tt.wantStale)
+			}
+			if stepDown := pendingStepDown(lf) != nil; stepDown != tt.wantStepDown {
+				t.Fatalf("step down: got %t, want %t", stepDown, tt.wantStepDown)
+			}
+		})
+	}
+}
+
+func TestCheckFenceUnreadableCloudEpoch(t *testing.T) {
+	cloud := newTestCloud()
+	lf, _ := newTestPrimary(t, cloud)
+	injected := errors.New("throttled")
+
+	cloud.FailNext("GetEpochTag", injected)
+	if err := lf.checkFence(context.Background()); !errors.Is(err, injected) {
+		t.Fatalf("fence: got %v, want the cloud error", err)
+	}
+	if pendingStepDown(lf) != nil {
+		t.Fatal("stepped down on an unreadable cloud epoch")
+	}
+}
+
+func TestObserveHigherEpochStepsDown(t *testing.T) {
+	lf, epoch := newTestPrimary(t, newTestCloud())
+
+	if lf.observeEpoch(epoch, "test") {
+		t.Fatal("own epoch reported as stale")
+	}
+	if pendingStepDown(lf) != nil {
+		t.Fatal("stepped down on its own epoch")
+	}
+
+	if !lf.observeEpoch(epoch+1, "test") {
+		t.Fatal("higher epoch not reported as stale")
+	}
+	request := pendingStepDown(lf)
+	if request == nil || request.role != RoleSecondary {
+		t.Fatalf("step down: got %+v, want a request for the secondary role", request)
+	}
+	if leader := lf.epochs.leader(); leader != 0 {
+		t.Fatalf("leading epoch after stepping down: got %d, want 0", leader)
+	}
+	if current := lf.GetEpoch(); current != epoch+1 {
+		t.Fatalf("epoch after stepping down: got %d, want %d", current, epoch+1)
+	}
+}
+
+func TestHeartbeatRejectsStaleEpoch(t *testing.T) {
+	lf := newTestFailover(t, newTestCloud(), "i-b", nil)
+	lf.currentRole.Store(RoleSecondary)
+	if _, err := lf.epochs.observe(5); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := lf.Heartbeat(context.Background(), &FailoverHeartbeatRequest{Sequence: 1, Epoch: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Success || response.Epoch != 5 {
+		t.Fatalf("heartbeat from a stale primary: got success %t with epoch %d, want a refusal with epoch 5", response.Success, response.Epoch)
+	}
+	if stats := lf.GetHeartbeatStats(); stats.Sequence != 0 {
+		t.Fatalf("stale heartbeat recorded as sequence %d", stats.Sequence)
+	}
+}
+
+func TestClaimEpoch(t *testing.T) {
+	ctx := context.Background()
+	cloud := newTestCloud()
+	lf := newTestFailover(t, cloud, "i-b", nil)
+
+	// The new epoch is above the one a previous primary stamped in the cloud
+	if err := lf.cloud.SetEpochTag(ctx, "eni-a", 7); err != nil {
+		t.Fatal(err)
+	}
+	epoch, err := lf.claimEpoch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epoch != 8 || lf.epochs.leader() != 8 {
+		t.Fatalf("claimed epoch: got %d leading %d, want 8", epoch, lf.epochs.leader())
+	}
+
+	// Without the cloud epoch the claim could fall below a newer primary's
+	injected := errors.New("throttled")
+	cloud.FailNext("GetEpochTag", injected)
+	if _, err := lf.claimEpoch(ctx); !errors.Is(err, injected) {
+		t.Fatalf("claim with an unreadable cloud epoch: got %v, want the cloud error", err)
+	}
+	if current := lf.epochs.current(); current != 8 {
+		t.Fatalf("epoch after a failed claim: got %d, want 8", current)
+	}
+}
@@ -4,10 +4,10 @@
 package failover
 
 import (
-	"context
+	"context"
 	"errors"
 
-	"git
+	"sync"
 	"net"
 	"github.com/loopholelabs/polyglot/v2"
 
@@ -25,7 +25,15 @@ type FailoverSyncStateRequest struct {
 	error error
 	flags uint8
 
-	RequestId string
+	RequestId    string
+	Epoch        uint64
+	StreamId     string
+	SinceVersion uint64
+	Chunked      bool
+	WireVersion  uint32
+	Compress     bool
+	NodeId       string
+	Port         uint32
 }
 
 func NewFailoverSyncStateRequest() *FailoverSyncStateRequest {
@@ -45,7 +53,7 @@ func (x *FailoverSyncStateRequest) Encode(b *polyglot.Buffer) {
 			return
 		}
 		polyglot.Encoder(b).Uint8(x.flags)
-		polyglot.Encoder(b).String(x.RequestId)
+		polyglot.Encoder(b).String(x.RequestId).Uint64(x.Epoch).String(x.StreamId).Uint64(x.SinceVersion).Bool(x.Chunked).Uint32(x.WireVersion).Bool(x.Compress).String(x.NodeId).Uint32(x.Port)
 	}
 }
 
@@ -74,6 +82,38 @@ func (x *FailoverSyncStateRequest) decode(d *polyglot.BufferDecoder) error {
 	if err != nil {
 		return err
 	}
+	x.Epoch, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	x.StreamId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.SinceVersion, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	x.Chunked, err = d.Bool()
+	if err != nil {
+		return err
+	}
+	x.WireVersion, err = d.Uint32()
+	if err != nil {
+		return err
+	}
+	x.Compress, err = d.Bool()
+	if err != nil {
+		return err
+	}
+	x.NodeId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Port, err = d.Uint32()
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -529,25 +569,23 @@ func (x *FailoverNATState) decode(d *polyglot.BufferDecoder) error {
 	return nil
 }
 
-type FailoverSyncStateResponse struct {
+type FailoverNATKeyTouch struct {
 	error error
 	flags uint8
 
-	RequestId    string
-	Success      bool
-	ErrorMessage string
-	State        *FailoverNATState
+	Key      *FailoverNATKey
+	LastSeen string
 }
 
-func NewFailoverSyncStateResponse() *FailoverSyncStateResponse {
-	return &FailoverSyncStateResponse{}
+func NewFailoverNATKeyTouch() *FailoverNATKeyTouch {
+	return &FailoverNATKeyTouch{}
 }
 
-func (x *FailoverSyncStateResponse) Error(b *polyglot.Buffer, err error) {
+func (x *FailoverNATKeyTouch) Error(b *polyglot.Buffer, err error) {
 	polyglot.Encoder(b).Error(err)
 }
 
-func (x *FailoverSyncStateResponse) Encode(b *polyglot.Buffer) {
+func (x *FailoverNATKeyTouch) Encode(b *polyglot.Buffer) {
 	if x == nil {
 		polyglot.Encoder(b).Nil()
 	} else {
@@ -556,19 +594,19 @@ func (x *FailoverSyncStateResponse) Encode(b *polyglot.Buffer) {
 			return
 		}
 		polyglot.Encoder(b).Uint8(x.flags)
-		polyglot.Encoder(b).String(x.RequestId).Bool(x.Success).String(x.ErrorMessage)
-		x.State.Encode(b)
+		polyglot.Encoder(b).String(x.LastSeen)
+		x.Key.Encode(b)
 	}
 }
 
-func (x *FailoverSyncStateResponse) Decode(b []byte) error {
+func (x *FailoverNATKeyTouch) Decode(b []byte) error {
 	if x == nil {
 		return ErrDecodeNil
 	}
 	return x.decode(polyglot.Decoder(b))
 }
 
-func (x *FailoverSyncStateResponse) decode(d *polyglot.BufferDecoder) error {
+func (x *FailoverNATKeyTouch) decode(d *polyglot.BufferDecoder) error {
 	if d.Nil() {
 		return nil
 	}
@@ -582,21 +620,13 @@ func (x *FailoverSyncStateResponse) decode(d *polyglot.BufferDecoder) error {
 	if err != nil {
 		return err
 	}
-	x.RequestId, err = d.String()
-	if err != nil {
-		return err
-	}
-	x.Success, err = d.Bool()
-	if err != nil {
-		return err
-	}
-	x.ErrorMessage, err = d.String()
+	x.LastSeen, err = d.String()
 	if err != nil {
 		return err
 	}
 	if !d.Nil() {
-		x.State = NewFailoverNATState()
-		err = x.State.decode(d)
+		x.Key = NewFailoverNATKey()
+		err = x.Key.decode(d)
 		if err != nil {
 			return err
 		}
@@ -604,22 +634,24 @@ func (x *FailoverSyncStateResponse) decode(d *polyglot.BufferDecoder) error {
 	return nil
 }
 
-type FailoverHealthCheckRequest struct {
+type FailoverNATTableDelta struct {
 	error error
 	flags uint8
 
-	RequestId string
+	Inserts []*FailoverNATKeyValuePair
+	Touches []*FailoverNATKeyTouch
+	Deletes []*FailoverNATKey
 }
 
-func NewFailoverHealthCheckRequest() *FailoverHealthCheckRequest {
-	return &FailoverHealthCheckRequest{}
+func NewFailoverNATTableDelta() *FailoverNATTableDelta {
+	return &FailoverNATTableDelta{}
 }
 
-func (x *FailoverHealthCheckRequest) Error(b *polyglot.Buffer, err error) {
+func (x *FailoverNATTableDelta) Error(b *polyglot.Buffer, err error) {
 	polyglot.Encoder(b).Error(err)
 }
 
-func (x *FailoverHealthCheckRequest) Encode(b *polyglot.Buffer) {
+func (x *FailoverNATTableDelta) Encode(b *polyglot.Buffer) {
 	if x == nil {
 		polyglot.Encoder(b).Nil()
 	} else {
@@ -628,18 +660,30 @@ func (x *FailoverHealthCheckRequest) Encode(b *polyglot.Buffer) {
 			return
 		}
 		polyglot.Encoder(b).Uint8(x.flags)
-		polyglot.Encoder(b).String(x.RequestId)
+
+		polyglot.Encoder(b).Slice(uint32(len(x.Inserts)), polyglot.AnyKind)
+		for _, v := range x.Inserts {
+			v.Encode(b)
+		}
+		polyglot.Encoder(b).Slice(uint32(len(x.Touches)), polyglot.AnyKind)
+		for _, v := range x.Touches {
+			v.Encode(b)
+		}
+		polyglot.Encoder(b).Slice(uint32(len(x.Deletes)), polyglot.AnyKind)
+		for _, v := range x.Deletes {
+			v.Encode(b)
+		}
 	}
 }
 
-func (x *FailoverHealthCheckRequest) Decode(b []byte) error {
+func (x *FailoverNATTableDelta) Decode(b []byte) error {
 	if x == nil {
 		return ErrDecodeNil
 	}
 	return x.decode(polyglot.Decoder(b))
 }
 
-func (x *FailoverHealthCheckRequest) decode(d *polyglot.BufferDecoder) error {
+func (x *FailoverNATTableDelta) decode(d *polyglot.BufferDecoder) error {
 	if d.Nil() {
 		return nil
 	}
@@ -653,32 +697,80 @@ func (x *FailoverHealthCheckRequest) decode(d *polyglot.BufferDecoder) error {
 	if err != nil {
 		return err
 	}
-	x.RequestId, err = d.String()
+	var sliceSize uint32
+	sliceSize, err = d.Slice(polyglot.AnyKind)
+	if err != nil {
+		return err
+	}
+	if uint32(len(x.Inserts)) != sliceSize {
+		x.Inserts = make([]*FailoverNATKeyValuePair, sliceSize)
+	}
+	for i := uint32(0); i < sliceSize; i++ {
+		if x.Inserts[i] == nil {
+			x.Inserts[i] = NewFailoverNATKeyValuePair()
+		}
+		err = x.Inserts[i].decode(d)
+		if err != nil {
+			return err
+		}
+	}
+	sliceSize, err = d.Slice(polyglot.AnyKind)
+	if err != nil {
+		return err
+	}
+	if uint32(len(x.Touches)) != sliceSize {
+		x.Touches = make([]*FailoverNATKeyTouch, sliceSize)
+	}
+	for i := uint32(0); i < sliceSize; i++ {
+		if x.Touches[i] == nil {
+			x.Touches[i] = NewFailoverNATKeyTouch()
+		}
+		err = x.Touches[i].decode(d)
+		if err != nil {
+			return err
+		}
+	}
+	sliceSize, err = d.Slice(polyglot.AnyKind)
 	if err != nil {
 		return err
 	}
+	if uint32(len(x.Deletes)) != sliceSize {
+		x.Deletes = make([]*FailoverNATKey, sliceSize)
+	}
+	for i := uint32(0); i < sliceSize; i++ {
+		if x.Deletes[i] == nil {
+			x.Deletes[i] = NewFailoverNATKey()
+		}
+		err = x.Deletes[i].decode(d)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-type FailoverHealthCheckResponse struct {
+type FailoverNATDelta struct {
 	error error
 	flags uint8
 
-	RequestId  string
-	Success    bool
-	NodeRole   string
-	InstanceId string
+	Ips            []string
+	TcpInbound     *FailoverNATTableDelta
+	TcpOutbound    *FailoverNATTableDelta
+	UdpInbound     *FailoverNATTableDelta
+	UdpOutbound    *FailoverNATTableDelta
+	NatPortUpdates []*FailoverNATBitmapPair
+	NatPortDeletes []*FailoverNATBitmapPair
 }
 
-func NewFailoverHealthCheckResponse() *FailoverHealthCheckResponse {
-	return &FailoverHealthCheckResponse{}
+func NewFailoverNATDelta() *FailoverNATDelta {
+	return &FailoverNATDelta{}
 }
 
-func (x *FailoverHealthCheckResponse) Error(b *polyglot.Buffer, err error) {
+func (x *FailoverNATDelta) Error(b *polyglot.Buffer, err error) {
 	polyglot.Encoder(b).Error(err)
 }
 
-func (x *FailoverHealthCheckResponse) Encode(b *polyglot.Buffer) {
+func (x *FailoverNATDelta) Encode(b *polyglot.Buffer) {
 	if x == nil {
 		polyglot.Encoder(b).Nil()
 	} else {
@@ -687,18 +779,34 @@ func (x *FailoverHealthCheckResponse) Encode(b *polyglot.Buffer) {
 			return
 		}
 		polyglot.Encoder(b).Uint8(x.flags)
-		polyglot.Encoder(b).String(x.RequestId).Bool(x.Success).String(x.NodeRole).String(x.InstanceId)
+
+		polyglot.Encoder(b).Slice(uint32(len(x.Ips)), polyglot.StringKind)
+		for _, v := range x.Ips {
+			polyglot.Encoder(b).String(v)
+		}
+		polyglot.Encoder(b).Slice(uint32(len(x.NatPortUpdates)), polyglot.AnyKind)
+		for _, v := range x.NatPortUpdates {
+			v.Encode(b)
+		}
+		polyglot.Encoder(b).Slice(uint32(len(x.NatPortDeletes)), polyglot.AnyKind)
+		for _, v := range x.NatPortDeletes {
+			v.Encode(b)
+		}
+		x.TcpInbound.Encode(b)
+		x.TcpOutbound.Encode(b)
+		x.UdpInbound.Encode(b)
+		x.UdpOutbound.Encode(b)
 	}
 }
 
-func (x *FailoverHealthCheckResponse) Decode(b []byte) error {
+func (x *FailoverNATDelta) Decode(b []byte) error {
 	if x == nil {
 		return ErrDecodeNil
 	}
 	return x.decode(polyglot.Decoder(b))
 }
 
-func (x *FailoverHealthCheckResponse) decode(d *polyglot.BufferDecoder) error {
+func (x *FailoverNATDelta) decode(d *polyglot.BufferDecoder) error {
 	if d.Nil() {
 		return nil
 	}
@@ -712,43 +820,110 @@ func (x *FailoverHealthCheckResponse) decode(d *polyglot.BufferDecoder) error {
 	if err != nil {
 		return err
 	}
-	x.RequestId, err = d.String()
+	var sliceSize uint32
+	sliceSize, err = d.Slice(polyglot.StringKind)
 	if err != nil {
 		return err
 	}
-	x.Success, err = d.Bool()
-	if err != nil {
-		return err
+	if uint32(len(x.Ips)) != sliceSize {
+		x.Ips = make([]string, sliceSize)
 	}
-	x.NodeRole, err = d.String()
+	for i := uint32(0); i < sliceSize; i++ {
+		x.Ips[i], err = d.String()
+		if err != nil {
+			return err
+		}
+	}
+	sliceSize, err = d.Slice(polyglot.AnyKind)
 	if err != nil {
 		return err
 	}
-	x.InstanceId, err = d.String()
+	if uint32(len(x.NatPortUpdates)) != sliceSize {
+		x.NatPortUpdates = make([]*FailoverNATBitmapPair, sliceSize)
+	}
+	for i := uint32(0); i < sliceSize; i++ {
+		if x.NatPortUpdates[i] == nil {
+			x.NatPortUpdates[i] = NewFailoverNATBitmapPair()
+		}
+		err = x.NatPortUpdates[i].decode(d)
+		if err != nil {
+			return err
+		}
+	}
+	sliceSize, err = d.Slice(polyglot.AnyKind)
 	if err != nil {
 		return err
 	}
+	if uint32(len(x.NatPortDeletes)) != sliceSize {
+		x.NatPortDeletes = make([]*FailoverNATBitmapPair, sliceSize)
+	}
+	for i := uint32(0); i < sliceSize; i++ {
+		if x.NatPortDeletes[i] == nil {
+			x.NatPortDeletes[i] = NewFailoverNATBitmapPair()
+		}
+		err = x.NatPortDeletes[i].decode(d)
+		if err != nil {
+			return err
+		}
+	}
+	if !d.Nil() {
+		x.TcpInbound = NewFailoverNATTableDelta()
+		err = x.TcpInbound.decode(d)
+		if err != nil {
+			return err
+		}
+	}
+	if !d.Nil() {
+		x.TcpOutbound = NewFailoverNATTableDelta()
+		err = x.TcpOutbound.decode(d)
+		if err != nil {
+			return err
+		}
+	}
+	if !d.Nil() {
+		x.UdpInbound = NewFailoverNATTableDelta()
+		err = x.UdpInbound.decode(d)
+		if err != nil {
+			return err
+		}
+	}
+	if !d.Nil() {
+		x.UdpOutbound = NewFailoverNATTableDelta()
+		err = x.UdpOutbound.decode(d)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-type FailoverHeartbeatRequest struct {
+type FailoverSyncStateResponse struct {
 	error error
 	flags uint8
 
-	RequestId  string
-	Timestamp  int64
-	PrimaryEni string
+	RequestId    string
+	Success      bool
+	ErrorMessage string
+	State        *FailoverNATState
+	Epoch        uint64
+	StreamId     string
+	Version      uint64
+	Full         bool
+	Delta        *FailoverNATDelta
+	WireVersion  uint32
+	Compressed   bool
+	Payload      []byte
 }
 
-func NewFailoverHeartbeatRequest() *FailoverHeartbeatRequest {
-	return &FailoverHeartbeatRequest{}
+func NewFailoverSyncStateResponse() *FailoverSyncStateResponse {
+	return &FailoverSyncStateResponse{}
 }
 
-func (x *FailoverHeartbeatRequest) Error(b *polyglot.Buffer, err error) {
+func (x *FailoverSyncStateResponse) Error(b *polyglot.Buffer, err error) {
 	polyglot.Encoder(b).Error(err)
 }
 
-func (x *FailoverHeartbeatRequest) Encode(b *polyglot.Buffer) {
+func (x *FailoverSyncStateResponse) Encode(b *polyglot.Buffer) {
 	if x == nil {
 		polyglot.Encoder(b).Nil()
 	} else {
@@ -757,18 +932,20 @@ func (x *FailoverHeartbeatRequest) Encode(b *polyglot.Buffer) {
 			return
 		}
 		polyglot.Encoder(b).Uint8(x.flags)
-		polyglot.Encoder(b).String(x.RequestId).Int64(x.Timestamp).String(x.PrimaryEni)
+		polyglot.Encoder(b).String(x.RequestId).Bool(x.Success).String(x.ErrorMessage).Uint64(x.Epoch).String(x.StreamId).Uint64(x.Version).Bool(x.Full).Uint32(x.WireVersion).Bool(x.Compressed).Bytes(x.Payload)
+		x.State.Encode(b)
+		x.Delta.Encode(b)
 	}
 }
 
-func (x *FailoverHeartbeatRequest) Decode(b []byte) error {
+func (x *FailoverSyncStateResponse) Decode(b []byte) error {
 	if x == nil {
 		return ErrDecodeNil
 	}
 	return x.decode(polyglot.Decoder(b))
 }
 
-func (x *FailoverHeartbeatRequest) decode(d *polyglot.BufferDecoder) error {
+func (x *FailoverSyncStateResponse) decode(d *polyglot.BufferDecoder) error {
 	if d.Nil() {
 		return nil
 	}
@@ -786,35 +963,85 @@ func (x *FailoverHeartbeatRequest) decode(d *polyglot.BufferDecoder) error {
 	if err != nil {
 		return err
 	}
-	x.Timestamp, err = d.Int64()
+	x.Success, err = d.Bool()
 	if err != nil {
 		return err
 	}
-	x.PrimaryEni, err = d.String()
+	x.ErrorMessage, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Epoch, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	x.StreamId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Version, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	x.Full, err = d.Bool()
+	if err != nil {
+		return err
+	}
+	x.WireVersion, err = d.Uint32()
+	if err != nil {
+		return err
+	}
+	x.Compressed, err = d.Bool()
+	if err != nil {
+		return err
+	}
+	x.Payload, err = d.Bytes(nil)
 	if err != nil {
 		return err
 	}
+	if !d.Nil() {
+		x.State = NewFailoverNATState()
+		err = x.State.decode(d)
+		if err != nil {
+			return err
+		}
+	}
+	if !d.Nil() {
+		x.Delta = NewFailoverNATDelta()
+		err = x.Delta.decode(d)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-type FailoverHeartbeatResponse struct {
+type FailoverSyncStateChunkRequest struct {
 	error error
 	flags uint8
 
-	RequestId string
-	Success   bool
-	Timestamp int64
+	RequestId   string
+	Epoch       uint64
+	StreamId    string
+	Version     uint64
+	Table       uint32
+	Cursor      uint64
+	Limit       uint32
+	WireVersion uint32
+	Compress    bool
+	NodeId      string
+	Port        uint32
 }
 
-func NewFailoverHeartbeatResponse() *FailoverHeartbeatResponse {
-	return &FailoverHeartbeatResponse{}
+func NewFailoverSyncStateChunkRequest() *FailoverSyncStateChunkRequest {
+	return &FailoverSyncStateChunkRequest{}
 }
 
-func (x *FailoverHeartbeatResponse) Error(b *polyglot.Buffer, err error) {
+func (x *FailoverSyncStateChunkRequest) Error(b *polyglot.Buffer, err error) {
 	polyglot.Encoder(b).Error(err)
 }
 
-func (x *FailoverHeartbeatResponse) Encode(b *polyglot.Buffer) {
+func (x *FailoverSyncStateChunkRequest) Encode(b *polyglot.Buffer) {
 	if x == nil {
 		polyglot.Encoder(b).Nil()
 	} else {
@@ -823,18 +1050,18 @@ func (x *FailoverHeartbeatResponse) Encode(b *polyglot.Buffer) {
 			return
 		}
 		polyglot.Encoder(b).Uint8(x.flags)
-		polyglot.Encoder(b).String(x.RequestId).Bool(x.Success).Int64(x.Timestamp)
+		polyglot.Encoder(b).String(x.RequestId).Uint64(x.Epoch).String(x.StreamId).Uint64(x.Version).Uint32(x.Table).Uint64(x.Cursor).Uint32(x.Limit).Uint32(x.WireVersion).Bool(x.Compress).String(x.NodeId).Uint32(x.Port)
 	}
 }
 
-func (x *FailoverHeartbeatResponse) Decode(b []byte) error {
+func (x *FailoverSyncStateChunkRequest) Decode(b []byte) error {
 	if x == nil {
 		return ErrDecodeNil
 	}
 	return x.decode(polyglot.Decoder(b))
 }
 
-func (x *FailoverHeartbeatResponse) decode(d *polyglot.BufferDecoder) error {
+func (x *FailoverSyncStateChunkRequest) decode(d *polyglot.BufferDecoder) error {
 	if d.Nil() {
 		return nil
 	}
@@ -852,30 +1079,1023 @@ func (x *FailoverHeartbeatResponse) decode(d *polyglot.BufferDecoder) error {
 	if err != nil {
 		return err
 	}
-	x.Success, err = d.Bool()
+	x.Epoch, err = d.Uint64()
 	if err != nil {
 		return err
 	}
-	x.Timestamp, err = d.Int64()
+	x.StreamId, err = d.String()
 	if err != nil {
 		return err
 	}
-	return nil
-}
-
-type FailoverService interface {
-	SyncState(context.Context, *FailoverSyncStateRequest) (*FailoverSyncStateResponse, error)
-	HealthCheck(context.Context, *FailoverHealthCheckRequest) (*FailoverHealthCheckResponse, error)
-	Heartbeat(context.Context, *FailoverHeartbeatRequest) (*FailoverHeartbeatResponse, error)
-}
-
-const ConnectionContextKey int = 1000
-const StreamContextKey int = 1001
-
-func SetErrorFlag(flags uint8, error bool) uint8 {
-	return flags | 0x2
-}
-func HasErrorFlag(flags uint8) bool {
+	x.Version, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	x.Table, err = d.Uint32()
+	if err != nil {
+		return err
+	}
+	x.Cursor, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	x.Limit, err = d.Uint32()
+	if err != nil {
+		return err
+	}
+	x.WireVersion, err = d.Uint32()
+	if err != nil {
+		return err
+	}
+	x.Compress, err = d.Bool()
+	if err != nil {
+		return err
+	}
+	x.NodeId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Port, err = d.Uint32()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+type FailoverSyncStateChunkResponse struct {
+	error error
+	flags uint8
+
+	RequestId    string
+	Success      bool
+	ErrorMessage string
+	Epoch        uint64
+	StreamId     string
+	Version      uint64
+	Table        uint32
+	Cursor       uint64
+	Ips          []string
+	Entries      []*FailoverNATKeyValuePair
+	NatPorts     []*FailoverNATBitmapPair
+	NextTable    uint32
+	NextCursor   uint64
+	Done         bool
+	Restart      bool
+	WireVersion  uint32
+	Compressed   bool
+	Payload      []byte
+}
+
+func NewFailoverSyncStateChunkResponse() *FailoverSyncStateChunkResponse {
+	return &FailoverSyncStateChunkResponse{}
+}
+
+func (x *FailoverSyncStateChunkResponse) Error(b *polyglot.Buffer, err error) {
+	polyglot.Encoder(b).Error(err)
+}
+
+func (x *FailoverSyncStateChunkResponse) Encode(b *polyglot.Buffer) {
+	if x == nil {
+		polyglot.Encoder(b).Nil()
+	} else {
+		if x.error != nil {
+			polyglot.Encoder(b).Error(x.error)
+			return
+		}
+		polyglot.Encoder(b).Uint8(x.flags)
+		polyglot.Encoder(b).String(x.RequestId).Bool(x.Success).String(x.ErrorMessage).Uint64(x.Epoch).String(x.StreamId).Uint64(x.Version).Uint32(x.Table).Uint64(x.Cursor).Uint32(x.NextTable).Uint64(x.NextCursor).Bool(x.Done).Bool(x.Restart).Uint32(x.WireVersion).Bool(x.Compressed).Bytes(x.Payload)
+		polyglot.Encoder(b).Slice(uint32(len(x.Ips)), polyglot.StringKind)
+		for _, v := range x.Ips {
+			polyglot.Encoder(b).String(v)
+		}
+		polyglot.Encoder(b).Slice(uint32(len(x.Entries)), polyglot.AnyKind)
+		for _, v := range x.Entries {
+			v.Encode(b)
+		}
+		polyglot.Encoder(b).Slice(uint32(len(x.NatPorts)), polyglot.AnyKind)
+		for _, v := range x.NatPorts {
+			v.Encode(b)
+		}
+	}
+}
+
+func (x *FailoverSyncStateChunkResponse) Decode(b []byte) error {
+	if x == nil {
+		return ErrDecodeNil
+	}
+	return x.decode(polyglot.Decoder(b))
+}
+
+func (x *FailoverSyncStateChunkResponse) decode(d *polyglot.BufferDecoder) error {
+	if d.Nil() {
+		return nil
+	}
+
+	var err error
+	x.error, err = d.Error()
+	if err == nil {
+		return nil
+	}
+	x.flags, err = d.Uint8()
+	if err != nil {
+		return err
+	}
+	x.RequestId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Success, err = d.Bool()
+	if err != nil {
+		return err
+	}
+	x.ErrorMessage, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Epoch, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	x.StreamId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Version, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	x.Table, err = d.Uint32()
+	if err != nil {
+		return err
+	}
+	x.Cursor, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	x.NextTable, err = d.Uint32()
+	if err != nil {
+		return err
+	}
+	x.NextCursor, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	x.Done, err = d.Bool()
+	if err != nil {
+		return err
+	}
+	x.Restart, err = d.Bool()
+	if err != nil {
+		return err
+	}
+	x.WireVersion, err = d.Uint32()
+	if err != nil {
+		return err
+	}
+	x.Compressed, err = d.Bool()
+	if err != nil {
+		return err
+	}
+	x.Payload, err = d.Bytes(nil)
+	if err != nil {
+		return err
+	}
+	var sliceSize uint32
+	sliceSize, err = d.Slice(polyglot.StringKind)
+	if err != nil {
+		return err
+	}
+	if uint32(len(x.Ips)) != sliceSize {
+		x.Ips = make([]string, sliceSize)
+	}
+	for i := uint32(0); i < sliceSize; i++ {
+		x.Ips[i], err = d.String()
+		if err != nil {
+			return err
+		}
+	}
+	sliceSize, err = d.Slice(polyglot.AnyKind)
+	if err != nil {
+		return err
+	}
+	if uint32(len(x.Entries)) != sliceSize {
+		x.Entries = make([]*FailoverNATKeyValuePair, sliceSize)
+	}
+	for i := uint32(0); i < sliceSize; i++ {
+		if x.Entries[i] == nil {
+			x.Entries[i] = NewFailoverNATKeyValuePair()
+		}
+		err = x.Entries[i].decode(d)
+		if err != nil {
+			return err
+		}
+	}
+	sliceSize, err = d.Slice(polyglot.AnyKind)
+	if err != nil {
+		return err
+	}
+	if uint32(len(x.NatPorts)) != sliceSize {
+		x.NatPorts = make([]*FailoverNATBitmapPair, sliceSize)
+	}
+	for i := uint32(0); i < sliceSize; i++ {
+		if x.NatPorts[i] == nil {
+			x.NatPorts[i] = NewFailoverNATBitmapPair()
+		}
+		err = x.NatPorts[i].decode(d)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type FailoverHealthCheckRequest struct {
+	error error
+	flags uint8
+
+	RequestId string
+	Epoch     uint64
+	Probe     bool
+	NodeId    string
+	Port      uint32
+}
+
+func NewFailoverHealthCheckRequest() *FailoverHealthCheckRequest {
+	return &FailoverHealthCheckRequest{}
+}
+
+func (x *FailoverHealthCheckRequest) Error(b *polyglot.Buffer, err error) {
+	polyglot.Encoder(b).Error(err)
+}
+
+func (x *FailoverHealthCheckRequest) Encode(b *polyglot.Buffer) {
+	if x == nil {
+		polyglot.Encoder(b).Nil()
+	} else {
+		if x.error != nil {
+			polyglot.Encoder(b).Error(x.error)
+			return
+		}
+		polyglot.Encoder(b).Uint8(x.flags)
+		polyglot.Encoder(b).String(x.RequestId).Uint64(x.Epoch).Bool(x.Probe).String(x.NodeId).Uint32(x.Port)
+	}
+}
+
+func (x *FailoverHealthCheckRequest) Decode(b []byte) error {
+	if x == nil {
+		return ErrDecodeNil
+	}
+	return x.decode(polyglot.Decoder(b))
+}
+
+func (x *FailoverHealthCheckRequest) decode(d *polyglot.BufferDecoder) error {
+	if d.Nil() {
+		return nil
+	}
+
+	var err error
+	x.error, err = d.Error()
+	if err == nil {
+		return nil
+	}
+	x.flags, err = d.Uint8()
+	if err != nil {
+		return err
+	}
+	x.RequestId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Epoch, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	x.Probe, err = d.Bool()
+	if err != nil {
+		return err
+	}
+	x.NodeId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Port, err = d.Uint32()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+type FailoverHealthCheckResponse struct {
+	error error
+	flags uint8
+
+	RequestId        string
+	Success          bool
+	NodeRole         string
+	InstanceId       string
+	Epoch            uint64
+	LastHeartbeat    int64
+	MissedHeartbeats uint32
+	LastSync         int64
+	Maintenance      bool
+	Priority         uint32
+	FrozenUntil      int64
+}
+
+func NewFailoverHealthCheckResponse() *FailoverHealthCheckResponse {
+	return &FailoverHealthCheckResponse{}
+}
+
+func (x *FailoverHealthCheckResponse) Error(b *polyglot.Buffer, err error) {
+	polyglot.Encoder(b).Error(err)
+}
+
+func (x *FailoverHealthCheckResponse) Encode(b *polyglot.Buffer) {
+	if x == nil {
+		polyglot.Encoder(b).Nil()
+	} else {
+		if x.error != nil {
+			polyglot.Encoder(b).Error(x.error)
+			return
+		}
+		polyglot.Encoder(b).Uint8(x.flags)
+		polyglot.Encoder(b).String(x.RequestId).Bool(x.Success).String(x.NodeRole).String(x.InstanceId).Uint64(x.Epoch).Int64(x.LastHeartbeat).Uint32(x.MissedHeartbeats).Int64(x.LastSync).Bool(x.Maintenance).Uint32(x.Priority).Int64(x.FrozenUntil)
+	}
+}
+
+func (x *FailoverHealthCheckResponse) Decode(b []byte) error {
+	if x == nil {
+		return ErrDecodeNil
+	}
+	return x.decode(polyglot.Decoder(b))
+}
+
+func (x *FailoverHealthCheckResponse) decode(d *polyglot.BufferDecoder) error {
+	if d.Nil() {
+		return nil
+	}
+
+	var err error
+	x.error, err = d.Error()
+	if err == nil {
+		return nil
+	}
+	x.flags, err = d.Uint8()
+	if err != nil {
+		return err
+	}
+	x.RequestId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Success, err = d.Bool()
+	if err != nil {
+		return err
+	}
+	x.NodeRole, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.InstanceId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Epoch, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	x.LastHeartbeat, err = d.Int64()
+	if err != nil {
+		return err
+	}
+	x.MissedHeartbeats, err = d.Uint32()
+	if err != nil {
+		return err
+	}
+	x.LastSync, err = d.Int64()
+	if err != nil {
+		return err
+	}
+	x.Maintenance, err = d.Bool()
+	if err != nil {
+		return err
+	}
+	x.Priority, err = d.Uint32()
+	if err != nil {
+		return err
+	}
+	x.FrozenUntil, err = d.Int64()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+type FailoverHeartbeatRequest struct {
+	error error
+	flags uint8
+
+	RequestId  string
+	Timestamp  int64
+	PrimaryEni string
+	Sequence   uint64
+	Epoch      uint64
+	Path       string
+	Priority   uint32
+}
+
+func NewFailoverHeartbeatRequest() *FailoverHeartbeatRequest {
+	return &FailoverHeartbeatRequest{}
+}
+
+func (x *FailoverHeartbeatRequest) Error(b *polyglot.Buffer, err error) {
+	polyglot.Encoder(b).Error(err)
+}
+
+func (x *FailoverHeartbeatRequest) Encode(b *polyglot.Buffer) {
+	if x == nil {
+		polyglot.Encoder(b).Nil()
+	} else {
+		if x.error != nil {
+			polyglot.Encoder(b).Error(x.error)
+			return
+		}
+		polyglot.Encoder(b).Uint8(x.flags)
+		polyglot.Encoder(b).String(x.RequestId).Int64(x.Timestamp).String(x.PrimaryEni).Uint64(x.Sequence).Uint64(x.Epoch).String(x.Path).Uint32(x.Priority)
+	}
+}
+
+func (x *FailoverHeartbeatRequest) Decode(b []byte) error {
+	if x == nil {
+		return ErrDecodeNil
+	}
+	return x.decode(polyglot.Decoder(b))
+}
+
+func (x *FailoverHeartbeatRequest) decode(d *polyglot.BufferDecoder) error {
+	if d.Nil() {
+		return nil
+	}
+
+	var err error
+	x.error, err = d.Error()
+	if err == nil {
+		return nil
+	}
+	x.flags, err = d.Uint8()
+	if err != nil {
+		return err
+	}
+	x.RequestId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Timestamp, err = d.Int64()
+	if err != nil {
+		return err
+	}
+	x.PrimaryEni, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Sequence, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	x.Epoch, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	x.Path, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Priority, err = d.Uint32()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+type FailoverHeartbeatResponse struct {
+	error error
+	flags uint8
+
+	RequestId string
+	Success   bool
+	Timestamp int64
+	Sequence  uint64
+	Epoch     uint64
+}
+
+func NewFailoverHeartbeatResponse() *FailoverHeartbeatResponse {
+	return &FailoverHeartbeatResponse{}
+}
+
+func (x *FailoverHeartbeatResponse) Error(b *polyglot.Buffer, err error) {
+	polyglot.Encoder(b).Error(err)
+}
+
+func (x *FailoverHeartbeatResponse) Encode(b *polyglot.Buffer) {
+	if x == nil {
+		polyglot.Encoder(b).Nil()
+	} else {
+		if x.error != nil {
+			polyglot.Encoder(b).Error(x.error)
+			return
+		}
+		polyglot.Encoder(b).Uint8(x.flags)
+		polyglot.Encoder(b).String(x.RequestId).Bool(x.Success).Int64(x.Timestamp).Uint64(x.Sequence).Uint64(x.Epoch)
+	}
+}
+
+func (x *FailoverHeartbeatResponse) Decode(b []byte) error {
+	if x == nil {
+		return ErrDecodeNil
+	}
+	return x.decode(polyglot.Decoder(b))
+}
+
+func (x *FailoverHeartbeatResponse) decode(d *polyglot.BufferDecoder) error {
+	if d.Nil() {
+		return nil
+	}
+
+	var err error
+	x.error, err = d.Error()
+	if err == nil {
+		return nil
+	}
+	x.flags, err = d.Uint8()
+	if err != nil {
+		return err
+	}
+	x.RequestId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Success, err = d.Bool()
+	if err != nil {
+		return err
+	}
+	x.Timestamp, err = d.Int64()
+	if err != nil {
+		return err
+	}
+	x.Sequence, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	x.Epoch, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+type FailoverVoteRequest struct {
+	error error
+	flags uint8
+
+	RequestId   string
+	CandidateId string
+	Epoch       uint64
+}
+
+func NewFailoverVoteRequest() *FailoverVoteRequest {
+	return &FailoverVoteRequest{}
+}
+
+func (x *FailoverVoteRequest) Error(b *polyglot.Buffer, err error) {
+	polyglot.Encoder(b).Error(err)
+}
+
+func (x *FailoverVoteRequest) Encode(b *polyglot.Buffer) {
+	if x == nil {
+		polyglot.Encoder(b).Nil()
+	} else {
+		if x.error != nil {
+			polyglot.Encoder(b).Error(x.error)
+			return
+		}
+		polyglot.Encoder(b).Uint8(x.flags)
+		polyglot.Encoder(b).String(x.RequestId).String(x.CandidateId).Uint64(x.Epoch)
+	}
+}
+
+func (x *FailoverVoteRequest) Decode(b []byte) error {
+	if x == nil {
+		return ErrDecodeNil
+	}
+	return x.decode(polyglot.Decoder(b))
+}
+
+func (x *FailoverVoteRequest) decode(d *polyglot.BufferDecoder) error {
+	if d.Nil() {
+		return nil
+	}
+
+	var err error
+	x.error, err = d.Error()
+	if err == nil {
+		return nil
+	}
+	x.flags, err = d.Uint8()
+	if err != nil {
+		return err
+	}
+	x.RequestId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.CandidateId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Epoch, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+type FailoverVoteResponse struct {
+	error error
+	flags uint8
+
+	RequestId     string
+	Granted       bool
+	Reason        string
+	LastHeartbeat int64
+	Epoch         uint64
+}
+
+func NewFailoverVoteResponse() *FailoverVoteResponse {
+	return &FailoverVoteResponse{}
+}
+
+func (x *FailoverVoteResponse) Error(b *polyglot.Buffer, err error) {
+	polyglot.Encoder(b).Error(err)
+}
+
+func (x *FailoverVoteResponse) Encode(b *polyglot.Buffer) {
+	if x == nil {
+		polyglot.Encoder(b).Nil()
+	} else {
+		if x.error != nil {
+			polyglot.Encoder(b).Error(x.error)
+			return
+		}
+		polyglot.Encoder(b).Uint8(x.flags)
+		polyglot.Encoder(b).String(x.RequestId).Bool(x.Granted).String(x.Reason).Int64(x.LastHeartbeat).Uint64(x.Epoch)
+	}
+}
+
+func (x *FailoverVoteResponse) Decode(b []byte) error {
+	if x == nil {
+		return ErrDecodeNil
+	}
+	return x.decode(polyglot.Decoder(b))
+}
+
+func (x *FailoverVoteResponse) decode(d *polyglot.BufferDecoder) error {
+	if d.Nil() {
+		return nil
+	}
+
+	var err error
+	x.error, err = d.Error()
+	if err == nil {
+		return nil
+	}
+	x.flags, err = d.Uint8()
+	if err != nil {
+		return err
+	}
+	x.RequestId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Granted, err = d.Bool()
+	if err != nil {
+		return err
+	}
+	x.Reason, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.LastHeartbeat, err = d.Int64()
+	if err != nil {
+		return err
+	}
+	x.Epoch, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+type FailoverSwitchoverRequest struct {
+	error error
+	flags uint8
+
+	RequestId string
+	Role      string
+	Trigger   string
+}
+
+func NewFailoverSwitchoverRequest() *FailoverSwitchoverRequest {
+	return &FailoverSwitchoverRequest{}
+}
+
+func (x *FailoverSwitchoverRequest) Error(b *polyglot.Buffer, err error) {
+	polyglot.Encoder(b).Error(err)
+}
+
+func (x *FailoverSwitchoverRequest) Encode(b *polyglot.Buffer) {
+	if x == nil {
+		polyglot.Encoder(b).Nil()
+	} else {
+		if x.error != nil {
+			polyglot.Encoder(b).Error(x.error)
+			return
+		}
+		polyglot.Encoder(b).Uint8(x.flags)
+		polyglot.Encoder(b).String(x.RequestId).String(x.Role).String(x.Trigger)
+	}
+}
+
+func (x *FailoverSwitchoverRequest) Decode(b []byte) error {
+	if x == nil {
+		return ErrDecodeNil
+	}
+	return x.decode(polyglot.Decoder(b))
+}
+
+func (x *FailoverSwitchoverRequest) decode(d *polyglot.BufferDecoder) error {
+	if d.Nil() {
+		return nil
+	}
+
+	var err error
+	x.error, err = d.Error()
+	if err == nil {
+		return nil
+	}
+	x.flags, err = d.Uint8()
+	if err != nil {
+		return err
+	}
+	x.RequestId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Role, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Trigger, err = d.String()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+type FailoverSwitchoverResponse struct {
+	error error
+	flags uint8
+
+	RequestId         string
+	Success           bool
+	ErrorMessage      string
+	PrimaryInstanceId string
+	Epoch             uint64
+}
+
+func NewFailoverSwitchoverResponse() *FailoverSwitchoverResponse {
+	return &FailoverSwitchoverResponse{}
+}
+
+func (x *FailoverSwitchoverResponse) Error(b *polyglot.Buffer, err error) {
+	polyglot.Encoder(b).Error(err)
+}
+
+func (x *FailoverSwitchoverResponse) Encode(b *polyglot.Buffer) {
+	if x == nil {
+		polyglot.Encoder(b).Nil()
+	} else {
+		if x.error != nil {
+			polyglot.Encoder(b).Error(x.error)
+			return
+		}
+		polyglot.Encoder(b).Uint8(x.flags)
+		polyglot.Encoder(b).String(x.RequestId).Bool(x.Success).String(x.ErrorMessage).String(x.PrimaryInstanceId).Uint64(x.Epoch)
+	}
+}
+
+func (x *FailoverSwitchoverResponse) Decode(b []byte) error {
+	if x == nil {
+		return ErrDecodeNil
+	}
+	return x.decode(polyglot.Decoder(b))
+}
+
+func (x *FailoverSwitchoverResponse) decode(d *polyglot.BufferDecoder) error {
+	if d.Nil() {
+		return nil
+	}
+
+	var err error
+	x.error, err = d.Error()
+	if err == nil {
+		return nil
+	}
+	x.flags, err = d.Uint8()
+	if err != nil {
+		return err
+	}
+	x.RequestId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Success, err = d.Bool()
+	if err != nil {
+		return err
+	}
+	x.ErrorMessage, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.PrimaryInstanceId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Epoch, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+type FailoverPromoteRequest struct {
+	error error
+	flags uint8
+
+	RequestId string
+	Epoch     uint64
+	Trigger   string
+}
+
+func NewFailoverPromoteRequest() *FailoverPromoteRequest {
+	return &FailoverPromoteRequest{}
+}
+
+func (x *FailoverPromoteRequest) Error(b *polyglot.Buffer, err error) {
+	polyglot.Encoder(b).Error(err)
+}
+
+func (x *FailoverPromoteRequest) Encode(b *polyglot.Buffer) {
+	if x == nil {
+		polyglot.Encoder(b).Nil()
+	} else {
+		if x.error != nil {
+			polyglot.Encoder(b).Error(x.error)
+			return
+		}
+		polyglot.Encoder(b).Uint8(x.flags)
+		polyglot.Encoder(b).String(x.RequestId).Uint64(x.Epoch).String(x.Trigger)
+	}
+}
+
+func (x *FailoverPromoteRequest) Decode(b []byte) error {
+	if x == nil {
+		return ErrDecodeNil
+	}
+	return x.decode(polyglot.Decoder(b))
+}
+
+func (x *FailoverPromoteRequest) decode(d *polyglot.BufferDecoder) error {
+	if d.Nil() {
+		return nil
+	}
+
+	var err error
+	x.error, err = d.Error()
+	if err == nil {
+		return nil
+	}
+	x.flags, err = d.Uint8()
+	if err != nil {
+		return err
+	}
+	x.RequestId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Epoch, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	x.Trigger, err = d.String()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+type FailoverPromoteResponse struct {
+	error error
+	flags uint8
+
+	RequestId    string
+	Success      bool
+	ErrorMessage string
+	InstanceId   string
+	Epoch        uint64
+}
+
+func NewFailoverPromoteResponse() *FailoverPromoteResponse {
+	return &FailoverPromoteResponse{}
+}
+
+func (x *FailoverPromoteResponse) Error(b *polyglot.Buffer, err error) {
+	polyglot.Encoder(b).Error(err)
+}
+
+func (x *FailoverPromoteResponse) Encode(b *polyglot.Buffer) {
+	if x == nil {
+		polyglot.Encoder(b).Nil()
+	} else {
+		if x.error != nil {
+			polyglot.Encoder(b).Error(x.error)
+			return
+		}
+		polyglot.Encoder(b).Uint8(x.flags)
+		polyglot.Encoder(b).String(x.RequestId).Bool(x.Success).String(x.ErrorMessage).String(x.InstanceId).Uint64(x.Epoch)
+	}
+}
+
+func (x *FailoverPromoteResponse) Decode(b []byte) error {
+	if x == nil {
+		return ErrDecodeNil
+	}
+	return x.decode(polyglot.Decoder(b))
+}
+
+func (x *FailoverPromoteResponse) decode(d *polyglot.BufferDecoder) error {
+	if d.Nil() {
+		return nil
+	}
+
+	var err error
+	x.error, err = d.Error()
+	if err == nil {
+		return nil
+	}
+	x.flags, err = d.Uint8()
+	if err != nil {
+		return err
+	}
+	x.RequestId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Success, err = d.Bool()
+	if err != nil {
+		return err
+	}
+	x.ErrorMessage, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.InstanceId, err = d.String()
+	if err != nil {
+		return err
+	}
+	x.Epoch, err = d.Uint64()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+type FailoverService interface {
+	SyncState(context.Context, *FailoverSyncStateRequest) (*FailoverSyncStateResponse, error)
+	HealthCheck(context.Context, *FailoverHealthCheckRequest) (*FailoverHealthCheckResponse, error)
+	Heartbeat(context.Context, *FailoverHeartbeatRequest) (*FailoverHeartbeatResponse, error)
+	RequestVote(context.Context, *FailoverVoteRequest) (*FailoverVoteResponse, error)
+	SyncStateChunk(context.Context, *FailoverSyncStateChunkRequest) (*FailoverSyncStateChunkResponse, error)
+	Switchover(context.Context, *FailoverSwitchoverRequest) (*FailoverSwitchoverResponse, error)
+	Promote(context.Context, *FailoverPromoteRequest) (*FailoverPromoteResponse, error)
+}
+
+const ConnectionContextKey int = 1000
+const StreamContextKey int = 1001
+
+func SetErrorFlag(flags uint8, error bool) uint8 {
+	return flags | 0x2
+}
+func HasErrorFlag(flags uint8) bool {
 	return flags&(1<<1) == 1
 }
 
@@ -947,6 +2167,86 @@ func NewServer(failoverService FailoverService, tlsConfig *tls.Config, logger ty
 		}
 		return
 	}
+	table[13] = func(ctx context.Context, incoming *packet.Packet) (outgoing *packet.Packet, action frisbee.Action) {
+		req := NewFailoverVoteRequest()
+		err := req.Decode((*incoming.Content).Bytes()[:incoming.Metadata.ContentLength])
+		if err == nil {
+			var res *FailoverVoteResponse
+			outgoing = incoming
+			outgoing.Content.Reset()
+			res, err = failoverService.RequestVote(ctx, req)
+			if err != nil {
+				if _, ok := err.(CloseError); ok {
+					action = frisbee.CLOSE
+				}
+				res.Error(outgoing.Content, err)
+			} else {
+				res.Encode(outgoing.Content)
+			}
+			outgoing.Metadata.ContentLength = uint32(outgoing.Content.Len())
+		}
+		return
+	}
+	table[14] = func(ctx context.Context, incoming *packet.Packet) (outgoing *packet.Packet, action frisbee.Action) {
+		req := NewFailoverSyncStateChunkRequest()
+		err := req.Decode((*incoming.Content).Bytes()[:incoming.Metadata.ContentLength])
+		if err == nil {
+			var res *FailoverSyncStateChunkResponse
+			outgoing = incoming
+			outgoing.Content.Reset()
+			res, err = failoverService.SyncStateChunk(ctx, req)
+			if err != nil {
+				if _, ok := err.(CloseError); ok {
+					action = frisbee.CLOSE
+				}
+				res.Error(outgoing.Content, err)
+			} else {
+				res.Encode(outgoing.Content)
+			}
+			outgoing.Metadata.ContentLength = uint32(outgoing.Content.Len())
+		}
+		return
+	}
+	table[15] = func(ctx context.Context, incoming *packet.Packet) (outgoing *packet.Packet, action frisbee.Action) {
+		req := NewFailoverSwitchoverRequest()
+		err := req.Decode((*incoming.Content).Bytes()[:incoming.Metadata.ContentLength])
+		if err == nil {
+			var res *FailoverSwitchoverResponse
+			outgoing = incoming
+			outgoing.Content.Reset()
+			res, err = failoverService.Switchover(ctx, req)
+			if err != nil {
+				if _, ok := err.(CloseError); ok {
+					action = frisbee.CLOSE
+				}
+				res.Error(outgoing.Content, err)
+			} else {
+				res.Encode(outgoing.Content)
+			}
+			outgoing.Metadata.ContentLength = uint32(outgoing.Content.Len())
+		}
+		return
+	}
+	table[16] = func(ctx context.Context, incoming *packet.Packet) (outgoing *packet.Packet, action frisbee.Action) {
+		req := NewFailoverPromoteRequest()
+		err := req.Decode((*incoming.Content).Bytes()[:incoming.Metadata.ContentLength])
+		if err == nil {
+			var res *FailoverPromoteResponse
+			outgoing = incoming
+			outgoing.Content.Reset()
+			res, err = failoverService.Promote(ctx, req)
+			if err != nil {
+				if _, ok := err.(CloseError); ok {
+					action = frisbee.CLOSE
+				}
+				res.Error(outgoing.Content, err)
+			} else {
+				res.Encode(outgoing.Content)
+			}
+			outgoing.Metadata.ContentLength = uint32(outgoing.Content.Len())
+		}
+		return
+	}
 	var err error
 	if tlsConfig != nil {
 		s.server, err = frisbee.NewServer(table, context.Background(), frisbee.WithTLS(tlsConfig), frisbee.WithLogger(logger))
@@ -1000,21 +2300,37 @@ func (s *Server) Shutdown() error {
 }
 
 type subFailoverServiceClient struct {
-	client                *frisbee.Client
-	nextSyncState         uint16
-	nextSyncStateMu       sync.RWMutex
-	inflightSyncState     map[uint16]chan *FailoverSyncStateResponse
-	inflightSyncStateMu   sync.RWMutex
-	nextHealthCheck       uint16
-	nextHealthCheckMu     sync.RWMutex
-	inflightHealthCheck   map[uint16]chan *FailoverHealthCheckResponse
-	inflightHealthCheckMu sync.RWMutex
-	nextHeartbeat         uint16
-	nextHeartbeatMu       sync.RWMutex
-	inflightHeartbeat     map[uint16]chan *FailoverHeartbeatResponse
-	inflightHeartbeatMu   sync.RWMutex
-	nextStreamingID       uint16
-	nextStreamingIDMu     sync.RWMutex
+	client                   *frisbee.Client
+	nextSyncState            uint16
+	nextSyncStateMu          sync.RWMutex
+	inflightSyncState        map[uint16]chan *FailoverSyncStateResponse
+	inflightSyncStateMu      sync.RWMutex
+	nextHealthCheck          uint16
+	nextHealthCheckMu        sync.RWMutex
+	inflightHealthCheck      map[uint16]chan *FailoverHealthCheckResponse
+	inflightHealthCheckMu    sync.RWMutex
+	nextHeartbeat            uint16
+	nextHeartbeatMu          sync.RWMutex
+	inflightHeartbeat        map[uint16]chan *FailoverHeartbeatResponse
+	inflightHeartbeatMu      sync.RWMutex
+	nextRequestVote          uint16
+	nextRequestVoteMu        sync.RWMutex
+	inflightRequestVote      map[uint16]chan *FailoverVoteResponse
+	inflightRequestVoteMu    sync.RWMutex
+	nextSyncStateChunk       uint16
+	nextSyncStateChunkMu     sync.RWMutex
+	inflightSyncStateChunk   map[uint16]chan *FailoverSyncStateChunkResponse
+	inflightSyncStateChunkMu sync.RWMutex
+	nextSwitchover           uint16
+	nextSwitchoverMu         sync.RWMutex
+	inflightSwitchover       map[uint16]chan *FailoverSwitchoverResponse
+	inflightSwitchoverMu     sync.RWMutex
+	nextPromote              uint16
+	nextPromoteMu            sync.RWMutex
+	inflightPromote          map[uint16]chan *FailoverPromoteResponse
+	inflightPromoteMu        sync.RWMutex
+	nextStreamingID          uint16
+	nextStreamingIDMu        sync.RWMutex
 }
 type Client struct {
 	*frisbee.Client
@@ -1061,6 +2377,54 @@ func NewClient(tlsConfig *tls.Config, logger types.Logger) (*Client, error) {
 		}
 		return
 	}
+	table[13] = func(ctx context.Context, incoming *packet.Packet) (outgoing *packet.Packet, action frisbee.Action) {
+		c.FailoverService.inflightRequestVoteMu.RLock()
+		if ch, ok := c.FailoverService.inflightRequestVote[incoming.Metadata.Id]; ok {
+			c.FailoverService.inflightRequestVoteMu.RUnlock()
+			res := NewFailoverVoteResponse()
+			res.Decode((*incoming.Content).Bytes()[:incoming.Metadata.ContentLength])
+			ch <- res
+		} else {
+			c.FailoverService.inflightRequestVoteMu.RUnlock()
+		}
+		return
+	}
+	table[14] = func(ctx context.Context, incoming *packet.Packet) (outgoing *packet.Packet, action frisbee.Action) {
+		c.FailoverService.inflightSyncStateChunkMu.RLock()
+		if ch, ok := c.FailoverService.inflightSyncStateChunk[incoming.Metadata.Id]; ok {
+			c.FailoverService.inflightSyncStateChunkMu.RUnlock()
+			res := NewFailoverSyncStateChunkResponse()
+			res.Decode((*incoming.Content).Bytes()[:incoming.Metadata.ContentLength])
+			ch <- res
+		} else {
+			c.FailoverService.inflightSyncStateChunkMu.RUnlock()
+		}
+		return
+	}
+	table[15] = func(ctx context.Context, incoming *packet.Packet) (outgoing *packet.Packet, action frisbee.Action) {
+		c.FailoverService.inflightSwitchoverMu.RLock()
+		if ch, ok := c.FailoverService.inflightSwitchover[incoming.Metadata.Id]; ok {
+			c.FailoverService.inflightSwitchoverMu.RUnlock()
+			res := NewFailoverSwitchoverResponse()
+			res.Decode((*incoming.Content).Bytes()[:incoming.Metadata.ContentLength])
+			ch <- res
+		} else {
+			c.FailoverService.inflightSwitchoverMu.RUnlock()
+		}
+		return
+	}
+	table[16] = func(ctx context.Context, incoming *packet.Packet) (outgoing *packet.Packet, action frisbee.Action) {
+		c.FailoverService.inflightPromoteMu.RLock()
+		if ch, ok := c.FailoverService.inflightPromote[incoming.Metadata.Id]; ok {
+			c.FailoverService.inflightPromoteMu.RUnlock()
+			res := NewFailoverPromoteResponse()
+			res.Decode((*incoming.Content).Bytes()[:incoming.Metadata.ContentLength])
+			ch <- res
+		} else {
+			c.FailoverService.inflightPromoteMu.RUnlock()
+		}
+		return
+	}
 	var err error
 	if tlsConfig != nil {
 		c.Client, err = frisbee.NewClient(table, context.Background(), frisbee.WithTLS(tlsConfig), frisbee.WithLogger(logger))
@@ -1088,6 +2452,22 @@ func NewClient(tlsConfig *tls.Config, logger types.Logger) (*Client, error) {
 	c.FailoverService.nextHeartbeat = 0
 	c.FailoverService.nextHeartbeatMu.Unlock()
 	c.FailoverService.inflightHeartbeat = make(map[uint16]chan *FailoverHeartbeatResponse)
+	c.FailoverService.nextRequestVoteMu.Lock()
+	c.FailoverService.nextRequestVote = 0
+	c.FailoverService.nextRequestVoteMu.Unlock()
+	c.FailoverService.inflightRequestVote = make(map[uint16]chan *FailoverVoteResponse)
+	c.FailoverService.nextSyncStateChunkMu.Lock()
+	c.FailoverService.nextSyncStateChunk = 0
+	c.FailoverService.nextSyncStateChunkMu.Unlock()
+	c.FailoverService.inflightSyncStateChunk = make(map[uint16]chan *FailoverSyncStateChunkResponse)
+	c.FailoverService.nextSwitchoverMu.Lock()
+	c.FailoverService.nextSwitchover = 0
+	c.FailoverService.nextSwitchoverMu.Unlock()
+	c.FailoverService.inflightSwitchover = make(map[uint16]chan *FailoverSwitchoverResponse)
+	c.FailoverService.nextPromoteMu.Lock()
+	c.FailoverService.nextPromote = 0
+	c.FailoverService.nextPromoteMu.Unlock()
+	c.FailoverService.inflightPromote = make(map[uint16]chan *FailoverPromoteResponse)
 	return c, nil
 }
 
@@ -1207,6 +2587,150 @@ func (c *subFailoverServiceClient) Heartbeat(ctx context.Context, req *FailoverH
 	return
 }
 
+func (c *subFailoverServiceClient) RequestVote(ctx context.Context, req *FailoverVoteRequest) (res *FailoverVoteResponse, err error) {
+	ch := make(chan *FailoverVoteResponse, 1)
+	p := packet.Get()
+	p.Metadata.Operation = 13
+
+	c.nextRequestVoteMu.Lock()
+	c.nextRequestVote += 1
+	id := c.nextRequestVote
+	c.nextRequestVoteMu.Unlock()
+	p.Metadata.Id = id
+
+	req.Encode(p.Content)
+	p.Metadata.ContentLength = uint32((*p.Content).Len())
+	c.inflightRequestVoteMu.Lock()
+	c.inflightRequestVote[id] = ch
+	c.inflightRequestVoteMu.Unlock()
+	err = c.client.WritePacket(p)
+	if err != nil {
+		packet.Put(p)
+		return
+	}
+	select {
+	case <-c.client.CloseChannel():
+		err = c.client.Error()
+	case res = <-ch:
+		err = res.error
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	c.inflightRequestVoteMu.Lock()
+	delete(c.inflightRequestVote, id)
+	c.inflightRequestVoteMu.Unlock()
+	packet.Put(p)
+	return
+}
+
+func (c *subFailoverServiceClient) SyncStateChunk(ctx context.Context, req *FailoverSyncStateChunkRequest) (res *FailoverSyncStateChunkResponse, err error) {
+	ch := make(chan *FailoverSyncStateChunkResponse, 1)
+	p := packet.Get()
+	p.Metadata.Operation = 14
+
+	c.nextSyncStateChunkMu.Lock()
+	c.nextSyncStateChunk += 1
+	id := c.nextSyncStateChunk
+	c.nextSyncStateChunkMu.Unlock()
+	p.Metadata.Id = id
+
+	req.Encode(p.Content)
+	p.Metadata.ContentLength = uint32((*p.Content).Len())
+	c.inflightSyncStateChunkMu.Lock()
+	c.inflightSyncStateChunk[id] = ch
+	c.inflightSyncStateChunkMu.Unlock()
+	err = c.client.WritePacket(p)
+	if err != nil {
+		packet.Put(p)
+		return
+	}
+	select {
+	case <-c.client.CloseChannel():
+		err = c.client.Error()
+	case res = <-ch:
+		err = res.error
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	c.inflightSyncStateChunkMu.Lock()
+	delete(c.inflightSyncStateChunk, id)
+	c.inflightSyncStateChunkMu.Unlock()
+	packet.Put(p)
+	return
+}
+
+func (c *subFailoverServiceClient) Switchover(ctx context.Context, req *FailoverSwitchoverRequest) (res *FailoverSwitchoverResponse, err error) {
+	ch := make(chan *FailoverSwitchoverResponse, 1)
+	p := packet.Get()
+	p.Metadata.Operation = 15
+
+	c.nextSwitchoverMu.Lock()
+	c.nextSwitchover += 1
+	id := c.nextSwitchover
+	c.nextSwitchoverMu.Unlock()
+	p.Metadata.Id = id
+
+	req.Encode(p.Content)
+	p.Metadata.ContentLength = uint32((*p.Content).Len())
+	c.inflightSwitchoverMu.Lock()
+	c.inflightSwitchover[id] = ch
+	c.inflightSwitchoverMu.Unlock()
+	err = c.client.WritePacket(p)
+	if err != nil {
+		packet.Put(p)
+		return
+	}
+	select {
+	case <-c.client.CloseChannel():
+		err = c.client.Error()
+	case res = <-ch:
+		err = res.error
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	c.inflightSwitchoverMu.Lock()
+	delete(c.inflightSwitchover, id)
+	c.inflightSwitchoverMu.Unlock()
+	packet.Put(p)
+	return
+}
+
+func (c *subFailoverServiceClient) Promote(ctx context.Context, req *FailoverPromoteRequest) (res *FailoverPromoteResponse, err error) {
+	ch := make(chan *FailoverPromoteResponse, 1)
+	p := packet.Get()
+	p.Metadata.Operation = 16
+
+	c.nextPromoteMu.Lock()
+	c.nextPromote += 1
+	id := c.nextPromote
+	c.nextPromoteMu.Unlock()
+	p.Metadata.Id = id
+
+	req.Encode(p.Content)
+	p.Metadata.ContentLength = uint32((*p.Content).Len())
+	c.inflightPromoteMu.Lock()
+	c.inflightPromote[id] = ch
+	c.inflightPromoteMu.Unlock()
+	err = c.client.WritePacket(p)
+	if err != nil {
+		packet.Put(p)
+		return
+	}
+	select {
+	case <-c.client.CloseChannel():
+		err = c.client.Error()
+	case res = <-ch:
+		err = res.error
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	c.inflightPromoteMu.Lock()
+	delete(c.inflightPromote, id)
+	c.inflightPromoteMu.Unlock()
+	packet.Put(p)
+	return
+}
+
 type CloseError struct {
 	err error
 }
@@ -0,0 +1,228 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/loopholelabs/architect-networking/pkg/client"
+)
+
+// Conduit health checks run by the health probe
+const (
+	HealthCheckRouter      = "router"       // router and its interfaces are enabled
+	HealthCheckOutboundNAT = "outbound_nat" // outbound NAT is enabled
+	HealthCheckNATIPs      = "nat_ips"      // at least one NAT IP is configured
+	HealthCheckState       = "state"        // the NAT state can be read
+)
+
+// AllHealthChecks are the Conduit health checks run when none are configured
+var AllHealthChecks = []string{HealthCheckRouter, HealthCheckOutboundNAT, HealthCheckNATIPs, HealthCheckState}
+
+var ErrConduitUnhealthy = errors.New("conduit is unhealthy")
+
+// HealthResult is the outcome of the last Conduit health probe
+type HealthResult struct {
+	Time    time.Time     `json:"time"`
+	Healthy bool          `json:"healthy"`
+	Latency time.Duration `json:"latency_ns"`
+	Error   string        `json:"error,omitempty"`
+
+	// Consecutive failed probes
+	Failures int `json:"failures"`
+}
+
+// healthProbeLoop probes the local Conduit instance and acts when it becomes unhealthy: a
+// primary hands over or stops heartbeating, a secondary becomes ineligible for promotion
+func (lf *LeaderFailover) healthProbeLoop(ctx context.Context) {
+	ticker := time.NewTicker(lf.config.HealthProbeInterval)
+	defer ticker.Stop()
+
+	lf.logger.Info().
+		Str("interval", lf.config.HealthProbeInterval.String()).
+		Int("failure_threshold", lf.config.HealthProbeFailureThreshold).
+		Str("checks", strings.Join(lf.config.HealthChecks, ",")).
+		Str("max_latency", lf.config.HealthMaxLatency.String()).
+		Msg("Starting Conduit health probe")
+
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-lf.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		failures = lf.runHealthProbe(ctx, failures)
+	}
+}
+
+// runHealthProbe probes the local Conduit instance once after failures consecutive failed
+// probes, records the result and acts on it. It returns the consecutive failures after the probe.
+func (lf *LeaderFailover) runHealthProbe(ctx context.Context, failures int) int {
+	probeCtx, cancel := context.WithTimeout(ctx, lf.config.HealthProbeInterval)
+	latency, err := lf.probeConduit(probeCtx)
+	cancel()
+
+	result := &HealthResult{
+		Time:    time.Now(),
+		Healthy: err == nil,
+		Latency: latency,
+	}
+	if err != nil {
+		failures++
+		result.Error = err.Error()
+		lf.logger.Warn().Err(err).
+			Int("failures", failures).
+			Str("latency", latency.String()).
+			Msg("Conduit health probe failed")
+	} else {
+		failures = 0
+	}
+	result.Failures = failures
+
+	lf.statusMutex.Lock()
+	lf.lastHealth = result
+	lf.statusMutex.Unlock()
+
+	switch {
+	case err == nil && lf.unhealthy.Load():
+		lf.unhealthy.Store(false)
+		lf.logger.Info().Str("role", lf.currentRole.Load().String()).Msg("Conduit is healthy again")
+	case failures >= lf.config.HealthProbeFailureThreshold:
+		if lf.unhealthy.Swap(true) {
+			break
+		}
+		lf.logger.Error().Err(err).
+			Str("role", lf.currentRole.Load().String()).
+			Int("failures", failures).
+			Msg("Conduit is unhealthy")
+
+		// Hand over once per unhealthy episode, without holding up the probes that tell
+		// when it ends. Should the handover fail, the stopped heartbeats still let the
+		// secondary take over.
+		if lf.currentRole.Load() == RolePrimary {
+			lf.unhealthyHandOver.Add(1)
+			go func() {
+				defer lf.unhealthyHandOver.Done()
+				lf.handOverUnhealthy(ctx)
+			}()
+		}
+	}
+
+	return failures
+}
+
+// probeConduit runs the configured health checks against the local Conduit instance and
+// returns the latency of the slowest of its small API calls
+func (lf *LeaderFailover) probeConduit(ctx context.Context) (time.Duration, error) {
+	checks := lf.config.HealthChecks
+	var slowest time.Duration
+	timed := func(call func() error) error {
+		start := time.Now()
+		err := call()
+		slowest = max(slowest, time.Since(start))
+		return err
+	}
+
+	if slices.Contains(checks, HealthCheckRouter) || slices.Contains(checks, HealthCheckOutboundNAT) {
+		var status *client.GetRouterStatusResponse
+		err := timed(func() (err error) {
+			status, err = lf.localClient.GetRouterStatusWithResponse(ctx)
+			return err
+		})
+		if err != nil {
+			return slowest, fmt.Errorf("%w: failed to get router status: %w", ErrConduitUnhealthy, err)
+		}
+		if status.StatusCode() != http.StatusOK || status.JSON200 == nil {
+			return slowest, fmt.Errorf("%w: router status returned %s", ErrConduitUnhealthy, status.Status())
+		}
+		if slices.Contains(checks, HealthCheckRouter) && (!status.JSON200.Enabled || !status.JSON200.InterfacesEnabled) {
+			return slowest, fmt.Errorf("%w: router is disabled", ErrConduitUnhealthy)
+		}
+		if slices.Contains(checks, HealthCheckOutboundNAT) && !status.JSON200.OutboundNATEnabled {
+			return slowest, fmt.Errorf("%w: outbound NAT is disabled", ErrConduitUnhealthy)
+		}
+	}
+
+	if slices.Contains(checks, HealthCheckNATIPs) {
+		var ips *client.ListIPsResponse
+		err := timed(func() (err error) {
+			ips, err = lf.localClient.ListIPsWithResponse(ctx)
+			return err
+		})
+		if err != nil {
+			return slowest, fmt.Errorf("%w: failed to list NAT IPs: %w", ErrConduitUnhealthy, err)
+		}
+		if ips.StatusCode() != http.StatusOK || ips.JSON200 == nil {
+			return slowest, fmt.Errorf("%w: listing NAT IPs returned %s", ErrConduitUnhealthy, ips.Status())
+		}
+		if len(*ips.JSON200) == 0 {
+			return slowest, fmt.Errorf("%w: no NAT IPs configured", ErrConduitUnhealthy)
+		}
+	}
+
+	// Only the status of the state is checked: the body holds the full NAT table, which
+	// takes as long to read as a sync and is not a measure of API latency
+	if slices.Contains(checks, HealthCheckState) {
+		resp, err := lf.localClient.GetState(ctx)
+		if err != nil {
+			return slowest, fmt.Errorf("%w: failed to get state: %w", ErrConduitUnhealthy, err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return slowest, fmt.Errorf("%w: getting state returned %s", ErrConduitUnhealthy, resp.Status)
+		}
+	}
+
+	if slowest > lf.config.HealthMaxLatency {
+		return slowest, fmt.Errorf("%w: API latency %s exceeds %s", ErrConduitUnhealthy, slowest, lf.config.HealthMaxLatency)
+	}
+
+	return slowest, nil
+}
+
+// handOverUnhealthy moves the primary role away from an unhealthy Conduit instance. If the
+// secondary cannot take over with a planned switchover, heartbeats stay stopped so it takes
+// over once it misses them.
+func (lf *LeaderFailover) handOverUnhealthy(ctx context.Context) {
+	lf.logger.Warn().Msg("Handing over primary role from unhealthy Conduit instance")
+
+	ctx, cancel := context.WithTimeout(ctx, lf.switchoverTimeout())
+	defer cancel()
+
+	if _, _, err := lf.handOver(ctx, TriggerHealthProbe); err != nil {
+		lf.logger.Error().Err(err).Msg("Failed to hand over primary role, stopping heartbeats so the secondary takes over")
+
+		// Let a lease or quorum based elector pass leadership to the secondary
+		if _, ok := lf.elector.(LeaseGuard); ok {
+			if err := lf.elector.Resign(ctx); err != nil {
+				lf.logger.Warn().Err(err).Msg("Failed to resign leadership")
+			}
+		}
+	}
+}
+
+// heartbeatsSuppressed reports whether an unhealthy primary should stop heartbeating.
+// Heartbeats continue while a handover runs, so the secondary does not promote itself.
+func (lf *LeaderFailover) heartbeatsSuppressed() bool {
+	return lf.unhealthy.Load() && !lf.switchingOver.Load()
+}
+
+// healthInputs returns the last health probe failure for the journal
+func (lf *LeaderFailover) healthInputs() *JournalInputs {
+	lf.statusMutex.Lock()
+	defer lf.statusMutex.Unlock()
+
+	inputs := &JournalInputs{}
+	if lf.lastHealth != nil {
+		inputs.HealthError = lf.lastHealth.Error
+	}
+	return inputs
+}
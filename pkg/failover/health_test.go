@@ -0,0 +1,197 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// probing has the node probe the health of the fake Conduit serving on socket
+func probing(socket string) func(*LeaderConfig) {
+	return func(config *LeaderConfig) {
+		config.LocalSocket = socket
+		config.HealthProbeInterval = time.Second
+	}
+}
+
+func TestProbeConduit(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []string
+		update func(health *conduitHealth)
+		want   string // expected failure, healthy when empty
+	}{
+		{name: "healthy", update: func(*conduitHealth) {}},
+		{name: "router disabled", update: func(h *conduitHealth) { h.router.Enabled = false }, want: "router is disabled"},
+		{name: "interfaces disabled", update: func(h *conduitHealth) { h.router.InterfacesEnabled = false }, want: "router is disabled"},
+		{name: "outbound NAT off", update: func(h *conduitHealth) { h.router.OutboundNATEnabled = false }, want: "outbound NAT is disabled"},
+		{name: "no NAT IPs", update: func(h *conduitHealth) { h.ips = nil }, want: "no NAT IPs configured"},
+		{name: "state unreadable", update: func(h *conduitHealth) { h.stateCode = http.StatusInternalServerError }, want: "getting state returned 500"},
+		{name: "latency over the limit", update: func(h *conduitHealth) { h.latency = 100 * time.Millisecond }, want: "exceeds 50ms"},
+		{
+			name:   "unchecked criterion",
+			checks: []string{HealthCheckRouter, HealthCheckNATIPs},
+			update: func(h *conduitHealth) { h.router.OutboundNATEnabled = false },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conduit, socket := newFakeConduit(t, testNATEntries())
+			lf := newTestFailover(t, newTestCloud(), "i-b", probing(socket), func(config *LeaderConfig) {
+				config.HealthChecks = tt.checks
+				config.HealthMaxLatency = 50 * time.Millisecond
+			})
+			lf.currentRole.Store(RoleSecondary)
+			conduit.SetHealth(tt.update)
+
+			_, err := lf.probeConduit(context.Background())
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("probe: got %v, want healthy", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrConduitUnhealthy) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("probe: got %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthProbeFailureThreshold(t *testing.T) {
+	ctx := context.Background()
+	conduit, socket := newFakeConduit(t, testNATEntries())
+	lf := newTestFailover(t, newTestCloud(), "i-b", probing(socket), func(config *LeaderConfig) {
+		config.HealthProbeFailureThreshold = 3
+	})
+	lf.currentRole.Store(RoleSecondary)
+	conduit.SetHealth(func(h *conduitHealth) { h.router.Enabled = false })
+
+	failures := 0
+	for i := range 3 {
+		if lf.unhealthy.Load() {
+			t.Fatalf("unhealthy after %d failed probes", i)
+		}
+		failures = lf.runHealthProbe(ctx, failures)
+	}
+	if !lf.unhealthy.Load() || failures != 3 || lf.lastHealth.Healthy || lf.lastHealth.Failures != 3 {
+		t.Fatalf("after 3 failed probes: unhealthy %t, last probe %+v", lf.unhealthy.Load(), lf.lastHealth)
+	}
+
+	// An unhealthy secondary is not eligible to take over
+	if lf.requestPromotion(ctx, "test", nil) {
+		t.Fatal("unhealthy secondary requested promotion")
+	}
+	if len(lf.roleCh) != 0 {
+		t.Fatal("unhealthy secondary queued a role change")
+	}
+
+	conduit.SetHealth(func(h *conduitHealth) { h.router.Enabled = true })
+	if failures = lf.runHealthProbe(ctx, failures); failures != 0 || lf.unhealthy.Load() {
+		t.Fatalf("after a healthy probe: %d failures, unhealthy %t", failures, lf.unhealthy.Load())
+	}
+}
+
+func TestHeartbeatsSuppressed(t *testing.T) {
+	lf := newTestFailover(t, newTestCloud(), "i-a", nil)
+
+	tests := []struct {
+		unhealthy, switchingOver, want bool
+	}{
+		{unhealthy: false, switchingOver: false, want: false},
+		{unhealthy: true, switchingOver: false, want: true},
+		{unhealthy: true, switchingOver: true, want: false}, // the handover needs the secondary to stay put
+		{unhealthy: false, switchingOver: true, want: false},
+	}
+	for _, tt := range tests {
+		lf.unhealthy.Store(tt.unhealthy)
+		lf.switchingOver.Store(tt.switchingOver)
+		if got := lf.heartbeatsSuppressed(); got != tt.want {
+			t.Fatalf("unhealthy %t while switching over %t: got suppressed %t, want %t", tt.unhealthy, tt.switchingOver, got, tt.want)
+		}
+	}
+}
+
+func TestHandOverUnhealthyPrimary(t *testing.T) {
+	pair := newSwitchoverPair(t, func(_ string, config *LeaderConfig) {
+		config.HealthProbeInterval = time.Second
+		config.HealthProbeFailureThreshold = 1
+	})
+	pair.primaryNAT.SetHealth(func(h *conduitHealth) { h.router.OutboundNATEnabled = false })
+
+	pair.primary.runHealthProbe(context.Background(), 0)
+	pair.primary.unhealthyHandOver.Wait()
+
+	pair.requireRoles(t, RoleSecondary, RolePrimary)
+	requireFlows(t, pair.secondaryNAT.NATState(), 0)
+}
+
+func TestHandOverUnhealthyPrimaryRefused(t *testing.T) {
+	pair := newSwitchoverPair(t, func(_ string, config *LeaderConfig) {
+		config.HealthProbeInterval = time.Second
+		config.HealthProbeFailureThreshold = 1
+	})
+	pair.primaryNAT.SetHealth(func(h *conduitHealth) { h.ips = nil })
+	pair.secondary.unhealthy.Store(true)
+
+	pair.primary.runHealthProbe(context.Background(), 0)
+	pair.primary.unhealthyHandOver.Wait()
+
+	// The secondary refused, so the primary stops heartbeating for it to take over instead
+	pair.requireRoles(t, RolePrimary, RoleSecondary)
+	if !pair.primary.heartbeatsSuppressed() {
+		t.Fatal("unhealthy primary still heartbeats after the secondary refused to take over")
+	}
+}
+
+// resignCounter is a lease elector that counts how often it resigns leadership
+type resignCounter struct {
+	electedAfter
+	resigns atomic.Int32
+}
+
+func (e *resignCounter) Resign(context.Context) error {
+	e.resigns.Add(1)
+	return nil
+}
+
+func TestHandOverUnhealthyOncePerEpisode(t *testing.T) {
+	ctx := context.Background()
+	conduit, socket := newFakeConduit(t, testNATEntries())
+	elector := &resignCounter{}
+	lf := newTestFailover(t, newTestCloud(), "i-a", probing(socket), func(config *LeaderConfig) {
+		config.HealthProbeFailureThreshold = 1
+		config.Elector = elector
+	})
+	lf.currentRole.Store(RolePrimary)
+	setRouter := func(enabled bool) {
+		conduit.SetHealth(func(h *conduitHealth) { h.router.Enabled = enabled })
+	}
+
+	// Without TLS the handover fails and leadership is resigned instead, once however long
+	// the primary stays unhealthy
+	setRouter(false)
+	failures := 0
+	for range 3 {
+		failures = lf.runHealthProbe(ctx, failures)
+	}
+	lf.unhealthyHandOver.Wait()
+	if resigns := elector.resigns.Load(); resigns != 1 {
+		t.Fatalf("resigned %d times while unhealthy, want once", resigns)
+	}
+
+	// Becoming unhealthy again starts another handover
+	setRouter(true)
+	failures = lf.runHealthProbe(ctx, failures)
+	setRouter(false)
+	lf.runHealthProbe(ctx, failures)
+	lf.unhealthyHandOver.Wait()
+	if resigns := elector.resigns.Load(); resigns != 2 {
+		t.Fatalf("resigned %d times over two unhealthy episodes, want twice", resigns)
+	}
+}
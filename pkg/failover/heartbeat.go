@@ -0,0 +1,802 @@
+package failover
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/loopholelabs/frisbee-go"
+)
+
+// witnessVoteTimeout bounds how long a secondary waits for the witness to answer a vote request
+const witnessVoteTimeout = time.Second
+
+// ErrNoResponse is returned for an fRPC call whose connection closed before the peer answered
+var ErrNoResponse = errors.New("connection closed before the peer responded")
+
+// HeartbeatStats describes the heartbeat path as seen by this node
+type HeartbeatStats struct {
+	// Sequence is the last heartbeat sequence sent (primary) or received (secondary)
+	Sequence uint64
+
+	// LastHeartbeat is the time the last heartbeat was acknowledged (primary) or received (secondary)
+	LastHeartbeat time.Time
+
+	// LastRTT is the round-trip time of the last acknowledged heartbeat (primary only)
+	LastRTT time.Duration
+
+	// MissedHeartbeats is the current count of consecutive missed heartbeats
+	MissedHeartbeats int
+
+	// SequenceGaps counts heartbeats that were lost in transit (secondary only)
+	SequenceGaps uint64
+
+	// PeerAddr is the fRPC address heartbeats are sent to, the first registered secondary by
+	// node ID when several are (primary only)
+	PeerAddr string
+
+	// Paths describes each configured heartbeat path (primary) or each path heartbeats
+	// arrived on (secondary), when peer addresses are configured
+	Paths []PathStats
+
+	// Phi describes the phi accrual failure detector (secondary with the phi detector only)
+	Phi *PhiStats
+}
+
+// GetHeartbeatStats returns a snapshot of the heartbeat tracking state
+func (lf *LeaderFailover) GetHeartbeatStats() HeartbeatStats {
+	lf.heartbeatMutex.Lock()
+	stats := HeartbeatStats{
+		Sequence:         lf.heartbeatSequence,
+		LastHeartbeat:    lf.lastHeartbeat,
+		LastRTT:          lf.heartbeatRTT,
+		MissedHeartbeats: lf.missedHeartbeats,
+		SequenceGaps:     lf.heartbeatGaps,
+	}
+	if lf.currentRole.Load() == RoleSecondary {
+		stats.Phi = lf.phiStatsLocked()
+	}
+	lf.heartbeatMutex.Unlock()
+
+	stats.PeerAddr = lf.registeredPeerAddr()
+	stats.Paths = lf.pathStatsSnapshot()
+
+	return stats
+}
+
+// dialFailoverClient creates an fRPC client and connects it to the given address
+func (lf *LeaderFailover) dialFailoverClient(addr string) (*Client, error) {
+	c, err := NewClient(lf.tls.clientConfig(), lf.logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fRPC client: %w", err)
+	}
+
+	if err := c.Connect(addr); err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	return c, nil
+}
+
+// dialPeerClient connects to the other node of the failover pair and verifies its identity
+func (lf *LeaderFailover) dialPeerClient(addr string) (*Client, error) {
+	c, err := lf.dialFailoverClient(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lf.verifyPeerIdentity(c); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// clientConnected reports whether the client has a live connection
+func clientConnected(c *Client) bool {
+	if c == nil || c.Closed() {
+		return false
+	}
+	select {
+	case <-c.CloseChannel():
+		return false
+	default:
+		return true
+	}
+}
+
+// rpcResponse returns the result of an fRPC call, turning a missing response into
+// ErrNoResponse. The generated client returns neither a response nor an error when the
+// connection closes cleanly while the call is waiting.
+func rpcResponse[T any](response *T, err error) (*T, error) {
+	if err != nil {
+		return nil, err
+	}
+	if response == nil {
+		return nil, ErrNoResponse
+	}
+	return response, nil
+}
+
+// startFRPCServer starts the fRPC server used by both roles to receive requests from the peer,
+// unless it is already running from a previous role
+func (lf *LeaderFailover) startFRPCServer() error {
+	lf.frpcServerMutex.Lock()
+	defer lf.frpcServerMutex.Unlock()
+
+	if lf.frpcServer != nil {
+		return nil
+	}
+
+	tlsConfig := lf.tls.serverConfig()
+	server, err := NewServer(lf, tlsConfig, lf.logger)
+	if err != nil {
+		return fmt.Errorf("failed to create fRPC server: %w", err)
+	}
+
+	serverAddr := fmt.Sprintf(":%d", lf.config.Port)
+	var listener net.Listener
+	if tlsConfig != nil {
+		listener, err = tls.Listen("tcp", serverAddr, tlsConfig)
+	} else {
+		listener, err = net.Listen("tcp", serverAddr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to listen for fRPC on %s: %w", serverAddr, err)
+	}
+
+	accepting := &acceptingListener{Listener: listener, accepting: make(chan struct{})}
+	lf.frpcServer = server
+	lf.frpcAccepting = accepting.accepting
+	go func() {
+		if err := server.StartWithListener(accepting); err != nil {
+			lf.logger.Error().Err(err).Msg("fRPC server failed")
+		}
+	}()
+
+	lf.logger.Info().Str("addr", serverAddr).Msg("fRPC server started")
+
+	return nil
+}
+
+// acceptingListener closes accepting once the fRPC server first accepts on it, by which time
+// the server has finished starting
+type acceptingListener struct {
+	net.Listener
+	accepting chan struct{}
+	once      sync.Once
+}
+
+// Accept signals the server started and waits for the next connection
+func (l *acceptingListener) Accept() (net.Conn, error) {
+	l.once.Do(func() { close(l.accepting) })
+	return l.Listener.Accept()
+}
+
+// stopFRPCServer shuts down the fRPC server
+func (lf *LeaderFailover) stopFRPCServer() error {
+	lf.frpcServerMutex.Lock()
+	defer lf.frpcServerMutex.Unlock()
+
+	if lf.frpcServer == nil {
+		return nil
+	}
+
+	// The server records its listener without synchronisation, shutting it down before it
+	// accepts would race with the start
+	<-lf.frpcAccepting
+	err := lf.frpcServer.Shutdown()
+	if err != nil {
+		lf.logger.Error().Err(err).Msg("Error shutting down fRPC server")
+	}
+	lf.frpcServer = nil
+
+	return err
+}
+
+// peerNode is a secondary registered with the primary. Each peer dials under its own lock,
+// so a secondary that does not answer never holds up heartbeats to the others.
+type peerNode struct {
+	addr string
+
+	mu     sync.Mutex
+	client *Client
+	closed bool
+}
+
+// registerPeer records the fRPC address of the secondary making an incoming request, so the
+// primary knows where to send heartbeats. Each secondary is tracked by the node ID it sends,
+// on the port it listens on. Configured peer addresses take precedence.
+func (lf *LeaderFailover) registerPeer(ctx context.Context, nodeID string, port uint32) {
+	if lf.currentRole.Load() != RolePrimary || len(lf.peerPaths) > 0 {
+		return
+	}
+
+	conn, ok := ctx.Value(ConnectionContextKey).(*frisbee.Async)
+	if !ok || conn == nil {
+		return
+	}
+
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		lf.logger.Warn().Err(err).Str("remote_addr", conn.RemoteAddr().String()).Msg("Failed to parse peer address")
+		return
+	}
+	if port == 0 || port > 65535 {
+		port = uint32(lf.config.Port)
+	}
+	peerAddr := net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10))
+
+	// A secondary that does not identify itself is known by its address
+	if nodeID == "" {
+		nodeID = peerAddr
+	}
+
+	lf.peerMutex.Lock()
+	old, ok := lf.peers[nodeID]
+	if ok && old.addr == peerAddr {
+		lf.peerMutex.Unlock()
+		return
+	}
+	lf.peers[nodeID] = &peerNode{addr: peerAddr}
+	lf.peerMutex.Unlock()
+
+	logEvent := lf.logger.Info().
+		Str("node_id", nodeID).
+		Str("peer_addr", peerAddr)
+	if ok {
+		logEvent = logEvent.Str("old_peer_addr", old.addr)
+		lf.closePeer(old)
+	}
+	logEvent.Msg("Registered secondary peer for heartbeats")
+}
+
+// registeredPeers returns the registered secondaries ordered by node ID
+func (lf *LeaderFailover) registeredPeers() []*peerNode {
+	lf.peerMutex.Lock()
+	defer lf.peerMutex.Unlock()
+
+	peers := make([]*peerNode, 0, len(lf.peers))
+	for _, nodeID := range slices.Sorted(maps.Keys(lf.peers)) {
+		peers = append(peers, lf.peers[nodeID])
+	}
+	return peers
+}
+
+// registeredPeerAddr returns the fRPC address of the first registered secondary by node ID,
+// or an empty string when none has registered
+func (lf *LeaderFailover) registeredPeerAddr() string {
+	peers := lf.registeredPeers()
+	if len(peers) == 0 {
+		return ""
+	}
+	return peers[0].addr
+}
+
+// peerHeartbeatClient returns a connected client to a registered secondary, dialing if necessary
+func (lf *LeaderFailover) peerHeartbeatClient(peer *peerNode) (*Client, error) {
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+
+	if peer.closed {
+		return nil, fmt.Errorf("secondary %s: %w", peer.addr, net.ErrClosed)
+	}
+	if clientConnected(peer.client) {
+		return peer.client, nil
+	}
+	if peer.client != nil {
+		_ = peer.client.Close()
+		peer.client = nil
+	}
+
+	c, err := lf.dialPeerClient(peer.addr)
+	if err != nil {
+		return nil, err
+	}
+	peer.client = c
+
+	return c, nil
+}
+
+// closePeer closes the heartbeat client to a secondary that is no longer registered
+func (lf *LeaderFailover) closePeer(peer *peerNode) {
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+
+	peer.closed = true
+	if peer.client != nil {
+		if err := peer.client.Close(); err != nil {
+			lf.logger.Debug().Err(err).Str("peer_addr", peer.addr).Msg("Error closing heartbeat client")
+		}
+		peer.client = nil
+	}
+}
+
+// closePeers closes the heartbeat clients to the secondaries and forgets them
+func (lf *LeaderFailover) closePeers() {
+	lf.peerMutex.Lock()
+	peers := lf.peers
+	lf.peers = make(map[string]*peerNode)
+	lf.peerMutex.Unlock()
+
+	for _, peer := range peers {
+		lf.closePeer(peer)
+	}
+}
+
+// heartbeatSenderLoop sends heartbeats to the secondary when acting as primary
+func (lf *LeaderFailover) heartbeatSenderLoop(ctx context.Context, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(lf.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	lf.logger.Info().
+		Str("interval", lf.config.HeartbeatInterval.String()).
+		Msg("Starting heartbeat sender")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-lf.stopCh:
+			return
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			// An unhealthy primary goes quiet so the secondary takes over
+			if lf.heartbeatsSuppressed() {
+				continue
+			}
+			if err := lf.sendHeartbeat(ctx); err != nil {
+				lf.logger.Debug().Err(err).Msg("Failed to send heartbeat to secondary")
+			}
+		}
+	}
+}
+
+// sendHeartbeat sends a single heartbeat to every registered secondary and records the
+// round-trip time of the fastest. The heartbeat only counts as missed when no secondary
+// acknowledged it.
+func (lf *LeaderFailover) sendHeartbeat(ctx context.Context) error {
+	if len(lf.peerPaths) > 0 {
+		return lf.sendPathHeartbeats(ctx)
+	}
+
+	peers := lf.registeredPeers()
+	if len(peers) == 0 {
+		return nil
+	}
+
+	request := lf.nextHeartbeat()
+
+	hbCtx, cancel := context.WithTimeout(ctx, lf.config.HeartbeatInterval)
+	defer cancel()
+
+	type peerResult struct {
+		i   int
+		rtt time.Duration
+		err error
+	}
+	results := make(chan peerResult, len(peers))
+	for i, peer := range peers {
+		go func() {
+			rtt, err := lf.sendPeerHeartbeat(hbCtx, peer, request)
+			results <- peerResult{i: i, rtt: rtt, err: err}
+		}()
+	}
+
+	// A secondary that has not answered within the interval missed this heartbeat, the
+	// others are not held up waiting for it
+	rtts := make([]time.Duration, len(peers))
+	errs := make([]error, len(peers))
+	for i := range errs {
+		errs[i] = fmt.Errorf("heartbeat %d to %s: %w", request.Sequence, peers[i].addr, context.DeadlineExceeded)
+	}
+collect:
+	for range peers {
+		select {
+		case result := <-results:
+			rtts[result.i], errs[result.i] = result.rtt, result.err
+		case <-hbCtx.Done():
+			break collect
+		}
+	}
+
+	lf.heartbeatMutex.Lock()
+	defer lf.heartbeatMutex.Unlock()
+
+	delivered := false
+	for i, err := range errs {
+		if err != nil {
+			lf.logger.Debug().Err(err).Str("peer_addr", peers[i].addr).Msg("Failed to send heartbeat to secondary")
+			continue
+		}
+		if !delivered || rtts[i] < lf.heartbeatRTT {
+			lf.heartbeatRTT = rtts[i]
+		}
+		delivered = true
+	}
+
+	if !delivered {
+		lf.missedHeartbeats++
+		return fmt.Errorf("heartbeat %d failed: %w", request.Sequence, errors.Join(errs...))
+	}
+
+	lf.lastHeartbeat = time.Now()
+	lf.missedHeartbeats = 0
+
+	lf.logger.Trace().
+		Uint64("sequence", request.Sequence).
+		Str("rtt", lf.heartbeatRTT.String()).
+		Msg("Heartbeat acknowledged")
+
+	return nil
+}
+
+// sendPeerHeartbeat sends a heartbeat to one secondary and returns its round-trip time
+func (lf *LeaderFailover) sendPeerHeartbeat(ctx context.Context, peer *peerNode, request *FailoverHeartbeatRequest) (time.Duration, error) {
+	c, err := lf.peerHeartbeatClient(peer)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := time.Now()
+	response, err := rpcResponse(c.FailoverService.Heartbeat(ctx, request))
+	if err != nil {
+		return 0, fmt.Errorf("heartbeat %d to %s failed: %w", request.Sequence, peer.addr, err)
+	}
+	if err := lf.checkHeartbeatResponse(response, request.Sequence); err != nil {
+		return 0, err
+	}
+
+	return time.Since(sent), nil
+}
+
+// nextHeartbeat builds the heartbeat with the next sequence number
+func (lf *LeaderFailover) nextHeartbeat() *FailoverHeartbeatRequest {
+	lf.heartbeatMutex.Lock()
+	lf.heartbeatSequence++
+	sequence := lf.heartbeatSequence
+	lf.heartbeatMutex.Unlock()
+
+	return &FailoverHeartbeatRequest{
+		RequestId:  fmt.Sprintf("heartbeat_%d", sequence),
+		Timestamp:  time.Now().UnixNano(),
+		PrimaryEni: lf.currentENI.Load(),
+		Sequence:   sequence,
+		Epoch:      lf.epochs.leader(),
+		Priority:   lf.config.Priority,
+	}
+}
+
+// checkHeartbeatResponse verifies the secondary accepted the heartbeat with the given sequence
+func (lf *LeaderFailover) checkHeartbeatResponse(response *FailoverHeartbeatResponse, sequence uint64) error {
+	if lf.observeEpoch(response.Epoch, "heartbeat response") {
+		return fmt.Errorf("%w: secondary has epoch %d", ErrStaleEpoch, response.Epoch)
+	}
+
+	if !response.Success {
+		return fmt.Errorf("secondary rejected heartbeat %d", sequence)
+	}
+
+	if response.Sequence != sequence {
+		return fmt.Errorf("heartbeat acknowledgment out of order: sent %d, got %d", sequence, response.Sequence)
+	}
+
+	return nil
+}
+
+// recordHeartbeat updates heartbeat tracking for a heartbeat received from the primary. The
+// sequence only moves forward until a primary with another epoch or ENI sends heartbeats.
+func (lf *LeaderFailover) recordHeartbeat(req *FailoverHeartbeatRequest) {
+	lf.heartbeatMutex.Lock()
+	defer lf.heartbeatMutex.Unlock()
+
+	// A restarted or newly elected primary starts again from 1 under a new epoch
+	restarted := lf.heartbeatSequence != 0 && (req.Epoch != lf.heartbeatEpoch || req.PrimaryEni != lf.heartbeatENI)
+
+	switch {
+	case restarted:
+		lf.logger.Info().
+			Uint64("last_sequence", lf.heartbeatSequence).
+			Uint64("sequence", req.Sequence).
+			Uint64("epoch", req.Epoch).
+			Str("primary_eni", req.PrimaryEni).
+			Msg("Heartbeat sequence reset by primary")
+	case req.Sequence <= lf.heartbeatSequence:
+		// A copy sent over another path, or one delayed behind a later heartbeat: the primary
+		// is alive, but the copy is not timed and does not move the sequence back
+		lf.lastHeartbeat = time.Now()
+		lf.missedHeartbeats = 0
+		if req.Path != "" {
+			lf.recordPathHeartbeatLocked(req.Path)
+		}
+		return
+	case lf.heartbeatSequence != 0 && req.Sequence > lf.heartbeatSequence+1:
+		gap := req.Sequence - lf.heartbeatSequence - 1
+		lf.heartbeatGaps += gap
+		lf.logger.Debug().
+			Uint64("last_sequence", lf.heartbeatSequence).
+			Uint64("sequence", req.Sequence).
+			Uint64("lost", gap).
+			Msg("Heartbeat sequence gap detected")
+	}
+
+	if lf.phi != nil {
+		lf.phi.heartbeat()
+	}
+
+	lf.heartbeatSequence = req.Sequence
+	lf.heartbeatEpoch = req.Epoch
+	lf.heartbeatENI = req.PrimaryEni
+	lf.lastHeartbeat = time.Now()
+	lf.missedHeartbeats = 0
+	lf.primaryPriority = req.Priority
+
+	if req.Path != "" {
+		lf.recordPathHeartbeatLocked(req.Path)
+	}
+}
+
+// announceToPrimary connects to the primary if needed and sends a health check,
+// which registers this node as the heartbeat target on the primary
+func (lf *LeaderFailover) announceToPrimary(ctx context.Context) error {
+	c, err := lf.primaryClient()
+	if err != nil {
+		return err
+	}
+
+	request := &FailoverHealthCheckRequest{
+		RequestId: fmt.Sprintf("announce_%d", time.Now().UnixNano()),
+		Epoch:     lf.epochs.current(),
+		NodeId:    lf.nodeID(),
+		Port:      uint32(lf.config.Port),
+	}
+
+	response, err := rpcResponse(c.FailoverService.HealthCheck(ctx, request))
+	if err != nil {
+		return fmt.Errorf("failed to announce to primary: %w", err)
+	}
+	lf.observeEpoch(response.Epoch, "health check response")
+
+	// BFD carries no priority, so a secondary using it learns the primary's from here
+	lf.heartbeatMutex.Lock()
+	lf.primaryPriority = response.Priority
+	lf.heartbeatMutex.Unlock()
+
+	lf.logger.Info().
+		Str("primary_role", response.NodeRole).
+		Str("primary_instance_id", response.InstanceId).
+		Uint64("primary_epoch", response.Epoch).
+		Msg("Announced to primary")
+
+	return nil
+}
+
+// primaryClient returns a connected client to the primary, reconnecting if necessary
+func (lf *LeaderFailover) primaryClient() (*Client, error) {
+	lf.frpcClientMutex.Lock()
+	defer lf.frpcClientMutex.Unlock()
+
+	if clientConnected(lf.frpcClient) {
+		return lf.frpcClient, nil
+	}
+	if lf.frpcClient != nil {
+		_ = lf.frpcClient.Close()
+		lf.frpcClient = nil
+	}
+
+	c, err := lf.dialPrimary()
+	if err != nil {
+		return nil, fmt.Errorf("fRPC client not connected: %w", err)
+	}
+	lf.frpcClient = c
+
+	return c, nil
+}
+
+// dialPrimary connects to the primary, trying each of its addresses in order so the
+// secondary can reach it while one path is down. In a cluster the peer addresses lead to
+// several nodes, so those that are not primary are skipped.
+func (lf *LeaderFailover) dialPrimary() (*Client, error) {
+	var errs []error
+	for _, primaryAddr := range lf.primaryAddrs() {
+		c, err := lf.dialPeerClient(primaryAddr)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if len(lf.config.ClusterPeers) > 0 {
+			if err := confirmPrimary(c); err != nil {
+				_ = c.Close()
+				errs = append(errs, fmt.Errorf("%s: %w", primaryAddr, err))
+				continue
+			}
+		}
+
+		lf.logger.Info().Str("primary_addr", primaryAddr).Msg("Connected to primary")
+
+		return c, nil
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// confirmPrimary checks a newly connected cluster member reports the primary role
+func confirmPrimary(c *Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), peerIdentityTimeout)
+	defer cancel()
+
+	response, err := rpcResponse(c.FailoverService.HealthCheck(ctx, &FailoverHealthCheckRequest{
+		RequestId: fmt.Sprintf("primary_%d", time.Now().UnixNano()),
+		Probe:     true,
+	}))
+	if err != nil {
+		return fmt.Errorf("failed to check role: %w", err)
+	}
+	if response.NodeRole != RoleStringPrimary {
+		return fmt.Errorf("node %s is %s, not primary", response.InstanceId, response.NodeRole)
+	}
+	return nil
+}
+
+// primaryAddr is the fRPC address of the primary: the first configured peer address, or
+// the ENI IP the primary holds when none are configured
+func (lf *LeaderFailover) primaryAddr() string {
+	return lf.primaryAddrs()[0]
+}
+
+// primaryAddrs lists the fRPC addresses the primary can be reached on, in order of preference
+func (lf *LeaderFailover) primaryAddrs() []string {
+	if len(lf.peerPaths) > 0 {
+		return lf.peerPaths
+	}
+	return []string{net.JoinHostPort(lf.config.ENIIP, strconv.Itoa(int(lf.config.Port)))}
+}
+
+// witnessRPCClient returns a connected client to the witness, dialing if necessary
+func (lf *LeaderFailover) witnessRPCClient() (*Client, error) {
+	lf.witnessMutex.Lock()
+	defer lf.witnessMutex.Unlock()
+
+	if clientConnected(lf.witnessClient) {
+		return lf.witnessClient, nil
+	}
+	if lf.witnessClient != nil {
+		_ = lf.witnessClient.Close()
+		lf.witnessClient = nil
+	}
+
+	c, err := lf.dialFailoverClient(lf.config.WitnessAddr)
+	if err != nil {
+		return nil, err
+	}
+	lf.witnessClient = c
+
+	return c, nil
+}
+
+// closeWitnessClient closes the client to the witness
+func (lf *LeaderFailover) closeWitnessClient() {
+	lf.witnessMutex.Lock()
+	defer lf.witnessMutex.Unlock()
+
+	if lf.witnessClient != nil {
+		if err := lf.witnessClient.Close(); err != nil {
+			lf.logger.Debug().Err(err).Msg("Error closing witness client")
+		}
+		lf.witnessClient = nil
+	}
+}
+
+// witnessHeartbeatLoop sends heartbeats to the witness when acting as primary, so the
+// witness can tell whether the primary is reachable when a secondary asks to promote
+func (lf *LeaderFailover) witnessHeartbeatLoop(ctx context.Context, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(lf.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	lf.logger.Info().
+		Str("witness_addr", lf.config.WitnessAddr).
+		Msg("Starting witness heartbeat sender")
+
+	var sequence uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-lf.stopCh:
+			return
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			// The witness must also see an unhealthy primary as down
+			if lf.heartbeatsSuppressed() {
+				continue
+			}
+			sequence++
+			if err := lf.sendWitnessHeartbeat(ctx, sequence); err != nil {
+				lf.logger.Debug().Err(err).Msg("Failed to send heartbeat to witness")
+			}
+		}
+	}
+}
+
+// sendWitnessHeartbeat sends a single heartbeat to the witness
+func (lf *LeaderFailover) sendWitnessHeartbeat(ctx context.Context, sequence uint64) error {
+	c, err := lf.witnessRPCClient()
+	if err != nil {
+		return err
+	}
+
+	request := &FailoverHeartbeatRequest{
+		RequestId:  fmt.Sprintf("witness_heartbeat_%d", sequence),
+		Timestamp:  time.Now().UnixNano(),
+		PrimaryEni: lf.currentENI.Load(),
+		Sequence:   sequence,
+		Epoch:      lf.epochs.leader(),
+	}
+
+	hbCtx, cancel := context.WithTimeout(ctx, lf.config.HeartbeatInterval)
+	defer cancel()
+
+	response, err := rpcResponse(c.FailoverService.Heartbeat(hbCtx, request))
+	if err != nil {
+		return fmt.Errorf("witness heartbeat %d failed: %w", sequence, err)
+	}
+
+	if lf.observeEpoch(response.Epoch, "witness heartbeat response") {
+		return fmt.Errorf("%w: witness has epoch %d", ErrStaleEpoch, response.Epoch)
+	}
+
+	if !response.Success {
+		return fmt.Errorf("witness rejected heartbeat %d", sequence)
+	}
+
+	return nil
+}
+
+// confirmPrimaryDown asks the witness to agree that the primary is unreachable before
+// this secondary promotes. Without a configured witness promotion is always allowed.
+func (lf *LeaderFailover) confirmPrimaryDown(ctx context.Context) error {
+	if lf.config.WitnessAddr == "" {
+		return nil
+	}
+
+	c, err := lf.witnessRPCClient()
+	if err != nil {
+		return fmt.Errorf("witness unreachable: %w", err)
+	}
+
+	request := &FailoverVoteRequest{
+		RequestId:   fmt.Sprintf("vote_%d", time.Now().UnixNano()),
+		CandidateId: lf.nodeID(),
+		Epoch:       lf.epochs.current(),
+	}
+
+	voteCtx, cancel := context.WithTimeout(ctx, witnessVoteTimeout)
+	defer cancel()
+
+	response, err := rpcResponse(c.FailoverService.RequestVote(voteCtx, request))
+	if err != nil {
+		return fmt.Errorf("witness vote request failed: %w", err)
+	}
+	lf.observeEpoch(response.Epoch, "witness vote")
+
+	if !response.Granted {
+		return fmt.Errorf("witness refused promotion: %s", response.Reason)
+	}
+
+	lf.logger.Info().
+		Str("witness_addr", lf.config.WitnessAddr).
+		Uint64("witness_epoch", response.Epoch).
+		Msg("Witness confirmed primary is unreachable")
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRPCResponse(t *testing.T) {
+	callErr := errors.New("call failed")
+
+	if _, err := rpcResponse[FailoverHeartbeatResponse](nil, callErr); !errors.Is(err, callErr) {
+		t.Fatalf("failed call: got %v, want the call error", err)
+	}
+	if _, err := rpcResponse[FailoverHeartbeatResponse](nil, nil); !errors.Is(err, ErrNoResponse) {
+		t.Fatalf("closed connection: got %v, want ErrNoResponse", err)
+	}
+
+	want := &FailoverHeartbeatResponse{Sequence: 7}
+	if got, err := rpcResponse(want, nil); err != nil || got != want {
+		t.Fatalf("answered call: got %v, %v, want the response", got, err)
+	}
+}
+
+// freeTCPPort returns a loopback port nothing is listening on
+func freeTCPPort(t *testing.T) uint16 {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	if err := listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return uint16(port) //nolint:gosec // ports fit in 16 bits
+}
+
+// newHeartbeatPair creates a primary sending heartbeats to a secondary whose fRPC server
+// listens on loopback
+func newHeartbeatPair(t *testing.T) (*LeaderFailover, *LeaderFailover) {
+	t.Helper()
+
+	cloud := newTestCloud()
+	port := freeTCPPort(t)
+	configure := func(config *LeaderConfig) {
+		config.Port = port
+		config.HeartbeatInterval = time.Second
+	}
+
+	secondary := newTestFailover(t, cloud, "i-b", configure)
+	secondary.currentRole.Store(RoleSecondary)
+	if err := secondary.startFRPCServer(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = secondary.stopFRPCServer() })
+
+	primary := newTestFailover(t, cloud, "i-a", configure)
+	primary.currentRole.Store(RolePrimary)
+	primary.currentENI.Store("eni-a")
+	primary.peers["i-b"] = &peerNode{addr: net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port)))}
+	t.Cleanup(primary.closePeers)
+
+	return primary, secondary
+}
+
+func TestHeartbeatSequenceGaps(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := newHeartbeatPair(t)
+
+	if err := primary.sendHeartbeat(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stats := secondary.GetHeartbeatStats(); stats.Sequence != 1 || stats.SequenceGaps != 0 {
+		t.Fatalf("after the first heartbeat: got sequence %d with %d gaps, want 1 with 0", stats.Sequence, stats.SequenceGaps)
+	}
+
+	// Heartbeats 2 and 3 are lost in transit
+	primary.nextHeartbeat()
+	primary.nextHeartbeat()
+	if err := primary.sendHeartbeat(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stats := secondary.GetHeartbeatStats(); stats.Sequence != 4 || stats.SequenceGaps != 2 {
+		t.Fatalf("after losing two heartbeats: got sequence %d with %d gaps, want 4 with 2", stats.Sequence, stats.SequenceGaps)
+	}
+
+	if stats := primary.GetHeartbeatStats(); stats.Sequence != 4 || stats.MissedHeartbeats != 0 || stats.LastHeartbeat.IsZero() {
+		t.Fatalf("primary stats: got %+v, want sequence 4 acknowledged", stats)
+	}
+}
+
+func TestHeartbeatOutOfOrder(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := newHeartbeatPair(t)
+	secondary.phi = newPhiDetector(10, time.Second, 0)
+
+	for range 3 {
+		if err := primary.sendHeartbeat(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	samples := secondary.phi.count
+
+	c, err := primary.peerHeartbeatClient(primary.peers["i-b"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliver := func(sequence, epoch uint64) *FailoverHeartbeatResponse {
+		t.Helper()
+		request := &FailoverHeartbeatRequest{RequestId: "heartbeat_" + strconv.FormatUint(sequence, 10), PrimaryEni: "eni-a", Sequence: sequence, Epoch: epoch}
+		response, err := rpcResponse(c.FailoverService.Heartbeat(ctx, request))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	// Duplicates delayed behind later heartbeats neither move the sequence back nor are timed
+	response := deliver(2, 0)
+	deliver(3, 0)
+	deliver(1, 0)
+	if stats := secondary.GetHeartbeatStats(); stats.Sequence != 3 || stats.SequenceGaps != 0 {
+		t.Fatalf("after late duplicates: got sequence %d with %d gaps, want 3 with 0", stats.Sequence, stats.SequenceGaps)
+	}
+	if secondary.phi.count != samples {
+		t.Fatalf("phi samples after late duplicates: got %d, want %d", secondary.phi.count, samples)
+	}
+
+	// The primary never takes an acknowledgment for another heartbeat as its own
+	if err := primary.checkHeartbeatResponse(response, 3); err == nil {
+		t.Fatal("acknowledgment of heartbeat 2 accepted for heartbeat 3")
+	}
+
+	// The next heartbeat from the primary follows on without a gap
+	if err := primary.sendHeartbeat(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stats := secondary.GetHeartbeatStats(); stats.Sequence != 4 || stats.SequenceGaps != 0 {
+		t.Fatalf("after the next heartbeat: got sequence %d with %d gaps, want 4 with 0", stats.Sequence, stats.SequenceGaps)
+	}
+	if secondary.phi.count != samples+1 {
+		t.Fatalf("phi samples after the next heartbeat: got %d, want %d", secondary.phi.count, samples+1)
+	}
+
+	// A primary elected under a new epoch starts again from 1
+	deliver(1, 1)
+	if stats := secondary.GetHeartbeatStats(); stats.Sequence != 1 || stats.SequenceGaps != 0 {
+		t.Fatalf("after a new primary: got sequence %d with %d gaps, want 1 with 0", stats.Sequence, stats.SequenceGaps)
+	}
+}
+
+func TestHeartbeatWhileENIChanges(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := newHeartbeatPair(t)
+
+	// Failover actions and drift reconciliation move the ENI while heartbeats are sent
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 100 {
+			primary.currentENI.Store("eni-" + strconv.Itoa(i))
+		}
+	}()
+
+	for range 10 {
+		if err := primary.sendHeartbeat(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	if stats := secondary.GetHeartbeatStats(); stats.Sequence != 10 || stats.SequenceGaps != 0 {
+		t.Fatalf("got sequence %d with %d gaps, want 10 with 0", stats.Sequence, stats.SequenceGaps)
+	}
+}
+
+func TestHeartbeatsToSeveralSecondaries(t *testing.T) {
+	ctx := context.Background()
+	cloud := newTestCloud()
+	primaryPort := freeTCPPort(t)
+
+	primary := newTestFailover(t, cloud, "i-a", func(config *LeaderConfig) {
+		config.Port = primaryPort
+		config.HeartbeatInterval = time.Second
+	})
+	primary.currentRole.Store(RolePrimary)
+	if err := primary.startFRPCServer(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = primary.stopFRPCServer() })
+	t.Cleanup(primary.closePeers)
+
+	// Each secondary announces itself with its node ID and the port it listens on
+	secondaries := make(map[string]*LeaderFailover)
+	for _, instance := range []string{"i-b", "i-c"} {
+		secondary := newTestFailover(t, cloud, instance, func(config *LeaderConfig) {
+			config.Port = freeTCPPort(t)
+			config.PeerAddrs = []string{"/ip4/127.0.0.1/tcp/" + strconv.Itoa(int(primaryPort))}
+			config.HeartbeatInterval = time.Second
+		})
+		secondary.currentRole.Store(RoleSecondary)
+		if err := secondary.startFRPCServer(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = secondary.stopFRPCServer() })
+		t.Cleanup(func() { _ = secondary.cleanup() })
+
+		if err := secondary.announceToPrimary(ctx); err != nil {
+			t.Fatal(err)
+		}
+		secondaries[instance] = secondary
+	}
+
+	if err := primary.sendHeartbeat(ctx); err != nil {
+		t.Fatal(err)
+	}
+	clients := make(map[string]*Client)
+	for nodeID, peer := range primary.peers {
+		clients[nodeID] = peer.client
+	}
+	if len(clients) != 2 {
+		t.Fatalf("registered secondaries: got %d, want 2", len(clients))
+	}
+
+	// Another secondary announcing again neither replaces nor redials the first one
+	if err := secondaries["i-c"].announceToPrimary(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := primary.sendHeartbeat(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for nodeID, peer := range primary.peers {
+		if peer.client != clients[nodeID] {
+			t.Fatalf("heartbeat client to %s was redialed", nodeID)
+		}
+	}
+	for instance, secondary := range secondaries {
+		if stats := secondary.GetHeartbeatStats(); stats.Sequence != 3 || stats.SequenceGaps != 0 {
+			t.Fatalf("%s: got sequence %d with %d gaps, want 3 with 0", instance, stats.Sequence, stats.SequenceGaps)
+		}
+	}
+}
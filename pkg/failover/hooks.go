@@ -0,0 +1,153 @@
+package failover
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transition hook points
+const (
+	HookPrePromote  = "pre_promote"  // before the node claims the primary role, may veto the promotion
+	HookPostPromote = "post_promote" // once the node acts as primary
+	HookPostDemote  = "post_demote"  // once the node acts as secondary
+)
+
+// hookWaitDelay bounds how long a hook command that timed out may keep its output open
+const hookWaitDelay = time.Second
+
+// TransitionHook is a Go callback run at a transition hook point. A pre-promote hook vetoes
+// the promotion by returning an error, and any hook may annotate the transition by adding
+// to the event's annotations.
+type TransitionHook func(ctx context.Context, event *TransitionEvent) error
+
+// TransitionHooks are Go callbacks run at each transition hook point, before the
+// configured hook commands
+type TransitionHooks struct {
+	PrePromote  []TransitionHook
+	PostPromote []TransitionHook
+	PostDemote  []TransitionHook
+}
+
+// TransitionEvent describes the transition a hook runs for
+type TransitionEvent struct {
+	Hook   string
+	From   NodeState
+	To     NodeRole
+	Reason string
+	Epoch  uint64
+
+	// Annotations recorded with the transition
+	Annotations map[string]string
+}
+
+// runHooks runs the Go callbacks and then the commands configured for a hook point, each
+// with the hook timeout. It returns the annotations the hooks added. A pre-promote hook
+// that fails stops the remaining ones, failures of other hooks are collected.
+func (lf *LeaderFailover) runHooks(ctx context.Context, hook string, from NodeState, to NodeRole, reason string) (map[string]string, error) {
+	var callbacks []TransitionHook
+	var commands []string
+	switch hook {
+	case HookPrePromote:
+		callbacks, commands = lf.config.Hooks.PrePromote, lf.config.PrePromoteHooks
+	case HookPostPromote:
+		callbacks, commands = lf.config.Hooks.PostPromote, lf.config.PostPromoteHooks
+	case HookPostDemote:
+		callbacks, commands = lf.config.Hooks.PostDemote, lf.config.PostDemoteHooks
+	}
+
+	annotations := make(map[string]string)
+	event := &TransitionEvent{
+		Hook:        hook,
+		From:        from,
+		To:          to,
+		Reason:      reason,
+		Epoch:       lf.epochs.current(),
+		Annotations: make(map[string]string),
+	}
+
+	// A Go hook may replace the event's annotations or set them to nil, so what each hook
+	// added is copied out and the next one gets a map of its own
+	var errs []error
+	for i, callback := range callbacks {
+		hookCtx, cancel := context.WithTimeout(ctx, lf.config.HookTimeout)
+		err := callback(hookCtx, event)
+		cancel()
+		maps.Copy(annotations, event.Annotations)
+		event.Annotations = maps.Clone(annotations)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s hook %d: %w", hook, i, err))
+			if hook == HookPrePromote {
+				return annotations, errors.Join(errs...)
+			}
+		}
+	}
+	for _, command := range commands {
+		err := lf.runHookCommand(ctx, command, event)
+		maps.Copy(annotations, event.Annotations)
+		if err != nil {
+			errs = append(errs, err)
+			if hook == HookPrePromote {
+				return annotations, errors.Join(errs...)
+			}
+		}
+	}
+
+	return annotations, errors.Join(errs...)
+}
+
+// runHookCommand runs a hook command with sh, describing the transition in FAILOVER_*
+// environment variables. Lines of the form key=value on its standard output annotate
+// the transition, and its standard error explains a failure.
+func (lf *LeaderFailover) runHookCommand(ctx context.Context, command string, event *TransitionEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, lf.config.HookTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command) //nolint:gosec // hook commands are configured by the operator
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	killHookOnCancel(cmd)
+	cmd.WaitDelay = hookWaitDelay // a process holding the output open must not stall the transition
+	cmd.Env = append(os.Environ(),
+		"FAILOVER_HOOK="+event.Hook,
+		"FAILOVER_FROM_STATE="+event.From.String(),
+		"FAILOVER_TO_ROLE="+event.To.String(),
+		"FAILOVER_REASON="+event.Reason,
+		"FAILOVER_EPOCH="+strconv.FormatUint(event.Epoch, 10),
+		"FAILOVER_ENI_IP="+lf.config.ENIIP,
+		"FAILOVER_INSTANCE_ID="+lf.instanceID(),
+	)
+
+	err := cmd.Run()
+
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if ok && key != "" {
+			event.Annotations[key] = value
+		}
+	}
+
+	lf.logger.Debug().
+		Str("hook", event.Hook).
+		Str("command", command).
+		Bool("success", err == nil).
+		Msg("Ran transition hook")
+
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("%s hook %q: %w: %s", event.Hook, command, err, message)
+		}
+		return fmt.Errorf("%s hook %q: %w", event.Hook, command, err)
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package failover
+
+import "os/exec"
+
+// killHookOnCancel leaves a timed out hook command to be killed on its own on platforms
+// without process groups
+func killHookOnCancel(_ *exec.Cmd) {}
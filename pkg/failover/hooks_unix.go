@@ -0,0 +1,17 @@
+//go:build unix
+
+package failover
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killHookOnCancel runs a hook command in its own process group and kills the whole group
+// when the hook times out, so processes the shell started do not outlive it
+func killHookOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
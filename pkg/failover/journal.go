@@ -0,0 +1,420 @@
+package failover
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/loopholelabs/logging/types"
+)
+
+// JournalFileName is the name of the event journal in the state directory
+const JournalFileName = "journal.jsonl"
+
+// journalMaxSize is the size at which the journal is rotated, keeping one previous file
+const journalMaxSize = 16 << 20
+
+// Triggers of role decisions
+const (
+	TriggerElection    = "election"       // leader election check, e.g. ENI ownership
+	TriggerHeartbeat   = "heartbeat_miss" // the failure detector considers the primary down
+	TriggerManual      = "manual"         // an operator requested a switchover
+	TriggerHealthProbe = "health_probe"   // the local Conduit instance is unhealthy
+	TriggerPreempt     = "preempt"        // a higher priority secondary took the primary role back
+	TriggerStepDown    = "step_down"      // a newer epoch fenced this node off
+	TriggerResume      = "resume"         // a promotion interrupted by a restart is resumed
+)
+
+// Events recorded in the journal
+const (
+	JournalEventDecision = "decision" // a role change was requested
+	JournalEventState    = "state"    // the transition state machine moved
+	JournalEventAction   = "action"   // an AWS failover step completed or gave up
+	JournalEventResult   = "result"   // the role change finished
+	JournalEventDrift    = "drift"    // the primary repaired a resource that drifted away from it
+)
+
+// Failover actions recorded in the journal
+const (
+	ActionTakeOverENI         = "take_over_eni"
+	ActionGetENI              = "get_eni"
+	ActionStampEpoch          = "stamp_epoch"
+	ActionUpdateRoutes        = "update_routes"
+	ActionReassignFloatingIPs = "reassign_floating_ips"
+	ActionMoveEIP             = "move_eip"
+)
+
+// JournalInputs are the observations a role decision was based on
+type JournalInputs struct {
+	MissedHeartbeats int           `json:"missed_heartbeats,omitempty"`
+	LastHeartbeatAge time.Duration `json:"last_heartbeat_age_ns,omitempty"`
+	Phi              float64       `json:"phi,omitempty"`
+	ElectionBackend  string        `json:"election_backend,omitempty"`
+	Leader           string        `json:"leader,omitempty"`
+	ENIOwner         string        `json:"eni_owner,omitempty"`
+	HealthError      string        `json:"health_error,omitempty"`
+}
+
+// JournalEntry is an event of a role decision. Entries of the same decision share its number.
+type JournalEntry struct {
+	Time     time.Time `json:"time"`
+	Decision uint64    `json:"decision"`
+	Event    string    `json:"event"`
+
+	// Decision: what triggered it, the role it asked for and the inputs it was based on
+	Trigger    string         `json:"trigger,omitempty"`
+	TargetRole string         `json:"target_role,omitempty"`
+	Reason     string         `json:"reason,omitempty"`
+	Inputs     *JournalInputs `json:"inputs,omitempty"`
+
+	// State transition
+	From        string            `json:"from,omitempty"`
+	To          string            `json:"to,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// AWS failover step or drift repair, recorded when it completes or gives up: how many
+	// attempts it took, whether its change was already in place, and whether it was rolled back
+	Action     string        `json:"action,omitempty"`
+	Resource   string        `json:"resource,omitempty"`
+	Duration   time.Duration `json:"duration_ns,omitempty"`
+	Attempts   int           `json:"attempts,omitempty"`
+	InPlace    bool          `json:"in_place,omitempty"`
+	RolledBack bool          `json:"rolled_back,omitempty"`
+
+	// Result: the role and epoch the node ended up with
+	Role  string `json:"role,omitempty"`
+	Epoch uint64 `json:"epoch,omitempty"`
+
+	// Failure of a state transition, action or role change
+	Error string `json:"error,omitempty"`
+}
+
+// JournalFile returns the journal in a state directory
+func JournalFile(stateDir string) string {
+	return filepath.Join(stateDir, JournalFileName)
+}
+
+// DefaultJournalFile returns the journal of a daemon using the default state directory
+func DefaultJournalFile() string {
+	return JournalFile(defaultStateDir())
+}
+
+// eventJournal appends the events of role decisions to a file in the state directory
+type eventJournal struct {
+	path   string
+	logger types.Logger
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	decision uint64 // last decision number
+	current  uint64 // decision in progress, 0 between decisions
+
+	// Promotion still running when the daemon last stopped, until the next decision ends
+	interrupted *FailoverTimeline
+}
+
+// openJournal opens the journal in the state directory, continuing its decision numbering
+func openJournal(stateDir string, logger types.Logger) (*eventJournal, error) {
+	j := &eventJournal{
+		path:   JournalFile(stateDir),
+		logger: logger,
+	}
+
+	entries, err := ReadJournal(j.path)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		j.decision = max(j.decision, entry.Decision)
+	}
+	if timelines := BuildTimelines(entries); len(timelines) > 0 {
+		last := timelines[len(timelines)-1]
+		if last.Result == nil && last.Decision.TargetRole == RolePrimary.String() {
+			j.interrupted = &last
+		}
+	}
+
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// open opens the journal file for appending; callers must hold j.mu unless it is not shared yet
+func (j *eventJournal) open() error {
+	file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open journal %s: %w", j.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to stat journal %s: %w", j.path, err)
+	}
+
+	size := info.Size()
+
+	// A line cut short by a crash is ended, so the next entry does not run into it
+	if size > 0 && !endsWithNewline(j.path, size) {
+		n, err := file.Write([]byte{'\n'})
+		size += int64(n)
+		if err != nil {
+			_ = file.Close()
+			return fmt.Errorf("failed to end truncated line of journal %s: %w", j.path, err)
+		}
+	}
+
+	j.file = file
+	j.size = size
+	return nil
+}
+
+// endsWithNewline reports whether the last of the size bytes of a file is a newline, or
+// whether it cannot be read
+func endsWithNewline(path string, size int64) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer func() { _ = file.Close() }()
+
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, size-1); err != nil {
+		return true
+	}
+	return last[0] == '\n'
+}
+
+// begin records a role decision, whose number the following events share until end is called
+func (j *eventJournal) begin(request roleRequest) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.decision++
+	j.current = j.decision
+	j.appendLocked(JournalEntry{
+		Time:       request.detected,
+		Decision:   j.current,
+		Event:      JournalEventDecision,
+		Trigger:    request.trigger,
+		TargetRole: request.role.String(),
+		Reason:     request.reason,
+		Inputs:     request.inputs,
+	})
+}
+
+// end records the outcome of the decision in progress
+func (j *eventJournal) end(role NodeRole, epoch uint64, cause error) {
+	entry := JournalEntry{
+		Event: JournalEventResult,
+		Role:  role.String(),
+		Epoch: epoch,
+	}
+	if cause != nil {
+		entry.Error = cause.Error()
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.appendLocked(entry)
+	j.current = 0
+	j.interrupted = nil
+}
+
+// interruptedPromotion returns the promotion that was still running when the daemon last
+// stopped, or nil once a decision has ended since it started
+func (j *eventJournal) interruptedPromotion() *FailoverTimeline {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.interrupted
+}
+
+// record appends an event to the decision in progress
+func (j *eventJournal) record(entry JournalEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.appendLocked(entry)
+}
+
+// appendLocked writes an entry, rotating the journal once it grows too large. A journal
+// that cannot be written must not stop failover, so failures are only logged.
+func (j *eventJournal) appendLocked(entry JournalEntry) {
+	if j.file == nil {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if entry.Decision == 0 {
+		entry.Decision = j.current
+	}
+	// Drift is repaired between decisions, under the one that made this node primary
+	if entry.Decision == 0 && entry.Event == JournalEventDrift {
+		entry.Decision = j.decision
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		j.logger.Warn().Err(err).Msg("Failed to encode journal entry")
+		return
+	}
+	line = append(line, '\n')
+
+	if j.size+int64(len(line)) > journalMaxSize {
+		if err := j.rotateLocked(); err != nil {
+			j.logger.Warn().Err(err).Msg("Failed to rotate journal")
+		}
+		if j.file == nil {
+			return
+		}
+	}
+
+	n, err := j.file.Write(line)
+	j.size += int64(n)
+	if err != nil {
+		j.logger.Warn().Err(err).Str("path", j.path).Msg("Failed to write journal entry")
+	}
+}
+
+// rotateLocked moves the journal to a backup file, replacing the previous one, and starts a new journal
+func (j *eventJournal) rotateLocked() error {
+	if err := j.file.Close(); err != nil {
+		return fmt.Errorf("failed to close journal %s: %w", j.path, err)
+	}
+	j.file = nil
+
+	// Keep appending to the current journal if it cannot be moved
+	var rotateErr error
+	if err := os.Rename(j.path, j.path+".1"); err != nil {
+		rotateErr = fmt.Errorf("failed to rotate journal %s: %w", j.path, err)
+	}
+	return errors.Join(rotateErr, j.open())
+}
+
+// Close closes the journal file
+func (j *eventJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to close journal %s: %w", j.path, err)
+	}
+	return nil
+}
+
+// ReadJournal reads the entries of a journal and its rotated predecessor, oldest first.
+// Lines that cannot be decoded, such as one cut short by a crash, are skipped.
+func ReadJournal(path string) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	for _, name := range []string{path + ".1", path} {
+		file, err := os.Open(name)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to open journal %s: %w", name, err)
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+		for scanner.Scan() {
+			var entry JournalEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		err = scanner.Err()
+		_ = file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read journal %s: %w", name, err)
+		}
+	}
+
+	return entries, nil
+}
+
+// FailoverTimeline is one role decision from the journal with the events that followed it
+type FailoverTimeline struct {
+	Decision JournalEntry   `json:"decision"`
+	Events   []JournalEntry `json:"events"`
+	Result   *JournalEntry  `json:"result,omitempty"`
+
+	// Time from detecting the trigger until the route tables pointed at this node, zero
+	// when the decision did not update routes
+	DetectToRoutesUpdated time.Duration `json:"detect_to_routes_updated_ns,omitempty"`
+
+	// Time from the last heartbeat of the failed primary until the routes were updated,
+	// zero unless the decision was triggered by missed heartbeats
+	LastHeartbeatToRoutesUpdated time.Duration `json:"last_heartbeat_to_routes_updated_ns,omitempty"`
+}
+
+// Duration returns how long the role change took, zero while it is unfinished
+func (t *FailoverTimeline) Duration() time.Duration {
+	if t.Result == nil {
+		return 0
+	}
+	return t.Result.Time.Sub(t.Decision.Time)
+}
+
+// BuildTimelines groups journal entries into one timeline per role decision, oldest first
+func BuildTimelines(entries []JournalEntry) []FailoverTimeline {
+	var timelines []FailoverTimeline
+	index := make(map[uint64]int)
+
+	for _, entry := range entries {
+		if entry.Event == JournalEventDecision {
+			index[entry.Decision] = len(timelines)
+			timelines = append(timelines, FailoverTimeline{Decision: entry})
+			continue
+		}
+
+		i, ok := index[entry.Decision]
+		if !ok {
+			continue
+		}
+		t := &timelines[i]
+		switch entry.Event {
+		case JournalEventResult:
+			result := entry
+			t.Result = &result
+		case JournalEventAction:
+			if entry.Action == ActionUpdateRoutes && entry.Error == "" && !entry.InPlace {
+				t.DetectToRoutesUpdated = entry.Time.Sub(t.Decision.Time)
+				if inputs := t.Decision.Inputs; inputs != nil && t.Decision.Trigger == TriggerHeartbeat && inputs.LastHeartbeatAge > 0 {
+					t.LastHeartbeatToRoutesUpdated = t.DetectToRoutesUpdated + inputs.LastHeartbeatAge
+				}
+			}
+			t.Events = append(t.Events, entry)
+		default:
+			t.Events = append(t.Events, entry)
+		}
+	}
+
+	return timelines
+}
+
+// completedSteps lists the failover steps of a timeline that completed, as action and resource
+func completedSteps(t *FailoverTimeline) []string {
+	var steps []string
+	for _, event := range t.Events {
+		if event.Event == JournalEventAction && event.Error == "" {
+			steps = append(steps, event.Action+" "+event.Resource)
+		}
+	}
+	return steps
+}
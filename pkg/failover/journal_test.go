@@ -0,0 +1,220 @@
+package failover
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loopholelabs/logging"
+)
+
+// newTestJournal opens the journal in dir, closed when the test ends
+func newTestJournal(t *testing.T, dir string) *eventJournal {
+	t.Helper()
+
+	j, err := openJournal(dir, logging.Test(t, logging.Zerolog, "journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = j.Close() })
+
+	return j
+}
+
+func TestBuildTimelines(t *testing.T) {
+	start := time.Unix(1_760_000_000, 0)
+	at := func(offset time.Duration) time.Time { return start.Add(offset) }
+
+	entries := []JournalEntry{
+		{Time: at(0), Decision: 1, Event: JournalEventDecision, Trigger: TriggerHeartbeat, TargetRole: RoleStringPrimary, Inputs: &JournalInputs{LastHeartbeatAge: 2 * time.Second}},
+		{Time: at(time.Second), Decision: 1, Event: JournalEventAction, Action: ActionUpdateRoutes, Resource: "rtb-1", InPlace: true},
+		{Time: at(2 * time.Second), Decision: 1, Event: JournalEventAction, Action: ActionUpdateRoutes, Resource: "rtb-2", Error: "throttled"},
+		{Time: at(3 * time.Second), Decision: 1, Event: JournalEventAction, Action: ActionUpdateRoutes, Resource: "rtb-2"},
+		{Time: at(4 * time.Second), Decision: 1, Event: JournalEventResult, Role: RoleStringPrimary, Epoch: 2},
+
+		// Events of a decision whose start was rotated away are dropped
+		{Time: at(5 * time.Second), Decision: 7, Event: JournalEventState, From: "candidate", To: "promoting"},
+
+		{Time: at(10 * time.Second), Decision: 2, Event: JournalEventDecision, Trigger: TriggerManual, TargetRole: RoleStringPrimary},
+		{Time: at(11 * time.Second), Decision: 2, Event: JournalEventAction, Action: ActionUpdateRoutes, Resource: "rtb-1"},
+
+		{Time: at(20 * time.Second), Decision: 3, Event: JournalEventDecision, Trigger: TriggerHeartbeat, TargetRole: RoleStringPrimary, Inputs: &JournalInputs{LastHeartbeatAge: time.Second}},
+		{Time: at(21 * time.Second), Decision: 3, Event: JournalEventAction, Action: ActionUpdateRoutes, Resource: "rtb-1", Error: "throttled"},
+	}
+
+	timelines := BuildTimelines(entries)
+	if len(timelines) != 3 {
+		t.Fatalf("got %d timelines, want 3", len(timelines))
+	}
+
+	tests := []struct {
+		events            int
+		duration          time.Duration
+		detectToRoutes    time.Duration
+		heartbeatToRoutes time.Duration
+	}{
+		// Routes already in place or whose update failed do not count
+		{events: 3, duration: 4 * time.Second, detectToRoutes: 3 * time.Second, heartbeatToRoutes: 5 * time.Second},
+		// Only failed primaries have a last heartbeat, and the decision is unfinished
+		{events: 1, detectToRoutes: time.Second},
+		// Routes were never updated
+		{events: 1},
+	}
+	for i, tt := range tests {
+		timeline := timelines[i]
+		if timeline.Decision.Decision != uint64(i+1) || len(timeline.Events) != tt.events {
+			t.Fatalf("timeline %d: got decision %d with %d events, want %d events", i, timeline.Decision.Decision, len(timeline.Events), tt.events)
+		}
+		if timeline.Duration() != tt.duration || timeline.DetectToRoutesUpdated != tt.detectToRoutes || timeline.LastHeartbeatToRoutesUpdated != tt.heartbeatToRoutes {
+			t.Fatalf("timeline %d: took %s, routes updated %s after detection and %s after the last heartbeat, want %s, %s and %s",
+				i, timeline.Duration(), timeline.DetectToRoutesUpdated, timeline.LastHeartbeatToRoutesUpdated, tt.duration, tt.detectToRoutes, tt.heartbeatToRoutes)
+		}
+	}
+}
+
+func TestReadJournalSkipsTruncatedLine(t *testing.T) {
+	dir := t.TempDir()
+	j := newTestJournal(t, dir)
+	j.begin(newRoleRequest(RoleSecondary, TriggerElection, "test", nil))
+	j.end(RoleSecondary, 1, nil)
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The daemon crashed while writing the next entry
+	file, err := os.OpenFile(JournalFile(dir), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString(`{"time":"2026-10-16T12:00:00Z","decision":2,"ev`); err != nil {
+		t.Fatal(err)
+	}
+	_ = file.Close()
+
+	entries, err := ReadJournal(JournalFile(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want the 2 complete ones", len(entries))
+	}
+
+	// Entries written after the restart are not lost to the truncated line
+	j = newTestJournal(t, dir)
+	j.begin(newRoleRequest(RolePrimary, TriggerElection, "after restart", nil))
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = ReadJournal(JournalFile(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[2].Decision != 2 || entries[2].Reason != "after restart" {
+		t.Fatalf("entries after the restart: got %+v", entries)
+	}
+}
+
+func TestJournalRotation(t *testing.T) {
+	dir := t.TempDir()
+	j := newTestJournal(t, dir)
+
+	// Decisions whose reasons fill the journal past its limit
+	reason := strings.Repeat("x", 512<<10)
+	decisions := uint64(0)
+	for {
+		j.begin(newRoleRequest(RoleSecondary, TriggerElection, reason, nil))
+		j.end(RoleSecondary, 1, nil)
+		decisions++
+		if _, err := os.Stat(JournalFile(dir) + ".1"); err == nil {
+			break
+		} else if !errors.Is(err, os.ErrNotExist) {
+			t.Fatal(err)
+		}
+		if decisions > 2*journalMaxSize/uint64(len(reason)) {
+			t.Fatal("journal was never rotated")
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The decision numbering continues from the rotated journal after a restart
+	j = newTestJournal(t, dir)
+	j.begin(newRoleRequest(RoleSecondary, TriggerElection, "after restart", nil))
+	decisions++
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(JournalFile(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > journalMaxSize {
+		t.Fatalf("journal is %d bytes after rotating, over the %d limit", info.Size(), journalMaxSize)
+	}
+
+	entries, err := ReadJournal(JournalFile(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	timelines := BuildTimelines(entries)
+	if len(timelines) != int(decisions) {
+		t.Fatalf("got %d decisions across the rotation, want %d", len(timelines), decisions)
+	}
+	for i, timeline := range timelines {
+		if timeline.Decision.Decision != uint64(i+1) {
+			t.Fatalf("decision %d is numbered %d", i+1, timeline.Decision.Decision)
+		}
+	}
+}
+
+func TestOpenJournalDetectsInterruptedPromotion(t *testing.T) {
+	tests := []struct {
+		name        string
+		role        NodeRole
+		finished    bool
+		interrupted bool
+	}{
+		{name: "interrupted promotion", role: RolePrimary, interrupted: true},
+		{name: "finished promotion", role: RolePrimary, finished: true},
+		{name: "interrupted demotion", role: RoleSecondary},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			j := newTestJournal(t, dir)
+			j.begin(newRoleRequest(tt.role, TriggerHeartbeat, "test", nil))
+			j.record(JournalEntry{Event: JournalEventAction, Action: ActionTakeOverENI, Resource: testENIIP})
+			j.record(JournalEntry{Event: JournalEventAction, Action: ActionUpdateRoutes, Resource: "rtb-1", Error: "throttled"})
+			if tt.finished {
+				j.end(tt.role, 1, nil)
+			}
+			if err := j.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			j = newTestJournal(t, dir)
+			interrupted := j.interruptedPromotion()
+			if (interrupted != nil) != tt.interrupted {
+				t.Fatalf("interrupted promotion: got %+v, want one %t", interrupted, tt.interrupted)
+			}
+			if !tt.interrupted {
+				return
+			}
+			if steps := completedSteps(interrupted); len(steps) != 1 || steps[0] != ActionTakeOverENI+" "+testENIIP {
+				t.Fatalf("completed steps: got %q, want only the take-over", steps)
+			}
+
+			// The next decision to finish supersedes the interrupted one
+			j.begin(newRoleRequest(RolePrimary, TriggerResume, "resume", nil))
+			j.end(RolePrimary, 2, nil)
+			if j.interruptedPromotion() != nil {
+				t.Fatal("interrupted promotion still reported after the next decision ended")
+			}
+		})
+	}
+}
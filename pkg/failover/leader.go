@@ -6,13 +6,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
-	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/adrg/xdg"
+	metrics "github.com/hashicorp/go-metrics/compat"
 	"github.com/loopholelabs/logging/types"
 
 	"github.com/loopholelabs/architect-networking/pkg/client"
@@ -45,6 +51,39 @@ func (r NodeRole) String() string {
 	}
 }
 
+// roleValue is a NodeRole read by the fRPC handlers, control API and loops while the role
+// management loop changes it
+type roleValue struct {
+	v atomic.Int32
+}
+
+// Load returns the role
+func (r *roleValue) Load() NodeRole {
+	return NodeRole(r.v.Load())
+}
+
+// Store sets the role
+func (r *roleValue) Store(role NodeRole) {
+	r.v.Store(int32(role)) //nolint:gosec // roles are small constants
+}
+
+// eniValue is the ENI ID of the primary, read by the heartbeat loops, control API and
+// fencing checks while failover actions and drift reconciliation change it
+type eniValue struct {
+	v atomic.Value
+}
+
+// Load returns the ENI ID, or an empty string when it is not known
+func (e *eniValue) Load() string {
+	eni, _ := e.v.Load().(string)
+	return eni
+}
+
+// Store sets the ENI ID
+func (e *eniValue) Store(eni string) {
+	e.v.Store(eni)
+}
+
 // portUint32ToUint16 converts uint32 port to uint16, clamping to valid port range
 func portUint32ToUint16(port uint32) uint16 {
 	if port > 65535 {
@@ -53,56 +92,272 @@ func portUint32ToUint16(port uint32) uint16 {
 	return uint16(port)
 }
 
+// Failover daemon modes
+const (
+	ModeNode    = "node"
+	ModeWitness = "witness"
+)
+
 // LeaderConfig extends the basic failover config with leader election parameters
 type LeaderConfig struct {
+	// Daemon mode: node runs NAT failover, witness only takes part in leader election
+	Mode string `yaml:"mode" mapstructure:"mode"`
+
 	// ENI IP address to monitor for ownership
 	ENIIP string `yaml:"eni_ip" mapstructure:"eni_ip"`
 
 	// Port for frpc communication between nodes
 	Port uint16 `yaml:"port" mapstructure:"port"`
 
+	// Multiaddrs of the other node, e.g. /ip4/10.0.1.10/tcp/1022 for the management IP of its ENI
+	// or an address on a dedicated link (port defaults to Port). Heartbeats are sent over every
+	// address and the peer only counts as down when all of them miss. When empty, the secondary
+	// reaches the primary on the ENI IP and the primary heartbeats the secondaries that registered.
+	// In a raft cluster, list the other members: a secondary syncs from the one that is primary.
+	PeerAddrs []string `yaml:"peer_addrs" mapstructure:"peer_addrs"`
+
 	// Interval for checking ENI ownership
 	LeaderCheckInterval time.Duration `yaml:"leader_check_interval" mapstructure:"leader_check_interval"`
 
 	// Interval for syncing NAT state (when acting as secondary)
 	SyncInterval time.Duration `yaml:"sync_interval" mapstructure:"sync_interval"`
 
+	// Maximum number of NAT entries per message during a full state resync. This bounds the
+	// message size; both nodes still hold the full NAT state in memory during the resync.
+	SyncChunkSize int `yaml:"sync_chunk_size" mapstructure:"sync_chunk_size"`
+
+	// Wire format requested for synced NAT state: 1 for protocol messages, 2 for the compact encoding
+	SyncWireVersion uint32 `yaml:"sync_wire_version" mapstructure:"sync_wire_version"`
+
+	// Request zstd compression of compact encoded sync payloads
+	SyncCompression bool `yaml:"sync_compression" mapstructure:"sync_compression"`
+
 	// Heartbeat interval (must be <50ms for 3 heartbeats in 150ms)
 	HeartbeatInterval time.Duration `yaml:"heartbeat_interval" mapstructure:"heartbeat_interval"`
 
 	// Number of missed heartbeats before failover
 	HeartbeatMissThreshold int `yaml:"heartbeat_miss_threshold" mapstructure:"heartbeat_miss_threshold"`
 
+	// Failure detector deciding when the primary is down: counter counts missed heartbeats,
+	// phi suspects the primary once the phi accrual level exceeds PhiThreshold
+	FailureDetector string `yaml:"failure_detector" mapstructure:"failure_detector"`
+
+	// Suspicion level at which the phi accrual detector considers the primary down
+	PhiThreshold float64 `yaml:"phi_threshold" mapstructure:"phi_threshold"`
+
+	// Number of heartbeat inter-arrival times in the phi accrual detector's sliding window
+	PhiWindowSize int `yaml:"phi_window_size" mapstructure:"phi_window_size"`
+
+	// Lower bound of the inter-arrival time deviation, so perfectly regular heartbeats do not
+	// make the phi accrual detector suspect the primary after the slightest delay
+	PhiMinStdDev time.Duration `yaml:"phi_min_std_dev" mapstructure:"phi_min_std_dev"`
+
+	// Liveness protocol between the nodes: frpc heartbeat requests, or bfd for BFD (RFC 5880)
+	// control packets over UDP that detect a failed peer within a few tens of milliseconds
+	LivenessProtocol string `yaml:"liveness_protocol" mapstructure:"liveness_protocol"`
+
+	// UDP port for BFD control packets on this node and on the peer (defaults to BFDPort)
+	BFDPort     uint16 `yaml:"bfd_port" mapstructure:"bfd_port"`
+	BFDPeerPort uint16 `yaml:"bfd_peer_port" mapstructure:"bfd_peer_port"`
+
+	// Minimum intervals at which this node wants to send and can receive BFD control packets
+	BFDDesiredMinTx  time.Duration `yaml:"bfd_desired_min_tx" mapstructure:"bfd_desired_min_tx"`
+	BFDRequiredMinRx time.Duration `yaml:"bfd_required_min_rx" mapstructure:"bfd_required_min_rx"`
+
+	// BFD control packets the peer may miss before its session goes down
+	BFDDetectMultiplier uint8 `yaml:"bfd_detect_multiplier" mapstructure:"bfd_detect_multiplier"`
+
+	// Shared key (up to 20 bytes) and key ID for meticulous keyed SHA1 authentication of BFD packets
+	BFDAuthKeyFile string `yaml:"bfd_auth_key_file" mapstructure:"bfd_auth_key_file"`
+	BFDAuthKeyID   uint8  `yaml:"bfd_auth_key_id" mapstructure:"bfd_auth_key_id"`
+
+	// Fraction of received BFD control packets dropped, to test failure detection under packet loss
+	BFDPacketLoss float64 `yaml:"bfd_packet_loss" mapstructure:"bfd_packet_loss"`
+
+	// Metrics sink URL in addition to the control API, e.g. statsd://127.0.0.1:8125
+	MetricsSink string `yaml:"metrics_sink" mapstructure:"metrics_sink"`
+
 	// Local conduit server socket for API access
 	LocalSocket string `yaml:"local_socket" mapstructure:"local_socket"`
 
+	// Priority of this node for the primary role, a higher value is preferred
+	Priority uint32 `yaml:"priority" mapstructure:"priority"`
+
+	// Take the primary role back from a lower priority primary once this node has recovered,
+	// with a planned switchover that requires mutual TLS
+	Preempt bool `yaml:"preempt" mapstructure:"preempt"`
+
+	// Minimum time after a role transition before this node takes the primary role on its own again
+	HoldDownTime time.Duration `yaml:"hold_down_time" mapstructure:"hold_down_time"`
+
+	// Automatic role transitions within FlapWindow that freeze automatic failover, disabled when zero
+	FlapThreshold int           `yaml:"flap_threshold" mapstructure:"flap_threshold"`
+	FlapWindow    time.Duration `yaml:"flap_window" mapstructure:"flap_window"`
+
+	// How long automatic failover stays frozen once flapping is detected (defaults to FlapWindow)
+	FlapFreezeDuration time.Duration `yaml:"flap_freeze_duration" mapstructure:"flap_freeze_duration"`
+
+	// Time allowed for claiming the epoch and running the failover actions of a promotion
+	PromotionTimeout time.Duration `yaml:"promotion_timeout" mapstructure:"promotion_timeout"`
+
+	// Attempts at the failover actions before a promotion fails and the node demotes again
+	PromotionAttempts int `yaml:"promotion_attempts" mapstructure:"promotion_attempts"`
+
+	// Commands run with sh around role transitions, described by FAILOVER_* environment
+	// variables. A failing pre-promote hook vetoes the promotion, and key=value lines a
+	// hook prints annotate the transition.
+	PrePromoteHooks  []string `yaml:"pre_promote_hooks" mapstructure:"pre_promote_hooks"`
+	PostPromoteHooks []string `yaml:"post_promote_hooks" mapstructure:"post_promote_hooks"`
+	PostDemoteHooks  []string `yaml:"post_demote_hooks" mapstructure:"post_demote_hooks"`
+
+	// Maximum run time of each transition hook
+	HookTimeout time.Duration `yaml:"hook_timeout" mapstructure:"hook_timeout"`
+
+	// Go callbacks run at the transition hook points before the hook commands
+	Hooks TransitionHooks
+
+	// Interval between probes of the local Conduit instance's health, disabled when zero
+	HealthProbeInterval time.Duration `yaml:"health_probe_interval" mapstructure:"health_probe_interval"`
+
+	// Consecutive failed health probes before Conduit is considered unhealthy
+	HealthProbeFailureThreshold int `yaml:"health_probe_failure_threshold" mapstructure:"health_probe_failure_threshold"`
+
+	// Health checks to run: router, outbound_nat, nat_ips and state (all when empty)
+	HealthChecks []string `yaml:"health_checks" mapstructure:"health_checks"`
+
+	// Maximum latency of a Conduit API call before a health probe fails
+	HealthMaxLatency time.Duration `yaml:"health_max_latency" mapstructure:"health_max_latency"`
+
+	// Unix socket multiaddr serving the local control API (defaults to control.sock in the state directory)
+	ControlSocket string `yaml:"control_socket" mapstructure:"control_socket"`
+
 	// Destination CIDR block for route table updates
 	DestinationCIDR string `yaml:"destination_cidr" mapstructure:"destination_cidr"`
 
+	// EC2 tags as key=value selecting the ENIs and route tables of this pair, e.g. architect:pair=nat-a
+	ResourceTags []string `yaml:"resource_tags" mapstructure:"resource_tags"`
+
+	// ENIs of this pair, in addition to those selected by tags (all ENIs in the ENI IP's subnet when unset, which is deprecated)
+	ManagedENIs []string `yaml:"managed_enis" mapstructure:"managed_enis"`
+
+	// Floating IPs or CIDR blocks of them moved to the primary (all secondary IPs of the managed ENIs when unset)
+	FloatingIPs []string `yaml:"floating_ips" mapstructure:"floating_ips"`
+
+	// Route tables of this pair, in addition to those selected by tags (all in the ENI IP's VPC with a route to the destination CIDR when unset, which is deprecated)
+	RouteTables []string `yaml:"route_tables" mapstructure:"route_tables"`
+
+	// Interval at which a primary checks the routes, floating IPs and EIPs still point at it
+	// and repairs any drift, disabled when zero (the default). Requires the ENIs and route
+	// tables to be selected explicitly.
+	ReconcileInterval time.Duration `yaml:"reconcile_interval" mapstructure:"reconcile_interval"`
+
 	// Disable ENI ownership checks for testing purposes
 	DisableENICheck bool `yaml:"disable_eni_check" mapstructure:"disable_eni_check"`
 
-	// Force role for testing (primary or secondary)
+	// Role this node takes with the static election backend, for tests on hosts that share
+	// no election: primary or secondary
 	ForceRole string `yaml:"force_role" mapstructure:"force_role"`
 
+	// Leader election backend: eni, file, lease, raft, static or memory
+	ElectionBackend string `yaml:"election_backend" mapstructure:"election_backend"`
+
+	// Lock file used by the file election backend
+	ElectorLockFile string `yaml:"elector_lock_file" mapstructure:"elector_lock_file"`
+
+	// DynamoDB table holding the lease for the lease election backend
+	LeaseTable string `yaml:"lease_table" mapstructure:"lease_table"`
+
+	// Key of the lease item, shared by both nodes of a failover pair
+	LeaseKey string `yaml:"lease_key" mapstructure:"lease_key"`
+
+	// How long a lease is valid without renewal (must exceed the leader check interval). With
+	// the raft backend, how long a candidate campaigns for quorum leadership before giving up.
+	LeaseDuration time.Duration `yaml:"lease_duration" mapstructure:"lease_duration"`
+
+	// DynamoDB endpoint override, e.g. for DynamoDB Local
+	LeaseEndpoint string `yaml:"lease_endpoint" mapstructure:"lease_endpoint"`
+
+	// Lease store instance, overrides the DynamoDB lease table when set
+	LeaseStore LeaseStore
+
+	// Stable ID of this node in the raft cluster, must match one of the cluster peers
+	NodeID string `yaml:"node_id" mapstructure:"node_id"`
+
+	// Raft cluster members as id=host:port, including this node (port defaults to Port+1)
+	ClusterPeers []string `yaml:"cluster_peers" mapstructure:"cluster_peers"`
+
+	// Address of a heartbeat witness that must agree before a secondary promotes (port defaults to Port)
+	WitnessAddr string `yaml:"witness_addr" mapstructure:"witness_addr"`
+
+	// CA bundle used to verify peer certificates, enables mutual TLS on the fRPC channel
+	TLSCAFile string `yaml:"tls_ca_file" mapstructure:"tls_ca_file"`
+
+	// Certificate and private key presented to peers, reloaded when the files change
+	TLSCertFile string `yaml:"tls_cert_file" mapstructure:"tls_cert_file"`
+	TLSKeyFile  string `yaml:"tls_key_file" mapstructure:"tls_key_file"`
+
+	// Subject alternative names accepted in peer certificates (any certificate signed by the CA when empty)
+	TLSPeerSANs []string `yaml:"tls_peer_sans" mapstructure:"tls_peer_sans"`
+
+	// Instance ID the peer must report in health checks before it is trusted (not checked when empty)
+	PeerInstanceID string `yaml:"peer_instance_id" mapstructure:"peer_instance_id"`
+
+	// Directory for persistent failover state such as the leadership epoch
+	StateDir string `yaml:"state_dir" mapstructure:"state_dir"`
+
+	// Elector instance, overrides the configured election backend when set
+	Elector Elector
+
+	// Cloud provider instance, overrides the AWS client when set and enables failover
+	// actions even with ENI checks disabled
+	Cloud CloudProvider
+
 	// Logger instance
 	Logger types.Logger
 }
 
 func (c *LeaderConfig) Validate() error {
-	if c.ENIIP == "" {
-		return errors.New("ENI IP address is required")
+	if c.Mode == "" {
+		c.Mode = ModeNode
 	}
-	if !c.DisableENICheck {
-		if net.ParseIP(c.ENIIP) == nil {
-			return fmt.Errorf("invalid ENI IP address: %s", c.ENIIP)
+	if c.Mode != ModeNode && c.Mode != ModeWitness {
+		return fmt.Errorf("mode must be '%s' or '%s', got: %s", ModeNode, ModeWitness, c.Mode)
+	}
+	if c.Mode == ModeNode {
+		if c.ENIIP == "" {
+			return errors.New("ENI IP address is required")
+		}
+		if !c.DisableENICheck || c.Cloud != nil {
+			if net.ParseIP(c.ENIIP) == nil {
+				return fmt.Errorf("invalid ENI IP address: %s", c.ENIIP)
+			}
+		}
+		if c.LocalSocket == "" {
+			return errors.New("local socket address is required")
 		}
 	}
 	if c.Port == 0 {
 		c.Port = 1022 // Default port
 	}
-	if c.LocalSocket == "" {
-		return errors.New("local socket address is required")
+	if _, err := c.PeerPaths(); err != nil {
+		return err
+	}
+	if _, err := c.ResourceSelector(); err != nil {
+		return err
+	}
+	if c.WitnessAddr != "" {
+		if _, _, err := net.SplitHostPort(c.WitnessAddr); err != nil {
+			c.WitnessAddr = net.JoinHostPort(c.WitnessAddr, strconv.Itoa(int(c.Port)))
+		}
+	}
+	if c.TLSCAFile != "" || c.TLSCertFile != "" || c.TLSKeyFile != "" {
+		if c.TLSCAFile == "" || c.TLSCertFile == "" || c.TLSKeyFile == "" {
+			return errors.New("mutual TLS requires a CA file, certificate file and key file")
+		}
+	} else if len(c.TLSPeerSANs) > 0 {
+		return errors.New("peer SANs require mutual TLS to be configured")
+	} else if c.Preempt {
+		return errors.New("preempt takes over with a planned switchover, which requires mutual TLS to be configured")
 	}
 	if c.LeaderCheckInterval <= 0 {
 		c.LeaderCheckInterval = 30 * time.Second
@@ -110,44 +365,348 @@ func (c *LeaderConfig) Validate() error {
 	if c.SyncInterval <= 0 {
 		c.SyncInterval = 10 * time.Second
 	}
+	if c.SyncChunkSize <= 0 {
+		c.SyncChunkSize = 16384
+	}
+	if c.SyncWireVersion == 0 {
+		c.SyncWireVersion = WireVersionV2
+	}
+	if c.SyncWireVersion != WireVersionV1 && c.SyncWireVersion != WireVersionV2 {
+		return fmt.Errorf("sync wire version must be 1 or 2, got: %d", c.SyncWireVersion)
+	}
 	if c.HeartbeatInterval <= 0 {
 		c.HeartbeatInterval = 40 * time.Millisecond // Default 40ms to allow 3 heartbeats in <150ms
 	}
 	if c.HeartbeatMissThreshold <= 0 {
 		c.HeartbeatMissThreshold = 3 // Default to 3 missed heartbeats
 	}
-	if c.ForceRole != "" && c.ForceRole != RoleStringPrimary && c.ForceRole != RoleStringSecondary {
-		return fmt.Errorf("force-role must be 'primary' or 'secondary', got: %s", c.ForceRole)
+	if c.FailureDetector == "" {
+		c.FailureDetector = FailureDetectorCounter
+	}
+	switch c.FailureDetector {
+	case FailureDetectorCounter:
+	case FailureDetectorPhi:
+		if c.PhiThreshold <= 0 {
+			c.PhiThreshold = 8
+		}
+		if c.PhiWindowSize <= 0 {
+			c.PhiWindowSize = 200
+		}
+		if c.PhiMinStdDev <= 0 {
+			c.PhiMinStdDev = c.HeartbeatInterval / 4
+		}
+	default:
+		return fmt.Errorf("failure detector must be '%s' or '%s', got: %s", FailureDetectorCounter, FailureDetectorPhi, c.FailureDetector)
+	}
+	if c.LivenessProtocol == "" {
+		c.LivenessProtocol = LivenessFRPC
+	}
+	switch c.LivenessProtocol {
+	case LivenessFRPC:
+	case LivenessBFD:
+		if c.Mode == ModeNode && len(c.PeerAddrs) == 0 {
+			return errors.New("bfd liveness requires peer addresses")
+		}
+		if c.FailureDetector != FailureDetectorCounter {
+			return fmt.Errorf("the %s failure detector requires %s liveness", c.FailureDetector, LivenessFRPC)
+		}
+		if c.BFDPort == 0 {
+			c.BFDPort = 3784 // Single hop BFD control port (RFC 5881)
+		}
+		if c.BFDPeerPort == 0 {
+			c.BFDPeerPort = c.BFDPort
+		}
+		if c.BFDDesiredMinTx <= 0 {
+			c.BFDDesiredMinTx = 10 * time.Millisecond
+		}
+		if c.BFDRequiredMinRx <= 0 {
+			c.BFDRequiredMinRx = 10 * time.Millisecond
+		}
+		if c.BFDDetectMultiplier == 0 {
+			c.BFDDetectMultiplier = 3 // Default 30ms detection time
+		}
+		if c.BFDPacketLoss < 0 || c.BFDPacketLoss >= 1 {
+			return fmt.Errorf("BFD packet loss must be at least 0 and below 1, got: %g", c.BFDPacketLoss)
+		}
+	default:
+		return fmt.Errorf("liveness protocol must be '%s' or '%s', got: %s", LivenessFRPC, LivenessBFD, c.LivenessProtocol)
+	}
+	if c.HoldDownTime < 0 {
+		return fmt.Errorf("hold down time must not be negative, got: %s", c.HoldDownTime)
+	}
+	if c.FlapThreshold > 0 {
+		if c.FlapWindow <= 0 {
+			c.FlapWindow = 10 * time.Minute
+		}
+		if c.FlapFreezeDuration <= 0 {
+			c.FlapFreezeDuration = c.FlapWindow
+		}
+	}
+	if c.PromotionTimeout <= 0 {
+		c.PromotionTimeout = 2 * time.Minute
+	}
+	if c.PromotionAttempts <= 0 {
+		c.PromotionAttempts = 3
+	}
+	if c.ReconcileInterval < 0 {
+		return fmt.Errorf("reconcile interval must not be negative, got: %s", c.ReconcileInterval)
+	}
+	if c.ReconcileInterval > 0 {
+		// Repairing what the default discovery finds would pull in resources of other pairs
+		selector, _ := c.ResourceSelector()
+		if kinds := selector.DefaultDiscovery(c.DestinationCIDR); len(kinds) > 0 {
+			return fmt.Errorf("reconcile interval requires the ENIs and route tables to be selected with resource tags or lists, found by default discovery: %s", strings.Join(kinds, ","))
+		}
+	}
+	if c.HookTimeout <= 0 {
+		c.HookTimeout = 10 * time.Second
+	}
+	if c.HealthProbeInterval > 0 {
+		if c.HealthProbeFailureThreshold <= 0 {
+			c.HealthProbeFailureThreshold = 3
+		}
+		if len(c.HealthChecks) == 0 {
+			c.HealthChecks = AllHealthChecks
+		}
+		for _, check := range c.HealthChecks {
+			if !slices.Contains(AllHealthChecks, check) {
+				return fmt.Errorf("health check must be one of %s, got: %s", strings.Join(AllHealthChecks, ", "), check)
+			}
+		}
+		if c.HealthMaxLatency <= 0 {
+			c.HealthMaxLatency = time.Second
+		}
+	}
+	if c.StateDir == "" {
+		c.StateDir = defaultStateDir()
+	}
+	if c.ControlSocket == "" {
+		c.ControlSocket = controlSocketIn(c.StateDir)
+	}
+	if c.ElectionBackend == "" {
+		switch {
+		case c.ForceRole != "":
+			c.ElectionBackend = ElectionBackendStatic
+		case c.DisableENICheck:
+			// A lock file in each node's own state directory would let both nodes lead
+			if c.ElectorLockFile == "" {
+				return errors.New("disabling ENI checks requires a forced role or an elector lock file shared by both nodes")
+			}
+			c.ElectionBackend = ElectionBackendFile
+		default:
+			c.ElectionBackend = ElectionBackendENI
+		}
+	}
+	if c.ForceRole != "" && c.ElectionBackend != ElectionBackendStatic {
+		return fmt.Errorf("force role requires the static election backend, got: %s", c.ElectionBackend)
+	}
+	switch c.ElectionBackend {
+	case ElectionBackendENI:
+		if c.DisableENICheck && c.Elector == nil && c.Cloud == nil {
+			return errors.New("eni election backend requires ENI checks to be enabled")
+		}
+	case ElectionBackendFile:
+		if c.ElectorLockFile == "" {
+			c.ElectorLockFile = filepath.Join(c.StateDir, "leader.lock")
+		}
+	case ElectionBackendLease:
+		if c.LeaseTable == "" && c.LeaseStore == nil && c.Elector == nil {
+			return errors.New("lease election backend requires a lease table")
+		}
+		if c.LeaseKey == "" {
+			c.LeaseKey = c.ENIIP
+		}
+		if c.LeaseDuration <= 0 {
+			c.LeaseDuration = 3 * c.LeaderCheckInterval // Survive two missed renewals
+		}
+		if c.LeaseDuration <= c.LeaderCheckInterval {
+			return fmt.Errorf("lease duration %s must be longer than the leader check interval %s", c.LeaseDuration, c.LeaderCheckInterval)
+		}
+	case ElectionBackendRaft:
+		if c.LeaseDuration <= 0 {
+			c.LeaseDuration = 3 * c.LeaderCheckInterval // Allow a few elections before giving up
+		}
+		if c.NodeID == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				return fmt.Errorf("raft election backend requires a node ID: %w", err)
+			}
+			c.NodeID = hostname
+		}
+		peers, err := c.RaftPeers()
+		if err != nil {
+			return err
+		}
+		if len(peers) < 3 {
+			return fmt.Errorf("raft election backend requires at least three cluster peers, got %d", len(peers))
+		}
+		found := false
+		for _, peer := range peers {
+			found = found || peer.ID == c.NodeID
+		}
+		if !found {
+			return fmt.Errorf("node ID %s is not in the cluster peer list", c.NodeID)
+		}
+	case ElectionBackendStatic:
+		if c.ForceRole != RoleStringPrimary && c.ForceRole != RoleStringSecondary {
+			return fmt.Errorf("force role must be '%s' or '%s', got: %s", RoleStringPrimary, RoleStringSecondary, c.ForceRole)
+		}
+	case ElectionBackendMemory:
+		if c.Elector == nil {
+			return errors.New("memory election backend requires an Elector instance")
+		}
+	default:
+		return fmt.Errorf("election backend must be 'eni', 'file', 'lease', 'raft', 'static' or 'memory', got: %s", c.ElectionBackend)
 	}
 	return nil
 }
 
+// defaultStateDir is the state directory used when none is configured
+func defaultStateDir() string {
+	return filepath.Join(xdg.StateHome, "architect-networking", "failover")
+}
+
+// ResourceSelector parses the configured selection of the resources of this pair
+func (c *LeaderConfig) ResourceSelector() (ResourceSelector, error) {
+	return ParseResourceSelector(c.ResourceTags, c.ManagedENIs, c.FloatingIPs, c.RouteTables)
+}
+
+// RaftPeers parses the configured raft cluster peers
+func (c *LeaderConfig) RaftPeers() ([]RaftPeer, error) {
+	peers := make([]RaftPeer, 0, len(c.ClusterPeers))
+	for _, s := range c.ClusterPeers {
+		peer, err := ParseRaftPeer(s, c.Port+1)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, peer)
+	}
+	return peers, nil
+}
+
 // LeaderFailover implements leader election based failover using AWS ENI ownership
 type LeaderFailover struct {
 	config      *LeaderConfig
 	logger      types.Logger
-	awsClient   *AWSClient
+	cloud       CloudProvider
 	localClient *client.ClientWithResponses
+	elector     Elector
+
+	// Mutual TLS certificates for the fRPC channel, nil when TLS is disabled
+	tls *tlsReloader
 
 	// Current role and state
-	currentRole NodeRole
-	currentENI  string // ENI ID of current primary
+	currentRole roleValue
+	currentENI  eniValue // ENI ID of current primary
+
+	// Role transition state machine and its recent transitions
+	state        NodeState
+	stateHistory []StateTransition
+	stateMutex   sync.Mutex
+
+	// Leadership epoch used to fence stale primaries
+	epochs *epochStore
 
-	// fRPC server (when acting as primary)
-	frpcServer *Server
+	// Append-only record of role decisions for post-mortems
+	journal *eventJournal
+
+	// NAT state replication: versioned stream (primary) and applied copy (secondary)
+	replicator atomic.Pointer[natReplicator]
+	mirror     natMirror
+
+	// fRPC server (receives sync requests as primary, heartbeats as secondary), kept across
+	// role transitions so in-flight requests such as a switchover are not cut off
+	frpcServer      *Server
+	frpcAccepting   chan struct{} // closed once frpcServer accepts connections
+	frpcServerMutex sync.Mutex
 
 	// fRPC client (when acting as secondary)
-	frpcClient *Client
+	frpcClient      *Client
+	frpcClientMutex sync.Mutex
 
 	// Heartbeat tracking
-	lastHeartbeat    time.Time
-	missedHeartbeats int
-	heartbeatMutex   sync.Mutex
-	heartbeatStopCh  chan struct{}
+	lastHeartbeat     time.Time
+	missedHeartbeats  int
+	heartbeatSequence uint64        // last sequence sent (primary) or received (secondary)
+	heartbeatEpoch    uint64        // epoch of the primary that sent heartbeatSequence (secondary)
+	heartbeatENI      string        // ENI of the primary that sent heartbeatSequence (secondary)
+	heartbeatRTT      time.Duration // last measured round-trip time (primary)
+	heartbeatGaps     uint64        // lost heartbeats detected from sequence gaps (secondary)
+	primaryPriority   uint32        // priority the primary sends with its heartbeats (secondary)
+	phi               *phiDetector  // phi accrual detector, nil with the counter detector (secondary)
+	heartbeatMutex    sync.Mutex
+
+	// Stops the loops the current role runs, closed and replaced on every transition and
+	// at shutdown, which may overlap
+	heartbeatStopCh    chan struct{}
+	heartbeatStopMutex sync.Mutex
+
+	// BFD sessions with the peer, replacing fRPC heartbeats when set
+	bfd *BFDEndpoint
+
+	// Secondaries discovered from incoming fRPC requests by node ID, each with its own
+	// heartbeat client (when acting as primary)
+	peers     map[string]*peerNode
+	peerMutex sync.Mutex
+
+	// Configured paths to the other node, with a heartbeat client per path (when acting as
+	// primary) and per-path heartbeat tracking guarded by heartbeatMutex
+	peerPaths   []string
+	pathClients map[string]*pathClient
+	pathMutex   sync.Mutex
+	pathStats   map[string]*PathStats
+
+	// Heartbeat witness client, used by the primary for heartbeats and by the secondary for votes
+	witnessClient *Client
+	witnessMutex  sync.Mutex
+
+	// Planned switchover: serialises handovers and pauses campaigning while one runs, and
+	// records what triggered the handover for the journal
+	switchoverMutex   sync.Mutex
+	switchingOver     atomic.Bool
+	switchoverTrigger atomic.Value
+
+	// Serialises syncs from the primary, which share the mirror
+	syncMutex sync.Mutex
+
+	// Local control API and the state it reports beyond role and heartbeats
+	control            *controlServer
+	metrics            *metrics.InmemSink
+	maintenance        atomic.Bool
+	lastSync           *SyncResult
+	lastFailoverAction *FailoverActionResult
+	lastHealth         *HealthResult
+	statusMutex        sync.Mutex
+
+	// Set while the health probe finds the local Conduit instance unhealthy, and the
+	// handover it starts off the probe loop when the primary becomes unhealthy
+	unhealthy         atomic.Bool
+	unhealthyHandOver sync.WaitGroup
+
+	// Damping of automatic role transitions: the last transition, recent automatic
+	// transitions for flap detection and when a detected flap stops freezing failover
+	lastTransition time.Time
+	transitions    []time.Time
+	frozenUntil    time.Time
+	policyMutex    sync.Mutex
+
+	// Clock the damping of role transitions reads the time from
+	now func() time.Time
+
+	// Drift reconciliation while primary: the EIPs the failover actions manage by
+	// allocation ID, when the resources were last checked and the recent corrections
+	managedEIPs      map[string]CloudEIP
+	lastReconcile    time.Time
+	driftCorrections []DriftCorrection
+	reconcileMutex   sync.Mutex
 
 	// Control channels
-	stopCh chan struct{}
-	roleCh chan NodeRole
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	roleCh   chan roleRequest
+
+	// Step downs of a fenced primary, which are never dropped in favour of other requests
+	stepDownCh chan roleRequest
 }
 
 // NewLeaderFailover creates a new leader election based failover instance
@@ -158,15 +717,76 @@ func NewLeaderFailover(config *LeaderConfig) (*LeaderFailover, error) {
 
 	logger := config.Logger
 
-	// Create AWS client for ENI ownership detection (if not disabled)
-	var awsClient *AWSClient
-	if !config.DisableENICheck {
-		ctx := context.Background()
-		var err error
-		awsClient, err = NewAWSClient(ctx, logger)
+	// Load the persisted leadership epoch
+	epochs, err := newEpochStore(config.StateDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load epoch: %w", err)
+	}
+
+	journal, err := openJournal(config.StateDir, logger)
+	if err != nil {
+		return nil, err
+	}
+	if interrupted := journal.interruptedPromotion(); interrupted != nil {
+		logger.Warn().
+			Uint64("decision", interrupted.Decision.Decision).
+			Str("reason", interrupted.Decision.Reason).
+			Msg("Found a promotion interrupted by the last shutdown, it resumes if this node is still elected")
+	}
+
+	// Create AWS client for ENI ownership detection and failover actions (if not disabled)
+	cloud := config.Cloud
+	if cloud == nil && !config.DisableENICheck {
+		awsClient, err := NewAWSClient(context.Background(), logger)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create AWS client: %w", err)
 		}
+		cloud = awsClient
+	}
+	if selector, _ := config.ResourceSelector(); cloud != nil {
+		if kinds := selector.DefaultDiscovery(config.DestinationCIDR); len(kinds) > 0 {
+			logger.Warn().
+				Str("kinds", strings.Join(kinds, ",")).
+				Msg("Discovering failover resources without --resource-tag or explicit lists is deprecated, select them explicitly")
+		}
+	}
+
+	// Load the mutual TLS certificates and watch them for changes, they secure
+	// the raft transport as well as fRPC
+	tlsCerts, err := newTLSReloader(config, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS configuration: %w", err)
+	}
+
+	// Create the leader election backend
+	elector := config.Elector
+	if elector == nil {
+		switch config.ElectionBackend {
+		case ElectionBackendENI:
+			elector = NewENIElector(cloud, config.ENIIP)
+		case ElectionBackendFile:
+			elector = NewFileLockElector(config.ElectorLockFile, localNodeID())
+		case ElectionBackendStatic:
+			elector = NewStaticElector(localNodeID(), config.ForceRole == RoleStringPrimary)
+		case ElectionBackendLease:
+			store := config.LeaseStore
+			if store == nil {
+				store, err = NewDynamoDBLeaseStore(context.Background(), config.LeaseTable, config.LeaseEndpoint)
+				if err != nil {
+					return nil, fmt.Errorf("failed to create lease store: %w", err)
+				}
+			}
+			nodeID := localNodeID()
+			if cloud != nil {
+				nodeID = cloud.GetInstanceID()
+			}
+			elector = NewLeaseElector(store, config.LeaseKey, nodeID, config.LeaseDuration)
+		case ElectionBackendRaft:
+			elector, err = newRaftElectorFromConfig(config, false, tlsCerts)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	// Create local client for conduit API access
@@ -180,14 +800,46 @@ func NewLeaderFailover(config *LeaderConfig) (*LeaderFailover, error) {
 		return nil, fmt.Errorf("failed to create local API client: %w", err)
 	}
 
+	peerPaths, err := config.PeerPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	inmemMetrics, err := newMetrics(config.MetricsSink)
+	if err != nil {
+		return nil, err
+	}
+
+	var phi *phiDetector
+	if config.FailureDetector == FailureDetectorPhi {
+		phi = newPhiDetector(config.PhiWindowSize, config.HeartbeatInterval, config.PhiMinStdDev)
+	}
+
+	bfd, err := newBFDEndpoint(config, peerPaths)
+	if err != nil {
+		return nil, err
+	}
+
 	return &LeaderFailover{
 		config:      config,
 		logger:      logger,
-		awsClient:   awsClient,
+		cloud:       cloud,
 		localClient: localAPIClient,
-		currentRole: RoleUnknown,
+		elector:     elector,
+		tls:         tlsCerts,
+		epochs:      epochs,
+		journal:     journal,
+		peers:       make(map[string]*peerNode),
+		peerPaths:   peerPaths,
+		pathClients: make(map[string]*pathClient),
+		pathStats:   make(map[string]*PathStats),
+		phi:         phi,
+		bfd:         bfd,
+		metrics:     inmemMetrics,
 		stopCh:      make(chan struct{}),
-		roleCh:      make(chan NodeRole, 1),
+		roleCh:      make(chan roleRequest, 1),
+		stepDownCh:  make(chan roleRequest, 1),
+		now:         time.Now,
 	}, nil
 }
 
@@ -195,22 +847,33 @@ func NewLeaderFailover(config *LeaderConfig) (*LeaderFailover, error) {
 func (lf *LeaderFailover) Start(ctx context.Context) error {
 	logEvent := lf.logger.Info().
 		Str("eni_ip", lf.config.ENIIP).
-		Uint16("port", lf.config.Port)
+		Uint16("port", lf.config.Port).
+		Uint64("epoch", lf.epochs.current()).
+		Str("instance_id", lf.instanceID())
 
-	if lf.awsClient != nil {
-		logEvent = logEvent.Str("instance_id", lf.awsClient.GetInstanceID())
-	} else {
-		logEvent = logEvent.Str("instance_id", "test-mode")
+	logEvent.Msg("Starting leader election failover")
+
+	if err := lf.startControlServer(); err != nil {
+		return err
 	}
 
-	logEvent.Msg("Starting leader election failover")
+	// BFD sessions run in both roles, so the peer is tracked across role transitions
+	if lf.bfd != nil {
+		lf.bfd.Start()
+	}
+
+	// Watch the local Conduit instance so an unhealthy dataplane does not stay primary
+	if lf.config.HealthProbeInterval > 0 {
+		go lf.healthProbeLoop(ctx)
+	}
 
 	lf.logger.Info().
 		Str("eni_ip", lf.config.ENIIP).
 		Uint16("port", lf.config.Port).
 		Str("leader_check_interval", lf.config.LeaderCheckInterval.String()).
 		Bool("disable_eni_check", lf.config.DisableENICheck).
-		Str("force_role", lf.config.ForceRole).
+		Str("election_backend", lf.config.ElectionBackend).
+		Str("liveness_protocol", lf.config.LivenessProtocol).
 		Msg("Leader election configuration")
 
 	// Start the leader election loop
@@ -223,100 +886,194 @@ func (lf *LeaderFailover) Start(ctx context.Context) error {
 
 	// Wait for context cancellation
 	<-ctx.Done()
-	close(lf.stopCh)
+	lf.stopOnce.Do(func() { close(lf.stopCh) })
 
-	return lf.cleanup()
+	return errors.Join(lf.cleanup(), lf.stopBFD(), lf.stopFRPCServer(), lf.stopControlServer(), lf.journal.Close())
 }
 
 // Stop gracefully shuts down the failover system
 func (lf *LeaderFailover) Stop() error {
-	if lf.stopCh != nil {
-		close(lf.stopCh)
+	lf.stopOnce.Do(func() { close(lf.stopCh) })
+	if err := lf.elector.Resign(context.Background()); err != nil {
+		lf.logger.Warn().Err(err).Msg("Failed to resign leadership")
 	}
-	return lf.cleanup()
+	if closer, ok := lf.elector.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			lf.logger.Warn().Err(err).Msg("Failed to close elector")
+		}
+	}
+	if err := lf.tls.Close(); err != nil {
+		lf.logger.Warn().Err(err).Msg("Failed to stop TLS certificate watcher")
+	}
+	return errors.Join(lf.cleanup(), lf.stopBFD(), lf.stopFRPCServer(), lf.stopControlServer(), lf.journal.Close())
 }
 
 // GetCurrentRole returns the current role of this node
 func (lf *LeaderFailover) GetCurrentRole() NodeRole {
-	return lf.currentRole
+	return lf.currentRole.Load()
+}
+
+// instanceID returns the EC2 instance ID of this node, or "test-mode" when AWS is disabled
+func (lf *LeaderFailover) instanceID() string {
+	if lf.cloud == nil {
+		return "test-mode"
+	}
+	return lf.cloud.GetInstanceID()
+}
+
+// nodeID identifies this node to the witness: the configured node ID, else the EC2
+// instance ID, else the hostname and process ID
+func (lf *LeaderFailover) nodeID() string {
+	if lf.config.NodeID != "" {
+		return lf.config.NodeID
+	}
+	if lf.cloud != nil {
+		return lf.cloud.GetInstanceID()
+	}
+	return localNodeID()
 }
 
-// leaderElectionLoop continuously checks ENI ownership to determine leadership
+// leaderElectionLoop continuously campaigns with the elector to determine leadership
 func (lf *LeaderFailover) leaderElectionLoop(ctx context.Context) {
 	ticker := time.NewTicker(lf.config.LeaderCheckInterval)
 	defer ticker.Stop()
 
+	// Electors that push leadership changes are checked immediately instead of waiting for the ticker
+	var changes <-chan struct{}
+	if notifier, ok := lf.elector.(ElectionNotifier); ok {
+		changes = notifier.Changes()
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-lf.stopCh:
 			return
+		case <-changes:
+			lf.checkLeadership(ctx)
 		case <-ticker.C:
-			lf.logger.Debug().
-				Str("current_role", string(rune(lf.currentRole))).
-				Str("eni_ip", lf.config.ENIIP).
-				Bool("disable_eni_check", lf.config.DisableENICheck).
-				Str("force_role", lf.config.ForceRole).
-				Msg("Starting leader election check")
-
-			// Skip ENI checks if we're secondary - heartbeat monitoring takes precedence
-			if lf.currentRole == RoleSecondary {
-				lf.logger.Debug().Msg("Skipping ENI check - currently secondary, heartbeat monitoring active")
-				continue
-			}
-
-			var newRole NodeRole
-
-			if lf.config.DisableENICheck {
-				// Use forced role for testing
-				if lf.config.ForceRole == RoleStringPrimary {
-					newRole = RolePrimary
-					lf.logger.Info().Msg("ENI check disabled - forcing role to PRIMARY")
-				} else {
-					newRole = RoleSecondary
-					lf.logger.Info().Msg("ENI check disabled - forcing role to SECONDARY")
-				}
-			} else {
-				// Normal AWS ENI ownership check
-				lf.logger.Debug().Str("eni_ip", lf.config.ENIIP).Msg("Checking ENI ownership")
-				owns, err := lf.awsClient.CheckENIOwnership(ctx, lf.config.ENIIP)
-				if err != nil {
-					lf.logger.Error().Err(err).Str("eni_ip", lf.config.ENIIP).Msg("Failed to check ENI ownership")
-					continue
-				}
+			lf.checkLeadership(ctx)
+		}
+	}
+}
 
-				lf.logger.Info().
-					Str("eni_ip", lf.config.ENIIP).
-					Bool("owns_eni", owns).
-					Msg("ENI ownership check result")
+// checkLeadership campaigns once and requests a role transition if leadership changed
+func (lf *LeaderFailover) checkLeadership(ctx context.Context) {
+	lf.logger.Debug().
+		Str("current_role", lf.currentRole.Load().String()).
+		Str("eni_ip", lf.config.ENIIP).
+		Str("election_backend", lf.config.ElectionBackend).
+		Msg("Starting leader election check")
 
-				newRole = RoleSecondary
-				if owns {
-					newRole = RolePrimary
-				}
-			}
+	// A planned switchover decides the roles until it completes
+	if lf.switchingOver.Load() {
+		lf.logger.Debug().Msg("Skipping leader election - switchover in progress")
+		return
+	}
 
-			if newRole != lf.currentRole {
-				lf.logger.Info().
-					Str("old_role", lf.currentRole.String()).
-					Str("new_role", newRole.String()).
-					Bool("disable_eni_check", lf.config.DisableENICheck).
-					Msg("Role change detected, triggering transition")
+	// In maintenance mode a primary keeps holding leadership but nothing else takes it
+	if lf.maintenance.Load() && lf.currentRole.Load() != RolePrimary {
+		lf.logger.Debug().Msg("Skipping leader election - maintenance mode")
+		return
+	}
 
+	// An unhealthy node does not take leadership, and an unhealthy primary lets a lease
+	// or quorum based elector pass it on. Other electors still observe losing leadership.
+	if lf.unhealthy.Load() {
+		_, authoritative := lf.elector.(LeaseGuard)
+		if lf.currentRole.Load() != RolePrimary || authoritative {
+			lf.logger.Debug().Msg("Skipping leader election - Conduit is unhealthy")
+			// A starting node still joins the pair, as a secondary
+			if lf.currentRole.Load() == RoleUnknown {
 				select {
-				case lf.roleCh <- newRole:
-					lf.logger.Debug().Str("new_role", newRole.String()).Msg("Role change sent to transition channel")
+				case lf.roleCh <- newRoleRequest(RoleSecondary, TriggerHealthProbe, "Conduit is unhealthy at startup", lf.healthInputs()):
 				default:
-					lf.logger.Warn().Str("new_role", newRole.String()).Msg("Role transition channel full, skipping update")
 				}
-			} else {
-				lf.logger.Debug().
-					Str("current_role", lf.currentRole.String()).
-					Str("determined_role", newRole.String()).
-					Msg("Role unchanged, no transition needed")
 			}
+			return
+		}
+	}
+
+	// A recovered higher priority secondary takes the primary role back with a switchover
+	if lf.preemptPrimary(ctx) {
+		return
+	}
+
+	// Do not campaign for leadership this node may not act on yet, a lease or
+	// lock won now would leave the pair without a primary
+	if lf.currentRole.Load() != RolePrimary {
+		if err := lf.checkAutomaticTransition(); err != nil {
+			lf.logger.Debug().Err(err).Msg("Skipping leader election - automatic transitions are damped")
+			return
+		}
+	}
+
+	// Skip campaigning if we're secondary - heartbeat monitoring takes precedence,
+	// unless the elector is authoritative and can hand leadership to a secondary itself
+	if _, authoritative := lf.elector.(LeaseGuard); lf.currentRole.Load() == RoleSecondary && !authoritative {
+		lf.logger.Debug().Msg("Skipping leader election - currently secondary, heartbeat monitoring active")
+		return
+	}
+
+	leader, err := lf.elector.Campaign(ctx)
+	if err != nil {
+		lf.logger.Error().Err(err).Str("election_backend", lf.config.ElectionBackend).Msg("Failed to campaign for leadership")
+		return
+	}
+
+	inputs := &JournalInputs{ElectionBackend: lf.config.ElectionBackend}
+	logEvent := lf.logger.Info().
+		Str("election_backend", lf.config.ElectionBackend).
+		Bool("leader", leader)
+	if !leader {
+		if observed, err := lf.elector.Observe(ctx); err == nil {
+			logEvent = logEvent.Str("observed_leader", observed)
+			inputs.Leader = observed
+		}
+	}
+	logEvent.Msg("Leader election result")
+
+	// The ENI elector's leader is the instance owning the ENI IP
+	if lf.config.ElectionBackend == ElectionBackendENI {
+		inputs.ENIOwner = inputs.Leader
+		if leader {
+			inputs.ENIOwner = lf.instanceID()
+		}
+	}
+
+	newRole := RoleSecondary
+	trigger := TriggerElection
+	reason := "lost leader election (" + lf.config.ElectionBackend + ")"
+	if leader {
+		newRole = RolePrimary
+		reason = "won leader election (" + lf.config.ElectionBackend + ")"
+
+		// A node still elected after a restart finishes the promotion it was running
+		if interrupted := lf.journal.interruptedPromotion(); interrupted != nil {
+			trigger = TriggerResume
+			reason = fmt.Sprintf("%s, resuming promotion #%d interrupted by a restart", reason, interrupted.Decision.Decision)
+		}
+	}
+
+	if newRole != lf.currentRole.Load() {
+		lf.logger.Info().
+			Str("old_role", lf.currentRole.Load().String()).
+			Str("new_role", newRole.String()).
+			Str("election_backend", lf.config.ElectionBackend).
+			Msg("Role change detected, triggering transition")
+
+		select {
+		case lf.roleCh <- newRoleRequest(newRole, trigger, reason, inputs):
+			lf.logger.Debug().Str("new_role", newRole.String()).Msg("Role change sent to transition channel")
+		default:
+			lf.logger.Warn().Str("new_role", newRole.String()).Msg("Role transition channel full, skipping update")
 		}
+	} else {
+		lf.logger.Debug().
+			Str("current_role", lf.currentRole.Load().String()).
+			Str("determined_role", newRole.String()).
+			Msg("Role unchanged, no transition needed")
 	}
 }
 
@@ -328,94 +1085,122 @@ func (lf *LeaderFailover) roleManagementLoop(ctx context.Context) {
 			return
 		case <-lf.stopCh:
 			return
-		case newRole := <-lf.roleCh:
-			lf.logger.Info().
-				Str("current_role", lf.currentRole.String()).
-				Str("target_role", newRole.String()).
-				Msg("Received role transition request, starting transition")
-
-			if err := lf.transitionToRole(ctx, newRole); err != nil {
-				lf.logger.Error().Err(err).
-					Str("current_role", lf.currentRole.String()).
-					Str("target_role", newRole.String()).
-					Msg("Failed to transition to new role")
-			} else {
-				lf.currentRole = newRole
-				lf.logger.Info().
-					Str("role", newRole.String()).
-					Msg("Successfully transitioned to new role")
+		case request := <-lf.stepDownCh:
+			lf.handleRoleRequest(ctx, request)
+		case request := <-lf.roleCh:
+			// A fenced primary steps down before anything else it was asked to do
+			select {
+			case stepDown := <-lf.stepDownCh:
+				lf.handleRoleRequest(ctx, stepDown)
+			default:
 			}
+			lf.handleRoleRequest(ctx, request)
 		}
 	}
 }
 
-// transitionToRole handles the transition logic between roles
-func (lf *LeaderFailover) transitionToRole(ctx context.Context, newRole NodeRole) error {
+// handleRoleRequest runs a role transition and records its outcome
+func (lf *LeaderFailover) handleRoleRequest(ctx context.Context, request roleRequest) {
 	lf.logger.Info().
-		Str("target_role", newRole.String()).
-		Msg("Starting role transition, cleaning up current state")
-
-	// Clean up current role
-	if err := lf.cleanup(); err != nil {
-		lf.logger.Warn().Err(err).Str("target_role", newRole.String()).Msg("Error during role cleanup")
+		Str("current_role", lf.currentRole.Load().String()).
+		Str("target_role", request.role.String()).
+		Str("reason", request.reason).
+		Msg("Received role transition request, starting transition")
+
+	oldRole := lf.currentRole.Load()
+	planned := lf.switchingOver.Load()
+
+	lf.journal.begin(request)
+	err := lf.transitionToRole(ctx, request)
+	role := lf.settleRole()
+	if role != RoleUnknown {
+		lf.recordTransition(oldRole, role, planned)
+	}
+	lf.journal.end(role, lf.epochs.current(), err)
+	if err != nil {
+		lf.logger.Error().Err(err).
+			Str("current_role", lf.currentRole.Load().String()).
+			Str("target_role", request.role.String()).
+			Msg("Failed to transition to new role")
 	} else {
-		lf.logger.Debug().Str("target_role", newRole.String()).Msg("Role cleanup completed successfully")
+		lf.logger.Info().
+			Str("role", role.String()).
+			Msg("Successfully transitioned to new role")
 	}
+}
 
-	switch newRole {
+// transitionToRole runs the requested transition through the state machine, which the
+// transition leaves in the state the node ended up in
+func (lf *LeaderFailover) transitionToRole(ctx context.Context, request roleRequest) error {
+	var err error
+	switch request.role {
 	case RolePrimary:
-		lf.logger.Info().Msg("Transitioning to PRIMARY role")
-		return lf.becomePrimary(ctx)
+		_, err = lf.promote(ctx, request.reason)
 	case RoleSecondary:
-		lf.logger.Info().Msg("Transitioning to SECONDARY role")
-		return lf.becomeSecondary(ctx)
+		_, err = lf.demote(ctx, request.reason)
 	default:
-		lf.logger.Error().Str("invalid_role", string(rune(newRole))).Msg("Invalid role requested for transition")
-		return fmt.Errorf("invalid role: %v", newRole)
+		lf.logger.Error().Str("invalid_role", request.role.String()).Msg("Invalid role requested for transition")
+		err = fmt.Errorf("invalid role: %v", request.role)
 	}
+	return err
 }
 
 // becomePrimary sets up this node as the primary (leader)
 func (lf *LeaderFailover) becomePrimary(ctx context.Context) error {
 	lf.logger.Info().Uint16("port", lf.config.Port).Msg("Becoming primary, starting fRPC server")
 
-	// Execute failover actions if AWS client is available
-	if lf.awsClient != nil {
-		if err := lf.executeFailoverActions(ctx); err != nil {
-			lf.logger.Error().Err(err).Msg("Failed to execute failover actions")
-			// Don't fail the transition - log error and continue
-		}
-	}
+	// Claiming the epoch and moving AWS resources must finish within the promotion timeout
+	promotionCtx, cancel := context.WithTimeout(ctx, lf.config.PromotionTimeout)
+	defer cancel()
 
-	// Create fRPC server with this LeaderFailover as the service implementation
-	var err error
-	lf.frpcServer, err = NewServer(lf, nil, lf.logger)
-	if err != nil {
-		return fmt.Errorf("failed to create fRPC server: %w", err)
+	// Claim a new epoch so a stale primary can be fenced off
+	if _, err := lf.claimEpoch(promotionCtx); err != nil {
+		return fmt.Errorf("failed to claim leadership epoch: %w", err)
 	}
 
-	// Start the server in a goroutine
-	serverAddr := fmt.Sprintf(":%d", lf.config.Port)
-	go func() {
-		if err := lf.frpcServer.Start(serverAddr); err != nil {
-			lf.logger.Error().Err(err).Msg("fRPC server failed")
+	// Execute failover actions if a cloud provider is available
+	if lf.cloud != nil {
+		if err := lf.runFailoverActions(promotionCtx); err != nil {
+			lf.logger.Error().Err(err).Msg("Failed to execute failover actions")
+			return err
 		}
-	}()
+	}
 
-	lf.logger.Info().Str("addr", serverAddr).Msg("fRPC server started")
+	// Start a new replication stream, secondaries resync in full on their first request
+	lf.replicator.Store(newNATReplicator())
 
-	// Stop any existing heartbeat monitoring (from when we were secondary)
-	if lf.heartbeatStopCh != nil {
-		close(lf.heartbeatStopCh)
-		lf.heartbeatStopCh = nil
+	// Create fRPC server with this LeaderFailover as the service implementation
+	if err := lf.startFRPCServer(); err != nil {
+		return err
 	}
 
 	// Primary sends heartbeats, doesn't monitor them
 	lf.heartbeatMutex.Lock()
 	lf.lastHeartbeat = time.Time{}
 	lf.missedHeartbeats = 0
+	lf.heartbeatSequence = 0
+	lf.heartbeatRTT = 0
+	lf.resetPathStatsLocked()
 	lf.heartbeatMutex.Unlock()
 
+	// Start sending heartbeats to the secondary once it registers with us
+	stopCh := lf.restartRoleLoops()
+	if lf.bfd != nil {
+		go lf.bfdLivenessLoop(ctx, stopCh, RolePrimary)
+	} else {
+		go lf.heartbeatSenderLoop(ctx, stopCh)
+	}
+
+	// Keep the witness informed that we are alive
+	if lf.config.WitnessAddr != "" {
+		go lf.witnessHeartbeatLoop(ctx, stopCh)
+	}
+
+	// Repair routes, floating IPs and EIPs that drift away from this node
+	if lf.cloud != nil && lf.config.ReconcileInterval > 0 {
+		go lf.reconcileLoop(ctx, stopCh)
+	}
+
 	return nil
 }
 
@@ -426,52 +1211,85 @@ func (lf *LeaderFailover) becomeSecondary(ctx context.Context) error {
 		Uint16("port", lf.config.Port).
 		Msg("Becoming secondary, connecting to primary")
 
-	// Create fRPC client to connect to primary
-	primaryAddr := fmt.Sprintf("%s:%d", lf.config.ENIIP, lf.config.Port)
-	c, err := NewClient(nil, lf.logger)
-	if err != nil {
-		return fmt.Errorf("failed to create fRPC client: %w", err)
+	// Stop leading any epoch we previously held and release leadership
+	lf.epochs.resign()
+	if err := lf.elector.Resign(ctx); err != nil {
+		lf.logger.Warn().Err(err).Msg("Failed to resign leadership")
 	}
 
-	// Test connection to primary
-	if err := c.Connect(primaryAddr); err != nil {
-		lf.logger.Warn().Err(err).
-			Str("primary_addr", primaryAddr).
-			Msg("Failed to connect to primary, will retry during sync")
-		// Don't fail here - we'll retry connection during sync attempts
-	} else {
-		lf.logger.Info().Str("primary_addr", primaryAddr).Msg("Connected to primary")
-	}
+	// Our NAT state may have diverged while we were primary, start with a full resync
+	lf.replicator.Store(nil)
+	lf.mirror.reset()
 
-	// Validate the client is properly initialized before assigning
-	// Test that the client can be safely closed to avoid nil pointer issues later
-	if c != nil {
-		// Only assign to lf.frpcClient after successful creation and validation
-		lf.frpcClient = c
-	} else {
-		return errors.New("failed to create valid fRPC client")
+	// Start fRPC server so the primary can deliver heartbeats to us
+	if err := lf.startFRPCServer(); err != nil {
+		return err
 	}
 
 	// Initialize heartbeat tracking
 	lf.heartbeatMutex.Lock()
 	lf.lastHeartbeat = time.Now() // Start with current time to give primary time to start
 	lf.missedHeartbeats = 0
+	lf.heartbeatSequence = 0
+	lf.heartbeatGaps = 0
+	lf.resetPathStatsLocked()
+	if lf.phi != nil {
+		lf.phi.reset()
+	}
 	lf.heartbeatMutex.Unlock()
 
-	// Create heartbeat stop channel
-	lf.heartbeatStopCh = make(chan struct{})
-
-	// Start heartbeat monitoring
-	go lf.heartbeatMonitorLoop(ctx)
+	// Connect to the primary and register as its heartbeat target
+	if err := lf.announceToPrimary(ctx); err != nil {
+		lf.logger.Warn().Err(err).
+			Str("eni_ip", lf.config.ENIIP).
+			Msg("Failed to announce to primary, will retry during sync")
+		// Don't fail here - we'll retry connection during sync attempts
+	}
 
-	// Start sync loop for NAT state synchronization
-	go lf.secondarySyncLoop(ctx)
+	// Start heartbeat monitoring and NAT state synchronization
+	lf.monitorPrimary(ctx)
 
 	return nil
 }
 
+// monitorPrimary (re)starts tracking the primary's liveness and syncing its NAT state until
+// the secondary role ends
+func (lf *LeaderFailover) monitorPrimary(ctx context.Context) {
+	stopCh := lf.restartRoleLoops()
+	if lf.bfd != nil {
+		go lf.bfdLivenessLoop(ctx, stopCh, RoleSecondary)
+	} else {
+		go lf.heartbeatMonitorLoop(ctx, stopCh)
+	}
+	go lf.secondarySyncLoop(ctx, stopCh)
+}
+
+// restartRoleLoops stops the loops started for the current role and returns the channel
+// that stops the ones started next
+func (lf *LeaderFailover) restartRoleLoops() chan struct{} {
+	lf.heartbeatStopMutex.Lock()
+	defer lf.heartbeatStopMutex.Unlock()
+
+	if lf.heartbeatStopCh != nil {
+		close(lf.heartbeatStopCh)
+	}
+	lf.heartbeatStopCh = make(chan struct{})
+	return lf.heartbeatStopCh
+}
+
+// stopRoleLoops stops the loops started for the current role
+func (lf *LeaderFailover) stopRoleLoops() {
+	lf.heartbeatStopMutex.Lock()
+	defer lf.heartbeatStopMutex.Unlock()
+
+	if lf.heartbeatStopCh != nil {
+		close(lf.heartbeatStopCh)
+		lf.heartbeatStopCh = nil
+	}
+}
+
 // secondarySyncLoop handles periodic state synchronization when acting as secondary
-func (lf *LeaderFailover) secondarySyncLoop(ctx context.Context) {
+func (lf *LeaderFailover) secondarySyncLoop(ctx context.Context, stopCh <-chan struct{}) {
 	ticker := time.NewTicker(lf.config.SyncInterval)
 	defer ticker.Stop()
 
@@ -481,8 +1299,10 @@ func (lf *LeaderFailover) secondarySyncLoop(ctx context.Context) {
 			return
 		case <-lf.stopCh:
 			return
+		case <-stopCh:
+			return
 		case <-ticker.C:
-			if lf.currentRole != RoleSecondary {
+			if lf.currentRole.Load() != RoleSecondary {
 				return // Stop if we're no longer secondary
 			}
 
@@ -497,18 +1317,35 @@ func (lf *LeaderFailover) secondarySyncLoop(ctx context.Context) {
 
 // syncFromPrimary fetches state from primary and applies it locally
 func (lf *LeaderFailover) syncFromPrimary(ctx context.Context) error {
-	if lf.frpcClient == nil {
-		return errors.New("fRPC client not initialized")
+	lf.syncMutex.Lock()
+	defer lf.syncMutex.Unlock()
+
+	c, err := lf.primaryClient()
+	if err != nil {
+		return err
 	}
 
-	// Create sync request
+	// Without a base state, page the full state from the primary in bounded chunks
+	if lf.mirror.snapshot == nil {
+		return lf.resyncFromPrimary(ctx, c)
+	}
+
+	// Ask for the changes since the last version we applied
 	requestID := fmt.Sprintf("sync_%d", time.Now().UnixNano())
 	request := &FailoverSyncStateRequest{
-		RequestId: requestID,
+		RequestId:    requestID,
+		Epoch:        lf.epochs.current(),
+		StreamId:     lf.mirror.streamID,
+		SinceVersion: lf.mirror.version,
+		Chunked:      true,
+		WireVersion:  lf.config.SyncWireVersion,
+		Compress:     lf.config.SyncCompression,
+		NodeId:       lf.nodeID(),
+		Port:         uint32(lf.config.Port),
 	}
 
 	// Send request to primary via fRPC
-	response, err := lf.frpcClient.FailoverService.SyncState(ctx, request)
+	response, err := rpcResponse(c.FailoverService.SyncState(ctx, request))
 	if err != nil {
 		return fmt.Errorf("failed to send sync request: %w", err)
 	}
@@ -517,98 +1354,44 @@ func (lf *LeaderFailover) syncFromPrimary(ctx context.Context) error {
 		return fmt.Errorf("primary returned error: %s", response.ErrorMessage)
 	}
 
-	if response.State == nil {
-		return errors.New("primary returned empty state")
-	}
-
-	// Convert fRPC state to client.NATState
-	natState := &client.NATState{
-		IPs:         response.State.Ips,
-		TCPInbound:  make([]client.NATKeyValuePair, len(response.State.TcpInbound)),
-		TCPOutbound: make([]client.NATKeyValuePair, len(response.State.TcpOutbound)),
-		UDPInbound:  make([]client.NATKeyValuePair, len(response.State.UdpInbound)),
-		UDPOutbound: make([]client.NATKeyValuePair, len(response.State.UdpOutbound)),
-		NATPorts:    make([]client.NATBitmapPair, len(response.State.NatPorts)),
-	}
-
-	// Convert key-value pairs
-	for i, kv := range response.State.TcpInbound {
-		natState.TCPInbound[i] = client.NATKeyValuePair{
-			Key: client.NATKey{
-				DestinationIP:   kv.Key.DestinationIp,
-				DestinationPort: portUint32ToUint16(kv.Key.DestinationPort),
-				SourceIP:        kv.Key.SourceIp,
-				SourcePort:      portUint32ToUint16(kv.Key.SourcePort),
-			},
-			Value: client.NATValue{
-				LastSeen:      kv.Value.LastSeen,
-				TranslateIP:   kv.Value.TranslateIp,
-				TranslatePort: portUint32ToUint16(kv.Value.TranslatePort),
-			},
-		}
-	}
-	for i, kv := range response.State.TcpOutbound {
-		natState.TCPOutbound[i] = client.NATKeyValuePair{
-			Key: client.NATKey{
-				DestinationIP:   kv.Key.DestinationIp,
-				DestinationPort: portUint32ToUint16(kv.Key.DestinationPort),
-				SourceIP:        kv.Key.SourceIp,
-				SourcePort:      portUint32ToUint16(kv.Key.SourcePort),
-			},
-			Value: client.NATValue{
-				LastSeen:      kv.Value.LastSeen,
-				TranslateIP:   kv.Value.TranslateIp,
-				TranslatePort: portUint32ToUint16(kv.Value.TranslatePort),
-			},
-		}
-	}
-	for i, kv := range response.State.UdpInbound {
-		natState.UDPInbound[i] = client.NATKeyValuePair{
-			Key: client.NATKey{
-				DestinationIP:   kv.Key.DestinationIp,
-				DestinationPort: portUint32ToUint16(kv.Key.DestinationPort),
-				SourceIP:        kv.Key.SourceIp,
-				SourcePort:      portUint32ToUint16(kv.Key.SourcePort),
-			},
-			Value: client.NATValue{
-				LastSeen:      kv.Value.LastSeen,
-				TranslateIP:   kv.Value.TranslateIp,
-				TranslatePort: portUint32ToUint16(kv.Value.TranslatePort),
-			},
-		}
-	}
-	for i, kv := range response.State.UdpOutbound {
-		natState.UDPOutbound[i] = client.NATKeyValuePair{
-			Key: client.NATKey{
-				DestinationIP:   kv.Key.DestinationIp,
-				DestinationPort: portUint32ToUint16(kv.Key.DestinationPort),
-				SourceIP:        kv.Key.SourceIp,
-				SourcePort:      portUint32ToUint16(kv.Key.SourcePort),
-			},
-			Value: client.NATValue{
-				LastSeen:      kv.Value.LastSeen,
-				TranslateIP:   kv.Value.TranslateIp,
-				TranslatePort: portUint32ToUint16(kv.Value.TranslatePort),
-			},
-		}
-	}
-	for i, bp := range response.State.NatPorts {
-		var destIP *string
-		if bp.DestinationIp != "" {
-			destIP = &bp.DestinationIp
-		}
-		natState.NATPorts[i] = client.NATBitmapPair{
-			Bitmap:        bp.Bitmap,
-			DestinationIP: destIP,
-			LastChunk:     portUint32ToUint16(bp.LastChunk),
-			NATIP:         bp.Natip,
-		}
-	}
-
-	// Apply the state to local conduit instance
+	// Never apply state from a primary that has been superseded
+	if response.Epoch < lf.epochs.current() {
+		return fmt.Errorf("%w: primary epoch %d is older than %d", ErrStaleEpoch, response.Epoch, lf.epochs.current())
+	}
+	lf.observeEpoch(response.Epoch, "sync state")
+
+	// The primary could not serve a delta from our version
+	if response.Full && response.State == nil && response.Payload == nil {
+		lf.mirror.reset()
+		return lf.resyncFromPrimary(ctx, c)
+	}
+
+	natState, err := lf.mirror.apply(response)
+	if err != nil {
+		return fmt.Errorf("failed to apply sync response: %w", err)
+	}
+
+	lf.logger.Debug().
+		Str("stream_id", response.StreamId).
+		Uint64("version", response.Version).
+		Bool("full", response.Full).
+		Uint32("wire_version", response.WireVersion).
+		Int("payload_bytes", len(response.Payload)).
+		Bool("changed", natState != nil).
+		Msg("Received NAT state from primary")
+
+	if natState == nil {
+		lf.recordSync(response.Full)
+		return nil
+	}
+
+	// Conduit only accepts the complete state, so apply the updated mirror
 	if err := lf.applySyncedState(ctx, natState); err != nil {
+		// Local state is unknown now, start over with a full resync
+		lf.mirror.reset()
 		return fmt.Errorf("failed to apply synced state: %w", err)
 	}
+	lf.recordSync(response.Full)
 
 	return nil
 }
@@ -617,16 +1400,16 @@ func (lf *LeaderFailover) syncFromPrimary(ctx context.Context) error {
 func (lf *LeaderFailover) cleanup() error {
 	var lastErr error
 
-	// Stop fRPC server if running
-	if lf.frpcServer != nil {
-		if err := lf.frpcServer.Shutdown(); err != nil {
-			lf.logger.Error().Err(err).Msg("Error shutting down fRPC server")
-			lastErr = err
-		}
-		lf.frpcServer = nil
-	}
+	// Stop heartbeat sender or monitor
+	lf.stopRoleLoops()
+
+	// Close heartbeat clients to the secondaries and the witness
+	lf.closePeers()
+	lf.closePathClients()
+	lf.closeWitnessClient()
 
 	// Close fRPC client if running
+	lf.frpcClientMutex.Lock()
 	if lf.frpcClient != nil {
 		// Safely close the client with error recovery
 		func() {
@@ -642,6 +1425,7 @@ func (lf *LeaderFailover) cleanup() error {
 		}()
 		lf.frpcClient = nil
 	}
+	lf.frpcClientMutex.Unlock()
 
 	return lastErr
 }
@@ -653,158 +1437,134 @@ func (lf *LeaderFailover) SyncState(
 ) (*FailoverSyncStateResponse, error) {
 	lf.logger.Debug().Str("request_id", req.RequestId).Msg("Handling sync state request")
 
-	// Get current NAT state from local conduit instance
-	resp, err := lf.localClient.GetStateWithResponse(ctx)
-	if err != nil {
-		lf.logger.Error().Err(err).Msg("Failed to get local NAT state")
+	lf.registerPeer(ctx, req.NodeId, req.Port)
+
+	// A secondary that has seen a newer epoch means we are no longer the primary
+	if lf.observeEpoch(req.Epoch, "sync state") {
 		return &FailoverSyncStateResponse{
 			RequestId:    req.RequestId,
 			Success:      false,
-			ErrorMessage: fmt.Sprintf("failed to get state: %v", err),
+			ErrorMessage: "primary epoch is stale",
+			Epoch:        lf.epochs.current(),
 		}, nil
 	}
 
-	if resp.StatusCode() != http.StatusOK {
-		lf.logger.Error().Int("status", resp.StatusCode()).Msg("Local API returned error status")
+	// Only the primary serves a replication stream. The stream is loaded once, as a demotion
+	// replaces it while the request is handled.
+	replicator := lf.replicator.Load()
+	if replicator == nil {
 		return &FailoverSyncStateResponse{
 			RequestId:    req.RequestId,
 			Success:      false,
-			ErrorMessage: fmt.Sprintf("API error: %d", resp.StatusCode()),
+			ErrorMessage: "node is not primary",
+			Epoch:        lf.epochs.current(),
 		}, nil
 	}
 
-	if resp.JSON200 == nil {
-		lf.logger.Error().Msg("Local API returned empty state")
+	// Get current NAT state from local conduit instance
+	state, err := lf.fetchLocalState(ctx)
+	if err != nil {
+		lf.logger.Error().Err(err).Msg("Failed to get local NAT state")
 		return &FailoverSyncStateResponse{
 			RequestId:    req.RequestId,
 			Success:      false,
-			ErrorMessage: "empty state returned",
+			ErrorMessage: err.Error(),
 		}, nil
 	}
 
-	// Convert client.NATState to fRPC state
-	natState := resp.JSON200
-	frpcState := &FailoverNATState{
-		Ips:         natState.IPs,
-		TcpInbound:  make([]*FailoverNATKeyValuePair, len(natState.TCPInbound)),
-		TcpOutbound: make([]*FailoverNATKeyValuePair, len(natState.TCPOutbound)),
-		UdpInbound:  make([]*FailoverNATKeyValuePair, len(natState.UDPInbound)),
-		UdpOutbound: make([]*FailoverNATKeyValuePair, len(natState.UDPOutbound)),
-		NatPorts:    make([]*FailoverNATBitmapPair, len(natState.NATPorts)),
-	}
-
-	// Convert key-value pairs
-	for i, kv := range natState.TCPInbound {
-		frpcState.TcpInbound[i] = &FailoverNATKeyValuePair{
-			Key: &FailoverNATKey{
-				DestinationIp:   kv.Key.DestinationIP,
-				DestinationPort: uint32(kv.Key.DestinationPort),
-				SourceIp:        kv.Key.SourceIP,
-				SourcePort:      uint32(kv.Key.SourcePort),
-			},
-			Value: &FailoverNATValue{
-				LastSeen:      kv.Value.LastSeen,
-				TranslateIp:   kv.Value.TranslateIP,
-				TranslatePort: uint32(kv.Value.TranslatePort),
-			},
-		}
-	}
-	for i, kv := range natState.TCPOutbound {
-		frpcState.TcpOutbound[i] = &FailoverNATKeyValuePair{
-			Key: &FailoverNATKey{
-				DestinationIp:   kv.Key.DestinationIP,
-				DestinationPort: uint32(kv.Key.DestinationPort),
-				SourceIp:        kv.Key.SourceIP,
-				SourcePort:      uint32(kv.Key.SourcePort),
-			},
-			Value: &FailoverNATValue{
-				LastSeen:      kv.Value.LastSeen,
-				TranslateIp:   kv.Value.TranslateIP,
-				TranslatePort: uint32(kv.Value.TranslatePort),
-			},
-		}
-	}
-	for i, kv := range natState.UDPInbound {
-		frpcState.UdpInbound[i] = &FailoverNATKeyValuePair{
-			Key: &FailoverNATKey{
-				DestinationIp:   kv.Key.DestinationIP,
-				DestinationPort: uint32(kv.Key.DestinationPort),
-				SourceIp:        kv.Key.SourceIP,
-				SourcePort:      uint32(kv.Key.SourcePort),
-			},
-			Value: &FailoverNATValue{
-				LastSeen:      kv.Value.LastSeen,
-				TranslateIp:   kv.Value.TranslateIP,
-				TranslatePort: uint32(kv.Value.TranslatePort),
-			},
-		}
-	}
-	for i, kv := range natState.UDPOutbound {
-		frpcState.UdpOutbound[i] = &FailoverNATKeyValuePair{
-			Key: &FailoverNATKey{
-				DestinationIp:   kv.Key.DestinationIP,
-				DestinationPort: uint32(kv.Key.DestinationPort),
-				SourceIp:        kv.Key.SourceIP,
-				SourcePort:      uint32(kv.Key.SourcePort),
-			},
-			Value: &FailoverNATValue{
-				LastSeen:      kv.Value.LastSeen,
-				TranslateIp:   kv.Value.TranslateIP,
-				TranslatePort: uint32(kv.Value.TranslatePort),
-			},
-		}
-	}
-	for i, bp := range natState.NATPorts {
-		destIP := ""
-		if bp.DestinationIP != nil {
-			destIP = *bp.DestinationIP
-		}
-		frpcState.NatPorts[i] = &FailoverNATBitmapPair{
-			Bitmap:        bp.Bitmap,
-			DestinationIp: destIP,
-			LastChunk:     uint32(bp.LastChunk),
-			Natip:         bp.NATIP,
-		}
-	}
-
-	return &FailoverSyncStateResponse{
+	replicator.update(state)
+
+	response := &FailoverSyncStateResponse{
 		RequestId: req.RequestId,
 		Success:   true,
-		State:     frpcState,
-	}, nil
+		Epoch:     lf.epochs.leader(),
+		StreamId:  replicator.streamID,
+	}
+
+	// Send only the changes when the secondary is on our stream and recent enough
+	if delta, version := replicator.since(req.StreamId, req.SinceVersion); delta != nil {
+		replicator.release(req.NodeId, req.StreamId, req.SinceVersion)
+		response.Version = version
+		if err := setSyncDelta(response, req, delta); err != nil {
+			lf.logger.Warn().Err(err).Msg("Sending NAT state delta in the v1 wire format")
+		}
+		return response, nil
+	}
+
+	response.Full = true
+
+	// Secondaries that support chunked resync page the state with SyncStateChunk instead
+	if req.Chunked {
+		lf.logger.Info().
+			Str("stream_id", response.StreamId).
+			Uint64("since_version", req.SinceVersion).
+			Msg("Secondary needs a full NAT state resync")
+		return response, nil
+	}
+
+	fullState, version := replicator.full()
+	response.Version = version
+	if err := setSyncState(response, req, fullState); err != nil {
+		lf.logger.Warn().Err(err).Msg("Sending full NAT state in the v1 wire format")
+	}
+
+	lf.logger.Info().
+		Str("stream_id", response.StreamId).
+		Uint64("since_version", req.SinceVersion).
+		Uint64("version", response.Version).
+		Msg("Sending full NAT state resync")
+
+	return response, nil
 }
 
 // HealthCheck implements the FailoverService interface for health checking
 func (lf *LeaderFailover) HealthCheck(
-	_ context.Context,
+	ctx context.Context,
 	req *FailoverHealthCheckRequest,
 ) (*FailoverHealthCheckResponse, error) {
-	return &FailoverHealthCheckResponse{
-		RequestId:  req.RequestId,
-		Success:    true,
-		NodeRole:   lf.currentRole.String(),
-		InstanceId: lf.awsClient.GetInstanceID(),
-	}, nil
+	// Status probes come from tooling rather than the secondary
+	if !req.Probe {
+		lf.registerPeer(ctx, req.NodeId, req.Port)
+	}
+	lf.observeEpoch(req.Epoch, "health check")
+
+	status := lf.Status()
+	response := &FailoverHealthCheckResponse{
+		RequestId:        req.RequestId,
+		Success:          true,
+		NodeRole:         status.Role,
+		InstanceId:       status.InstanceID,
+		Epoch:            status.Epoch,
+		MissedHeartbeats: uint32(status.MissedHeartbeats), //nolint:gosec // bounded by the miss threshold
+		Maintenance:      status.Maintenance,
+		Priority:         status.Priority,
+	}
+	if !status.LastHeartbeat.IsZero() {
+		response.LastHeartbeat = status.LastHeartbeat.UnixNano()
+	}
+	if !status.FrozenUntil.IsZero() {
+		response.FrozenUntil = status.FrozenUntil.UnixNano()
+	}
+	if status.LastSync != nil {
+		response.LastSync = status.LastSync.Time.UnixNano()
+	}
+
+	return response, nil
 }
 
 // applySyncedState applies the received state to the local conduit instance
-func (lf *LeaderFailover) applySyncedState(ctx context.Context, state *client.NATState) error {
-	resp, err := lf.localClient.SetStateWithResponse(ctx, *state)
-	if err != nil {
-		return fmt.Errorf("failed to set local state: %w", err)
-	}
-
-	if resp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("local API returned error status: %d", resp.StatusCode())
+func (lf *LeaderFailover) applySyncedState(ctx context.Context, snapshot *natSnapshot) error {
+	if err := lf.setLocalState(ctx, snapshot); err != nil {
+		return err
 	}
 
 	lf.logger.Debug().
-		Int("ips", len(state.IPs)).
-		Int("tcp_inbound", len(state.TCPInbound)).
-		Int("tcp_outbound", len(state.TCPOutbound)).
-		Int("udp_inbound", len(state.UDPInbound)).
-		Int("udp_outbound", len(state.UDPOutbound)).
-		Int("nat_ports", len(state.NATPorts)).
+		Int("ips", len(snapshot.ips)).
+		Int("tcp_inbound", len(snapshot.tables[natTableTCPInbound])).
+		Int("tcp_outbound", len(snapshot.tables[natTableTCPOutbound])).
+		Int("udp_inbound", len(snapshot.tables[natTableUDPInbound])).
+		Int("udp_outbound", len(snapshot.tables[natTableUDPOutbound])).
+		Int("nat_ports", len(snapshot.ports)).
 		Msg("Applied synced state to local instance")
 
 	return nil
@@ -815,153 +1575,208 @@ func (lf *LeaderFailover) Heartbeat(
 	_ context.Context,
 	req *FailoverHeartbeatRequest,
 ) (*FailoverHeartbeatResponse, error) {
-	// Only secondary should receive heartbeats from primary
-	if lf.currentRole != RoleSecondary {
+	// Heartbeats from a primary with an older epoch are fenced off; the
+	// response carries our epoch so the stale primary steps down
+	if req.Epoch < lf.epochs.current() {
+		lf.logger.Warn().
+			Uint64("epoch", req.Epoch).
+			Uint64("current_epoch", lf.epochs.current()).
+			Msg("Rejected heartbeat from stale primary")
+		return &FailoverHeartbeatResponse{
+			RequestId: req.RequestId,
+			Success:   false,
+			Timestamp: time.Now().UnixNano(),
+			Sequence:  req.Sequence,
+			Epoch:     lf.epochs.current(),
+		}, nil
+	}
+	stale := lf.observeEpoch(req.Epoch, "heartbeat")
+
+	// Only secondary should receive heartbeats from primary. The role is still
+	// unknown while becomeSecondary runs, so only reject when we are primary.
+	if lf.currentRole.Load() == RolePrimary && !stale {
 		return &FailoverHeartbeatResponse{
 			RequestId: req.RequestId,
 			Success:   false,
 			Timestamp: time.Now().UnixNano(),
+			Sequence:  req.Sequence,
+			Epoch:     lf.epochs.current(),
 		}, errors.New("node is not secondary")
 	}
 
 	// Update heartbeat tracking
-	lf.heartbeatMutex.Lock()
-	lf.lastHeartbeat = time.Now()
-	lf.missedHeartbeats = 0
-	lf.heartbeatMutex.Unlock()
+	lf.recordHeartbeat(req)
 
 	return &FailoverHeartbeatResponse{
 		RequestId: req.RequestId,
 		Success:   true,
 		Timestamp: time.Now().UnixNano(),
+		Sequence:  req.Sequence,
+		Epoch:     lf.epochs.current(),
+	}, nil
+}
+
+// RequestVote implements the FailoverService interface; only a witness grants votes
+func (lf *LeaderFailover) RequestVote(
+	_ context.Context,
+	req *FailoverVoteRequest,
+) (*FailoverVoteResponse, error) {
+	return &FailoverVoteResponse{
+		RequestId: req.RequestId,
+		Granted:   false,
+		Reason:    "node is not a witness",
+		Epoch:     lf.epochs.current(),
 	}, nil
 }
 
-// executeFailoverActions performs route table updates and floating IP reassignment
+// executeFailoverActions moves the pair's resources to this node as a sequence of idempotent
+// steps: the ENI IP and its EIP are taken over and the epoch stamped, then the routes and
+// floating IPs are moved in parallel and the floating IPs' EIPs follow. Steps already in
+// place are skipped, so a retried or resumed failover only makes the changes still missing.
 func (lf *LeaderFailover) executeFailoverActions(ctx context.Context) error {
-	lf.logger.Info().Msg("Executing failover actions")
+	epoch := lf.epochs.leader()
+	lf.logger.Info().Uint64("epoch", epoch).Msg("Executing failover actions")
+
+	if interrupted := lf.journal.interruptedPromotion(); interrupted != nil {
+		lf.logger.Info().
+			Uint64("decision", interrupted.Decision.Decision).
+			Str("completed_steps", strings.Join(completedSteps(interrupted), "; ")).
+			Msg("Resuming promotion interrupted by a restart")
+	}
 
-	// First, take over the ENI IP if we don't already own it
-	if err := lf.awsClient.TakeOverENI(ctx, lf.config.ENIIP); err != nil {
-		lf.logger.Error().Err(err).Msg("Failed to take over ENI IP")
-		return fmt.Errorf("failed to take over ENI IP: %w", err)
+	// Refuse to touch AWS state if another node holds a newer epoch
+	if err := lf.checkFence(ctx); err != nil {
+		return err
 	}
 
-	lf.logger.Info().Str("eni_ip", lf.config.ENIIP).Msg("Successfully took over ENI IP")
+	// The ENI IP moves to the first ENI of this instance
+	target, err := planTarget(ctx, lf.cloud, "")
+	if err != nil {
+		return err
+	}
+	newENI := target.ID
 
-	// Get the ENI ID for this instance (new primary)
-	newENI, err := lf.awsClient.GetENIByIP(ctx, lf.config.ENIIP)
+	// EIPs are found before the ENI IP moves, which may disassociate them. Only those on
+	// the pair's ENIs are moved, the same private IP may hold an EIP in another VPC.
+	selector, err := lf.config.ResourceSelector()
+	if err != nil {
+		return err
+	}
+	pair, err := DiscoverResources(ctx, lf.cloud, lf.config.ENIIP, "", selector)
+	if err != nil {
+		return fmt.Errorf("failed to discover failover resources: %w", err)
+	}
+	eips, err := lf.cloud.DescribeEIPs(ctx, EIPFilter{PrivateIPs: []string{lf.config.ENIIP}, ENIs: pair.ENIIDs()})
 	if err != nil {
-		return fmt.Errorf("failed to get new primary ENI: %w", err)
+		return err
 	}
+	lf.manageEIPs(eips)
 
-	lf.logger.Info().Str("new_eni", newENI).Msg("Identified new primary ENI")
+	steps := []*failoverStep{lf.takeOverStep(newENI)}
+	for _, eip := range eips {
+		steps = append(steps, lf.moveEIPStep(eip, newENI))
+	}
+	steps = append(steps, lf.stampEpochStep(newENI, epoch))
 
-	// Find the old primary ENI (the one that currently has floating IPs)
-	// We'll look for ENIs with floating IPs in the same subnet
-	oldENI := ""
-	var floatingIPs []string
+	// Each step depends on the ones before it
+	for _, step := range steps {
+		if err := lf.runStep(ctx, step); err != nil {
+			return failoverErr([]*StepError{err})
+		}
+		if step.action == ActionTakeOverENI {
+			lf.logger.Info().Str("eni_ip", lf.config.ENIIP).Str("new_eni", newENI).Msg("Took over ENI IP")
+			lf.currentENI.Store(newENI)
+		}
+	}
 
-	// Get all ENIs in the same VPC to find the one with floating IPs
-	describeInput := &ec2.DescribeNetworkInterfacesInput{}
-	result, err := lf.awsClient.EC2Client.DescribeNetworkInterfaces(ctx, describeInput)
-	if err != nil {
-		lf.logger.Warn().Err(err).Msg("Failed to describe network interfaces")
-	} else {
-		for _, eni := range result.NetworkInterfaces {
-			if eni.NetworkInterfaceId != nil && *eni.NetworkInterfaceId != newENI {
-				// Get floating IPs for this ENI
-				ips, err := lf.awsClient.GetENIFloatingIPs(ctx, *eni.NetworkInterfaceId)
-				if err != nil {
-					continue
-				}
+	// Re-check the fence now that the ENI IP has moved, before rewriting routes and IPs
+	if err := lf.checkFence(ctx); err != nil {
+		return err
+	}
 
-				// Filter to only get IPs matching the pattern (x.x.x.20 onwards)
-				filtered := lf.awsClient.FilterFloatingIPs(ips, lf.config.ENIIP)
-				if len(filtered) > 0 {
-					oldENI = *eni.NetworkInterfaceId
-					floatingIPs = filtered
-					lf.logger.Info().
-						Str("old_eni", oldENI).
-						Int("floating_ip_count", len(floatingIPs)).
-						Str("floating_ips", strings.Join(floatingIPs, ",")).
-						Msg("Found old primary ENI with floating IPs")
-					break
-				}
-			}
+	// Find the managed route tables and the floating IPs still held by other ENIs
+	resources, err := DiscoverResources(ctx, lf.cloud, lf.config.ENIIP, lf.config.DestinationCIDR, selector)
+	if err != nil {
+		return fmt.Errorf("failed to discover failover resources: %w", err)
+	}
+	for _, rejected := range resources.Rejected {
+		lf.logger.Warn().
+			Str("kind", rejected.Kind).
+			Str("id", rejected.ID).
+			Str("reason", rejected.Reason).
+			Msg("Ignoring resource selected for failover")
+	}
+	var floatingEIPs []CloudEIP
+	if len(resources.FloatingIPs) > 0 {
+		if floatingEIPs, err = lf.cloud.DescribeEIPs(ctx, EIPFilter{PrivateIPs: resources.FloatingIPs, ENIs: resources.ENIIDs()}); err != nil {
+			return err
 		}
+		lf.manageEIPs(floatingEIPs)
 	}
 
-	// Create error channel for parallel operations
-	errCh := make(chan error, 2)
+	moves := resources.FloatingIPMoves(newENI)
+	for oldENI, floatingIPs := range moves {
+		lf.logger.Info().
+			Str("old_eni", oldENI).
+			Int("floating_ip_count", len(floatingIPs)).
+			Str("floating_ips", strings.Join(floatingIPs, ",")).
+			Msg("Found old primary ENI with floating IPs")
+	}
 
-	// Execute route table update and floating IP reassignment in parallel
-	go func() {
-		if lf.config.DestinationCIDR != "" {
-			lf.logger.Info().
-				Str("cidr", lf.config.DestinationCIDR).
-				Str("new_eni", newENI).
-				Msg("Updating route tables")
-
-			if err := lf.awsClient.UpdateRouteTables(ctx, lf.config.DestinationCIDR, newENI); err != nil {
-				errCh <- fmt.Errorf("route table update failed: %w", err)
-			} else {
-				lf.logger.Info().Msg("Route tables updated successfully")
-				errCh <- nil
-			}
-		} else {
-			lf.logger.Warn().Msg("No destination CIDR configured, skipping route table update")
-			errCh <- nil
+	var routeSteps []*failoverStep
+	var failed []*StepError
+	if lf.config.DestinationCIDR == "" {
+		lf.logger.Warn().Msg("No destination CIDR configured, skipping route table update")
+	} else if len(resources.RouteTables) == 0 {
+		failed = append(failed, &StepError{
+			Action:   ActionUpdateRoutes,
+			Resource: lf.config.DestinationCIDR,
+			Err:      fmt.Errorf("no route tables found with routes to %s", lf.config.DestinationCIDR),
+		})
+	} else {
+		lf.logger.Info().
+			Str("cidr", lf.config.DestinationCIDR).
+			Str("new_eni", newENI).
+			Str("route_tables", strings.Join(resources.RouteTables, ",")).
+			Msg("Updating route tables")
+		for _, routeTable := range resources.RouteTables {
+			routeSteps = append(routeSteps, lf.updateRouteStep(resources.VPCID, routeTable, newENI))
 		}
-	}()
+	}
 
-	// Reassign floating IPs
+	// Route tables and floating IPs do not depend on each other and move in parallel
+	routeErrs := make(chan []*StepError, 1)
 	go func() {
-		if oldENI != "" && len(floatingIPs) > 0 {
-			lf.logger.Info().
-				Str("old_eni", oldENI).
-				Str("new_eni", newENI).
-				Int("ip_count", len(floatingIPs)).
-				Str("ips", strings.Join(floatingIPs, ",")).
-				Msg("Reassigning floating IPs")
-
-			if err := lf.awsClient.ReassignFloatingIPs(ctx, oldENI, newENI, floatingIPs); err != nil {
-				errCh <- fmt.Errorf("floating IP reassignment failed: %w", err)
-			} else {
-				lf.logger.Info().Msg("Floating IPs reassigned successfully")
-				errCh <- nil
-			}
-		} else {
-			lf.logger.Info().Msg("No floating IPs to reassign")
-			errCh <- nil
-		}
+		routeErrs <- lf.runSteps(ctx, routeSteps)
 	}()
+	failed = append(failed, lf.runSteps(ctx, lf.floatingIPSteps(moves, newENI))...)
+	failed = append(failed, <-routeErrs...)
 
-	// Wait for both operations to complete
-	var errs []string
-	for i := 0; i < 2; i++ {
-		if err := <-errCh; err != nil {
-			errs = append(errs, err.Error())
+	// The floating IPs' EIPs follow once the IPs have moved
+	for _, eip := range floatingEIPs {
+		if err := lf.runStep(ctx, lf.moveEIPStep(eip, newENI)); err != nil {
+			failed = append(failed, err)
 		}
 	}
 
-	if len(errs) > 0 {
-		return fmt.Errorf("failover action errors: %s", strings.Join(errs, "; "))
+	if err := failoverErr(failed); err != nil {
+		return err
 	}
 
-	lf.currentENI = newENI
+	lf.currentENI.Store(newENI)
 	lf.logger.Info().Msg("Failover actions completed successfully")
 	return nil
 }
 
 // heartbeatMonitorLoop monitors for missed heartbeats when acting as secondary
-func (lf *LeaderFailover) heartbeatMonitorLoop(ctx context.Context) {
+func (lf *LeaderFailover) heartbeatMonitorLoop(ctx context.Context, stopCh <-chan struct{}) {
 	ticker := time.NewTicker(lf.config.HeartbeatInterval)
 	defer ticker.Stop()
 
 	lf.logger.Info().
 		Str("interval", lf.config.HeartbeatInterval.String()).
 		Int("threshold", lf.config.HeartbeatMissThreshold).
+		Str("failure_detector", lf.config.FailureDetector).
 		Msg("Starting heartbeat monitor")
 
 	for {
@@ -970,11 +1785,13 @@ func (lf *LeaderFailover) heartbeatMonitorLoop(ctx context.Context) {
 			return
 		case <-lf.stopCh:
 			return
-		case <-lf.heartbeatStopCh:
+		case <-stopCh:
 			return
 		case <-ticker.C:
 			lf.heartbeatMutex.Lock()
-			timeSinceLastHeartbeat := time.Since(lf.lastHeartbeat)
+			now := time.Now()
+			timeSinceLastHeartbeat := now.Sub(lf.lastHeartbeat)
+			lf.checkPathsLocked()
 
 			// Check if we've missed a heartbeat
 			if timeSinceLastHeartbeat > lf.config.HeartbeatInterval {
@@ -983,28 +1800,78 @@ func (lf *LeaderFailover) heartbeatMonitorLoop(ctx context.Context) {
 					Int("missed_count", lf.missedHeartbeats).
 					Str("time_since_last", timeSinceLastHeartbeat.String()).
 					Msg("Missed heartbeat from primary")
+			}
+
+			phi := lf.phiStatsLocked()
+			lf.emitHeartbeatMetrics(lf.missedHeartbeats, phi)
+
+			// Check if the failure detector considers the primary down
+			if timeSinceLastHeartbeat > lf.config.HeartbeatInterval && lf.primarySuspectedLocked(phi) {
+				logEvent := lf.logger.Error().
+					Str("failure_detector", lf.config.FailureDetector).
+					Int("missed_count", lf.missedHeartbeats)
+				if phi != nil {
+					logEvent = logEvent.Str("phi", strconv.FormatFloat(phi.Phi, 'f', 2, 64))
+				}
+				logEvent.Msg("Heartbeat threshold exceeded, initiating failover")
+
+				inputs := &JournalInputs{
+					MissedHeartbeats: lf.missedHeartbeats,
+					LastHeartbeatAge: timeSinceLastHeartbeat,
+				}
+				reason := fmt.Sprintf("%d heartbeats missed", lf.missedHeartbeats)
+				if phi != nil {
+					inputs.Phi = phi.Phi
+					reason = "phi " + strconv.FormatFloat(phi.Phi, 'f', 2, 64) + " exceeded threshold"
+				}
+
+				// Reset before unlock to avoid race
+				lf.missedHeartbeats = 0
+				lf.heartbeatMutex.Unlock()
 
-				// Check if we've hit the threshold
-				if lf.missedHeartbeats >= lf.config.HeartbeatMissThreshold {
-					lf.logger.Error().
-						Int("missed_count", lf.missedHeartbeats).
-						Msg("Heartbeat threshold exceeded, initiating failover")
-
-					// Reset before unlock to avoid race
-					lf.missedHeartbeats = 0
-					lf.heartbeatMutex.Unlock()
-
-					// Trigger failover to primary
-					select {
-					case lf.roleCh <- RolePrimary:
-						lf.logger.Info().Msg("Triggered failover to primary role")
-					default:
-						lf.logger.Warn().Msg("Role channel full, failover request dropped")
-					}
+				if lf.requestPromotion(ctx, "primary failed: "+reason, inputs) {
 					return
 				}
+				continue
 			}
 			lf.heartbeatMutex.Unlock()
 		}
 	}
 }
+
+// requestPromotion asks for the primary role after the primary failed, unless this node
+// may not take it. It reports whether the role change was requested.
+func (lf *LeaderFailover) requestPromotion(ctx context.Context, reason string, inputs *JournalInputs) bool {
+	// An operator has pinned this node to the secondary role
+	if lf.maintenance.Load() {
+		lf.logger.Warn().Msg("Maintenance mode enabled, not promoting")
+		return false
+	}
+
+	// Promoting a node whose dataplane is broken would take the pair down
+	if lf.unhealthy.Load() {
+		lf.logger.Warn().Msg("Conduit is unhealthy, not eligible for promotion")
+		return false
+	}
+
+	// Damp promotions right after a transition or while the pair is flapping
+	if err := lf.checkAutomaticTransition(); err != nil {
+		lf.logger.Warn().Err(err).Msg("Not promoting")
+		return false
+	}
+
+	// Our own link may be the one that failed, so the witness must agree the primary is down
+	if err := lf.confirmPrimaryDown(ctx); err != nil {
+		lf.logger.Warn().Err(err).Msg("Witness did not confirm primary failure, remaining secondary")
+		return false
+	}
+
+	// Trigger failover to primary
+	select {
+	case lf.roleCh <- newRoleRequest(RolePrimary, TriggerHeartbeat, reason, inputs):
+		lf.logger.Info().Msg("Triggered failover to primary role")
+	default:
+		lf.logger.Warn().Msg("Role channel full, failover request dropped")
+	}
+	return true
+}
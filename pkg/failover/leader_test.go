@@ -0,0 +1,216 @@
+package failover
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/loopholelabs/logging"
+)
+
+// Addresses of the failover pair in the MemoryCloud built by newTestCloud
+const (
+	testENIIP           = "10.0.1.5"
+	testDestinationCIDR = "10.9.0.0/16"
+
+	// testFloatingIP is the floating IP withFloatingIP places on the primary's ENI
+	testFloatingIP = "10.0.1.20"
+)
+
+// testCloudOption adds resources to the cloud built by newTestCloud
+type testCloudOption func(cloud *MemoryCloud)
+
+// newTestCloud creates a cloud holding a failover pair: instance i-a owns the ENI IP and
+// the route to the destination CIDR, and i-b is the secondary. The options add to it in order.
+func newTestCloud(options ...testCloudOption) *MemoryCloud {
+	cloud := NewMemoryCloud()
+	cloud.AddSubnet(CloudSubnet{ID: "subnet-1", VPCID: "vpc-1", CIDR: "10.0.1.0/24"})
+	cloud.AddENI(CloudENI{ID: "eni-a", InstanceID: "i-a", SubnetID: "subnet-1", PrimaryIP: "10.0.1.10", SecondaryIPs: []string{testENIIP}})
+	cloud.AddENI(CloudENI{ID: "eni-b", InstanceID: "i-b", SubnetID: "subnet-1", PrimaryIP: "10.0.1.11"})
+	cloud.AddRouteTable(CloudRouteTable{ID: "rtb-1", VPCID: "vpc-1", Routes: map[string]string{testDestinationCIDR: "eni-a"}})
+	for _, option := range options {
+		option(cloud)
+	}
+	return cloud
+}
+
+// withFloatingIP places the floating IP on eni-a and adds a third ENI, eni-c, whose primary
+// IP can never be moved
+func withFloatingIP(cloud *MemoryCloud) {
+	cloud.AddENI(CloudENI{ID: "eni-a", InstanceID: "i-a", SubnetID: "subnet-1", PrimaryIP: "10.0.1.10", SecondaryIPs: []string{testENIIP, testFloatingIP}})
+	cloud.AddENI(CloudENI{ID: "eni-c", InstanceID: "i-c", SubnetID: "subnet-1", PrimaryIP: "10.0.1.12"})
+}
+
+// withEIPs associates an EIP with the ENI IP and one with the floating IP, and adds a second
+// route table already targeting eni-b
+func withEIPs(cloud *MemoryCloud) {
+	cloud.AddEIP(CloudEIP{AllocationID: "eipalloc-1", PublicIP: "203.0.113.1", PrivateIP: testENIIP})
+	cloud.AddEIP(CloudEIP{AllocationID: "eipalloc-2", PublicIP: "203.0.113.2", PrivateIP: testFloatingIP})
+	cloud.AddRouteTable(CloudRouteTable{ID: "rtb-2", VPCID: "vpc-1", Routes: map[string]string{testDestinationCIDR: "eni-b"}})
+}
+
+// withOtherVPC adds a VPC that reuses the pair's private IPs: its eni-0, which sorts before
+// the pair's ENIs, holds the ENI IP and the floating IP, each with an EIP of its own
+func withOtherVPC(cloud *MemoryCloud) {
+	cloud.AddSubnet(CloudSubnet{ID: "subnet-9", VPCID: "vpc-9", CIDR: "10.0.1.0/24"})
+	cloud.AddENI(CloudENI{ID: "eni-0", InstanceID: "i-z", SubnetID: "subnet-9", PrimaryIP: "10.0.1.10", SecondaryIPs: []string{testENIIP, testFloatingIP}})
+	cloud.AddEIP(CloudEIP{AllocationID: "eipalloc-8", PublicIP: "198.51.100.8", PrivateIP: testENIIP, ENI: "eni-0"})
+	cloud.AddEIP(CloudEIP{AllocationID: "eipalloc-9", PublicIP: "198.51.100.9", PrivateIP: testFloatingIP, ENI: "eni-0"})
+}
+
+// newTestConfig creates the config of a node named name, filled with what every node needs
+// before the configure hooks have their say in order
+func newTestConfig(t *testing.T, name string, configure ...func(*LeaderConfig)) *LeaderConfig {
+	t.Helper()
+
+	config := &LeaderConfig{
+		ENIIP:           testENIIP,
+		DestinationCIDR: testDestinationCIDR,
+		LocalSocket:     "/unix/tmp/conduit.sock",
+		StateDir:        t.TempDir(),
+		Logger:          logging.Test(t, logging.Zerolog, name),
+	}
+	for _, hook := range configure {
+		if hook != nil {
+			hook(config)
+		}
+	}
+	return config
+}
+
+// newTestFailover creates a failover node for instance on cloud without starting it, with
+// the config of newTestConfig. The node is stopped when the test ends.
+func newTestFailover(t *testing.T, cloud *MemoryCloud, instance string, configure ...func(*LeaderConfig)) *LeaderFailover {
+	t.Helper()
+
+	provider := func(config *LeaderConfig) { config.Cloud = NewMemoryCloudProvider(cloud, instance) }
+	lf, err := NewLeaderFailover(newTestConfig(t, instance, append([]func(*LeaderConfig){provider}, configure...)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = lf.Stop() })
+
+	return lf
+}
+
+// newTestPrimary creates a failover node for i-a on cloud that is primary, leading under a
+// freshly claimed epoch stamped on its ENI
+func newTestPrimary(t *testing.T, cloud *MemoryCloud, configure ...func(*LeaderConfig)) (*LeaderFailover, uint64) {
+	t.Helper()
+
+	lf := newTestFailover(t, cloud, "i-a", configure...)
+	lf.state = StatePrimary
+	lf.currentRole.Store(RolePrimary)
+	lf.currentENI.Store("eni-a")
+
+	epoch := leadTestEpoch(t, lf)
+	if err := lf.cloud.SetEpochTag(context.Background(), "eni-a", epoch); err != nil {
+		t.Fatal(err)
+	}
+
+	return lf, epoch
+}
+
+// leadTestEpoch has the node claim a new epoch, as a promotion does before its failover actions
+func leadTestEpoch(t *testing.T, lf *LeaderFailover) uint64 {
+	t.Helper()
+
+	epoch, err := lf.claimEpoch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return epoch
+}
+
+func TestSettleRole(t *testing.T) {
+	lf := newTestFailover(t, newTestCloud(), "i-a", nil)
+
+	tests := map[NodeState]NodeRole{
+		StateUnknown:   RoleUnknown,
+		StateCandidate: RoleUnknown,
+		StatePromoting: RoleUnknown,
+		StatePrimary:   RolePrimary,
+		StateDemoting:  RoleUnknown,
+		StateSecondary: RoleSecondary,
+		StateFailed:    RoleUnknown,
+	}
+	for state, want := range tests {
+		lf.state = state
+		lf.currentRole.Store(RolePrimary)
+		if role := lf.settleRole(); role != want || lf.currentRole.Load() != want {
+			t.Fatalf("role in state %s: got %s and stored %s, want %s", state, role, lf.currentRole.Load(), want)
+		}
+	}
+}
+
+func TestFailedTransitionClearsRole(t *testing.T) {
+	lf := newTestFailover(t, newTestCloud(), "i-a", nil)
+
+	// A primary whose promotion never settled cannot demote, and no longer holds the role
+	lf.state = StatePromoting
+	lf.currentRole.Store(RolePrimary)
+	lf.handleRoleRequest(context.Background(), newRoleRequest(RoleSecondary, "test", "failed demotion", nil))
+	if role := lf.currentRole.Load(); role != RoleUnknown {
+		t.Fatalf("role after a failed demotion: got %s, want %s", role, RoleUnknown)
+	}
+
+	// An invalid request leaves the role the state machine is in
+	lf.state = StateSecondary
+	lf.handleRoleRequest(context.Background(), newRoleRequest(RoleUnknown, "test", "invalid role", nil))
+	if role := lf.currentRole.Load(); role != RoleSecondary {
+		t.Fatalf("role after an invalid request: got %s, want %s", role, RoleSecondary)
+	}
+}
+
+func TestRoleLoopsStopOnceOnOverlappingShutdown(t *testing.T) {
+	lf := newTestFailover(t, newTestCloud(), "i-a", nil)
+
+	// A shutdown cleaning up while the role management loop starts the next role's loops
+	var wg sync.WaitGroup
+	stopped := make([]chan struct{}, 100)
+	for i := range stopped {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			stopped[i] = lf.restartRoleLoops()
+		}()
+		go func() {
+			defer wg.Done()
+			_ = lf.cleanup()
+		}()
+	}
+	wg.Wait()
+	lf.stopRoleLoops()
+
+	for i, stopCh := range stopped {
+		select {
+		case <-stopCh:
+		default:
+			t.Fatalf("loops started by restart %d were never stopped", i)
+		}
+	}
+}
+
+func TestSecondarySyncLoopStopsWithRole(t *testing.T) {
+	lf := newTestFailover(t, newTestCloud(), "i-a", func(config *LeaderConfig) {
+		config.SyncInterval = time.Hour
+	})
+	lf.currentRole.Store(RoleSecondary)
+
+	// A quick secondary, primary, secondary cycle must not leave the first sync loop running
+	stopCh := lf.restartRoleLoops()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lf.secondarySyncLoop(context.Background(), stopCh)
+	}()
+	lf.restartRoleLoops()
+	defer lf.stopRoleLoops()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sync loop kept running after its role loops were restarted")
+	}
+}
@@ -0,0 +1,263 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrLeaseNotHeld = errors.New("leadership lease is not held")
+
+// Lease is a time-bounded claim on leadership stored in a LeaseStore
+type Lease struct {
+	// Holder is the identity of the node holding the lease, empty when released
+	Holder string
+
+	// Expires is when the lease lapses unless renewed
+	Expires time.Time
+
+	// Version increases with every write and is used for compare-and-swap
+	Version uint64
+}
+
+// LeaseStore is a key/value store that supports conditional writes
+type LeaseStore interface {
+	// Get returns the lease stored under key, or nil if none has been written
+	Get(ctx context.Context, key string) (*Lease, error)
+
+	// CompareAndSwap writes next under key only if the stored version equals
+	// prevVersion (0 meaning absent), and reports whether the write happened
+	CompareAndSwap(ctx context.Context, key string, prevVersion uint64, next Lease) (bool, error)
+}
+
+// LeaseGuard is implemented by electors whose leadership is a time-bounded lease.
+// Failover actions are only performed while HoldsLease returns true.
+type LeaseGuard interface {
+	HoldsLease() bool
+}
+
+// LeaseElector elects the node holding an unexpired lease in a LeaseStore
+type LeaseElector struct {
+	store    LeaseStore
+	key      string
+	id       string
+	duration time.Duration
+
+	mu        sync.Mutex
+	version   uint64    // version of the lease we last wrote
+	heldUntil time.Time // local deadline after which we stop acting as leader
+}
+
+var (
+	_ Elector    = (*LeaseElector)(nil)
+	_ LeaseGuard = (*LeaseElector)(nil)
+)
+
+// NewLeaseElector creates an elector that holds the lease under key for duration, renewing it on every campaign
+func NewLeaseElector(store LeaseStore, key, id string, duration time.Duration) *LeaseElector {
+	return &LeaseElector{
+		store:    store,
+		key:      key,
+		id:       id,
+		duration: duration,
+	}
+}
+
+// Campaign acquires the lease if it is free or expired, or renews it if we already hold it
+func (e *LeaseElector) Campaign(ctx context.Context) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Measure the deadline from before the write so our view of the lease never outlives the stored one
+	start := time.Now()
+
+	current, err := e.store.Get(ctx, e.key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read lease %s: %w", e.key, err)
+	}
+
+	var prevVersion uint64
+	if current != nil {
+		prevVersion = current.Version
+		if current.Holder != "" && current.Holder != e.id && start.Before(current.Expires) {
+			e.heldUntil = time.Time{}
+			return false, nil
+		}
+	}
+
+	next := Lease{
+		Holder:  e.id,
+		Expires: start.Add(e.duration),
+		Version: prevVersion + 1,
+	}
+
+	ok, err := e.store.CompareAndSwap(ctx, e.key, prevVersion, next)
+	if err != nil {
+		return false, fmt.Errorf("failed to write lease %s: %w", e.key, err)
+	}
+	if !ok {
+		// Another candidate won the race for this version
+		e.heldUntil = time.Time{}
+		return false, nil
+	}
+
+	e.version = next.Version
+	e.heldUntil = start.Add(e.duration)
+
+	return true, nil
+}
+
+// Resign releases the lease if we hold it
+func (e *LeaseElector) Resign(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.heldUntil.IsZero() {
+		return nil
+	}
+	e.heldUntil = time.Time{}
+
+	released := Lease{
+		Expires: time.Now(),
+		Version: e.version + 1,
+	}
+
+	if _, err := e.store.CompareAndSwap(ctx, e.key, e.version, released); err != nil {
+		return fmt.Errorf("failed to release lease %s: %w", e.key, err)
+	}
+
+	return nil
+}
+
+// Observe returns the holder of the lease if it has not expired
+func (e *LeaseElector) Observe(ctx context.Context) (string, error) {
+	current, err := e.store.Get(ctx, e.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to read lease %s: %w", e.key, err)
+	}
+
+	if current == nil || current.Holder == "" || time.Now().After(current.Expires) {
+		return "", ErrNoLeader
+	}
+
+	return current.Holder, nil
+}
+
+// HoldsLease reports whether the lease we last acquired or renewed is still valid
+func (e *LeaseElector) HoldsLease() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return !e.heldUntil.IsZero() && time.Now().Before(e.heldUntil)
+}
+
+// MemoryLeaseStore is an in-process LeaseStore for tests
+type MemoryLeaseStore struct {
+	mu     sync.Mutex
+	leases map[string]Lease
+}
+
+var _ LeaseStore = (*MemoryLeaseStore)(nil)
+
+// NewMemoryLeaseStore creates an empty in-process lease store
+func NewMemoryLeaseStore() *MemoryLeaseStore {
+	return &MemoryLeaseStore{
+		leases: make(map[string]Lease),
+	}
+}
+
+// Get returns the lease stored under key
+func (s *MemoryLeaseStore) Get(_ context.Context, key string) (*Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease, ok := s.leases[key]
+	if !ok {
+		return nil, nil //nolint:nilnil // no lease has been written
+	}
+	return &lease, nil
+}
+
+// CompareAndSwap writes next if the stored version matches prevVersion
+func (s *MemoryLeaseStore) CompareAndSwap(_ context.Context, key string, prevVersion uint64, next Lease) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.leases[key].Version != prevVersion {
+		return false, nil
+	}
+
+	s.leases[key] = next
+	return true, nil
+}
+
+// acquireLease campaigns until this node holds the lease or it can no longer be waited for.
+// Electors without a lease are always considered to hold it.
+func (lf *LeaderFailover) acquireLease(ctx context.Context) error {
+	guard, ok := lf.elector.(LeaseGuard)
+	if !ok || guard.HoldsLease() {
+		return nil
+	}
+
+	deadline := time.Now().Add(lf.config.LeaseDuration)
+	ticker := time.NewTicker(lf.config.LeaderCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		leader, err := lf.elector.Campaign(ctx)
+		if err != nil {
+			lf.logger.Warn().Err(err).Msg("Failed to campaign for lease")
+		} else if leader {
+			lf.logger.Info().Msg("Acquired leadership lease")
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: timed out after %s", ErrLeaseNotHeld, lf.config.LeaseDuration)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-lf.stopCh:
+			return ErrLeaseNotHeld
+		case <-ticker.C:
+		}
+	}
+}
+
+// renewLease renews the leadership lease, if the elector uses one, before a failover
+// step changes AWS state, as a promotion may outlast the lease duration. A lease taken
+// by another node steps this node down.
+func (lf *LeaderFailover) renewLease(ctx context.Context) error {
+	if _, ok := lf.elector.(LeaseGuard); !ok {
+		return nil
+	}
+
+	leader, err := lf.elector.Campaign(ctx)
+	if err != nil {
+		// The lease is still ours until it lapses
+		lf.logger.Warn().Err(err).Msg("Failed to renew lease")
+		if err := lf.checkLease(); err != nil {
+			lf.stepDown("leadership lease lapsed")
+			return err
+		}
+		return nil
+	}
+	if !leader {
+		lf.stepDown("leadership lease taken by another node")
+		return fmt.Errorf("%w: taken by another node", ErrLeaseNotHeld)
+	}
+
+	return nil
+}
+
+// checkLease verifies this node holds the leadership lease, if the elector uses one
+func (lf *LeaderFailover) checkLease() error {
+	guard, ok := lf.elector.(LeaseGuard)
+	if !ok || guard.HoldsLease() {
+		return nil
+	}
+	return ErrLeaseNotHeld
+}
@@ -0,0 +1,123 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DynamoDB attribute names used for lease items
+const (
+	leaseAttrKey     = "lease_key"
+	leaseAttrHolder  = "holder"
+	leaseAttrExpires = "expires_at"
+	leaseAttrVersion = "version"
+)
+
+// DynamoDBLeaseStore stores leases in a DynamoDB table keyed by the string attribute "lease_key",
+// using conditional writes for compare-and-swap
+type DynamoDBLeaseStore struct {
+	client *dynamodb.Client
+	table  string
+}
+
+var _ LeaseStore = (*DynamoDBLeaseStore)(nil)
+
+// NewDynamoDBLeaseStore creates a lease store for the given table. A non-empty
+// endpoint overrides the DynamoDB endpoint, for example to use DynamoDB Local.
+func NewDynamoDBLeaseStore(ctx context.Context, table, endpoint string) (*DynamoDBLeaseStore, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+
+	return &DynamoDBLeaseStore{
+		client: client,
+		table:  table,
+	}, nil
+}
+
+// Get reads the lease with a strongly consistent read
+func (s *DynamoDBLeaseStore) Get(ctx context.Context, key string) (*Lease, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]types.AttributeValue{
+			leaseAttrKey: &types.AttributeValueMemberS{Value: key},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lease item: %w", err)
+	}
+
+	if len(result.Item) == 0 {
+		return nil, nil //nolint:nilnil // no lease has been written
+	}
+
+	lease := &Lease{}
+	if v, ok := result.Item[leaseAttrHolder].(*types.AttributeValueMemberS); ok {
+		lease.Holder = v.Value
+	}
+	if v, ok := result.Item[leaseAttrExpires].(*types.AttributeValueMemberN); ok {
+		nanos, err := strconv.ParseInt(v.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lease expiry %q: %w", v.Value, err)
+		}
+		lease.Expires = time.Unix(0, nanos)
+	}
+	if v, ok := result.Item[leaseAttrVersion].(*types.AttributeValueMemberN); ok {
+		lease.Version, err = strconv.ParseUint(v.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lease version %q: %w", v.Value, err)
+		}
+	}
+
+	return lease, nil
+}
+
+// CompareAndSwap writes the lease conditionally on the stored version
+func (s *DynamoDBLeaseStore) CompareAndSwap(ctx context.Context, key string, prevVersion uint64, next Lease) (bool, error) {
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]types.AttributeValue{
+			leaseAttrKey:     &types.AttributeValueMemberS{Value: key},
+			leaseAttrHolder:  &types.AttributeValueMemberS{Value: next.Holder},
+			leaseAttrExpires: &types.AttributeValueMemberN{Value: strconv.FormatInt(next.Expires.UnixNano(), 10)},
+			leaseAttrVersion: &types.AttributeValueMemberN{Value: strconv.FormatUint(next.Version, 10)},
+		},
+	}
+
+	if prevVersion == 0 {
+		input.ConditionExpression = aws.String("attribute_not_exists(#key)")
+		input.ExpressionAttributeNames = map[string]string{"#key": leaseAttrKey}
+	} else {
+		input.ConditionExpression = aws.String("#version = :prev")
+		input.ExpressionAttributeNames = map[string]string{"#version": leaseAttrVersion}
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":prev": &types.AttributeValueMemberN{Value: strconv.FormatUint(prevVersion, 10)},
+		}
+	}
+
+	if _, err := s.client.PutItem(ctx, input); err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to put lease item: %w", err)
+	}
+
+	return true, nil
+}
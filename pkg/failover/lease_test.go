@@ -0,0 +1,181 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+const testLeaseKey = "pair"
+
+func TestLeaseElectorAcquireAndRenew(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryLeaseStore()
+	a := NewLeaseElector(store, testLeaseKey, "a", time.Minute)
+	b := NewLeaseElector(store, testLeaseKey, "b", time.Minute)
+
+	if a.HoldsLease() {
+		t.Fatal("lease held before any campaign")
+	}
+	if leader, err := a.Campaign(ctx); err != nil || !leader {
+		t.Fatalf("acquire: got %t, %v, want leader", leader, err)
+	}
+	if !a.HoldsLease() {
+		t.Fatal("lease not held after acquiring it")
+	}
+	acquired, _ := store.Get(ctx, testLeaseKey)
+	if acquired.Holder != "a" || acquired.Version != 1 {
+		t.Fatalf("acquired lease: got %+v, want holder a at version 1", acquired)
+	}
+
+	if leader, err := b.Campaign(ctx); err != nil || leader {
+		t.Fatalf("campaign against a held lease: got %t, %v, want not leader", leader, err)
+	}
+	if b.HoldsLease() {
+		t.Fatal("lease held by the node that lost the campaign")
+	}
+	if observed, err := b.Observe(ctx); err != nil || observed != "a" {
+		t.Fatalf("observe: got %q, %v, want a", observed, err)
+	}
+
+	if leader, err := a.Campaign(ctx); err != nil || !leader {
+		t.Fatalf("renew: got %t, %v, want leader", leader, err)
+	}
+	renewed, _ := store.Get(ctx, testLeaseKey)
+	if renewed.Holder != "a" || renewed.Version != 2 || renewed.Expires.Before(acquired.Expires) {
+		t.Fatalf("renewed lease: got %+v, want holder a at version 2 expiring after %s", renewed, acquired.Expires)
+	}
+
+	if err := a.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if a.HoldsLease() {
+		t.Fatal("lease held after resigning")
+	}
+	if _, err := b.Observe(ctx); !errors.Is(err, ErrNoLeader) {
+		t.Fatalf("observe released lease: got %v, want ErrNoLeader", err)
+	}
+	if leader, err := b.Campaign(ctx); err != nil || !leader {
+		t.Fatalf("acquire released lease: got %t, %v, want leader", leader, err)
+	}
+}
+
+func TestLeaseElectorExpiredTakeover(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryLeaseStore()
+	a := NewLeaseElector(store, testLeaseKey, "a", time.Minute)
+	b := NewLeaseElector(store, testLeaseKey, "b", time.Minute)
+
+	if leader, err := a.Campaign(ctx); err != nil || !leader {
+		t.Fatalf("acquire: got %t, %v, want leader", leader, err)
+	}
+
+	// a stops renewing and its lease runs out
+	expired := Lease{Holder: "a", Expires: time.Now().Add(-time.Second), Version: 2}
+	if ok, err := store.CompareAndSwap(ctx, testLeaseKey, 1, expired); err != nil || !ok {
+		t.Fatalf("expire lease: got %t, %v", ok, err)
+	}
+	if _, err := b.Observe(ctx); !errors.Is(err, ErrNoLeader) {
+		t.Fatalf("observe expired lease: got %v, want ErrNoLeader", err)
+	}
+
+	if leader, err := b.Campaign(ctx); err != nil || !leader {
+		t.Fatalf("take over expired lease: got %t, %v, want leader", leader, err)
+	}
+	if current, _ := store.Get(ctx, testLeaseKey); current.Holder != "b" || current.Version != 3 {
+		t.Fatalf("taken over lease: got %+v, want holder b at version 3", current)
+	}
+
+	if leader, err := a.Campaign(ctx); err != nil || leader {
+		t.Fatalf("former holder campaigning: got %t, %v, want not leader", leader, err)
+	}
+	if a.HoldsLease() {
+		t.Fatal("former holder still holds the lease")
+	}
+}
+
+func TestLeaseStaleVersionRejected(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryLeaseStore()
+	a := NewLeaseElector(store, testLeaseKey, "a", time.Minute)
+	b := NewLeaseElector(store, testLeaseKey, "b", time.Minute)
+
+	if leader, err := a.Campaign(ctx); err != nil || !leader {
+		t.Fatalf("acquire: got %t, %v, want leader", leader, err)
+	}
+
+	// A write for an absent lease and a write from an older version both lose
+	if ok, err := store.CompareAndSwap(ctx, testLeaseKey, 0, Lease{Holder: "b", Version: 1}); err != nil || ok {
+		t.Fatalf("create over an existing lease: got %t, %v, want rejected", ok, err)
+	}
+	expired := Lease{Holder: "a", Expires: time.Now().Add(-time.Second), Version: 2}
+	if ok, err := store.CompareAndSwap(ctx, testLeaseKey, 1, expired); err != nil || !ok {
+		t.Fatalf("expire lease: got %t, %v", ok, err)
+	}
+	if ok, err := store.CompareAndSwap(ctx, testLeaseKey, 1, Lease{Holder: "b", Version: 2}); err != nil || ok {
+		t.Fatalf("write from a stale version: got %t, %v, want rejected", ok, err)
+	}
+
+	// The former holder resigning after the takeover must not release the new holder's lease
+	if leader, err := b.Campaign(ctx); err != nil || !leader {
+		t.Fatalf("take over expired lease: got %t, %v, want leader", leader, err)
+	}
+	if err := a.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if observed, err := a.Observe(ctx); err != nil || observed != "b" {
+		t.Fatalf("observe after stale resign: got %q, %v, want b", observed, err)
+	}
+}
+
+func TestLeaseRenewedBetweenSteps(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryLeaseStore()
+	lf := newTestFailover(t, newTestCloud(), "i-b", func(config *LeaderConfig) {
+		config.ElectionBackend = ElectionBackendLease
+		config.LeaseStore = store
+	})
+
+	if leader, err := lf.elector.Campaign(ctx); err != nil || !leader {
+		t.Fatalf("acquire: got %t, %v, want leader", leader, err)
+	}
+	acquired, _ := store.Get(ctx, testENIIP)
+
+	applied := 0
+	step := &failoverStep{
+		action:   ActionMoveEIP,
+		resource: "eipalloc-1",
+		verify: func(context.Context) (bool, error) {
+			return applied > 0, nil
+		},
+		apply: func(context.Context) error {
+			applied++
+			return nil
+		},
+		optional: true,
+	}
+
+	if err := lf.runStep(ctx, step); err != nil {
+		t.Fatal(err)
+	}
+	if renewed, _ := store.Get(ctx, testENIIP); renewed.Version != acquired.Version+1 {
+		t.Fatalf("lease version after a step: got %d, want %d", renewed.Version, acquired.Version+1)
+	}
+
+	// Another node takes the lease while the failover is running
+	current, _ := store.Get(ctx, testENIIP)
+	stolen := Lease{Holder: "i-a", Expires: time.Now().Add(time.Minute), Version: current.Version + 1}
+	if ok, err := store.CompareAndSwap(ctx, testENIIP, current.Version, stolen); err != nil || !ok {
+		t.Fatalf("take lease: got %t, %v", ok, err)
+	}
+
+	applied = 0
+	err := lf.runStep(ctx, step)
+	if !errors.Is(err, ErrLeaseNotHeld) {
+		t.Fatalf("step after losing the lease: got %v, want ErrLeaseNotHeld", err)
+	}
+	if applied != 0 {
+		t.Fatalf("step applied %d time(s) without the lease", applied)
+	}
+}
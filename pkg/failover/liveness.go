@@ -0,0 +1,148 @@
+package failover
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Liveness protocols the nodes of a pair use to detect each other's failure
+const (
+	LivenessFRPC = "frpc" // heartbeat requests over the fRPC channel
+	LivenessBFD  = "bfd"  // BFD control packets over UDP
+)
+
+// newBFDEndpoint creates the BFD endpoint for the configured peer addresses, or returns
+// nil when the nodes heartbeat over fRPC
+func newBFDEndpoint(config *LeaderConfig, peerPaths []string) (*BFDEndpoint, error) {
+	if config.LivenessProtocol != LivenessBFD {
+		return nil, nil //nolint:nilnil // BFD is disabled
+	}
+
+	var key []byte
+	if config.BFDAuthKeyFile != "" {
+		contents, err := os.ReadFile(config.BFDAuthKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read BFD authentication key: %w", err)
+		}
+		key = bytes.TrimSpace(contents)
+		if len(key) == 0 {
+			return nil, fmt.Errorf("BFD authentication key file %s is empty", config.BFDAuthKeyFile)
+		}
+	}
+
+	// BFD runs alongside fRPC on every path to the peer, on its own port
+	peers := make([]string, 0, len(peerPaths))
+	for _, path := range peerPaths {
+		host, _, err := net.SplitHostPort(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w %s: %w", ErrInvalidPeerAddr, path, err)
+		}
+		peers = append(peers, net.JoinHostPort(host, strconv.Itoa(int(config.BFDPeerPort))))
+	}
+
+	return NewBFDEndpoint(fmt.Sprintf(":%d", config.BFDPort), peers, BFDConfig{
+		DesiredMinTx:     config.BFDDesiredMinTx,
+		RequiredMinRx:    config.BFDRequiredMinRx,
+		DetectMultiplier: config.BFDDetectMultiplier,
+		AuthKeyID:        config.BFDAuthKeyID,
+		AuthKey:          key,
+		PacketLoss:       config.BFDPacketLoss,
+	}, config.Logger)
+}
+
+// stopBFD tells the peer this node is going down and closes the BFD endpoint
+func (lf *LeaderFailover) stopBFD() error {
+	if lf.bfd == nil {
+		return nil
+	}
+	if err := lf.bfd.Close(); err != nil {
+		return fmt.Errorf("failed to close BFD endpoint: %w", err)
+	}
+	return nil
+}
+
+// bfdSessionStats returns the state of the BFD sessions, nil when BFD is not used
+func (lf *LeaderFailover) bfdSessionStats() []BFDSessionStats {
+	if lf.bfd == nil {
+		return nil
+	}
+	return lf.bfd.Stats()
+}
+
+// bfdLivenessLoop tracks the peer through the BFD sessions in place of fRPC heartbeats.
+// The sessions run in both roles; an unhealthy primary takes them administratively down
+// so the secondary takes over, and a secondary promotes once every session is down and
+// the primary stayed silent for the detection time.
+func (lf *LeaderFailover) bfdLivenessLoop(ctx context.Context, stopCh <-chan struct{}, role NodeRole) {
+	ticker := time.NewTicker(lf.config.BFDRequiredMinRx)
+	defer ticker.Stop()
+
+	lf.logger.Info().
+		Str("role", role.String()).
+		Str("required_min_rx", lf.config.BFDRequiredMinRx.String()).
+		Int("detect_multiplier", int(lf.config.BFDDetectMultiplier)).
+		Msg("Starting BFD liveness tracking")
+
+	// After a refused promotion the sessions stay down, retry at the slow interval
+	var nextAttempt time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-lf.stopCh:
+			return
+		case <-stopCh:
+			return
+		case <-lf.bfd.Changes():
+		case <-ticker.C:
+		}
+
+		lf.bfd.SetAdminDown(role == RolePrimary && lf.heartbeatsSuppressed())
+
+		up := lf.bfd.Up()
+		detectTime := lf.bfd.DetectTime()
+
+		lf.heartbeatMutex.Lock()
+		if received := lf.bfd.LastReceived(); received.After(lf.lastHeartbeat) {
+			lf.lastHeartbeat = received
+		}
+		timeSinceLastHeartbeat := time.Since(lf.lastHeartbeat)
+		if up {
+			lf.missedHeartbeats = 0
+		} else if timeSinceLastHeartbeat > lf.config.BFDRequiredMinRx {
+			lf.missedHeartbeats++
+		}
+		lf.emitHeartbeatMetrics(lf.missedHeartbeats, nil)
+		emitBFDMetrics(up)
+
+		if role != RoleSecondary || up || timeSinceLastHeartbeat <= detectTime || time.Now().Before(nextAttempt) {
+			lf.heartbeatMutex.Unlock()
+			continue
+		}
+
+		lf.logger.Error().
+			Str("time_since_last", timeSinceLastHeartbeat.String()).
+			Str("detect_time", detectTime.String()).
+			Msg("BFD sessions to primary are down, initiating failover")
+
+		inputs := &JournalInputs{
+			MissedHeartbeats: lf.missedHeartbeats,
+			LastHeartbeatAge: timeSinceLastHeartbeat,
+		}
+
+		// Reset before unlock to avoid race
+		lf.missedHeartbeats = 0
+		lf.heartbeatMutex.Unlock()
+
+		if lf.requestPromotion(ctx, "primary failed: BFD sessions down for "+timeSinceLastHeartbeat.Round(time.Millisecond).String(), inputs) {
+			return
+		}
+		nextAttempt = time.Now().Add(max(detectTime, bfdSlowInterval))
+	}
+}
@@ -0,0 +1,70 @@
+package failover
+
+import (
+	"fmt"
+	"time"
+
+	metrics "github.com/hashicorp/go-metrics/compat"
+)
+
+// Metrics are aggregated in memory for the control API over these intervals
+const (
+	metricsInterval = 10 * time.Second
+	metricsRetain   = time.Minute
+)
+
+// metricsServiceName prefixes every metric emitted by the failover daemon
+const metricsServiceName = "failover"
+
+// newMetrics installs the global metrics sink shared with the raft elector. Metrics are
+// kept in memory for the control API and also sent to the configured sink, if any.
+func newMetrics(sinkURL string) (*metrics.InmemSink, error) {
+	inmem := metrics.NewInmemSink(metricsInterval, metricsRetain)
+
+	sinks := metrics.FanoutSink{inmem}
+	if sinkURL != "" {
+		sink, err := metrics.NewMetricSinkFromURL(sinkURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create metrics sink %s: %w", sinkURL, err)
+		}
+		sinks = append(sinks, sink)
+	}
+
+	conf := metrics.DefaultConfig(metricsServiceName)
+	conf.EnableHostname = false
+	if _, err := metrics.NewGlobal(conf, sinks); err != nil {
+		return nil, fmt.Errorf("failed to set up metrics: %w", err)
+	}
+
+	return inmem, nil
+}
+
+// emitHeartbeatMetrics records the secondary's view of the primary's heartbeats
+func (lf *LeaderFailover) emitHeartbeatMetrics(missed int, phi *PhiStats) {
+	metrics.SetGauge([]string{"heartbeat", "missed"}, float32(missed))
+	if phi == nil {
+		return
+	}
+	metrics.SetGauge([]string{"heartbeat", "phi"}, float32(phi.Phi))
+	metrics.SetGauge([]string{"heartbeat", "window", "samples"}, float32(phi.Samples))
+	metrics.SetGauge([]string{"heartbeat", "window", "mean_ms"}, float32(phi.Mean.Seconds()*1000))
+	metrics.SetGauge([]string{"heartbeat", "window", "std_dev_ms"}, float32(phi.StdDev.Seconds()*1000))
+}
+
+// emitBFDMetrics records whether a BFD session with the peer is up
+func emitBFDMetrics(up bool) {
+	var value float32
+	if up {
+		value = 1
+	}
+	metrics.SetGauge([]string{"bfd", "up"}, value)
+}
+
+// emitDriftMetrics counts a correction of a resource that drifted away from the primary
+func emitDriftMetrics(action string, repaired bool) {
+	outcome := "corrected"
+	if !repaired {
+		outcome = "failed"
+	}
+	metrics.IncrCounter([]string{"reconcile", outcome, action}, 1)
+}
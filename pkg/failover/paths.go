@@ -0,0 +1,369 @@
+package failover
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/multiformats/go-multiaddr"
+)
+
+var (
+	ErrInvalidPeerAddr  = errors.New("invalid peer address")
+	ErrPathReconnecting = errors.New("heartbeat path is reconnecting")
+)
+
+// PathStats describes the heartbeats over one network path to the peer
+type PathStats struct {
+	// Addr is the fRPC address heartbeats are sent to (primary) or were received on (secondary)
+	Addr string `json:"addr"`
+
+	// LastHeartbeat is the time the last heartbeat over the path was acknowledged or received
+	LastHeartbeat time.Time `json:"last_heartbeat,omitzero"`
+
+	// LastRTT is the round-trip time of the last acknowledged heartbeat (primary only)
+	LastRTT time.Duration `json:"last_rtt_ns,omitempty"`
+
+	// MissedHeartbeats is the current count of consecutive heartbeats missed on the path
+	MissedHeartbeats int `json:"missed_heartbeats"`
+
+	// LastError is the reason the last heartbeat over the path failed (primary only)
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Healthy reports whether the last heartbeat over the path got through
+func (s *PathStats) Healthy() bool {
+	return !s.LastHeartbeat.IsZero() && s.MissedHeartbeats == 0
+}
+
+// ParsePeerAddr converts a peer multiaddr such as /ip4/10.0.1.10/tcp/1022 or
+// /dns4/nat-b.internal/tcp/1022 to a host:port fRPC address. The port defaults
+// to defaultPort when the multiaddr has no tcp component.
+func ParsePeerAddr(s string, defaultPort uint16) (string, error) {
+	maddr, err := multiaddr.NewMultiaddr(s)
+	if err != nil {
+		return "", fmt.Errorf("%w %s: %w", ErrParsingMultiaddr, s, err)
+	}
+
+	var host, port string
+	for _, c := range maddr {
+		switch c.Code() {
+		case multiaddr.P_IP4, multiaddr.P_IP6, multiaddr.P_DNS, multiaddr.P_DNS4, multiaddr.P_DNS6:
+			host = c.Value()
+		case multiaddr.P_TCP:
+			port = c.Value()
+		default:
+			return "", fmt.Errorf("%w %s: unsupported protocol %s", ErrInvalidPeerAddr, s, c.Protocol().Name)
+		}
+	}
+	if host == "" {
+		return "", fmt.Errorf("%w %s: expected an ip4, ip6 or dns address", ErrInvalidPeerAddr, s)
+	}
+
+	return net.JoinHostPort(host, cmp.Or(port, strconv.Itoa(int(defaultPort)))), nil
+}
+
+// PeerPaths parses the configured peer addresses
+func (c *LeaderConfig) PeerPaths() ([]string, error) {
+	paths := make([]string, 0, len(c.PeerAddrs))
+	for _, s := range c.PeerAddrs {
+		addr, err := ParsePeerAddr(s, c.Port)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(paths, addr) {
+			return nil, fmt.Errorf("%w %s: duplicate of another peer address", ErrInvalidPeerAddr, s)
+		}
+		paths = append(paths, addr)
+	}
+	return paths, nil
+}
+
+// pathStatsLocked returns the tracking state of a path, the caller holds heartbeatMutex
+func (lf *LeaderFailover) pathStatsLocked(addr string) *PathStats {
+	stats, ok := lf.pathStats[addr]
+	if !ok {
+		stats = &PathStats{Addr: addr}
+		lf.pathStats[addr] = stats
+	}
+	return stats
+}
+
+// resetPathStatsLocked forgets the per-path tracking state, the caller holds heartbeatMutex
+func (lf *LeaderFailover) resetPathStatsLocked() {
+	lf.pathStats = make(map[string]*PathStats)
+}
+
+// pathStatsSnapshot returns a copy of the per-path tracking state ordered by address
+func (lf *LeaderFailover) pathStatsSnapshot() []PathStats {
+	lf.heartbeatMutex.Lock()
+	defer lf.heartbeatMutex.Unlock()
+
+	if len(lf.pathStats) == 0 {
+		return nil
+	}
+	paths := make([]PathStats, 0, len(lf.pathStats))
+	for _, addr := range slices.Sorted(maps.Keys(lf.pathStats)) {
+		paths = append(paths, *lf.pathStats[addr])
+	}
+	return paths
+}
+
+// preferredPeerPath returns the first configured path whose last heartbeat got through,
+// or the first configured path when none did
+func (lf *LeaderFailover) preferredPeerPath() string {
+	if len(lf.peerPaths) == 0 {
+		return ""
+	}
+
+	lf.heartbeatMutex.Lock()
+	defer lf.heartbeatMutex.Unlock()
+
+	for _, addr := range lf.peerPaths {
+		if stats, ok := lf.pathStats[addr]; ok && stats.Healthy() {
+			return addr
+		}
+	}
+	return lf.peerPaths[0]
+}
+
+// pathClient is the heartbeat client of one path. Each path dials in the background under
+// its own lock, so a path that does not answer never holds up the others.
+type pathClient struct {
+	mu     sync.Mutex
+	client *Client
+	err    error         // why the last dial failed
+	dialed chan struct{} // closed when the dial in progress finishes, nil when none is
+}
+
+// pathClient returns a connected client for a heartbeat path. A path without one starts
+// dialing and is waited for until ctx is done, a path still dialing since an earlier
+// heartbeat is skipped.
+func (lf *LeaderFailover) pathClient(ctx context.Context, addr string) (*Client, error) {
+	lf.pathMutex.Lock()
+	path, ok := lf.pathClients[addr]
+	if !ok {
+		path = &pathClient{}
+		lf.pathClients[addr] = path
+	}
+	lf.pathMutex.Unlock()
+
+	path.mu.Lock()
+	if clientConnected(path.client) {
+		defer path.mu.Unlock()
+		return path.client, nil
+	}
+	if path.dialed != nil {
+		path.mu.Unlock()
+		return nil, ErrPathReconnecting
+	}
+	if path.client != nil {
+		_ = path.client.Close()
+		path.client = nil
+	}
+	dialed := make(chan struct{})
+	path.dialed = dialed
+	path.mu.Unlock()
+
+	go lf.dialPath(addr, path, dialed)
+
+	select {
+	case <-dialed:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: %w", ErrPathReconnecting, ctx.Err())
+	}
+
+	path.mu.Lock()
+	defer path.mu.Unlock()
+	if path.client == nil {
+		return nil, path.err
+	}
+	return path.client, nil
+}
+
+// dialPath connects the client of a path and signals dialed when done
+func (lf *LeaderFailover) dialPath(addr string, path *pathClient, dialed chan struct{}) {
+	c, err := lf.dialPeerClient(addr)
+
+	lf.pathMutex.Lock()
+	defer lf.pathMutex.Unlock()
+	path.mu.Lock()
+	defer path.mu.Unlock()
+
+	// The paths were closed while dialing, so the client has no owner
+	if err == nil && lf.pathClients[addr] != path {
+		_ = c.Close()
+		c, err = nil, fmt.Errorf("heartbeat path %s: %w", addr, net.ErrClosed)
+	}
+
+	path.client, path.err = c, err
+	path.dialed = nil
+	close(dialed)
+}
+
+// closePathClients closes the heartbeat clients of every path
+func (lf *LeaderFailover) closePathClients() {
+	lf.pathMutex.Lock()
+	defer lf.pathMutex.Unlock()
+
+	for addr, path := range lf.pathClients {
+		path.mu.Lock()
+		if path.client != nil {
+			if err := path.client.Close(); err != nil {
+				lf.logger.Debug().Err(err).Str("path", addr).Msg("Error closing heartbeat path client")
+			}
+			path.client = nil
+		}
+		path.mu.Unlock()
+	}
+	clear(lf.pathClients)
+}
+
+// sendPathHeartbeats sends the same heartbeat over every configured path. The secondary
+// has only missed the heartbeat when it failed on all of them.
+func (lf *LeaderFailover) sendPathHeartbeats(ctx context.Context) error {
+	request := lf.nextHeartbeat()
+
+	hbCtx, cancel := context.WithTimeout(ctx, lf.config.HeartbeatInterval)
+	defer cancel()
+
+	type pathResult struct {
+		i   int
+		rtt time.Duration
+		err error
+	}
+	results := make(chan pathResult, len(lf.peerPaths))
+	for i, addr := range lf.peerPaths {
+		go func() {
+			rtt, err := lf.sendPathHeartbeat(hbCtx, addr, request)
+			results <- pathResult{i: i, rtt: rtt, err: err}
+		}()
+	}
+
+	// A path that has not answered within the interval missed this heartbeat, the others
+	// are not held up waiting for it
+	rtts := make([]time.Duration, len(lf.peerPaths))
+	errs := make([]error, len(lf.peerPaths))
+	for i := range errs {
+		errs[i] = fmt.Errorf("heartbeat %d: %w", request.Sequence, context.DeadlineExceeded)
+	}
+collect:
+	for range lf.peerPaths {
+		select {
+		case result := <-results:
+			rtts[result.i], errs[result.i] = result.rtt, result.err
+		case <-hbCtx.Done():
+			break collect
+		}
+	}
+
+	lf.heartbeatMutex.Lock()
+	defer lf.heartbeatMutex.Unlock()
+
+	now := time.Now()
+	delivered := false
+	for i, addr := range lf.peerPaths {
+		stats := lf.pathStatsLocked(addr)
+		if errs[i] != nil {
+			if stats.Healthy() {
+				lf.logger.Warn().Err(errs[i]).Str("path", addr).Msg("Heartbeat path down")
+			}
+			stats.MissedHeartbeats++
+			stats.LastError = errs[i].Error()
+			continue
+		}
+
+		if stats.MissedHeartbeats > 0 && !stats.LastHeartbeat.IsZero() {
+			lf.logger.Info().
+				Str("path", addr).
+				Int("missed_count", stats.MissedHeartbeats).
+				Msg("Heartbeat path recovered")
+		}
+		stats.LastHeartbeat = now
+		stats.LastRTT = rtts[i]
+		stats.MissedHeartbeats = 0
+		stats.LastError = ""
+
+		if !delivered || rtts[i] < lf.heartbeatRTT {
+			lf.heartbeatRTT = rtts[i]
+		}
+		delivered = true
+	}
+
+	if !delivered {
+		lf.missedHeartbeats++
+		return fmt.Errorf("heartbeat %d failed on all %d paths: %w", request.Sequence, len(lf.peerPaths), errors.Join(errs...))
+	}
+
+	lf.lastHeartbeat = now
+	lf.missedHeartbeats = 0
+
+	lf.logger.Trace().
+		Uint64("sequence", request.Sequence).
+		Str("rtt", lf.heartbeatRTT.String()).
+		Msg("Heartbeat acknowledged")
+
+	return nil
+}
+
+// sendPathHeartbeat sends a heartbeat over one path and returns its round-trip time
+func (lf *LeaderFailover) sendPathHeartbeat(ctx context.Context, addr string, heartbeat *FailoverHeartbeatRequest) (time.Duration, error) {
+	c, err := lf.pathClient(ctx, addr)
+	if err != nil {
+		return 0, err
+	}
+
+	request := *heartbeat
+	request.Path = addr
+
+	sent := time.Now()
+	response, err := rpcResponse(c.FailoverService.Heartbeat(ctx, &request))
+	if err != nil {
+		return 0, fmt.Errorf("heartbeat %d failed: %w", request.Sequence, err)
+	}
+	if err := lf.checkHeartbeatResponse(response, request.Sequence); err != nil {
+		return 0, err
+	}
+
+	return time.Since(sent), nil
+}
+
+// recordPathHeartbeatLocked updates the tracking state of the path a heartbeat from the
+// primary arrived on, the caller holds heartbeatMutex
+func (lf *LeaderFailover) recordPathHeartbeatLocked(addr string) {
+	stats := lf.pathStatsLocked(addr)
+	if stats.MissedHeartbeats >= lf.config.HeartbeatMissThreshold {
+		lf.logger.Info().
+			Str("path", addr).
+			Int("missed_count", stats.MissedHeartbeats).
+			Msg("Heartbeat path recovered")
+	}
+	stats.LastHeartbeat = time.Now()
+	stats.MissedHeartbeats = 0
+}
+
+// checkPathsLocked counts missed heartbeats on each path the primary has used, so a
+// secondary can report a path that went quiet while others still deliver heartbeats.
+// The caller holds heartbeatMutex.
+func (lf *LeaderFailover) checkPathsLocked() {
+	for _, addr := range slices.Sorted(maps.Keys(lf.pathStats)) {
+		stats := lf.pathStats[addr]
+		if time.Since(stats.LastHeartbeat) <= lf.config.HeartbeatInterval {
+			continue
+		}
+		stats.MissedHeartbeats++
+		if stats.MissedHeartbeats == lf.config.HeartbeatMissThreshold {
+			lf.logger.Warn().
+				Str("path", addr).
+				Int("missed_count", stats.MissedHeartbeats).
+				Msg("Heartbeat path down")
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blackhole accepts connections on loopback and never answers on them, like a path whose
+// far end stopped responding. It returns the peer multiaddr of the listener.
+func blackhole(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	t.Cleanup(func() {
+		_ = listener.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	})
+
+	return "/ip4/127.0.0.1/tcp/" + strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestPathHeartbeatsSkipBlackholedPath(t *testing.T) {
+	ctx := context.Background()
+	ca := newTestCA(t)
+	cloud := newTestCloud()
+	port := freeTCPPort(t)
+	interval := 200 * time.Millisecond
+
+	// With mutual TLS, dialing the blackholed path hangs in the handshake
+	secondaryCert, secondaryKey := ca.issue(t, 10, "node-b")
+	secondaryTLS := newTestTLSConfig(t, ca, secondaryCert, secondaryKey)
+	secondary := newTestFailover(t, cloud, "i-b", func(config *LeaderConfig) {
+		config.TLSCAFile, config.TLSCertFile, config.TLSKeyFile = secondaryTLS.TLSCAFile, secondaryTLS.TLSCertFile, secondaryTLS.TLSKeyFile
+		config.Port = port
+	})
+	secondary.currentRole.Store(RoleSecondary)
+	if err := secondary.startFRPCServer(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = secondary.stopFRPCServer() })
+
+	primaryCert, primaryKey := ca.issue(t, 11, "node-a")
+	healthy := "/ip4/127.0.0.1/tcp/" + strconv.Itoa(int(port))
+	primaryTLS := newTestTLSConfig(t, ca, primaryCert, primaryKey)
+	primary := newTestFailover(t, cloud, "i-a", func(config *LeaderConfig) {
+		config.TLSCAFile, config.TLSCertFile, config.TLSKeyFile = primaryTLS.TLSCAFile, primaryTLS.TLSCertFile, primaryTLS.TLSKeyFile
+		config.HeartbeatInterval = interval
+		config.PeerAddrs = []string{blackhole(t), healthy}
+	})
+	primary.currentRole.Store(RolePrimary)
+	primary.currentENI.Store("eni-a")
+	t.Cleanup(primary.closePathClients)
+
+	for i := range 3 {
+		sent := time.Now()
+		if err := primary.sendHeartbeat(ctx); err != nil {
+			t.Fatalf("heartbeat %d: %v", i+1, err)
+		}
+		if elapsed := time.Since(sent); elapsed > 2*interval {
+			t.Fatalf("heartbeat %d took %s, the blackholed path held it up", i+1, elapsed)
+		}
+	}
+
+	paths := primary.pathStatsSnapshot()
+	stats := make(map[string]PathStats, len(paths))
+	for _, path := range paths {
+		stats[path.Addr] = path
+	}
+	down := stats[primary.peerPaths[0]]
+	if down.Healthy() || down.MissedHeartbeats != 3 {
+		t.Fatalf("blackholed path: got %+v, want 3 missed heartbeats", down)
+	}
+	if up := stats[primary.peerPaths[1]]; !up.Healthy() {
+		t.Fatalf("healthy path: got %+v, want its heartbeats acknowledged", up)
+	}
+	if secondary.GetHeartbeatStats().Sequence != 3 {
+		t.Fatalf("secondary received sequence %d, want 3", secondary.GetHeartbeatStats().Sequence)
+	}
+
+	// The dial started by the first heartbeat is still running, later heartbeats skip the path
+	if _, err := primary.pathClient(ctx, primary.peerPaths[0]); !errors.Is(err, ErrPathReconnecting) {
+		t.Fatalf("blackholed path client: got %v, want ErrPathReconnecting", err)
+	}
+}
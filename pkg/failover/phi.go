@@ -0,0 +1,152 @@
+package failover
+
+import (
+	"math"
+	"time"
+)
+
+// Failure detectors deciding when the primary is down
+const (
+	FailureDetectorCounter = "counter" // a fixed number of consecutive missed heartbeats
+	FailureDetectorPhi     = "phi"     // phi accrual over the observed heartbeat inter-arrival times
+)
+
+// PhiStats describes the state of the phi accrual failure detector
+type PhiStats struct {
+	// Phi is the current suspicion level that the primary has failed
+	Phi       float64 `json:"phi"`
+	Threshold float64 `json:"threshold"`
+
+	// Inter-arrival times of the heartbeats in the sliding window
+	Samples int           `json:"samples"`
+	Mean    time.Duration `json:"mean_ns"`
+	StdDev  time.Duration `json:"std_dev_ns"`
+}
+
+// phiStatsLocked returns the current state of the phi accrual detector, or nil when the
+// counter detector is used. The caller holds heartbeatMutex.
+func (lf *LeaderFailover) phiStatsLocked() *PhiStats {
+	if lf.phi == nil {
+		return nil
+	}
+	stats := lf.phi.stats(lf.config.PhiThreshold)
+	return &stats
+}
+
+// primarySuspectedLocked reports whether the failure detector considers the primary down,
+// given the phi accrual detector state when it is used. The caller holds heartbeatMutex.
+func (lf *LeaderFailover) primarySuspectedLocked(phi *PhiStats) bool {
+	if phi != nil {
+		return phi.Phi >= phi.Threshold
+	}
+	return lf.missedHeartbeats >= lf.config.HeartbeatMissThreshold
+}
+
+// phiDetector is a phi accrual failure detector (Hayashibara et al.). It keeps a sliding
+// window of heartbeat inter-arrival times and expresses how unlikely the time since the
+// last heartbeat is under their normal distribution as phi = -log10(P(later arrival)).
+type phiDetector struct {
+	window    []float64 // inter-arrival times in milliseconds, used as a ring buffer
+	next      int
+	count     int
+	sum       float64
+	sumSquare float64
+
+	// Arrival time of the last heartbeat, or when tracking started
+	last    time.Time
+	started bool
+
+	// Distribution assumed until the window has samples, and the floor for its deviation
+	expected  time.Duration
+	minStdDev time.Duration
+
+	// Clock the arrivals and the time since the last one are read from
+	now func() time.Time
+}
+
+// newPhiDetector creates a detector with a window of size samples, expecting heartbeats
+// every interval until it has observed some
+func newPhiDetector(size int, interval, minStdDev time.Duration) *phiDetector {
+	return &phiDetector{
+		window:    make([]float64, size),
+		expected:  interval,
+		minStdDev: minStdDev,
+		now:       time.Now,
+	}
+}
+
+// reset forgets the observed heartbeats and measures the next one from now
+func (d *phiDetector) reset() {
+	clear(d.window)
+	d.next = 0
+	d.count = 0
+	d.sum = 0
+	d.sumSquare = 0
+	d.last = d.now()
+	d.started = false
+}
+
+// heartbeat records the arrival of a heartbeat. The first one after a reset only starts
+// the measurement, its delay includes the primary starting up.
+func (d *phiDetector) heartbeat() {
+	now := d.now()
+	if d.started {
+		d.add(float64(now.Sub(d.last)) / float64(time.Millisecond))
+	}
+	d.last = now
+	d.started = true
+}
+
+// add records an inter-arrival time, evicting the oldest once the window is full
+func (d *phiDetector) add(interval float64) {
+	if d.count == len(d.window) {
+		evicted := d.window[d.next]
+		d.sum -= evicted
+		d.sumSquare -= evicted * evicted
+	} else {
+		d.count++
+	}
+	d.window[d.next] = interval
+	d.next = (d.next + 1) % len(d.window)
+	d.sum += interval
+	d.sumSquare += interval * interval
+}
+
+// distribution returns the mean and standard deviation of the inter-arrival times in milliseconds
+func (d *phiDetector) distribution() (float64, float64) {
+	minStdDev := float64(d.minStdDev) / float64(time.Millisecond)
+	if d.count == 0 {
+		return float64(d.expected) / float64(time.Millisecond), minStdDev
+	}
+
+	mean := d.sum / float64(d.count)
+	variance := max(d.sumSquare/float64(d.count)-mean*mean, 0)
+	return mean, max(math.Sqrt(variance), minStdDev)
+}
+
+// phi returns the current suspicion level that the peer has failed
+func (d *phiDetector) phi() float64 {
+	mean, stdDev := d.distribution()
+	elapsed := float64(d.now().Sub(d.last)) / float64(time.Millisecond)
+
+	// Logistic approximation of the normal cumulative distribution function
+	y := (elapsed - mean) / stdDev
+	e := math.Exp(-y * (1.5976 + 0.070566*y*y))
+	if elapsed > mean {
+		// Far beyond the mean e underflows, keep phi finite so it can be reported
+		return -math.Log10(max(e, math.SmallestNonzeroFloat64) / (1 + e))
+	}
+	return max(-math.Log10(1-1/(1+e)), 0)
+}
+
+// stats returns the current detector state
+func (d *phiDetector) stats(threshold float64) PhiStats {
+	mean, stdDev := d.distribution()
+	return PhiStats{
+		Phi:       d.phi(),
+		Threshold: threshold,
+		Samples:   d.count,
+		Mean:      time.Duration(mean * float64(time.Millisecond)),
+		StdDev:    time.Duration(stdDev * float64(time.Millisecond)),
+	}
+}
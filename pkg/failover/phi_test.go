@@ -0,0 +1,145 @@
+package failover
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// testClock is a clock that only moves when advanced
+type testClock struct {
+	t time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.t
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+// newTestPhiDetector creates a detector reading the time from clock
+func newTestPhiDetector(clock *testClock, size int, interval, minStdDev time.Duration) *phiDetector {
+	d := newPhiDetector(size, interval, minStdDev)
+	d.now = clock.Now
+	d.reset()
+	return d
+}
+
+// heartbeats feeds the detector one heartbeat after each interval
+func heartbeats(clock *testClock, d *phiDetector, intervals ...time.Duration) {
+	for _, interval := range intervals {
+		clock.Advance(interval)
+		d.heartbeat()
+	}
+}
+
+func TestPhiDetectorThreshold(t *testing.T) {
+	const threshold = 8
+	clock := &testClock{t: time.Unix(1_760_000_000, 0)}
+	d := newTestPhiDetector(clock, 100, 100*time.Millisecond, 10*time.Millisecond)
+
+	// Heartbeats every 95 to 105ms
+	heartbeats(clock, d, 0)
+	for range 20 {
+		heartbeats(clock, d, 95*time.Millisecond, 105*time.Millisecond)
+	}
+
+	stats := d.stats(threshold)
+	if stats.Samples != 40 || stats.Mean != 100*time.Millisecond || stats.StdDev != 10*time.Millisecond {
+		t.Fatalf("got %d samples, mean %s, deviation %s, want 40, 100ms and the 10ms floor", stats.Samples, stats.Mean, stats.StdDev)
+	}
+	if stats.Phi != 0 {
+		t.Fatalf("phi right after a heartbeat: got %f, want 0", stats.Phi)
+	}
+
+	// Phi grows with the silence, crosses the threshold between 4 and 7 deviations beyond
+	// the mean and stays finite once the probability underflows
+	tests := []struct {
+		elapsed   time.Duration
+		suspected bool
+	}{
+		{elapsed: 100 * time.Millisecond},
+		{elapsed: 120 * time.Millisecond},
+		{elapsed: 140 * time.Millisecond},
+		{elapsed: 170 * time.Millisecond, suspected: true},
+		{elapsed: time.Second, suspected: true},
+		{elapsed: time.Hour, suspected: true},
+	}
+	previous := 0.0
+	start := clock.Now()
+	for _, tt := range tests {
+		clock.t = start.Add(tt.elapsed)
+		phi := d.phi()
+		if phi < previous || math.IsInf(phi, 0) {
+			t.Fatalf("phi after %s: got %f, want a finite value of at least %f", tt.elapsed, phi, previous)
+		}
+		if suspected := phi >= threshold; suspected != tt.suspected {
+			t.Fatalf("phi after %s: got %f, want suspected %t", tt.elapsed, phi, tt.suspected)
+		}
+		previous = phi
+	}
+}
+
+func TestPhiDetectorMinStdDev(t *testing.T) {
+	clock := &testClock{t: time.Unix(1_760_000_000, 0)}
+
+	// Perfectly regular heartbeats have no deviation, so the floor alone decides how
+	// quickly a late heartbeat becomes suspicious
+	tight := newTestPhiDetector(clock, 10, 100*time.Millisecond, time.Millisecond)
+	loose := newTestPhiDetector(clock, 10, 100*time.Millisecond, 100*time.Millisecond)
+	for range 10 {
+		heartbeats(clock, tight, 0)
+		heartbeats(clock, loose, 0)
+		clock.Advance(100 * time.Millisecond)
+	}
+	heartbeats(clock, tight, 0)
+	heartbeats(clock, loose, 0)
+
+	if stats := loose.stats(8); stats.StdDev != 100*time.Millisecond {
+		t.Fatalf("deviation: got %s, want the 100ms floor", stats.StdDev)
+	}
+
+	clock.Advance(150 * time.Millisecond)
+	if phi := tight.phi(); phi < 8 {
+		t.Fatalf("phi 50ms late with a 1ms floor: got %f, want suspected", phi)
+	}
+	if phi := loose.phi(); phi >= 1 {
+		t.Fatalf("phi 50ms late with a 100ms floor: got %f, want below 1", phi)
+	}
+}
+
+func TestPhiDetectorWindow(t *testing.T) {
+	clock := &testClock{t: time.Unix(1_760_000_000, 0)}
+	d := newTestPhiDetector(clock, 4, 200*time.Millisecond, time.Millisecond)
+
+	// Without samples the configured interval is expected
+	if stats := d.stats(8); stats.Samples != 0 || stats.Mean != 200*time.Millisecond {
+		t.Fatalf("empty window: got %d samples with mean %s, want 0 and 200ms", stats.Samples, stats.Mean)
+	}
+
+	// The first heartbeat after a reset only starts the measurement
+	heartbeats(clock, d, 5*time.Second)
+	if stats := d.stats(8); stats.Samples != 0 {
+		t.Fatalf("samples after the first heartbeat: got %d, want 0", stats.Samples)
+	}
+
+	heartbeats(clock, d, 100*time.Millisecond, 100*time.Millisecond, 100*time.Millisecond)
+	if stats := d.stats(8); stats.Samples != 3 || stats.Mean != 100*time.Millisecond {
+		t.Fatalf("partial window: got %d samples with mean %s, want 3 and 100ms", stats.Samples, stats.Mean)
+	}
+
+	// Once full the oldest samples are evicted
+	heartbeats(clock, d, 300*time.Millisecond, 300*time.Millisecond, 300*time.Millisecond, 300*time.Millisecond)
+	if stats := d.stats(8); stats.Samples != 4 || stats.Mean != 300*time.Millisecond || stats.StdDev != time.Millisecond {
+		t.Fatalf("full window: got %d samples with mean %s and deviation %s, want 4, 300ms and 1ms", stats.Samples, stats.Mean, stats.StdDev)
+	}
+
+	// A reset forgets the samples and measures the silence from then
+	clock.Advance(time.Minute)
+	d.reset()
+	if stats := d.stats(8); stats.Samples != 0 || stats.Phi != 0 {
+		t.Fatalf("after reset: got %d samples and phi %f, want 0 and 0", stats.Samples, stats.Phi)
+	}
+}
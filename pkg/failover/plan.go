@@ -0,0 +1,245 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Dry run results of a planned change other than an error
+const (
+	DryRunPermitted   = "permitted"
+	DryRunUnsupported = "not supported"
+)
+
+// PlannedChange is a change a failover would make to the cloud, moving a resource from
+// one ENI to another
+type PlannedChange struct {
+	// Failover action making the change
+	Action string `json:"action"`
+
+	// Resource changed: the IP moved, the route table rewritten, the EIP allocation
+	// re-associated, or the ENI tagged with the epoch
+	Resource string `json:"resource"`
+
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+
+	DestinationCIDR string `json:"destination_cidr,omitempty"`
+	PrivateIP       string `json:"private_ip,omitempty"`
+	PublicIP        string `json:"public_ip,omitempty"`
+
+	// Result of validating the change without making it: permitted, not supported, or
+	// the error. Empty when no dry run was requested.
+	DryRun string `json:"dry_run,omitempty"`
+}
+
+// FailoverPlan is the set of changes a node would make to the cloud to become the primary
+type FailoverPlan struct {
+	Time            time.Time `json:"time"`
+	ENIIP           string    `json:"eni_ip"`
+	DestinationCIDR string    `json:"destination_cidr,omitempty"`
+
+	// ENI the pair's resources would move to and the instance it is attached to
+	TargetENI        string `json:"target_eni"`
+	TargetInstanceID string `json:"target_instance_id,omitempty"`
+
+	Resources *PairResources  `json:"resources"`
+	Changes   []PlannedChange `json:"changes"`
+	Warnings  []string        `json:"warnings,omitempty"`
+}
+
+// DryRunFailed reports whether validating any of the changes failed
+func (p *FailoverPlan) DryRunFailed() bool {
+	return slices.ContainsFunc(p.Changes, func(change PlannedChange) bool {
+		return change.DryRun != "" && change.DryRun != DryRunPermitted && change.DryRun != DryRunUnsupported
+	})
+}
+
+// PlanConfig configures planning a failover
+type PlanConfig struct {
+	ENIIP           string
+	DestinationCIDR string
+	Selector        ResourceSelector
+
+	// ENI to plan moving the resources to. Defaults to the first ENI of the instance the
+	// cloud provider acts for, the ENI TakeOverENI moves the ENI IP to.
+	TargetENI string
+
+	// Validate each change with the cloud provider, which must be a DryRunner
+	DryRun bool
+}
+
+// PlanFailover works out the changes executing a failover to the target ENI would make,
+// in the order they would be made, without making them
+func PlanFailover(ctx context.Context, cloud CloudProvider, config PlanConfig) (*FailoverPlan, error) {
+	var dryRunner DryRunner
+	if config.DryRun {
+		var ok bool
+		if dryRunner, ok = cloud.(DryRunner); !ok {
+			return nil, errors.New("cloud provider does not support dry runs")
+		}
+	}
+
+	resources, err := DiscoverResources(ctx, cloud, config.ENIIP, config.DestinationCIDR, config.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover resources: %w", err)
+	}
+
+	plan := &FailoverPlan{
+		Time:            time.Now(),
+		ENIIP:           config.ENIIP,
+		DestinationCIDR: config.DestinationCIDR,
+		Resources:       resources,
+	}
+
+	target, err := planTarget(ctx, cloud, config.TargetENI)
+	if err != nil {
+		return nil, err
+	}
+	if kinds := config.Selector.DefaultDiscovery(config.DestinationCIDR); len(kinds) > 0 {
+		plan.warn("resources of kind %s are found by the deprecated default discovery, select them explicitly", strings.Join(kinds, ","))
+	}
+	plan.TargetENI = target.ID
+	plan.TargetInstanceID = target.InstanceID
+	if target.SubnetID != resources.SubnetID {
+		plan.warn("target ENI %s is in subnet %s, not the pair's subnet %s", target.ID, target.SubnetID, resources.SubnetID)
+	}
+
+	if resources.PrimaryENI != target.ID {
+		plan.Changes = append(plan.Changes, PlannedChange{
+			Action:   ActionTakeOverENI,
+			Resource: config.ENIIP,
+			From:     resources.PrimaryENI,
+			To:       target.ID,
+		})
+	}
+
+	eips, err := cloud.DescribeEIPs(ctx, EIPFilter{
+		PrivateIPs: append([]string{config.ENIIP}, resources.FloatingIPs...),
+		ENIs:       resources.ENIIDs(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var floatingEIPs []CloudEIP
+	for _, eip := range eips {
+		if eip.PrivateIP != config.ENIIP {
+			floatingEIPs = append(floatingEIPs, eip)
+			continue
+		}
+		plan.moveEIP(eip, target.ID)
+	}
+
+	plan.Changes = append(plan.Changes, PlannedChange{
+		Action:   ActionStampEpoch,
+		Resource: target.ID,
+		To:       target.ID,
+	})
+
+	if config.DestinationCIDR != "" {
+		targets, err := cloud.GetRouteTargets(ctx, resources.VPCID, config.DestinationCIDR)
+		if err != nil {
+			return nil, err
+		}
+		for _, routeTable := range resources.RouteTables {
+			if targets[routeTable] == target.ID {
+				continue
+			}
+			plan.Changes = append(plan.Changes, PlannedChange{
+				Action:          ActionUpdateRoutes,
+				Resource:        routeTable,
+				From:            targets[routeTable],
+				To:              target.ID,
+				DestinationCIDR: config.DestinationCIDR,
+			})
+		}
+		if len(resources.RouteTables) == 0 {
+			plan.warn("no route tables with a route to %s are managed, so updating routes would fail", config.DestinationCIDR)
+		}
+	}
+
+	moves := resources.FloatingIPMoves(target.ID)
+	for _, source := range slices.Sorted(maps.Keys(moves)) {
+		for _, ip := range moves[source] {
+			plan.Changes = append(plan.Changes, PlannedChange{
+				Action:   ActionReassignFloatingIPs,
+				Resource: ip,
+				From:     source,
+				To:       target.ID,
+			})
+		}
+	}
+
+	for _, eip := range floatingEIPs {
+		plan.moveEIP(eip, target.ID)
+	}
+
+	if len(plan.Changes) == 1 {
+		plan.warn("ENI %s already holds the pair's resources, only the epoch would be stamped", target.ID)
+	}
+
+	if dryRunner != nil {
+		for i := range plan.Changes {
+			plan.Changes[i].DryRun = dryRunResult(dryRunner.DryRun(ctx, plan.Changes[i]))
+		}
+	}
+
+	return plan, nil
+}
+
+// planTarget returns the ENI a planned failover moves the resources to
+func planTarget(ctx context.Context, cloud CloudProvider, targetENI string) (*CloudENI, error) {
+	filter := ENIFilter{InstanceID: cloud.GetInstanceID()}
+	if targetENI != "" {
+		filter = ENIFilter{IDs: []string{targetENI}}
+	}
+
+	enis, err := cloud.DescribeENIs(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find target ENI: %w", err)
+	}
+	if len(enis) == 0 {
+		if targetENI != "" {
+			return nil, fmt.Errorf("target ENI %s not found", targetENI)
+		}
+		return nil, fmt.Errorf("no ENI found for instance %s", filter.InstanceID)
+	}
+	return &enis[0], nil
+}
+
+// moveEIP plans associating an EIP with the target ENI, unless it already is
+func (p *FailoverPlan) moveEIP(eip CloudEIP, target string) {
+	if eip.ENI == target {
+		return
+	}
+	p.Changes = append(p.Changes, PlannedChange{
+		Action:    ActionMoveEIP,
+		Resource:  eip.AllocationID,
+		From:      eip.ENI,
+		To:        target,
+		PrivateIP: eip.PrivateIP,
+		PublicIP:  eip.PublicIP,
+	})
+}
+
+// warn records something about the plan an operator should know
+func (p *FailoverPlan) warn(format string, args ...any) {
+	p.Warnings = append(p.Warnings, fmt.Sprintf(format, args...))
+}
+
+// dryRunResult describes the result of validating a change
+func dryRunResult(err error) string {
+	switch {
+	case err == nil:
+		return DryRunPermitted
+	case errors.Is(err, ErrDryRunUnsupported):
+		return DryRunUnsupported
+	default:
+		return err.Error()
+	}
+}
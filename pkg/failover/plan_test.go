@@ -0,0 +1,208 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testPlanSelector selects the ENIs and route tables of a cloud with withEIPs explicitly
+var testPlanSelector = ResourceSelector{
+	ENIs:        []string{"eni-a", "eni-b"},
+	RouteTables: []string{"rtb-1", "rtb-2"},
+}
+
+// checkOtherVPC fails the test if the resources withOtherVPC added were touched
+func checkOtherVPC(t *testing.T, cloud *MemoryCloud) {
+	t.Helper()
+
+	if eni, _ := cloud.ENI("eni-0"); !slices.Equal(eni.SecondaryIPs, []string{testENIIP, testFloatingIP}) {
+		t.Fatalf("eni-0 of the other VPC holds %v, want %v", eni.SecondaryIPs, []string{testENIIP, testFloatingIP})
+	}
+	for _, allocationID := range []string{"eipalloc-8", "eipalloc-9"} {
+		if eip, _ := cloud.EIP(allocationID); eip.ENI != "eni-0" {
+			t.Fatalf("EIP %s of the other VPC moved to %q", allocationID, eip.ENI)
+		}
+	}
+}
+
+// planChanges describes the changes of a plan as action, resource, from and to
+func planChanges(plan *FailoverPlan) []string {
+	var changes []string
+	for _, change := range plan.Changes {
+		changes = append(changes, strings.Join([]string{change.Action, change.Resource, change.From, change.To}, " "))
+	}
+	return changes
+}
+
+func TestPlanFailover(t *testing.T) {
+	cloud := newTestCloud(withFloatingIP, withEIPs)
+	plan, err := PlanFailover(context.Background(), NewMemoryCloudProvider(cloud, "i-b"), PlanConfig{
+		ENIIP:           testENIIP,
+		DestinationCIDR: testDestinationCIDR,
+		Selector:        testPlanSelector,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The ENI IP and its EIP move first, the route table already on eni-b is left alone
+	want := []string{
+		"take_over_eni 10.0.1.5 eni-a eni-b",
+		"move_eip eipalloc-1 eni-a eni-b",
+		"stamp_epoch eni-b  eni-b",
+		"update_routes rtb-1 eni-a eni-b",
+		"reassign_floating_ips 10.0.1.20 eni-a eni-b",
+		"move_eip eipalloc-2 eni-a eni-b",
+	}
+	if got := planChanges(plan); !slices.Equal(got, want) {
+		t.Fatalf("changes:\n got %q\nwant %q", got, want)
+	}
+	if plan.TargetENI != "eni-b" || plan.TargetInstanceID != "i-b" || len(plan.Warnings) != 0 {
+		t.Fatalf("plan targets %s on %s with warnings %q, want eni-b on i-b without warnings", plan.TargetENI, plan.TargetInstanceID, plan.Warnings)
+	}
+	if change := plan.Changes[1]; change.PrivateIP != testENIIP || change.PublicIP != "203.0.113.1" {
+		t.Fatalf("EIP change: got %+v, want the ENI IP's EIP", change)
+	}
+	if change := plan.Changes[3]; change.DestinationCIDR != testDestinationCIDR {
+		t.Fatalf("route change: got %+v, want the destination CIDR", change)
+	}
+
+	// Planning changes nothing
+	if calls := cloud.Calls("TakeOverENI") + cloud.Calls("UpdateRouteTables") + cloud.Calls("SetEpochTag"); calls != 0 {
+		t.Fatalf("planning made %d changes", calls)
+	}
+}
+
+func TestPlanFailoverOtherVPC(t *testing.T) {
+	cloud := newTestCloud(withFloatingIP, withEIPs, withOtherVPC)
+	plan, err := PlanFailover(context.Background(), NewMemoryCloudProvider(cloud, "i-b"), PlanConfig{
+		ENIIP:           testENIIP,
+		DestinationCIDR: testDestinationCIDR,
+		Selector:        testPlanSelector,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the EIPs of the pair's ENIs move, not those of the same IPs in vpc-9
+	want := []string{
+		"take_over_eni 10.0.1.5 eni-a eni-b",
+		"move_eip eipalloc-1 eni-a eni-b",
+		"stamp_epoch eni-b  eni-b",
+		"update_routes rtb-1 eni-a eni-b",
+		"reassign_floating_ips 10.0.1.20 eni-a eni-b",
+		"move_eip eipalloc-2 eni-a eni-b",
+	}
+	if got := planChanges(plan); !slices.Equal(got, want) {
+		t.Fatalf("changes:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestPlanFailoverAlreadyOnTarget(t *testing.T) {
+	plan, err := PlanFailover(context.Background(), NewMemoryCloudProvider(newTestCloud(withFloatingIP, withEIPs), "i-b"), PlanConfig{
+		ENIIP:     testENIIP,
+		Selector:  testPlanSelector,
+		TargetENI: "eni-a",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := planChanges(plan); !slices.Equal(got, []string{"stamp_epoch eni-a  eni-a"}) {
+		t.Fatalf("changes: got %q, want only the epoch stamp", got)
+	}
+	if len(plan.Warnings) != 1 || !strings.Contains(plan.Warnings[0], "already holds the pair's resources") {
+		t.Fatalf("warnings: got %q", plan.Warnings)
+	}
+}
+
+func TestPlanFailoverWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector ResourceSelector
+		target   string
+		want     string
+	}{
+		{
+			name: "default discovery",
+			want: "resources of kind eni,floating_ip,route_table are found by the deprecated default discovery",
+		},
+		{
+			name:     "target in another subnet",
+			selector: testPlanSelector,
+			target:   "eni-d",
+			want:     "target ENI eni-d is in subnet subnet-2, not the pair's subnet subnet-1",
+		},
+		{
+			name:     "no managed route tables",
+			selector: ResourceSelector{ENIs: testPlanSelector.ENIs, RouteTables: []string{"rtb-9"}},
+			want:     "no route tables with a route to 10.9.0.0/16 are managed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloud := newTestCloud(withFloatingIP, withEIPs)
+			cloud.AddSubnet(CloudSubnet{ID: "subnet-2", VPCID: "vpc-1", CIDR: "10.0.2.0/24"})
+			cloud.AddENI(CloudENI{ID: "eni-d", InstanceID: "i-d", SubnetID: "subnet-2", PrimaryIP: "10.0.2.10"})
+
+			plan, err := PlanFailover(context.Background(), NewMemoryCloudProvider(cloud, "i-b"), PlanConfig{
+				ENIIP:           testENIIP,
+				DestinationCIDR: testDestinationCIDR,
+				Selector:        tt.selector,
+				TargetENI:       tt.target,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.ContainsFunc(plan.Warnings, func(warning string) bool { return strings.Contains(warning, tt.want) }) {
+				t.Fatalf("warnings: got %q, want %q", plan.Warnings, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanFailoverDryRun(t *testing.T) {
+	config := PlanConfig{
+		ENIIP:           testENIIP,
+		DestinationCIDR: testDestinationCIDR,
+		Selector:        testPlanSelector,
+		DryRun:          true,
+	}
+
+	cloud := newTestCloud(withFloatingIP, withEIPs)
+	plan, err := PlanFailover(context.Background(), NewMemoryCloudProvider(cloud, "i-b"), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{DryRunUnsupported, DryRunPermitted, DryRunPermitted, DryRunPermitted, DryRunUnsupported, DryRunPermitted}
+	var got []string
+	for _, change := range plan.Changes {
+		got = append(got, change.DryRun)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("dry run results: got %q, want %q", got, want)
+	}
+	if plan.DryRunFailed() {
+		t.Fatal("unsupported dry runs fail the plan")
+	}
+
+	// A change the cloud refuses fails the plan
+	cloud.FailNext("DryRun", nil, errors.New("UnauthorizedOperation"))
+	plan, err = PlanFailover(context.Background(), NewMemoryCloudProvider(cloud, "i-b"), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Changes[1].DryRun != "UnauthorizedOperation" || !plan.DryRunFailed() {
+		t.Fatalf("EIP dry run: got %q, want the refusal to fail the plan", plan.Changes[1].DryRun)
+	}
+
+	// A cloud provider that cannot validate changes cannot dry run a plan
+	provider := struct{ CloudProvider }{NewMemoryCloudProvider(cloud, "i-b")}
+	if _, err := PlanFailover(context.Background(), provider, config); err == nil {
+		t.Fatal("planned a dry run with a cloud provider that cannot validate changes")
+	}
+}
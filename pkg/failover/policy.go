@@ -0,0 +1,133 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrHeldDown       = errors.New("role transition held down")
+	ErrFailoverFrozen = errors.New("automatic failover frozen")
+)
+
+// recordTransition records a completed role transition for hold-down and flap detection.
+// Planned switchovers, the initial role and repeated requests for the current role do
+// not count as flaps.
+func (lf *LeaderFailover) recordTransition(from, to NodeRole, planned bool) {
+	now := lf.now()
+
+	lf.policyMutex.Lock()
+	defer lf.policyMutex.Unlock()
+
+	lf.lastTransition = now
+	if from == RoleUnknown || from == to || planned || lf.config.FlapThreshold <= 0 {
+		return
+	}
+
+	// Keep the automatic transitions within the flap window
+	cutoff := now.Add(-lf.config.FlapWindow)
+	recent := lf.transitions[:0]
+	for _, t := range lf.transitions {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	lf.transitions = append(recent, now)
+
+	if len(lf.transitions) < lf.config.FlapThreshold {
+		return
+	}
+
+	lf.frozenUntil = now.Add(lf.config.FlapFreezeDuration)
+	lf.transitions = nil
+
+	lf.logger.Error().
+		Str("from_role", from.String()).
+		Str("to_role", to.String()).
+		Int("transitions", lf.config.FlapThreshold).
+		Str("window", lf.config.FlapWindow.String()).
+		Str("frozen_until", lf.frozenUntil.Format(time.RFC3339)).
+		Msg("Role flapping detected, freezing automatic failover")
+}
+
+// checkAutomaticTransition reports why this node may not take the primary role on its
+// own right now: it changed role too recently, or flapping froze automatic failover.
+// Planned switchovers and stepping down are always allowed.
+func (lf *LeaderFailover) checkAutomaticTransition() error {
+	now := lf.now()
+
+	lf.policyMutex.Lock()
+	defer lf.policyMutex.Unlock()
+
+	if now.Before(lf.frozenUntil) {
+		return fmt.Errorf("%w until %s", ErrFailoverFrozen, lf.frozenUntil.Format(time.RFC3339))
+	}
+	if heldUntil := lf.lastTransition.Add(lf.config.HoldDownTime); now.Before(heldUntil) {
+		return fmt.Errorf("%w for another %s", ErrHeldDown, heldUntil.Sub(now).Round(time.Second))
+	}
+	return nil
+}
+
+// frozenUntilTime returns when automatic failover unfreezes, the zero time when it is not frozen
+func (lf *LeaderFailover) frozenUntilTime() time.Time {
+	lf.policyMutex.Lock()
+	defer lf.policyMutex.Unlock()
+
+	if lf.now().Before(lf.frozenUntil) {
+		return lf.frozenUntil
+	}
+	return time.Time{}
+}
+
+// lastTransitionTime returns when this node last changed role
+func (lf *LeaderFailover) lastTransitionTime() time.Time {
+	lf.policyMutex.Lock()
+	defer lf.policyMutex.Unlock()
+
+	return lf.lastTransition
+}
+
+// preemptPrimary takes the primary role back from a lower priority primary with a planned
+// switchover, if this secondary is configured to preempt and is ready to. It reports whether
+// a switchover was attempted.
+func (lf *LeaderFailover) preemptPrimary(ctx context.Context) bool {
+	if !lf.config.Preempt || lf.currentRole.Load() != RoleSecondary {
+		return false
+	}
+	if lf.maintenance.Load() || lf.unhealthy.Load() {
+		return false
+	}
+
+	// Only preempt a primary that is heartbeating, so its priority is known and it can hand over
+	lf.heartbeatMutex.Lock()
+	primaryPriority := lf.primaryPriority
+	heard := lf.heartbeatSequence > 0 && lf.missedHeartbeats == 0
+	lf.heartbeatMutex.Unlock()
+	if lf.bfd != nil {
+		heard = lf.bfd.Up()
+	}
+	if !heard || lf.config.Priority <= primaryPriority {
+		return false
+	}
+
+	if err := lf.checkAutomaticTransition(); err != nil {
+		lf.logger.Debug().Err(err).Msg("Not preempting lower priority primary")
+		return false
+	}
+
+	lf.logger.Info().
+		Uint32("priority", lf.config.Priority).
+		Uint32("primary_priority", primaryPriority).
+		Msg("Preempting lower priority primary")
+
+	ctx, cancel := context.WithTimeout(ctx, lf.switchoverTimeout())
+	defer cancel()
+
+	if _, _, err := lf.takeOver(ctx, TriggerPreempt); err != nil {
+		lf.logger.Warn().Err(err).Msg("Failed to preempt lower priority primary")
+	}
+
+	return true
+}
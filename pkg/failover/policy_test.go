@@ -0,0 +1,263 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// transition is a role change at an offset from the start of a test
+type transition struct {
+	at      time.Duration
+	from    NodeRole
+	to      NodeRole
+	planned bool
+}
+
+func TestCheckAutomaticTransition(t *testing.T) {
+	start := time.Unix(1_760_000_000, 0)
+
+	tests := []struct {
+		name        string
+		transitions []transition
+		at          time.Duration
+		wantErr     error
+	}{
+		{name: "no transition yet", at: 0},
+		{
+			name:        "inside hold-down",
+			transitions: []transition{{at: 0, from: RolePrimary, to: RoleSecondary}},
+			at:          29 * time.Second,
+			wantErr:     ErrHeldDown,
+		},
+		{
+			name:        "hold-down over",
+			transitions: []transition{{at: 0, from: RolePrimary, to: RoleSecondary}},
+			at:          30 * time.Second,
+		},
+		{
+			name:        "planned switchover holds down too",
+			transitions: []transition{{at: 0, from: RolePrimary, to: RoleSecondary, planned: true}},
+			at:          time.Second,
+			wantErr:     ErrHeldDown,
+		},
+		{
+			name: "flapping freezes",
+			transitions: []transition{
+				{at: 0, from: RoleSecondary, to: RolePrimary},
+				{at: time.Minute, from: RolePrimary, to: RoleSecondary},
+				{at: 2 * time.Minute, from: RoleSecondary, to: RolePrimary},
+			},
+			at:      2*time.Minute + time.Hour - time.Second,
+			wantErr: ErrFailoverFrozen,
+		},
+		{
+			name: "freeze over",
+			transitions: []transition{
+				{at: 0, from: RoleSecondary, to: RolePrimary},
+				{at: time.Minute, from: RolePrimary, to: RoleSecondary},
+				{at: 2 * time.Minute, from: RoleSecondary, to: RolePrimary},
+			},
+			at: 2*time.Minute + time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &testClock{t: start}
+			lf := newTestFailover(t, newTestCloud(), "i-b", func(config *LeaderConfig) {
+				config.HoldDownTime = 30 * time.Second
+				config.FlapThreshold = 3
+				config.FlapWindow = 10 * time.Minute
+				config.FlapFreezeDuration = time.Hour
+			})
+			lf.now = clock.Now
+			lf.currentRole.Store(RoleSecondary)
+
+			for _, tr := range tt.transitions {
+				clock.t = start.Add(tr.at)
+				lf.recordTransition(tr.from, tr.to, tr.planned)
+			}
+			clock.t = start.Add(tt.at)
+
+			if err := lf.checkAutomaticTransition(); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("check at %s: got %v, want %v", tt.at, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRecordTransitionFlaps(t *testing.T) {
+	start := time.Unix(1_760_000_000, 0)
+	flap := func(at time.Duration) transition {
+		return transition{at: at, from: RoleSecondary, to: RolePrimary}
+	}
+
+	tests := []struct {
+		name        string
+		transitions []transition
+		wantFrozen  bool
+	}{
+		{name: "below threshold", transitions: []transition{flap(0), flap(time.Minute)}},
+		{name: "at threshold", transitions: []transition{flap(0), flap(time.Minute), flap(2 * time.Minute)}, wantFrozen: true},
+		{
+			name:        "first transition left the window",
+			transitions: []transition{flap(0), flap(10 * time.Minute), flap(11 * time.Minute)},
+		},
+		{
+			name:        "last transition at the window edge",
+			transitions: []transition{flap(0), flap(5 * time.Minute), flap(10*time.Minute - time.Second)},
+			wantFrozen:  true,
+		},
+		{
+			name: "planned switchover",
+			transitions: []transition{
+				flap(0),
+				{at: time.Minute, from: RolePrimary, to: RoleSecondary, planned: true},
+				flap(2 * time.Minute),
+			},
+		},
+		{
+			name: "initial role",
+			transitions: []transition{
+				{at: 0, from: RoleUnknown, to: RolePrimary},
+				flap(time.Minute),
+				flap(2 * time.Minute),
+			},
+		},
+		{
+			name: "same role again",
+			transitions: []transition{
+				flap(0),
+				{at: time.Minute, from: RolePrimary, to: RolePrimary},
+				flap(2 * time.Minute),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &testClock{t: start}
+			lf := newTestFailover(t, newTestCloud(), "i-b", func(config *LeaderConfig) {
+				config.FlapThreshold = 3
+				config.FlapWindow = 10 * time.Minute
+				config.FlapFreezeDuration = time.Hour
+			})
+			lf.now = clock.Now
+			lf.currentRole.Store(RoleSecondary)
+
+			for _, tr := range tt.transitions {
+				clock.t = start.Add(tr.at)
+				lf.recordTransition(tr.from, tr.to, tr.planned)
+			}
+
+			frozenUntil := lf.frozenUntilTime()
+			if frozen := !frozenUntil.IsZero(); frozen != tt.wantFrozen {
+				t.Fatalf("frozen: got %t until %s, want %t", frozen, frozenUntil, tt.wantFrozen)
+			}
+			if want := clock.t.Add(time.Hour); tt.wantFrozen && !frozenUntil.Equal(want) {
+				t.Fatalf("frozen until %s, want %s", frozenUntil, want)
+			}
+			if tt.wantFrozen && len(lf.transitions) != 0 {
+				t.Fatalf("%d transitions still count towards the next flap", len(lf.transitions))
+			}
+		})
+	}
+}
+
+func TestPreemptPrimaryBlocked(t *testing.T) {
+	start := time.Unix(1_760_000_000, 0)
+
+	tests := []struct {
+		name            string
+		priority        uint32
+		primaryPriority uint32
+		heard           bool
+		transitions     []transition
+	}{
+		{name: "equal priority", priority: 5, primaryPriority: 5, heard: true},
+		{name: "lower priority", priority: 4, primaryPriority: 5, heard: true},
+		{name: "primary not heard", priority: 6, primaryPriority: 5},
+		{
+			name:            "inside hold-down",
+			priority:        6,
+			primaryPriority: 5,
+			heard:           true,
+			transitions:     []transition{{at: -29 * time.Second, from: RolePrimary, to: RoleSecondary}},
+		},
+		{
+			name:            "frozen",
+			priority:        6,
+			primaryPriority: 5,
+			heard:           true,
+			transitions: []transition{
+				{at: -3 * time.Minute, from: RoleSecondary, to: RolePrimary},
+				{at: -2 * time.Minute, from: RolePrimary, to: RoleSecondary},
+				{at: -time.Minute, from: RoleSecondary, to: RolePrimary},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &testClock{t: start}
+			lf := newTestFailover(t, newTestCloud(), "i-b", func(config *LeaderConfig) {
+				newTestCA(t).configure(t, config, "i-b")
+				config.Priority = tt.priority
+				config.Preempt = true
+				config.HoldDownTime = 30 * time.Second
+				config.FlapThreshold = 3
+			})
+			lf.now = clock.Now
+			lf.currentRole.Store(RoleSecondary)
+
+			for _, tr := range tt.transitions {
+				clock.t = start.Add(tr.at)
+				lf.recordTransition(tr.from, tr.to, tr.planned)
+			}
+			clock.t = start
+
+			lf.primaryPriority = tt.primaryPriority
+			if tt.heard {
+				lf.heartbeatSequence = 1
+			}
+
+			if lf.preemptPrimary(context.Background()) {
+				t.Fatal("preempted the primary")
+			}
+			if role := lf.currentRole.Load(); role != RoleSecondary {
+				t.Fatalf("role: got %s, want %s", role, RoleSecondary)
+			}
+		})
+	}
+}
+
+func TestPreemptPrimaryAfterHoldDown(t *testing.T) {
+	priorities := map[string]uint32{"i-a": 1, "i-b": 2}
+	pair := newSwitchoverPair(t, func(instance string, config *LeaderConfig) {
+		config.Priority = priorities[instance]
+		config.Preempt = true
+		config.HoldDownTime = 30 * time.Second
+	})
+
+	// The secondary learns the primary's priority from its heartbeats
+	if err := pair.primary.sendHeartbeat(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The secondary just became secondary, so it waits out the hold-down before preempting
+	clock := &testClock{t: pair.secondary.lastTransitionTime()}
+	pair.secondary.now = clock.Now
+	clock.Advance(29 * time.Second)
+	if pair.secondary.preemptPrimary(context.Background()) {
+		t.Fatal("preempted the primary inside the hold-down")
+	}
+	pair.requireRoles(t, RolePrimary, RoleSecondary)
+
+	clock.Advance(time.Second)
+	if !pair.secondary.preemptPrimary(context.Background()) {
+		t.Fatal("did not preempt the lower priority primary")
+	}
+	pair.requireRoles(t, RoleSecondary, RolePrimary)
+}
@@ -0,0 +1,234 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// reconcileMaxCorrections is the number of recent drift corrections kept for the status
+const reconcileMaxCorrections = 20
+
+// DriftCorrection is a resource the primary found pointing away from it and moved back
+type DriftCorrection struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	Resource string    `json:"resource"`
+
+	// Failure of the correction, empty when the resource was repaired
+	Error string `json:"error,omitempty"`
+}
+
+// reconcileLoop repairs drift of the pair's resources every reconcile interval while primary
+func (lf *LeaderFailover) reconcileLoop(ctx context.Context, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(lf.config.ReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-lf.stopCh:
+			return
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			// Role transitions move the resources themselves, and in maintenance mode an
+			// operator may be changing them by hand
+			if lf.currentState() != StatePrimary || lf.maintenance.Load() || lf.switchingOver.Load() {
+				continue
+			}
+
+			// A pass may take as long as the failover actions of a promotion
+			reconcileCtx, cancel := context.WithTimeout(ctx, lf.config.PromotionTimeout)
+			if err := lf.reconcile(reconcileCtx); err != nil {
+				lf.logger.Warn().Err(err).Msg("Failed to reconcile failover resources")
+			}
+			cancel()
+		}
+	}
+}
+
+// reconcile checks once that every managed route to the destination CIDR targets this
+// node's ENI, that the floating IPs are on it and that each EIP is associated with its
+// private IP, and repairs those that are not
+func (lf *LeaderFailover) reconcile(ctx context.Context) error {
+	target := lf.currentENI.Load()
+	if target == "" {
+		return errors.New("ENI of the primary is not known")
+	}
+
+	// Never pull resources back to a node that has been superseded
+	if err := lf.checkFence(ctx); err != nil {
+		return err
+	}
+
+	selector, err := lf.config.ResourceSelector()
+	if err != nil {
+		return err
+	}
+	resources, err := DiscoverResources(ctx, lf.cloud, lf.config.ENIIP, lf.config.DestinationCIDR, selector)
+	if err != nil {
+		return fmt.Errorf("failed to discover failover resources: %w", err)
+	}
+
+	var steps []*failoverStep
+	if lf.config.DestinationCIDR != "" {
+		for _, routeTable := range resources.RouteTables {
+			steps = append(steps, lf.updateRouteStep(resources.VPCID, routeTable, target))
+		}
+	}
+	steps = append(steps, lf.floatingIPSteps(resources.FloatingIPMoves(target), target)...)
+
+	// EIPs follow the floating IPs they are associated with
+	eips, err := lf.reconcileEIPs(ctx, resources)
+	if err != nil {
+		return err
+	}
+	for _, eip := range eips {
+		steps = append(steps, lf.moveEIPStep(eip, target))
+	}
+
+	var errs []error
+	for _, step := range steps {
+		if err := lf.correctDrift(ctx, step); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	lf.reconcileMutex.Lock()
+	lf.lastReconcile = time.Now()
+	lf.reconcileMutex.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// reconcileEIPs returns the EIPs of the pair with the private IP each belongs to: those the
+// failover actions moved, and any since associated with the ENI IP or a floating IP on a
+// managed ENI. The failover actions' association wins, as an EIP taken elsewhere has
+// drifted. Released EIPs are forgotten.
+func (lf *LeaderFailover) reconcileEIPs(ctx context.Context, resources *PairResources) ([]CloudEIP, error) {
+	found, err := lf.cloud.DescribeEIPs(ctx, EIPFilter{
+		PrivateIPs: append([]string{lf.config.ENIIP}, resources.FloatingIPs...),
+		ENIs:       resources.ENIIDs(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe EIPs: %w", err)
+	}
+
+	lf.reconcileMutex.Lock()
+	known := slices.Collect(maps.Keys(lf.managedEIPs))
+	lf.reconcileMutex.Unlock()
+
+	existing := make(map[string]bool)
+	if len(known) > 0 {
+		eips, err := lf.cloud.DescribeEIPs(ctx, EIPFilter{AllocationIDs: known})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe EIPs: %w", err)
+		}
+		for _, eip := range eips {
+			existing[eip.AllocationID] = true
+		}
+	}
+
+	lf.reconcileMutex.Lock()
+	defer lf.reconcileMutex.Unlock()
+
+	for _, allocationID := range known {
+		if !existing[allocationID] {
+			lf.logger.Info().Str("allocation_id", allocationID).Msg("Managed EIP was released, no longer reconciling it")
+			delete(lf.managedEIPs, allocationID)
+		}
+	}
+	if lf.managedEIPs == nil {
+		lf.managedEIPs = make(map[string]CloudEIP)
+	}
+	for _, eip := range found {
+		if _, ok := lf.managedEIPs[eip.AllocationID]; !ok {
+			lf.managedEIPs[eip.AllocationID] = eip
+		}
+	}
+
+	eips := make([]CloudEIP, 0, len(lf.managedEIPs))
+	for _, allocationID := range slices.Sorted(maps.Keys(lf.managedEIPs)) {
+		eips = append(eips, lf.managedEIPs[allocationID])
+	}
+	return eips, nil
+}
+
+// manageEIPs remembers the EIPs the failover actions move and the private IPs they belong
+// to, so the reconciler still finds them once they were disassociated
+func (lf *LeaderFailover) manageEIPs(eips []CloudEIP) {
+	lf.reconcileMutex.Lock()
+	defer lf.reconcileMutex.Unlock()
+
+	if lf.managedEIPs == nil {
+		lf.managedEIPs = make(map[string]CloudEIP)
+	}
+	for _, eip := range eips {
+		lf.managedEIPs[eip.AllocationID] = eip
+	}
+}
+
+// correctDrift repairs a resource that no longer points at this node. Every correction is
+// recorded as a drift event in the journal, a metric and in the status.
+func (lf *LeaderFailover) correctDrift(ctx context.Context, step *failoverStep) error {
+	inPlace, err := step.verify(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check %s %s: %w", step.action, step.resource, err)
+	}
+	if inPlace {
+		return nil
+	}
+
+	lf.logger.Warn().
+		Str("action", step.action).
+		Str("resource", step.resource).
+		Str("eni", lf.currentENI.Load()).
+		Msg("Resource drifted away from the primary, repairing")
+
+	// A failed correction is reported even for steps a failover may skip
+	repair := *step
+	repair.event = JournalEventDrift
+	repair.optional = false
+	stepErr := lf.runStep(ctx, &repair)
+
+	correction := DriftCorrection{
+		Time:     time.Now(),
+		Action:   step.action,
+		Resource: step.resource,
+	}
+	if stepErr != nil {
+		correction.Error = stepErr.Err.Error()
+	}
+	lf.recordDriftCorrection(correction)
+	emitDriftMetrics(step.action, stepErr == nil)
+
+	if stepErr != nil {
+		return stepErr
+	}
+	lf.logger.Info().Str("action", step.action).Str("resource", step.resource).Msg("Repaired drifted resource")
+	return nil
+}
+
+// recordDriftCorrection keeps a correction for the status, dropping the oldest beyond the limit
+func (lf *LeaderFailover) recordDriftCorrection(correction DriftCorrection) {
+	lf.reconcileMutex.Lock()
+	defer lf.reconcileMutex.Unlock()
+
+	lf.driftCorrections = append(lf.driftCorrections, correction)
+	if excess := len(lf.driftCorrections) - reconcileMaxCorrections; excess > 0 {
+		lf.driftCorrections = slices.Delete(lf.driftCorrections, 0, excess)
+	}
+}
+
+// reconcileStatus returns when the resources were last reconciled and the recent corrections
+func (lf *LeaderFailover) reconcileStatus() (time.Time, []DriftCorrection) {
+	lf.reconcileMutex.Lock()
+	defer lf.reconcileMutex.Unlock()
+
+	return lf.lastReconcile, slices.Clone(lf.driftCorrections)
+}
@@ -0,0 +1,374 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reconcilingPair selects eni-a, eni-b and rtb-1 of a cloud with withFloatingIP and
+// withEIPs for the node to reconcile
+func reconcilingPair(config *LeaderConfig) {
+	config.ManagedENIs = []string{"eni-a", "eni-b"}
+	config.RouteTables = []string{"rtb-1"}
+	config.ReconcileInterval = 10 * time.Millisecond
+}
+
+// driftToENIB points the route of rtb-1, the floating IP and the ENI IP's EIP at eni-b, as
+// an operator working on the wrong node would
+func driftToENIB(t *testing.T, cloud *MemoryCloud) {
+	t.Helper()
+
+	ctx := context.Background()
+	operator := NewMemoryCloudProvider(cloud, "i-b")
+	cloud.AddRoute("rtb-1", testDestinationCIDR, "eni-b")
+	if err := operator.ReassignFloatingIPs(ctx, "eni-a", "eni-b", []string{testFloatingIP}); err != nil {
+		t.Fatal(err)
+	}
+	if err := operator.AssociateEIP(ctx, "eipalloc-1", "eni-b", "10.0.1.11"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// driftEntries returns the drift events in the journal of the node
+func driftEntries(t *testing.T, lf *LeaderFailover) []JournalEntry {
+	t.Helper()
+
+	entries, err := ReadJournal(JournalFile(lf.config.StateDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return slices.DeleteFunc(entries, func(entry JournalEntry) bool { return entry.Event != JournalEventDrift })
+}
+
+func TestReconcileRepairsDrift(t *testing.T) {
+	ctx := context.Background()
+	cloud := newTestCloud(withFloatingIP, withEIPs)
+	lf, _ := newTestPrimary(t, cloud, reconcilingPair)
+
+	// The first pass finds nothing to repair and learns the pair's EIPs
+	if err := lf.reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if last, corrections := lf.reconcileStatus(); last.IsZero() || len(corrections) != 0 {
+		t.Fatalf("reconciled at %s with corrections %+v, want none", last, corrections)
+	}
+
+	driftToENIB(t, cloud)
+	if err := lf.reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if target := cloud.RouteTarget("rtb-1", testDestinationCIDR); target != "eni-a" {
+		t.Fatalf("route target: got %s, want eni-a", target)
+	}
+	if holder := cloud.ENIWithIP(testFloatingIP); holder != "eni-a" {
+		t.Fatalf("floating IP holder: got %s, want eni-a", holder)
+	}
+	for allocationID, privateIP := range map[string]string{"eipalloc-1": testENIIP, "eipalloc-2": testFloatingIP} {
+		if eip, _ := cloud.EIP(allocationID); eip.ENI != "eni-a" || eip.PrivateIP != privateIP {
+			t.Fatalf("EIP %s: got %s on %s, want %s on eni-a", allocationID, eip.PrivateIP, eip.ENI, privateIP)
+		}
+	}
+
+	// Route tables the selector leaves out are not the pair's to repair
+	if target := cloud.RouteTarget("rtb-2", testDestinationCIDR); target != "eni-b" {
+		t.Fatalf("unselected route table rtb-2 targets %s, want it left on eni-b", target)
+	}
+
+	// Unassigning the floating IP disassociated its EIP, which is repaired too
+	want := []string{
+		"update_routes rtb-1",
+		"reassign_floating_ips 10.0.1.20 from eni-b",
+		"move_eip eipalloc-1",
+		"move_eip eipalloc-2",
+	}
+	_, corrections := lf.reconcileStatus()
+	var got []string
+	for _, correction := range corrections {
+		if correction.Error != "" {
+			t.Fatalf("correction of %s %s failed: %s", correction.Action, correction.Resource, correction.Error)
+		}
+		got = append(got, correction.Action+" "+correction.Resource)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("corrections:\n got %q\nwant %q", got, want)
+	}
+
+	got = nil
+	for _, entry := range driftEntries(t, lf) {
+		got = append(got, entry.Action+" "+entry.Resource)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("drift journal entries:\n got %q\nwant %q", got, want)
+	}
+
+	// Repaired resources need no further correction
+	if err := lf.reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, corrections := lf.reconcileStatus(); len(corrections) != len(want) {
+		t.Fatalf("got %d corrections after a pass without drift, want %d", len(corrections), len(want))
+	}
+}
+
+func TestReconcileFailedRepair(t *testing.T) {
+	ctx := context.Background()
+	cloud := newTestCloud(withFloatingIP, withEIPs)
+	lf, _ := newTestPrimary(t, cloud, reconcilingPair)
+	if err := lf.reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	driftToENIB(t, cloud)
+	injected := errors.New("throttled")
+	cloud.SetError("UpdateRouteTables", injected)
+	cloud.SetError("ReassignFloatingIPs", injected)
+
+	if err := lf.reconcile(ctx); !errors.Is(err, injected) {
+		t.Fatalf("reconcile: got %v, want the failed repairs", err)
+	}
+
+	// The failed repairs leave the route and the floating IP whole where they drifted to
+	if target := cloud.RouteTarget("rtb-1", testDestinationCIDR); target != "eni-b" {
+		t.Fatalf("route target: got %s, want eni-b", target)
+	}
+	if holder := cloud.ENIWithIP(testFloatingIP); holder != "eni-b" {
+		t.Fatalf("floating IP holder: got %s, want eni-b", holder)
+	}
+
+	// The floating IP's EIP cannot follow an IP that stayed behind, the ENI IP's EIP is
+	// repaired regardless
+	if eip, _ := cloud.EIP("eipalloc-1"); eip.ENI != "eni-a" {
+		t.Fatalf("EIP eipalloc-1 is on %s, want eni-a", eip.ENI)
+	}
+	want := []string{"update_routes rtb-1", "reassign_floating_ips 10.0.1.20 from eni-b", "move_eip eipalloc-2"}
+
+	_, corrections := lf.reconcileStatus()
+	var failed []string
+	for _, correction := range corrections {
+		if correction.Error != "" {
+			failed = append(failed, correction.Action+" "+correction.Resource)
+		}
+	}
+	if !slices.Equal(failed, want) {
+		t.Fatalf("failed corrections:\n got %q\nwant %q", failed, want)
+	}
+	if !strings.Contains(corrections[0].Error, "throttled") {
+		t.Fatalf("route correction: got error %q, want the failure", corrections[0].Error)
+	}
+
+	failed = nil
+	for _, entry := range driftEntries(t, lf) {
+		if entry.Error != "" {
+			failed = append(failed, entry.Action+" "+entry.Resource)
+		}
+	}
+	if !slices.Equal(failed, want) {
+		t.Fatalf("failed drift journal entries:\n got %q\nwant %q", failed, want)
+	}
+
+	// The next pass repairs what the failed one could not
+	cloud.SetError("UpdateRouteTables", nil)
+	cloud.SetError("ReassignFloatingIPs", nil)
+	if err := lf.reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if target, holder := cloud.RouteTarget("rtb-1", testDestinationCIDR), cloud.ENIWithIP(testFloatingIP); target != "eni-a" || holder != "eni-a" {
+		t.Fatalf("after the next pass the route targets %s and %s holds the floating IP, want eni-a", target, holder)
+	}
+}
+
+func TestReconcileFenced(t *testing.T) {
+	tests := []struct {
+		name  string
+		fence func(t *testing.T, lf *LeaderFailover, cloud *MemoryCloud)
+	}{
+		{
+			name: "newer epoch in the cloud",
+			fence: func(t *testing.T, lf *LeaderFailover, cloud *MemoryCloud) {
+				other := NewMemoryCloudProvider(cloud, "i-b")
+				if err := other.SetEpochTag(context.Background(), "eni-a", lf.epochs.leader()+1); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "newer epoch observed",
+			fence: func(t *testing.T, lf *LeaderFailover, _ *MemoryCloud) {
+				lf.observeEpoch(lf.epochs.leader()+1, "peer")
+			},
+		},
+		{
+			name: "stepped down",
+			fence: func(_ *testing.T, lf *LeaderFailover, _ *MemoryCloud) {
+				lf.epochs.resign()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloud := newTestCloud(withFloatingIP, withEIPs)
+			lf, _ := newTestPrimary(t, cloud, reconcilingPair)
+			driftToENIB(t, cloud)
+			tt.fence(t, lf, cloud)
+			ops := []string{"UpdateRouteTables", "ReassignFloatingIPs", "AssociateEIP"}
+			before := make(map[string]int)
+			for _, op := range ops {
+				before[op] = cloud.Calls(op)
+			}
+
+			if err := lf.reconcile(context.Background()); !errors.Is(err, ErrStaleEpoch) {
+				t.Fatalf("reconcile: got %v, want a stale epoch", err)
+			}
+			for _, op := range ops {
+				if calls := cloud.Calls(op) - before[op]; calls != 0 {
+					t.Fatalf("fenced node called %s %d time(s)", op, calls)
+				}
+			}
+			if target := cloud.RouteTarget("rtb-1", testDestinationCIDR); target != "eni-b" {
+				t.Fatalf("route target: got %s, want it left on eni-b", target)
+			}
+			if _, corrections := lf.reconcileStatus(); len(corrections) != 0 {
+				t.Fatalf("fenced node recorded corrections %+v", corrections)
+			}
+		})
+	}
+}
+
+func TestReconcileLoopSkips(t *testing.T) {
+	tests := []struct {
+		name  string
+		pause func(lf *LeaderFailover, paused bool)
+	}{
+		{name: "maintenance mode", pause: func(lf *LeaderFailover, paused bool) { lf.maintenance.Store(paused) }},
+		{name: "switchover", pause: func(lf *LeaderFailover, paused bool) { lf.switchingOver.Store(paused) }},
+		{
+			name: "not primary",
+			pause: func(lf *LeaderFailover, paused bool) {
+				lf.stateMutex.Lock()
+				defer lf.stateMutex.Unlock()
+				lf.state = StatePrimary
+				if paused {
+					lf.state = StateDemoting
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloud := newTestCloud(withFloatingIP, withEIPs)
+			lf, _ := newTestPrimary(t, cloud, reconcilingPair)
+			driftToENIB(t, cloud)
+			tt.pause(lf, true)
+			before := cloud.Calls("GetEpochTag") + cloud.Calls("UpdateRouteTables")
+
+			stopCh := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				lf.reconcileLoop(context.Background(), stopCh)
+			}()
+			t.Cleanup(func() {
+				close(stopCh)
+				<-done
+			})
+
+			// Many intervals pass without the pass so much as checking the fence
+			time.Sleep(20 * lf.config.ReconcileInterval)
+			if calls := cloud.Calls("GetEpochTag") + cloud.Calls("UpdateRouteTables") - before; calls != 0 {
+				t.Fatalf("skipped passes made %d cloud calls", calls)
+			}
+
+			tt.pause(lf, false)
+			deadline := time.Now().Add(5 * time.Second)
+			for cloud.RouteTarget("rtb-1", testDestinationCIDR) != "eni-a" {
+				if time.Now().After(deadline) {
+					t.Fatal("drift not repaired once the pass was no longer skipped")
+				}
+				time.Sleep(lf.config.ReconcileInterval)
+			}
+		})
+	}
+}
+
+func TestReconcileForgetsReleasedEIP(t *testing.T) {
+	ctx := context.Background()
+	cloud := newTestCloud(withFloatingIP, withEIPs)
+	lf, _ := newTestPrimary(t, cloud, reconcilingPair)
+	if err := lf.reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lf.managedEIPs["eipalloc-2"]; !ok {
+		t.Fatalf("managed EIPs %v lack the floating IP's eipalloc-2", lf.managedEIPs)
+	}
+
+	cloud.ReleaseEIP("eipalloc-2")
+	if err := lf.reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lf.managedEIPs["eipalloc-2"]; ok {
+		t.Fatal("released EIP eipalloc-2 is still managed")
+	}
+	if _, ok := lf.managedEIPs["eipalloc-1"]; !ok {
+		t.Fatal("EIP eipalloc-1 is no longer managed")
+	}
+	if _, corrections := lf.reconcileStatus(); len(corrections) != 0 {
+		t.Fatalf("released EIP was corrected: %+v", corrections)
+	}
+}
+
+func TestReconcileOtherVPC(t *testing.T) {
+	ctx := context.Background()
+	cloud := newTestCloud(withFloatingIP, withEIPs, withOtherVPC)
+	lf, _ := newTestPrimary(t, cloud, reconcilingPair)
+
+	// EIPs of the pair's private IPs in another VPC have not drifted, they are not the pair's
+	for range 2 {
+		if err := lf.reconcile(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkOtherVPC(t, cloud)
+	if _, corrections := lf.reconcileStatus(); len(corrections) != 0 {
+		t.Fatalf("got corrections %+v, want none", corrections)
+	}
+	if got := slices.Sorted(maps.Keys(lf.managedEIPs)); !slices.Equal(got, []string{"eipalloc-1", "eipalloc-2"}) {
+		t.Fatalf("managed EIPs: got %v, want the pair's eipalloc-1 and eipalloc-2", got)
+	}
+}
+
+func TestValidateReconcileSelection(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  LeaderConfig
+		wantErr bool
+	}{
+		{name: "disabled with default discovery", config: LeaderConfig{}},
+		{name: "default discovery", config: LeaderConfig{ReconcileInterval: time.Minute}, wantErr: true},
+		{name: "route tables by default discovery", config: LeaderConfig{ReconcileInterval: time.Minute, ManagedENIs: []string{"eni-a"}}, wantErr: true},
+		{name: "ENIs by default discovery", config: LeaderConfig{ReconcileInterval: time.Minute, RouteTables: []string{"rtb-1"}}, wantErr: true},
+		{name: "listed", config: LeaderConfig{ReconcileInterval: time.Minute, ManagedENIs: []string{"eni-a"}, RouteTables: []string{"rtb-1"}}},
+		{name: "tagged", config: LeaderConfig{ReconcileInterval: time.Minute, ResourceTags: []string{"pair=a"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.ENIIP = testENIIP
+			config.DestinationCIDR = testDestinationCIDR
+			config.LocalSocket = "/unix/tmp/conduit.sock"
+			config.StateDir = t.TempDir()
+
+			if err := config.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("validate: got %v, want an error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
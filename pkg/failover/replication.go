@@ -0,0 +1,775 @@
+package failover
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/loopholelabs/architect-networking/pkg/client"
+)
+
+// natDeltaHistory is the number of deltas the primary retains for secondaries that fall behind.
+// A secondary further behind than this receives a full resync.
+const natDeltaHistory = 64
+
+var ErrDeltaMismatch = errors.New("NAT delta does not apply to local state")
+
+// NAT tables in the order they appear in client.NATState. Chunked resyncs page
+// through them in this order, followed by the port bitmaps.
+const (
+	natTableTCPInbound = iota
+	natTableTCPOutbound
+	natTableUDPInbound
+	natTableUDPOutbound
+	natTableCount
+	natTablePorts = natTableCount
+)
+
+// natPortKey identifies a port allocation bitmap
+type natPortKey struct {
+	natIP         string
+	destinationIP string // empty when the bitmap applies to all destinations
+}
+
+func natPortKeyOf(bp client.NATBitmapPair) natPortKey {
+	key := natPortKey{natIP: bp.NATIP}
+	if bp.DestinationIP != nil {
+		key.destinationIP = *bp.DestinationIP
+	}
+	return key
+}
+
+// natSnapshot is an indexed copy of the NAT state used to compute and apply deltas
+type natSnapshot struct {
+	ips    []string
+	tables [natTableCount]map[client.NATKey]client.NATValue
+	ports  map[natPortKey]client.NATBitmapPair
+}
+
+// natTables returns the NAT tables of a state in natTable order
+func natTables(state *client.NATState) [natTableCount]*[]client.NATKeyValuePair {
+	return [natTableCount]*[]client.NATKeyValuePair{
+		&state.TCPInbound,
+		&state.TCPOutbound,
+		&state.UDPInbound,
+		&state.UDPOutbound,
+	}
+}
+
+// newNATSnapshot indexes a NAT state
+func newNATSnapshot(state *client.NATState) *natSnapshot {
+	s := emptyNATSnapshot()
+	s.ips = slices.Clone(state.IPs)
+	for i, table := range natTables(state) {
+		for _, kv := range *table {
+			s.tables[i][kv.Key] = kv.Value
+		}
+	}
+	for _, bp := range state.NATPorts {
+		s.ports[natPortKeyOf(bp)] = bp
+	}
+	return s
+}
+
+// emptyNATSnapshot creates a snapshot with no entries
+func emptyNATSnapshot() *natSnapshot {
+	s := &natSnapshot{
+		ports: make(map[natPortKey]client.NATBitmapPair),
+	}
+	for i := range s.tables {
+		s.tables[i] = make(map[client.NATKey]client.NATValue)
+	}
+	return s
+}
+
+// state converts the snapshot back into a NAT state
+func (s *natSnapshot) state() *client.NATState {
+	state := &client.NATState{
+		IPs:      slices.Clone(s.ips),
+		NATPorts: make([]client.NATBitmapPair, 0, len(s.ports)),
+	}
+	for i, table := range natTables(state) {
+		*table = make([]client.NATKeyValuePair, 0, len(s.tables[i]))
+		for key, value := range s.tables[i] {
+			*table = append(*table, client.NATKeyValuePair{Key: key, Value: value})
+		}
+	}
+	for _, bp := range s.ports {
+		state.NATPorts = append(state.NATPorts, bp)
+	}
+	return state
+}
+
+// natTableNames are the JSON names of the NAT tables in natTable order
+var natTableNames = [natTableCount]string{"TCPInbound", "TCPOutbound", "UDPInbound", "UDPOutbound"}
+
+// encode writes the snapshot as the JSON of a NAT state one entry at a time, so applying
+// it to Conduit never copies the whole state into slices first
+func (s *natSnapshot) encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	ips := s.ips
+	if ips == nil {
+		ips = []string{}
+	}
+	_, _ = bw.WriteString(`{"IPs":`)
+	if err := json.NewEncoder(bw).Encode(ips); err != nil {
+		return err
+	}
+	if err := encodeJSONArray(bw, "NATPorts", maps.Values(s.ports)); err != nil {
+		return err
+	}
+	for i, name := range natTableNames {
+		entries := func(yield func(client.NATKeyValuePair) bool) {
+			for key, value := range s.tables[i] {
+				if !yield(client.NATKeyValuePair{Key: key, Value: value}) {
+					return
+				}
+			}
+		}
+		if err := encodeJSONArray(bw, name, entries); err != nil {
+			return err
+		}
+	}
+	_, _ = bw.WriteString("}")
+
+	return bw.Flush()
+}
+
+// encodeJSONArray writes an object member holding values as a JSON array
+func encodeJSONArray[T any](w *bufio.Writer, name string, values iter.Seq[T]) error {
+	_, _ = w.WriteString(`,"` + name + `":[`)
+	enc := json.NewEncoder(w)
+	first := true
+	for value := range values {
+		if !first {
+			_ = w.WriteByte(',')
+		}
+		first = false
+		if err := enc.Encode(value); err != nil {
+			return err
+		}
+	}
+	_, err := w.WriteString("]")
+	return err
+}
+
+// entries counts the NAT table entries in the snapshot
+func (s *natSnapshot) entries() int {
+	n := 0
+	for _, table := range s.tables {
+		n += len(table)
+	}
+	return n
+}
+
+// natChangeOp is the kind of change made to a NAT entry
+type natChangeOp int
+
+const (
+	natChangeInsert natChangeOp = iota // new entry, or an existing entry with a new translation
+	natChangeTouch                     // only LastSeen changed
+	natChangeDelete
+)
+
+// natChange is a change to a single NAT entry
+type natChange struct {
+	op    natChangeOp
+	value client.NATValue
+}
+
+// natDelta holds the changes between two snapshots
+type natDelta struct {
+	ips    []string
+	tables [natTableCount]map[client.NATKey]natChange
+	ports  map[natPortKey]*client.NATBitmapPair // nil value means the bitmap was deleted
+}
+
+func newNATDelta() *natDelta {
+	d := &natDelta{
+		ports: make(map[natPortKey]*client.NATBitmapPair),
+	}
+	for i := range d.tables {
+		d.tables[i] = make(map[client.NATKey]natChange)
+	}
+	return d
+}
+
+// diffNATSnapshots computes the changes that turn prev into next
+func diffNATSnapshots(prev, next *natSnapshot) *natDelta {
+	d := newNATDelta()
+	d.ips = slices.Clone(next.ips)
+
+	for i := range next.tables {
+		for key, value := range next.tables[i] {
+			old, ok := prev.tables[i][key]
+			switch {
+			case !ok || old.TranslateIP != value.TranslateIP || old.TranslatePort != value.TranslatePort:
+				d.tables[i][key] = natChange{op: natChangeInsert, value: value}
+			case old.LastSeen != value.LastSeen:
+				d.tables[i][key] = natChange{op: natChangeTouch, value: value}
+			}
+		}
+		for key := range prev.tables[i] {
+			if _, ok := next.tables[i][key]; !ok {
+				d.tables[i][key] = natChange{op: natChangeDelete}
+			}
+		}
+	}
+
+	for key, bp := range next.ports {
+		old, ok := prev.ports[key]
+		if !ok || old.Bitmap != bp.Bitmap || old.LastChunk != bp.LastChunk {
+			d.ports[key] = &bp
+		}
+	}
+	for key := range prev.ports {
+		if _, ok := next.ports[key]; !ok {
+			d.ports[key] = nil
+		}
+	}
+
+	return d
+}
+
+// changed reports whether the delta changes anything other than the IP list
+func (d *natDelta) changed() bool {
+	if len(d.ports) > 0 {
+		return true
+	}
+	for i := range d.tables {
+		if len(d.tables[i]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// merge folds a later delta into d, so d describes both
+func (d *natDelta) merge(next *natDelta) {
+	d.ips = next.ips
+
+	for i := range next.tables {
+		for key, change := range next.tables[i] {
+			// A touch of an entry inserted earlier in the window is still an insert
+			if prev, ok := d.tables[i][key]; ok && prev.op == natChangeInsert && change.op == natChangeTouch {
+				change.op = natChangeInsert
+			}
+			d.tables[i][key] = change
+		}
+	}
+
+	for key, bp := range next.ports {
+		d.ports[key] = bp
+	}
+}
+
+// frpc converts the delta to its wire representation
+func (d *natDelta) frpc() *FailoverNATDelta {
+	tables := [natTableCount]*FailoverNATTableDelta{}
+	for i := range d.tables {
+		tables[i] = &FailoverNATTableDelta{}
+		for key, change := range d.tables[i] {
+			switch change.op {
+			case natChangeInsert:
+				tables[i].Inserts = append(tables[i].Inserts, natKeyValueToFRPC(client.NATKeyValuePair{Key: key, Value: change.value}))
+			case natChangeTouch:
+				tables[i].Touches = append(tables[i].Touches, &FailoverNATKeyTouch{Key: natKeyToFRPC(key), LastSeen: change.value.LastSeen})
+			case natChangeDelete:
+				tables[i].Deletes = append(tables[i].Deletes, natKeyToFRPC(key))
+			}
+		}
+	}
+
+	delta := &FailoverNATDelta{
+		Ips:         d.ips,
+		TcpInbound:  tables[natTableTCPInbound],
+		TcpOutbound: tables[natTableTCPOutbound],
+		UdpInbound:  tables[natTableUDPInbound],
+		UdpOutbound: tables[natTableUDPOutbound],
+	}
+	for key, bp := range d.ports {
+		if bp == nil {
+			delta.NatPortDeletes = append(delta.NatPortDeletes, &FailoverNATBitmapPair{Natip: key.natIP, DestinationIp: key.destinationIP})
+		} else {
+			delta.NatPortUpdates = append(delta.NatPortUpdates, natBitmapPairToFRPC(*bp))
+		}
+	}
+	return delta
+}
+
+// natDeltaFromFRPC converts the wire representation of a delta
+func natDeltaFromFRPC(delta *FailoverNATDelta) *natDelta {
+	d := newNATDelta()
+	d.ips = delta.Ips
+
+	tables := [natTableCount]*FailoverNATTableDelta{delta.TcpInbound, delta.TcpOutbound, delta.UdpInbound, delta.UdpOutbound}
+	for i, table := range tables {
+		if table == nil {
+			continue
+		}
+		for _, kv := range table.Inserts {
+			entry := natKeyValueFromFRPC(kv)
+			d.tables[i][entry.Key] = natChange{op: natChangeInsert, value: entry.Value}
+		}
+		for _, touch := range table.Touches {
+			d.tables[i][natKeyFromFRPC(touch.Key)] = natChange{op: natChangeTouch, value: client.NATValue{LastSeen: touch.LastSeen}}
+		}
+		for _, k := range table.Deletes {
+			d.tables[i][natKeyFromFRPC(k)] = natChange{op: natChangeDelete}
+		}
+	}
+
+	for _, bp := range delta.NatPortUpdates {
+		pair := natBitmapPairFromFRPC(bp)
+		d.ports[natPortKeyOf(pair)] = &pair
+	}
+	for _, bp := range delta.NatPortDeletes {
+		d.ports[natPortKeyOf(natBitmapPairFromFRPC(bp))] = nil
+	}
+
+	return d
+}
+
+// apply applies a delta received from the primary to the snapshot. It reports whether
+// anything changed, and fails if the delta references entries the snapshot does not have.
+func (s *natSnapshot) apply(d *natDelta) (bool, error) {
+	changed := !slices.Equal(s.ips, d.ips)
+	s.ips = slices.Clone(d.ips)
+
+	for i := range d.tables {
+		for key, change := range d.tables[i] {
+			switch change.op {
+			case natChangeInsert:
+				s.tables[i][key] = change.value
+			case natChangeTouch:
+				value, ok := s.tables[i][key]
+				if !ok {
+					return changed, fmt.Errorf("%w: touched entry %s:%d -> %s:%d is missing", ErrDeltaMismatch, key.SourceIP, key.SourcePort, key.DestinationIP, key.DestinationPort)
+				}
+				value.LastSeen = change.value.LastSeen
+				s.tables[i][key] = value
+			case natChangeDelete:
+				delete(s.tables[i], key)
+			}
+			changed = true
+		}
+	}
+
+	for key, bp := range d.ports {
+		if bp == nil {
+			delete(s.ports, key)
+		} else {
+			s.ports[key] = *bp
+		}
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// natReplicator tracks versions of the primary's NAT state so secondaries can
+// request only the changes since the version they last applied. Deltas only shrink what
+// is sent to the secondary: Conduit reads and writes the NAT state as a whole, so every
+// sync still fetches, indexes and diffs the full state on the primary.
+type natReplicator struct {
+	mu       sync.Mutex
+	streamID string
+	version  uint64
+	state    *client.NATState // state at version as fetched from conduit
+	snapshot *natSnapshot
+	deltas   []*natDelta // deltas[i] turns version (version-len(deltas)+i) into the next one
+
+	// State held for each in-progress chunked resync by the ID of the node requesting it, so
+	// each resync can resume after a dropped connection without restarting the others
+	pinned map[string]natPin
+}
+
+// natPin is the NAT state a chunked resync pages through and its version
+type natPin struct {
+	state   *client.NATState
+	version uint64
+}
+
+// newNATReplicator starts a new replication stream; secondaries of a previous stream get a full resync
+func newNATReplicator() *natReplicator {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	return &natReplicator{
+		streamID: hex.EncodeToString(id),
+		pinned:   make(map[string]natPin),
+	}
+}
+
+// update records the current NAT state, assigning a new version if it changed
+func (r *natReplicator) update(state *client.NATState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next := newNATSnapshot(state)
+	r.state = state
+	if r.snapshot == nil {
+		r.snapshot = next
+		r.version = 1
+		return
+	}
+
+	delta := diffNATSnapshots(r.snapshot, next)
+	ipsChanged := !slices.Equal(r.snapshot.ips, next.ips)
+	r.snapshot = next
+	if !delta.changed() && !ipsChanged {
+		return
+	}
+
+	r.version++
+	r.deltas = append(r.deltas, delta)
+	if len(r.deltas) > natDeltaHistory {
+		r.deltas = r.deltas[len(r.deltas)-natDeltaHistory:]
+	}
+}
+
+// since returns the changes from the given version to the current one, or nil if the
+// version is not from this stream or too old, in which case a full resync is needed
+func (r *natReplicator) since(streamID string, version uint64) (*natDelta, uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	oldest := r.version - uint64(len(r.deltas))
+	if streamID != r.streamID || version < oldest || version > r.version {
+		return nil, r.version
+	}
+
+	merged := newNATDelta()
+	merged.ips = slices.Clone(r.snapshot.ips)
+	for _, delta := range r.deltas[version-oldest:] {
+		merged.merge(delta)
+	}
+	return merged, r.version
+}
+
+// full returns the complete current NAT state and its version
+func (r *natReplicator) full() (*client.NATState, uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.snapshot.state(), r.version
+}
+
+// chunk returns one page of a chunked resync and its contents as a partial NAT state. A request
+// for version 0 pins the current state for the requesting node; its later pages are served from
+// the pinned state until it is released. Pages slice the pinned state rather than copy it, but
+// the whole state stays in memory until the secondary moves on to deltas, as Conduit cannot
+// return part of its state. Memory is not bounded on either side until Conduit can.
+func (r *natReplicator) chunk(req *FailoverSyncStateChunkRequest, limit int) (*FailoverSyncStateChunkResponse, *client.NATState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	response := &FailoverSyncStateChunkResponse{
+		StreamId: r.streamID,
+		Table:    req.Table,
+		Cursor:   req.Cursor,
+	}
+
+	pin, ok := r.pinned[req.NodeId]
+	if req.Version == 0 {
+		if r.state == nil {
+			return nil, nil, errors.New("no NAT state available")
+		}
+		pin = natPin{state: r.state, version: r.version}
+		r.pinned[req.NodeId] = pin
+	} else if req.StreamId != r.streamID || !ok || req.Version != pin.version {
+		response.Restart = true
+		return response, nil, nil
+	}
+	response.Version = pin.version
+
+	page := &client.NATState{}
+	if req.Table == natTableTCPInbound && req.Cursor == 0 {
+		page.IPs = pin.state.IPs
+	}
+
+	var size int
+	switch {
+	case req.Table < natTableCount:
+		table := *natTables(pin.state)[req.Table]
+		size = len(table)
+		*natTables(page)[req.Table] = table[min(int(req.Cursor), size):min(int(req.Cursor)+limit, size)]
+	case req.Table == natTablePorts:
+		size = len(pin.state.NATPorts)
+		page.NATPorts = pin.state.NATPorts[min(int(req.Cursor), size):min(int(req.Cursor)+limit, size)]
+	default:
+		return nil, nil, fmt.Errorf("invalid NAT table %d", req.Table)
+	}
+
+	next := req.Cursor + uint64(limit)
+	switch {
+	case next < uint64(size):
+		response.NextTable, response.NextCursor = req.Table, next
+	case req.Table == natTablePorts:
+		response.Done = true
+	default:
+		response.NextTable, response.NextCursor = req.Table+1, 0
+	}
+
+	return response, page, nil
+}
+
+// release drops the state pinned for a node's resync once it has moved past it
+func (r *natReplicator) release(nodeID, streamID string, version uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if pin, ok := r.pinned[nodeID]; ok && streamID == r.streamID && version >= pin.version {
+		delete(r.pinned, nodeID)
+	}
+}
+
+// natMirror is the secondary's copy of the primary's NAT state at a replication version
+type natMirror struct {
+	streamID string
+	version  uint64
+	snapshot *natSnapshot
+
+	// Progress of an in-progress chunked resync
+	resync *natResync
+}
+
+// natResync tracks a chunked resync so it can resume where it left off
+type natResync struct {
+	streamID string
+	version  uint64
+	table    uint32
+	cursor   uint64
+	snapshot *natSnapshot
+}
+
+// apply updates the mirror from a sync response and returns the state to apply locally,
+// or nil if nothing changed. The returned state is the complete mirror, as Conduit only
+// accepts the full state: a delta of one entry still costs a SetState of the whole table.
+func (m *natMirror) apply(response *FailoverSyncStateResponse) (*natSnapshot, error) {
+	if response.Full {
+		state, err := syncResponseState(response)
+		if err != nil {
+			return nil, err
+		}
+		m.snapshot = newNATSnapshot(state)
+		m.streamID = response.StreamId
+		m.version = response.Version
+		return m.snapshot, nil
+	}
+
+	if m.snapshot == nil || response.StreamId != m.streamID {
+		m.reset()
+		return nil, fmt.Errorf("%w: no base state for stream %s", ErrDeltaMismatch, response.StreamId)
+	}
+	delta, err := syncResponseDelta(response)
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := m.snapshot.apply(delta)
+	if err != nil {
+		m.reset()
+		return nil, err
+	}
+	m.version = response.Version
+
+	if !changed {
+		return nil, nil //nolint:nilnil // nothing to apply
+	}
+	return m.snapshot, nil
+}
+
+// reset forgets the mirrored state so the next sync is a full resync
+func (m *natMirror) reset() {
+	m.streamID = ""
+	m.version = 0
+	m.snapshot = nil
+	m.resync = nil
+}
+
+// applyChunk adds a page of a chunked resync to the mirror. It returns the complete
+// state once the last page has been applied, and nil before that. The mirror holds every
+// page received so far, so a resync needs memory for the whole table: bounding it needs
+// a Conduit endpoint that appends to its state, which Conduit does not have.
+func (m *natMirror) applyChunk(chunk *FailoverSyncStateChunkResponse) (*natSnapshot, error) {
+	if chunk.Restart {
+		m.resync = nil
+		return nil, nil //nolint:nilnil // resync restarts with the next page request
+	}
+
+	if m.resync == nil || chunk.Version != m.resync.version || chunk.StreamId != m.resync.streamID {
+		if chunk.Table != natTableTCPInbound || chunk.Cursor != 0 {
+			m.resync = nil
+			return nil, fmt.Errorf("%w: resync page %d/%d without a start", ErrDeltaMismatch, chunk.Table, chunk.Cursor)
+		}
+		m.resync = &natResync{
+			streamID: chunk.StreamId,
+			version:  chunk.Version,
+			snapshot: emptyNATSnapshot(),
+		}
+	}
+
+	page, err := syncChunkPage(chunk)
+	if err != nil {
+		m.resync = nil
+		return nil, err
+	}
+
+	r := m.resync
+	if chunk.Table == natTableTCPInbound && chunk.Cursor == 0 {
+		r.snapshot.ips = slices.Clone(page.IPs)
+	}
+	for i, table := range natTables(page) {
+		for _, kv := range *table {
+			r.snapshot.tables[i][kv.Key] = kv.Value
+		}
+	}
+	for _, bp := range page.NATPorts {
+		r.snapshot.ports[natPortKeyOf(bp)] = bp
+	}
+	r.table, r.cursor = chunk.NextTable, chunk.NextCursor
+
+	if !chunk.Done {
+		return nil, nil //nolint:nilnil // more pages to come
+	}
+
+	m.streamID = r.streamID
+	m.version = r.version
+	m.snapshot = r.snapshot
+	m.resync = nil
+
+	return m.snapshot, nil
+}
+
+func natKeyToFRPC(key client.NATKey) *FailoverNATKey {
+	return &FailoverNATKey{
+		DestinationIp:   key.DestinationIP,
+		DestinationPort: uint32(key.DestinationPort),
+		SourceIp:        key.SourceIP,
+		SourcePort:      uint32(key.SourcePort),
+	}
+}
+
+func natKeyFromFRPC(key *FailoverNATKey) client.NATKey {
+	if key == nil {
+		return client.NATKey{}
+	}
+	return client.NATKey{
+		DestinationIP:   key.DestinationIp,
+		DestinationPort: portUint32ToUint16(key.DestinationPort),
+		SourceIP:        key.SourceIp,
+		SourcePort:      portUint32ToUint16(key.SourcePort),
+	}
+}
+
+func natKeyValueToFRPC(kv client.NATKeyValuePair) *FailoverNATKeyValuePair {
+	return &FailoverNATKeyValuePair{
+		Key: natKeyToFRPC(kv.Key),
+		Value: &FailoverNATValue{
+			LastSeen:      kv.Value.LastSeen,
+			TranslateIp:   kv.Value.TranslateIP,
+			TranslatePort: uint32(kv.Value.TranslatePort),
+		},
+	}
+}
+
+func natKeyValueFromFRPC(kv *FailoverNATKeyValuePair) client.NATKeyValuePair {
+	pair := client.NATKeyValuePair{
+		Key: natKeyFromFRPC(kv.Key),
+	}
+	if kv.Value != nil {
+		pair.Value = client.NATValue{
+			LastSeen:      kv.Value.LastSeen,
+			TranslateIP:   kv.Value.TranslateIp,
+			TranslatePort: portUint32ToUint16(kv.Value.TranslatePort),
+		}
+	}
+	return pair
+}
+
+func natBitmapPairToFRPC(bp client.NATBitmapPair) *FailoverNATBitmapPair {
+	destIP := ""
+	if bp.DestinationIP != nil {
+		destIP = *bp.DestinationIP
+	}
+	return &FailoverNATBitmapPair{
+		Bitmap:        bp.Bitmap,
+		DestinationIp: destIP,
+		LastChunk:     uint32(bp.LastChunk),
+		Natip:         bp.NATIP,
+	}
+}
+
+func natBitmapPairFromFRPC(bp *FailoverNATBitmapPair) client.NATBitmapPair {
+	var destIP *string
+	if bp.DestinationIp != "" {
+		destIP = &bp.DestinationIp
+	}
+	return client.NATBitmapPair{
+		Bitmap:        bp.Bitmap,
+		DestinationIP: destIP,
+		LastChunk:     portUint32ToUint16(bp.LastChunk),
+		NATIP:         bp.Natip,
+	}
+}
+
+// natStateToFRPC converts the conduit NAT state to its wire representation
+func natStateToFRPC(state *client.NATState) *FailoverNATState {
+	frpcState := &FailoverNATState{
+		Ips:      state.IPs,
+		NatPorts: make([]*FailoverNATBitmapPair, len(state.NATPorts)),
+	}
+
+	tables := [natTableCount]*[]*FailoverNATKeyValuePair{
+		&frpcState.TcpInbound,
+		&frpcState.TcpOutbound,
+		&frpcState.UdpInbound,
+		&frpcState.UdpOutbound,
+	}
+	for i, table := range natTables(state) {
+		*tables[i] = make([]*FailoverNATKeyValuePair, len(*table))
+		for j, kv := range *table {
+			(*tables[i])[j] = natKeyValueToFRPC(kv)
+		}
+	}
+	for i, bp := range state.NATPorts {
+		frpcState.NatPorts[i] = natBitmapPairToFRPC(bp)
+	}
+
+	return frpcState
+}
+
+// natStateFromFRPC converts the wire representation of the NAT state to the conduit type
+func natStateFromFRPC(frpcState *FailoverNATState) *client.NATState {
+	state := &client.NATState{
+		IPs:      frpcState.Ips,
+		NATPorts: make([]client.NATBitmapPair, len(frpcState.NatPorts)),
+	}
+
+	tables := [natTableCount][]*FailoverNATKeyValuePair{
+		frpcState.TcpInbound,
+		frpcState.TcpOutbound,
+		frpcState.UdpInbound,
+		frpcState.UdpOutbound,
+	}
+	for i, table := range natTables(state) {
+		*table = make([]client.NATKeyValuePair, len(tables[i]))
+		for j, kv := range tables[i] {
+			(*table)[j] = natKeyValueFromFRPC(kv)
+		}
+	}
+	for i, bp := range frpcState.NatPorts {
+		state.NATPorts[i] = natBitmapPairFromFRPC(bp)
+	}
+
+	return state
+}
@@ -0,0 +1,354 @@
+package failover
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/loopholelabs/architect-networking/pkg/client"
+)
+
+// testNATKey is the key of the i-th entry of testNATEntries
+func testNATKey(i int) client.NATKey {
+	return client.NATKey{
+		DestinationIP:   "198.51.100.1",
+		DestinationPort: 443,
+		SourceIP:        "10.0.0." + strconv.Itoa(i+1),
+		SourcePort:      40000,
+	}
+}
+
+// testNATEntry is an outbound TCP entry for key i seen at lastSeen and translated to port
+func testNATEntry(i int, lastSeen string, port uint16) client.NATKeyValuePair {
+	return client.NATKeyValuePair{
+		Key:   testNATKey(i),
+		Value: client.NATValue{LastSeen: lastSeen, TranslateIP: "203.0.113.1", TranslatePort: port},
+	}
+}
+
+// testNATEntries builds a NAT state holding the given outbound TCP entries
+func testNATEntries(entries ...client.NATKeyValuePair) *client.NATState {
+	return &client.NATState{
+		IPs:         []string{"203.0.113.1"},
+		TCPOutbound: entries,
+	}
+}
+
+// natSnapshotsEqual compares two snapshots entry by entry
+func natSnapshotsEqual(a, b *natSnapshot) bool {
+	if !slices.Equal(a.ips, b.ips) {
+		return false
+	}
+	for i := range a.tables {
+		if !maps.Equal(a.tables[i], b.tables[i]) {
+			return false
+		}
+	}
+	return maps.EqualFunc(a.ports, b.ports, func(x, y client.NATBitmapPair) bool {
+		return x.Bitmap == y.Bitmap && x.LastChunk == y.LastChunk
+	})
+}
+
+func TestNATReplicatorDeltas(t *testing.T) {
+	a := func(lastSeen string, port uint16) client.NATKeyValuePair { return testNATEntry(0, lastSeen, port) }
+	b := func(lastSeen string, port uint16) client.NATKeyValuePair { return testNATEntry(1, lastSeen, port) }
+
+	tests := []struct {
+		name   string
+		states []*client.NATState // versions 1, 2, ... of the primary's state
+		since  uint64
+		want   map[int]natChange // change of each key index in the outbound TCP table
+	}{
+		{
+			name:   "insert",
+			states: []*client.NATState{testNATEntries(), testNATEntries(a("1", 20000))},
+			since:  1,
+			want:   map[int]natChange{0: {op: natChangeInsert, value: a("1", 20000).Value}},
+		},
+		{
+			name:   "delete then re-insert",
+			states: []*client.NATState{testNATEntries(a("1", 20000)), testNATEntries(), testNATEntries(a("3", 20001))},
+			since:  1,
+			want:   map[int]natChange{0: {op: natChangeInsert, value: a("3", 20001).Value}},
+		},
+		{
+			name:   "delete then re-insert the same translation",
+			states: []*client.NATState{testNATEntries(a("1", 20000)), testNATEntries(), testNATEntries(a("1", 20000))},
+			since:  1,
+			want:   map[int]natChange{0: {op: natChangeInsert, value: a("1", 20000).Value}},
+		},
+		{
+			name:   "touch after insert",
+			states: []*client.NATState{testNATEntries(), testNATEntries(a("1", 20000)), testNATEntries(a("2", 20000))},
+			since:  1,
+			want:   map[int]natChange{0: {op: natChangeInsert, value: a("2", 20000).Value}},
+		},
+		{
+			name:   "touches",
+			states: []*client.NATState{testNATEntries(a("1", 20000)), testNATEntries(a("2", 20000)), testNATEntries(a("3", 20000))},
+			since:  1,
+			want:   map[int]natChange{0: {op: natChangeTouch, value: a("3", 20000).Value}},
+		},
+		{
+			name:   "insert then delete",
+			states: []*client.NATState{testNATEntries(b("1", 20001)), testNATEntries(a("2", 20000), b("1", 20001)), testNATEntries(b("1", 20001))},
+			since:  1,
+			want:   map[int]natChange{0: {op: natChangeDelete}},
+		},
+		{
+			name:   "touch then new translation",
+			states: []*client.NATState{testNATEntries(a("1", 20000)), testNATEntries(a("2", 20000)), testNATEntries(a("3", 20005))},
+			since:  1,
+			want:   map[int]natChange{0: {op: natChangeInsert, value: a("3", 20005).Value}},
+		},
+		{
+			name:   "from a later version",
+			states: []*client.NATState{testNATEntries(), testNATEntries(a("1", 20000)), testNATEntries(a("1", 20000), b("2", 20001))},
+			since:  2,
+			want:   map[int]natChange{1: {op: natChangeInsert, value: b("2", 20001).Value}},
+		},
+		{
+			name:   "up to date",
+			states: []*client.NATState{testNATEntries(a("1", 20000)), testNATEntries(a("2", 20000))},
+			since:  2,
+			want:   map[int]natChange{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newNATReplicator()
+			for _, state := range tt.states {
+				r.update(state)
+			}
+
+			delta, version := r.since(r.streamID, tt.since)
+			if delta == nil {
+				t.Fatalf("no delta from version %d", tt.since)
+			}
+			if version != uint64(len(tt.states)) {
+				t.Fatalf("version: got %d, want %d", version, len(tt.states))
+			}
+
+			want := make(map[client.NATKey]natChange, len(tt.want))
+			for i, change := range tt.want {
+				want[testNATKey(i)] = change
+			}
+			if got := delta.tables[natTableTCPOutbound]; !maps.Equal(got, want) {
+				t.Fatalf("changes: got %v, want %v", got, want)
+			}
+
+			// The delta turns the state at the requested version into the current one
+			mirror := newNATSnapshot(tt.states[tt.since-1])
+			if _, err := mirror.apply(delta); err != nil {
+				t.Fatal(err)
+			}
+			if final := newNATSnapshot(tt.states[len(tt.states)-1]); !natSnapshotsEqual(mirror, final) {
+				t.Fatalf("applied delta: got %v, want %v", mirror.tables, final.tables)
+			}
+		})
+	}
+}
+
+func TestNATDeltaMerge(t *testing.T) {
+	keyA, keyB, keyC, keyD := testNATKey(0), testNATKey(1), testNATKey(2), testNATKey(3)
+	value := func(lastSeen string) client.NATValue {
+		return client.NATValue{LastSeen: lastSeen, TranslateIP: "203.0.113.1", TranslatePort: 20000}
+	}
+	portKey := natPortKey{natIP: "203.0.113.1"}
+	bitmap := client.NATBitmapPair{NATIP: "203.0.113.1", Bitmap: "1010", LastChunk: 1}
+
+	first := newNATDelta()
+	first.ips = []string{"203.0.113.1"}
+	first.tables[natTableUDPInbound][keyA] = natChange{op: natChangeInsert, value: value("1")}
+	first.tables[natTableUDPInbound][keyB] = natChange{op: natChangeTouch, value: value("1")}
+	first.tables[natTableUDPInbound][keyC] = natChange{op: natChangeDelete}
+	first.ports[portKey] = &bitmap
+
+	second := newNATDelta()
+	second.ips = []string{"203.0.113.1", "203.0.113.2"}
+	second.tables[natTableUDPInbound][keyA] = natChange{op: natChangeTouch, value: value("2")}
+	second.tables[natTableUDPInbound][keyB] = natChange{op: natChangeDelete}
+	second.tables[natTableUDPInbound][keyC] = natChange{op: natChangeInsert, value: value("2")}
+	second.tables[natTableUDPInbound][keyD] = natChange{op: natChangeTouch, value: value("2")}
+	second.ports[portKey] = nil
+
+	first.merge(second)
+
+	want := map[client.NATKey]natChange{
+		keyA: {op: natChangeInsert, value: value("2")},
+		keyB: {op: natChangeDelete},
+		keyC: {op: natChangeInsert, value: value("2")},
+		keyD: {op: natChangeTouch, value: value("2")},
+	}
+	if got := first.tables[natTableUDPInbound]; !maps.Equal(got, want) {
+		t.Fatalf("merged changes: got %v, want %v", got, want)
+	}
+	if bp, ok := first.ports[portKey]; !ok || bp != nil {
+		t.Fatalf("merged bitmap: got %v, want a delete", bp)
+	}
+	if !slices.Equal(first.ips, second.ips) {
+		t.Fatalf("merged IPs: got %v, want %v", first.ips, second.ips)
+	}
+}
+
+func TestNATReplicatorSinceFallsBackToFullResync(t *testing.T) {
+	r := newNATReplicator()
+	updates := natDeltaHistory + 3
+	for i := range updates {
+		r.update(testNATEntries(testNATEntry(0, strconv.Itoa(i), 20000)))
+	}
+	current := uint64(updates)
+	oldest := current - natDeltaHistory
+
+	tests := []struct {
+		name     string
+		streamID string
+		version  uint64
+		wantFull bool
+	}{
+		{name: "current version", streamID: r.streamID, version: current},
+		{name: "oldest retained version", streamID: r.streamID, version: oldest},
+		{name: "older than the retained deltas", streamID: r.streamID, version: oldest - 1, wantFull: true},
+		{name: "never synced", streamID: r.streamID, version: 0, wantFull: true},
+		{name: "ahead of the primary", streamID: r.streamID, version: current + 1, wantFull: true},
+		{name: "previous stream", streamID: "previous", version: current, wantFull: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta, version := r.since(tt.streamID, tt.version)
+			if full := delta == nil; full != tt.wantFull {
+				t.Fatalf("full resync: got %t, want %t", full, tt.wantFull)
+			}
+			if version != current {
+				t.Fatalf("version: got %d, want %d", version, current)
+			}
+		})
+	}
+}
+
+func TestNATMirrorApply(t *testing.T) {
+	base := testNATEntries(testNATEntry(0, "1", 20000))
+	touch := newNATDelta()
+	touch.ips = base.IPs
+	touch.tables[natTableTCPOutbound][testNATKey(0)] = natChange{op: natChangeTouch, value: client.NATValue{LastSeen: "2"}}
+	insert := newNATDelta()
+	insert.ips = base.IPs
+	insert.tables[natTableTCPOutbound][testNATKey(1)] = natChange{op: natChangeInsert, value: testNATEntry(1, "2", 20001).Value}
+
+	deltaResponse := func(t *testing.T, streamID string, version uint64, d *natDelta) *FailoverSyncStateResponse {
+		t.Helper()
+		response := &FailoverSyncStateResponse{StreamId: streamID, Version: version}
+		if err := setSyncDelta(response, &FailoverSyncStateRequest{WireVersion: WireVersionV1}, d); err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	tests := []struct {
+		name     string
+		mirror   func() natMirror
+		response func(t *testing.T) *FailoverSyncStateResponse
+		wantErr  error
+		want     *client.NATState
+	}{
+		{
+			name:     "delta on an empty mirror",
+			mirror:   func() natMirror { return natMirror{} },
+			response: func(t *testing.T) *FailoverSyncStateResponse { return deltaResponse(t, "stream", 2, insert) },
+			wantErr:  ErrDeltaMismatch,
+		},
+		{
+			name: "delta from another stream",
+			mirror: func() natMirror {
+				return natMirror{streamID: "previous", version: 1, snapshot: newNATSnapshot(base)}
+			},
+			response: func(t *testing.T) *FailoverSyncStateResponse { return deltaResponse(t, "stream", 2, insert) },
+			wantErr:  ErrDeltaMismatch,
+		},
+		{
+			name: "touch of an entry the mirror does not have",
+			mirror: func() natMirror {
+				return natMirror{streamID: "stream", version: 1, snapshot: emptyNATSnapshot()}
+			},
+			response: func(t *testing.T) *FailoverSyncStateResponse { return deltaResponse(t, "stream", 2, touch) },
+			wantErr:  ErrDeltaMismatch,
+		},
+		{
+			name: "insert into an empty snapshot",
+			mirror: func() natMirror {
+				return natMirror{streamID: "stream", version: 1, snapshot: emptyNATSnapshot()}
+			},
+			response: func(t *testing.T) *FailoverSyncStateResponse { return deltaResponse(t, "stream", 2, insert) },
+			want:     testNATEntries(testNATEntry(1, "2", 20001)),
+		},
+		{
+			name: "full state on an empty mirror",
+			mirror: func() natMirror {
+				return natMirror{}
+			},
+			response: func(t *testing.T) *FailoverSyncStateResponse {
+				response := &FailoverSyncStateResponse{StreamId: "stream", Version: 2, Full: true}
+				if err := setSyncState(response, &FailoverSyncStateRequest{WireVersion: WireVersionV1}, base); err != nil {
+					t.Fatal(err)
+				}
+				return response
+			},
+			want: base,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mirror := tt.mirror()
+			state, err := mirror.apply(tt.response(t))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("apply: got %v, want %v", err, tt.wantErr)
+				}
+				// The next sync starts over with a full resync
+				if mirror.snapshot != nil || mirror.version != 0 {
+					t.Fatalf("mirror kept version %d after a failed delta", mirror.version)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !natSnapshotsEqual(state, newNATSnapshot(tt.want)) {
+				t.Fatalf("applied state: got %+v, want %+v", state, tt.want)
+			}
+			if mirror.streamID != "stream" || mirror.version != 2 {
+				t.Fatalf("mirror: got stream %s version %d, want stream version 2", mirror.streamID, mirror.version)
+			}
+		})
+	}
+}
+
+func TestNATSnapshotEncode(t *testing.T) {
+	for _, state := range []*client.NATState{testNATState(1000), {}} {
+		snapshot := newNATSnapshot(state)
+
+		var buf bytes.Buffer
+		if err := snapshot.encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+		var decoded client.NATState
+		if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+			t.Fatalf("encoded snapshot is not a NAT state: %v", err)
+		}
+
+		if !natSnapshotsEqual(newNATSnapshot(&decoded), snapshot) {
+			t.Fatal("decoded state differs from the snapshot")
+		}
+		// Conduit is sent empty tables rather than nulls
+		if decoded.IPs == nil || decoded.NATPorts == nil || decoded.TCPInbound == nil || decoded.UDPOutbound == nil {
+			t.Fatalf("encoded empty tables as null: %s", buf.String())
+		}
+	}
+}
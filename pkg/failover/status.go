@@ -0,0 +1,343 @@
+package failover
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/loopholelabs/logging/types"
+)
+
+// Node names in a pair status
+const (
+	StatusNodeLocal = "local"
+	StatusNodePeer  = "peer"
+)
+
+// PairStatusConfig configures an inspection of both nodes of a failover pair
+type PairStatusConfig struct {
+	// Control socket of the failover daemon on this node
+	ControlSocket string
+
+	// fRPC address of the other node, discovered from the local daemon when empty
+	PeerAddr string
+
+	// TLS configuration for the fRPC connection to the peer, nil when TLS is disabled
+	TLSConfig *tls.Config
+
+	// Check ENI ownership and routes with the AWS API
+	CheckAWS bool
+
+	// Cloud provider to check instead of the AWS API
+	Cloud CloudProvider
+
+	// Logger instance
+	Logger types.Logger
+}
+
+// PairStatus is the combined view of a failover pair and the AWS state it controls
+type PairStatus struct {
+	Time  time.Time    `json:"time"`
+	Nodes []NodeStatus `json:"nodes"`
+	AWS   *AWSStatus   `json:"aws,omitempty"`
+
+	// Problems lists disagreements between the nodes and AWS
+	Problems []string `json:"problems"`
+}
+
+// NodeStatus is the state one node of the pair reports
+type NodeStatus struct {
+	Name             string    `json:"name"`
+	Addr             string    `json:"addr,omitempty"`
+	Error            string    `json:"error,omitempty"`
+	Role             string    `json:"role,omitempty"`
+	InstanceID       string    `json:"instance_id,omitempty"`
+	Epoch            uint64    `json:"epoch"`
+	Maintenance      bool      `json:"maintenance"`
+	Priority         uint32    `json:"priority"`
+	FrozenUntil      time.Time `json:"frozen_until,omitzero"`
+	LastHeartbeat    time.Time `json:"last_heartbeat,omitzero"`
+	MissedHeartbeats int       `json:"missed_heartbeats"`
+	LastSync         time.Time `json:"last_sync,omitzero"`
+
+	// Role transition state and the last transition, reported for the local node only
+	State          string           `json:"state,omitempty"`
+	LastTransition *StateTransition `json:"last_transition,omitempty"`
+
+	// Failure of the last Conduit health probe, reported for the local node only
+	HealthError string `json:"health_error,omitempty"`
+
+	// Heartbeats over each configured path to the other node, reported for the local node only
+	HeartbeatPaths []PathStats `json:"heartbeat_paths,omitempty"`
+
+	// Phi accrual failure detector state, reported for a local secondary using it only
+	Phi *PhiStats `json:"phi,omitempty"`
+
+	// BFD sessions with the other node, reported for the local node only
+	BFDSessions []BFDSessionStats `json:"bfd_sessions,omitempty"`
+
+	// Recent repairs of resources that drifted away from the primary, reported for the local node only
+	DriftCorrections []DriftCorrection `json:"drift_corrections,omitempty"`
+}
+
+// AWSStatus is the AWS view of which node is primary
+type AWSStatus struct {
+	ENIIP           string            `json:"eni_ip"`
+	ENIOwner        string            `json:"eni_owner,omitempty"`
+	ENI             string            `json:"eni,omitempty"`
+	DestinationCIDR string            `json:"destination_cidr,omitempty"`
+	Routes          map[string]string `json:"routes,omitempty"` // managed route tables only
+	Error           string            `json:"error,omitempty"`
+
+	// Resources the daemon's selector picks that the pair does not manage
+	Rejected []RejectedResource `json:"rejected,omitempty"`
+}
+
+// Reachable reports whether the node answered
+func (n *NodeStatus) Reachable() bool {
+	return n.Error == ""
+}
+
+// InspectPair queries the local daemon, the peer and AWS and reports where they disagree.
+// Nodes or AWS that cannot be reached are recorded in the status rather than failing it.
+func InspectPair(ctx context.Context, config *PairStatusConfig) *PairStatus {
+	status := &PairStatus{
+		Time:     time.Now(),
+		Problems: []string{},
+	}
+
+	local, localStatus := inspectLocal(ctx, config.ControlSocket)
+	status.Nodes = append(status.Nodes, local)
+
+	peerAddr := config.PeerAddr
+	if peerAddr == "" && localStatus != nil {
+		peerAddr = localStatus.PeerAddr
+	}
+	status.Nodes = append(status.Nodes, inspectPeer(ctx, peerAddr, config.TLSConfig, config.Logger))
+
+	if config.CheckAWS && localStatus != nil {
+		status.AWS = inspectAWS(ctx, config, localStatus.ENIIP, localStatus.DestinationCIDR, localStatus.Selector)
+	}
+
+	status.Problems = append(status.Problems, status.check()...)
+
+	return status
+}
+
+// inspectLocal reads the status of the daemon on this node from its control API
+func inspectLocal(ctx context.Context, socket string) (NodeStatus, *ControlStatus) {
+	node := NodeStatus{
+		Name: StatusNodeLocal,
+		Addr: socket,
+	}
+
+	controlClient, err := NewControlClient(socket)
+	if err != nil {
+		node.Error = err.Error()
+		return node, nil
+	}
+	status, err := controlClient.Status(ctx)
+	if err != nil {
+		node.Error = err.Error()
+		return node, nil
+	}
+
+	node.Role = status.Role
+	node.InstanceID = status.InstanceID
+	node.Epoch = status.Epoch
+	node.Maintenance = status.Maintenance
+	node.Priority = status.Priority
+	node.FrozenUntil = status.FrozenUntil
+	node.LastHeartbeat = status.LastHeartbeat
+	node.MissedHeartbeats = status.MissedHeartbeats
+	if status.LastSync != nil {
+		node.LastSync = status.LastSync.Time
+	}
+	if status.Health != nil && !status.Health.Healthy {
+		node.HealthError = status.Health.Error
+	}
+	node.State = status.State
+	if len(status.StateHistory) > 0 {
+		node.LastTransition = &status.StateHistory[len(status.StateHistory)-1]
+	}
+	node.HeartbeatPaths = status.HeartbeatPaths
+	node.Phi = status.Phi
+	node.BFDSessions = status.BFDSessions
+	node.DriftCorrections = status.DriftCorrections
+
+	return node, status
+}
+
+// inspectPeer asks the other node for its status with an fRPC health check probe
+func inspectPeer(ctx context.Context, addr string, tlsConfig *tls.Config, logger types.Logger) NodeStatus {
+	node := NodeStatus{
+		Name: StatusNodePeer,
+		Addr: addr,
+	}
+	if addr == "" {
+		node.Error = "peer address unknown, no secondary has registered with the local primary"
+		return node
+	}
+
+	c, err := NewClient(tlsConfig, logger)
+	if err != nil {
+		node.Error = fmt.Sprintf("failed to create fRPC client: %v", err)
+		return node
+	}
+	if err := c.Connect(addr); err != nil {
+		node.Error = fmt.Sprintf("failed to connect: %v", err)
+		return node
+	}
+	defer func() { _ = c.Close() }()
+
+	response, err := rpcResponse(c.FailoverService.HealthCheck(ctx, &FailoverHealthCheckRequest{
+		RequestId: fmt.Sprintf("status_%d", time.Now().UnixNano()),
+		Probe:     true,
+	}))
+	if err != nil {
+		node.Error = fmt.Sprintf("health check failed: %v", err)
+		return node
+	}
+
+	node.Role = response.NodeRole
+	node.InstanceID = response.InstanceId
+	node.Epoch = response.Epoch
+	node.Maintenance = response.Maintenance
+	node.Priority = response.Priority
+	node.MissedHeartbeats = int(response.MissedHeartbeats)
+	if response.FrozenUntil != 0 {
+		node.FrozenUntil = time.Unix(0, response.FrozenUntil)
+	}
+	if response.LastHeartbeat != 0 {
+		node.LastHeartbeat = time.Unix(0, response.LastHeartbeat)
+	}
+	if response.LastSync != 0 {
+		node.LastSync = time.Unix(0, response.LastSync)
+	}
+
+	return node
+}
+
+// inspectAWS looks up the instance holding the ENI IP and where the routes of the route
+// tables the daemon's selector manages point
+func inspectAWS(ctx context.Context, config *PairStatusConfig, eniIP, destinationCIDR string, selector ResourceSelector) *AWSStatus {
+	status := &AWSStatus{
+		ENIIP:           eniIP,
+		DestinationCIDR: destinationCIDR,
+	}
+
+	cloud := config.Cloud
+	if cloud == nil {
+		awsClient, err := NewAWSClient(ctx, config.Logger)
+		if err != nil {
+			status.Error = err.Error()
+			return status
+		}
+		cloud = awsClient
+	}
+
+	owner, err := cloud.GetENIOwner(ctx, eniIP)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.ENIOwner = owner
+
+	resources, err := DiscoverResources(ctx, cloud, eniIP, destinationCIDR, selector)
+	if err != nil {
+		status.Error = fmt.Sprintf("failed to discover resources: %v", err)
+		return status
+	}
+	status.ENI = resources.PrimaryENI
+	status.Rejected = resources.Rejected
+
+	if destinationCIDR != "" {
+		targets, err := cloud.GetRouteTargets(ctx, resources.VPCID, destinationCIDR)
+		if err != nil {
+			status.Error = err.Error()
+			return status
+		}
+		status.Routes = make(map[string]string, len(resources.RouteTables))
+		for _, routeTable := range resources.RouteTables {
+			status.Routes[routeTable] = targets[routeTable]
+		}
+	}
+
+	return status
+}
+
+// check compares what the nodes believe with each other and with AWS
+func (s *PairStatus) check() []string {
+	var problems []string
+
+	var primaries []NodeStatus
+	for _, node := range s.Nodes {
+		if !node.Reachable() {
+			problems = append(problems, fmt.Sprintf("%s node is unreachable: %s", node.Name, node.Error))
+			continue
+		}
+		if node.Role == RoleStringPrimary {
+			primaries = append(primaries, node)
+		}
+		if node.Maintenance {
+			problems = append(problems, fmt.Sprintf("%s node is in maintenance mode", node.Name))
+		}
+		if !node.FrozenUntil.IsZero() {
+			problems = append(problems, fmt.Sprintf("%s node froze automatic failover after role flapping until %s", node.Name, node.FrozenUntil.Format(time.RFC3339)))
+		}
+		if node.State == StateFailed.String() {
+			problems = append(problems, fmt.Sprintf("%s node failed its last role transition", node.Name))
+		}
+		if node.HealthError != "" {
+			problems = append(problems, fmt.Sprintf("%s node failed its Conduit health probe: %s", node.Name, node.HealthError))
+		}
+		for _, path := range node.HeartbeatPaths {
+			if !path.Healthy() {
+				problems = append(problems, fmt.Sprintf("%s node heartbeat path %s is down", node.Name, path.Addr))
+			}
+		}
+		for _, session := range node.BFDSessions {
+			if !session.Up() {
+				problems = append(problems, fmt.Sprintf("%s node BFD session with %s is %s", node.Name, session.Peer, session.State))
+			}
+		}
+		if n := len(node.DriftCorrections); n > 0 && node.Role == RoleStringPrimary && node.DriftCorrections[n-1].Error != "" {
+			last := node.DriftCorrections[n-1]
+			problems = append(problems, fmt.Sprintf("%s node failed to repair drifted %s %s: %s", node.Name, last.Action, last.Resource, last.Error))
+		}
+	}
+
+	switch {
+	case len(primaries) == 0:
+		problems = append(problems, "no node reports the primary role")
+	case len(primaries) > 1:
+		problems = append(problems, "both nodes report the primary role")
+	}
+
+	if s.AWS == nil {
+		return problems
+	}
+	if s.AWS.Error != "" {
+		return append(problems, "failed to check AWS: "+s.AWS.Error)
+	}
+
+	if len(primaries) == 1 && s.AWS.ENIOwner != primaries[0].InstanceID {
+		problems = append(problems, fmt.Sprintf("ENI IP %s is attached to %s, but %s reports the primary role", s.AWS.ENIIP, s.AWS.ENIOwner, primaries[0].InstanceID))
+	}
+	if s.AWS.DestinationCIDR != "" && len(s.AWS.Routes) == 0 {
+		problems = append(problems, "no managed route tables have a route to "+s.AWS.DestinationCIDR)
+	}
+	for _, rejected := range s.AWS.Rejected {
+		problems = append(problems, fmt.Sprintf("selected %s %s is not managed: %s", rejected.Kind, rejected.ID, rejected.Reason))
+	}
+	for _, routeTable := range slices.Sorted(maps.Keys(s.AWS.Routes)) {
+		if target := s.AWS.Routes[routeTable]; target != s.AWS.ENI {
+			problems = append(problems, fmt.Sprintf("route to %s in %s targets %s, not the primary ENI %s", s.AWS.DestinationCIDR, routeTable, target, s.AWS.ENI))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,119 @@
+package failover
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPairStatusCheck(t *testing.T) {
+	node := func(name, role, instance string) NodeStatus {
+		return NodeStatus{Name: name, Role: role, InstanceID: instance}
+	}
+	healthy := []NodeStatus{node(StatusNodeLocal, RoleStringPrimary, "i-a"), node(StatusNodePeer, RoleStringSecondary, "i-b")}
+
+	tests := []struct {
+		name        string
+		nodes       []NodeStatus
+		prepare     func(cloud *MemoryCloud)
+		routeTables []string // selected besides rtb-1
+		want        []string // substrings of the expected problems, in order
+	}{
+		{name: "healthy", nodes: healthy},
+		{
+			name:  "both primaries",
+			nodes: []NodeStatus{node(StatusNodeLocal, RoleStringPrimary, "i-a"), node(StatusNodePeer, RoleStringPrimary, "i-b")},
+			want:  []string{"both nodes report the primary role"},
+		},
+		{
+			name:  "ENI owner mismatch",
+			nodes: []NodeStatus{node(StatusNodeLocal, RoleStringSecondary, "i-a"), node(StatusNodePeer, RoleStringPrimary, "i-b")},
+			want:  []string{"ENI IP 10.0.1.5 is attached to i-a, but i-b reports the primary role"},
+		},
+		{
+			name:    "wrong route target",
+			nodes:   healthy,
+			prepare: func(cloud *MemoryCloud) { cloud.AddRoute("rtb-1", testDestinationCIDR, "eni-b") },
+			want:    []string{"route to 10.9.0.0/16 in rtb-1 targets eni-b, not the primary ENI eni-a"},
+		},
+		{
+			name:  "unreachable peer",
+			nodes: []NodeStatus{node(StatusNodeLocal, RoleStringPrimary, "i-a"), {Name: StatusNodePeer, Error: "failed to connect: refused"}},
+			want:  []string{"peer node is unreachable: failed to connect: refused"},
+		},
+		{
+			// Route tables the selector leaves out are not the pair's to check
+			name:  "unmanaged route table",
+			nodes: healthy,
+			prepare: func(cloud *MemoryCloud) {
+				cloud.AddRouteTable(CloudRouteTable{ID: "rtb-2", VPCID: "vpc-1", Routes: map[string]string{testDestinationCIDR: "eni-b"}})
+			},
+		},
+		{
+			name:        "selected route table without the route",
+			nodes:       healthy,
+			prepare:     func(cloud *MemoryCloud) { cloud.AddRouteTable(CloudRouteTable{ID: "rtb-2", VPCID: "vpc-1"}) },
+			routeTables: []string{"rtb-2"},
+			want:        []string{"selected route_table rtb-2 is not managed: no route to 10.9.0.0/16"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloud := newTestCloud()
+			if tt.prepare != nil {
+				tt.prepare(cloud)
+			}
+
+			selector := ResourceSelector{ENIs: []string{"eni-a", "eni-b"}, RouteTables: append([]string{"rtb-1"}, tt.routeTables...)}
+			config := &PairStatusConfig{Cloud: NewMemoryCloudProvider(cloud, "i-a")}
+			status := &PairStatus{
+				Nodes: tt.nodes,
+				AWS:   inspectAWS(context.Background(), config, testENIIP, testDestinationCIDR, selector),
+			}
+			if status.AWS.Error != "" {
+				t.Fatal(status.AWS.Error)
+			}
+
+			problems := status.check()
+			if len(problems) != len(tt.want) {
+				t.Fatalf("problems: got %q, want %d", problems, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(problems[i], want) {
+					t.Fatalf("problem %d: got %q, want %q", i, problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestInspectPairUsesSelector(t *testing.T) {
+	cloud := newTestCloud()
+	cloud.AddRouteTable(CloudRouteTable{ID: "rtb-2", VPCID: "vpc-1", Routes: map[string]string{testDestinationCIDR: "eni-b"}})
+
+	lf := newTestFailover(t, cloud, "i-a", func(config *LeaderConfig) {
+		config.RouteTables = []string{"rtb-1"}
+	})
+	lf.currentRole.Store(RolePrimary)
+	startTestControl(t, lf)
+
+	status := InspectPair(context.Background(), &PairStatusConfig{
+		ControlSocket: lf.config.ControlSocket,
+		CheckAWS:      true,
+		Cloud:         NewMemoryCloudProvider(cloud, "i-a"),
+	})
+	if status.AWS == nil || status.AWS.Error != "" {
+		t.Fatalf("AWS status: got %+v", status.AWS)
+	}
+	if routeTables := slices.Sorted(maps.Keys(status.AWS.Routes)); !slices.Equal(routeTables, []string{"rtb-1"}) {
+		t.Fatalf("checked route tables %v, want only the selected rtb-1", routeTables)
+	}
+
+	// No secondary registered, so only the peer is reported
+	if len(status.Problems) != 1 || !strings.Contains(status.Problems[0], "peer node is unreachable") {
+		t.Fatalf("problems: got %q, want only the unknown peer", status.Problems)
+	}
+}
@@ -0,0 +1,337 @@
+package failover
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// stepAttempts is the number of times a failover step is applied before it gives up
+const stepAttempts = 3
+
+// stepRetryBackoff is the wait before the first retry of a failover step, doubling with
+// every further attempt
+const stepRetryBackoff = 250 * time.Millisecond
+
+// stepRollbackTimeout bounds undoing a step that gave up, which runs even once the
+// promotion timeout has expired
+const stepRollbackTimeout = 30 * time.Second
+
+// failoverStep is one idempotent change of the failover sequence. A step whose change is
+// already in place is skipped, so retrying the failover or resuming one interrupted by a
+// restart only makes the changes still missing.
+type failoverStep struct {
+	action   string
+	resource string
+
+	// verify reports whether the change is in place
+	verify func(ctx context.Context) (bool, error)
+
+	// apply makes the change, and is called again after it failed part way
+	apply func(ctx context.Context) error
+
+	// rollback undoes what apply changed once the step gives up, nil for steps whose
+	// partial change is kept for a retry to complete
+	rollback func(ctx context.Context) error
+
+	// An optional step that gives up is logged instead of failing the failover
+	optional bool
+
+	// Journal event recording the step, JournalEventAction when empty
+	event string
+}
+
+// StepError is a failover step that gave up
+type StepError struct {
+	Action   string
+	Resource string
+	Attempts int
+
+	// The changes the step had made were undone
+	RolledBack bool
+
+	Err error
+}
+
+func (e *StepError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s failed after %d attempt(s)", e.Action, e.Resource, e.Attempts)
+	if e.RolledBack {
+		b.WriteString(" and was rolled back")
+	}
+	b.WriteString(": ")
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// FailoverError lists the failover steps that gave up
+type FailoverError struct {
+	Steps []*StepError
+}
+
+func (e *FailoverError) Error() string {
+	msgs := make([]string, len(e.Steps))
+	for i, step := range e.Steps {
+		msgs[i] = step.Error()
+	}
+	return fmt.Sprintf("%d failover step(s) failed: %s", len(e.Steps), strings.Join(msgs, "; "))
+}
+
+func (e *FailoverError) Unwrap() []error {
+	errs := make([]error, len(e.Steps))
+	for i, step := range e.Steps {
+		errs[i] = step
+	}
+	return errs
+}
+
+// failoverErr returns the steps that gave up as a FailoverError, nil when none did
+func failoverErr(steps []*StepError) error {
+	if len(steps) == 0 {
+		return nil
+	}
+	return &FailoverError{Steps: steps}
+}
+
+// runStep makes the change of a step unless it is already in place, retrying with
+// backoff until the change verifies. The leadership lease is renewed before every
+// attempt. A step that gives up is rolled back if it has a rollback.
+func (lf *LeaderFailover) runStep(ctx context.Context, step *failoverStep) *StepError {
+	start := time.Now()
+	entry := JournalEntry{
+		Event:    cmp.Or(step.event, JournalEventAction),
+		Action:   step.action,
+		Resource: step.resource,
+	}
+
+	// A failed check is not conclusive, applying the step finds out
+	if done, err := step.verify(ctx); err == nil && done {
+		lf.logger.Info().Str("action", step.action).Str("resource", step.resource).Msg("Failover step already in place")
+		entry.InPlace = true
+		entry.Duration = time.Since(start)
+		lf.journal.record(entry)
+		return nil
+	}
+
+	backoff := stepRetryBackoff
+	var err error
+	for entry.Attempts = 1; ; entry.Attempts++ {
+		if err = lf.renewLease(ctx); err != nil {
+			break
+		}
+		if err = step.apply(ctx); err == nil {
+			var done bool
+			if done, err = step.verify(ctx); err == nil && !done {
+				err = errors.New("change is not in place after it was made")
+			}
+		}
+		if err == nil || entry.Attempts >= stepAttempts {
+			break
+		}
+
+		lf.logger.Warn().Err(err).
+			Str("action", step.action).
+			Str("resource", step.resource).
+			Int("attempt", entry.Attempts).
+			Str("backoff", backoff.String()).
+			Msg("Failover step failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			err = errors.Join(err, ctx.Err())
+		case <-time.After(backoff):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		backoff *= 2
+	}
+
+	if err == nil {
+		entry.Duration = time.Since(start)
+		lf.journal.record(entry)
+		return nil
+	}
+
+	stepErr := &StepError{
+		Action:   step.action,
+		Resource: step.resource,
+		Attempts: entry.Attempts,
+		Err:      err,
+	}
+	if step.rollback != nil {
+		rollbackCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stepRollbackTimeout)
+		if rollbackErr := step.rollback(rollbackCtx); rollbackErr != nil {
+			stepErr.Err = errors.Join(err, fmt.Errorf("rollback failed: %w", rollbackErr))
+		} else {
+			stepErr.RolledBack = true
+		}
+		cancel()
+	}
+
+	entry.Duration = time.Since(start)
+	entry.RolledBack = stepErr.RolledBack
+	entry.Error = stepErr.Err.Error()
+	lf.journal.record(entry)
+
+	// Losing the lease fails the failover even in an optional step
+	if step.optional && !errors.Is(err, ErrLeaseNotHeld) {
+		lf.logger.Warn().Err(stepErr).Msg("Optional failover step failed, continuing")
+		return nil
+	}
+	return stepErr
+}
+
+// runSteps runs independent steps in order, returning those that gave up
+func (lf *LeaderFailover) runSteps(ctx context.Context, steps []*failoverStep) []*StepError {
+	var errs []*StepError
+	for _, step := range steps {
+		if err := lf.runStep(ctx, step); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// takeOverStep moves the ENI IP to the target ENI
+func (lf *LeaderFailover) takeOverStep(target string) *failoverStep {
+	return &failoverStep{
+		action:   ActionTakeOverENI,
+		resource: lf.config.ENIIP,
+		verify: func(ctx context.Context) (bool, error) {
+			holder, err := lf.cloud.GetENIByIP(ctx, lf.config.ENIIP)
+			return holder == target, err
+		},
+		apply: func(ctx context.Context) error {
+			return lf.cloud.TakeOverENI(ctx, lf.config.ENIIP)
+		},
+	}
+}
+
+// moveEIPStep associates an EIP with its private IP on the target ENI. The ENI IP and
+// floating IPs usually take their EIPs with them, but a primary without its EIPs still
+// routes private traffic, so the step is optional.
+func (lf *LeaderFailover) moveEIPStep(eip CloudEIP, target string) *failoverStep {
+	return &failoverStep{
+		action:   ActionMoveEIP,
+		resource: eip.AllocationID,
+		verify: func(ctx context.Context) (bool, error) {
+			eips, err := lf.cloud.DescribeEIPs(ctx, EIPFilter{AllocationIDs: []string{eip.AllocationID}})
+			return slices.ContainsFunc(eips, func(e CloudEIP) bool {
+				return e.ENI == target && e.PrivateIP == eip.PrivateIP
+			}), err
+		},
+		apply: func(ctx context.Context) error {
+			return lf.cloud.AssociateEIP(ctx, eip.AllocationID, target, eip.PrivateIP)
+		},
+		optional: true,
+	}
+}
+
+// stampEpochStep tags the target ENI with the epoch this node leads under
+func (lf *LeaderFailover) stampEpochStep(target string, epoch uint64) *failoverStep {
+	return &failoverStep{
+		action:   ActionStampEpoch,
+		resource: target,
+		verify: func(ctx context.Context) (bool, error) {
+			stamped, holder, err := lf.cloud.GetEpochTag(ctx, lf.config.ENIIP)
+			return stamped == epoch && holder == target, err
+		},
+		apply: func(ctx context.Context) error {
+			return lf.cloud.SetEpochTag(ctx, target, epoch)
+		},
+	}
+}
+
+// updateRouteStep points the route to the destination CIDR in a route table of the pair's
+// VPC at the target ENI
+func (lf *LeaderFailover) updateRouteStep(vpcID, routeTable, target string) *failoverStep {
+	return &failoverStep{
+		action:   ActionUpdateRoutes,
+		resource: routeTable,
+		verify: func(ctx context.Context) (bool, error) {
+			targets, err := lf.cloud.GetRouteTargets(ctx, vpcID, lf.config.DestinationCIDR)
+			return targets[routeTable] == target, err
+		},
+		apply: func(ctx context.Context) error {
+			return lf.cloud.UpdateRouteTables(ctx, lf.config.DestinationCIDR, target, []string{routeTable})
+		},
+	}
+}
+
+// reassignStep moves the floating IPs of a source ENI to the target ENI. In a failover the
+// source belongs to a primary that is gone, so IPs already moved stay on the target and a
+// retry moves only those still pending. In a planned switchover the old primary still
+// serves, so the IPs of its ENI move together: if only some of them can be moved, those
+// are moved back.
+func (lf *LeaderFailover) reassignStep(source, target string, ips []string) *failoverStep {
+	// held returns the IPs the target ENI holds
+	held := func(ctx context.Context) ([]string, error) {
+		enis, err := lf.cloud.DescribeENIs(ctx, ENIFilter{IDs: []string{target}})
+		if err != nil {
+			return nil, err
+		}
+		if len(enis) == 0 {
+			return nil, fmt.Errorf("network interface %s not found", target)
+		}
+		return slices.DeleteFunc(slices.Clone(ips), func(ip string) bool {
+			return !enis[0].HasIP(ip)
+		}), nil
+	}
+
+	step := &failoverStep{
+		action:   ActionReassignFloatingIPs,
+		resource: strings.Join(ips, ",") + " from " + source,
+		verify: func(ctx context.Context) (bool, error) {
+			moved, err := held(ctx)
+			return len(moved) == len(ips), err
+		},
+		apply: func(ctx context.Context) error {
+			moved, err := held(ctx)
+			if err != nil {
+				return err
+			}
+			pending := slices.DeleteFunc(slices.Clone(ips), func(ip string) bool {
+				return slices.Contains(moved, ip)
+			})
+			return lf.cloud.ReassignFloatingIPs(ctx, source, target, pending)
+		},
+	}
+	if !lf.switchingOver.Load() {
+		return step
+	}
+
+	step.rollback = func(ctx context.Context) error {
+		moved, err := held(ctx)
+		if err != nil {
+			return err
+		}
+		if len(moved) == 0 {
+			return nil
+		}
+		lf.logger.Warn().
+			Str("source_eni", source).
+			Str("ips", strings.Join(moved, ",")).
+			Msg("Moving floating IPs back to their ENI")
+		return lf.cloud.ReassignFloatingIPs(ctx, target, source, moved)
+	}
+	return step
+}
+
+// floatingIPSteps returns a step per ENI holding floating IPs to move, ordered by ENI
+func (lf *LeaderFailover) floatingIPSteps(moves map[string][]string, target string) []*failoverStep {
+	steps := make([]*failoverStep, 0, len(moves))
+	for _, source := range slices.Sorted(maps.Keys(moves)) {
+		steps = append(steps, lf.reassignStep(source, target, moves[source]))
+	}
+	return steps
+}
@@ -0,0 +1,340 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRunStepRetriesFailedApply(t *testing.T) {
+	cloud := newTestCloud()
+	lf := newTestFailover(t, cloud, "i-b", nil)
+	injected := errors.New("throttled")
+
+	cloud.FailNext("UpdateRouteTables", injected, injected)
+	if err := lf.runStep(context.Background(), lf.updateRouteStep("vpc-1", "rtb-1", "eni-b")); err != nil {
+		t.Fatal(err)
+	}
+	if calls := cloud.Calls("UpdateRouteTables"); calls != 3 {
+		t.Fatalf("route updates: got %d, want 3", calls)
+	}
+	if target := cloud.RouteTarget("rtb-1", testDestinationCIDR); target != "eni-b" {
+		t.Fatalf("route target: got %s, want eni-b", target)
+	}
+
+	// A change in place is not made again
+	if err := lf.runStep(context.Background(), lf.updateRouteStep("vpc-1", "rtb-1", "eni-b")); err != nil {
+		t.Fatal(err)
+	}
+	if calls := cloud.Calls("UpdateRouteTables"); calls != 3 {
+		t.Fatalf("route updates after the route was in place: got %d, want 3", calls)
+	}
+}
+
+func TestRunStepGivesUp(t *testing.T) {
+	cloud := newTestCloud()
+	lf := newTestFailover(t, cloud, "i-b", nil)
+	injected := errors.New("throttled")
+
+	cloud.FailNext("UpdateRouteTables", injected, injected, injected)
+	err := lf.runStep(context.Background(), lf.updateRouteStep("vpc-1", "rtb-1", "eni-b"))
+	if err == nil {
+		t.Fatal("step succeeded")
+	}
+	if err.Attempts != stepAttempts || err.Action != ActionUpdateRoutes || err.Resource != "rtb-1" || !errors.Is(err, injected) {
+		t.Fatalf("got %v after %d attempt(s), want %s of rtb-1 failing after %d", err, err.Attempts, ActionUpdateRoutes, stepAttempts)
+	}
+	if target := cloud.RouteTarget("rtb-1", testDestinationCIDR); target != "eni-a" {
+		t.Fatalf("route target: got %s, want eni-a", target)
+	}
+
+	// An optional step that gives up does not fail the failover
+	cloud.FailNext("UpdateRouteTables", injected, injected, injected)
+	step := lf.updateRouteStep("vpc-1", "rtb-1", "eni-b")
+	step.optional = true
+	if err := lf.runStep(context.Background(), step); err != nil {
+		t.Fatalf("optional step: got %v, want nil", err)
+	}
+}
+
+func TestRunStepTimesOut(t *testing.T) {
+	cloud := newTestCloud()
+	lf := newTestFailover(t, cloud, "i-b", nil)
+
+	// A hanging API call gives up with the promotion timeout instead of being retried
+	cloud.SetLatency("UpdateRouteTables", time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := lf.runStep(ctx, lf.updateRouteStep("vpc-1", "rtb-1", "eni-b"))
+	if err == nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the deadline exceeded", err)
+	}
+	if err.Attempts != 1 {
+		t.Fatalf("attempts: got %d, want 1", err.Attempts)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("step gave up after %s", elapsed)
+	}
+}
+
+func TestReassignStepKeepsMovedIPs(t *testing.T) {
+	cloud := newTestCloud(withFloatingIP)
+	lf := newTestFailover(t, cloud, "i-b", nil)
+	step := lf.reassignStep("eni-a", "eni-b", []string{testFloatingIP, "10.0.1.12"})
+
+	// The floating IP moves, but eni-c's primary IP never does. The primary is gone, so the
+	// step gives up leaving the floating IP on the target.
+	err := lf.runStep(context.Background(), step)
+	if err == nil {
+		t.Fatal("step succeeded")
+	}
+	if err.RolledBack || err.Attempts != stepAttempts {
+		t.Fatalf("got %v after %d attempt(s), want no rollback after %d", err, err.Attempts, stepAttempts)
+	}
+	if holder := cloud.ENIWithIP(testFloatingIP); holder != "eni-b" {
+		t.Fatalf("floating IP holder: got %s, want eni-b", holder)
+	}
+	if calls := cloud.Calls("ReassignFloatingIPs"); calls != stepAttempts {
+		t.Fatalf("reassignments: got %d, want %d", calls, stepAttempts)
+	}
+
+	// A retry only moves the IP still pending, the moved one is never lost
+	cloud.SetError("ReassignFloatingIPs", errors.New("throttled"))
+	if err := lf.runStep(context.Background(), step); err == nil {
+		t.Fatal("retry succeeded")
+	}
+	if holder := cloud.ENIWithIP(testFloatingIP); holder != "eni-b" {
+		t.Fatalf("floating IP holder after retry: got %s, want eni-b", holder)
+	}
+}
+
+func TestReassignStepRollback(t *testing.T) {
+	cloud := newTestCloud(withFloatingIP)
+	lf := newTestFailover(t, cloud, "i-b", nil)
+
+	// In a planned switchover the old primary still serves, so the step gives up by moving
+	// the floating IP back
+	lf.switchingOver.Store(true)
+	err := lf.runStep(context.Background(), lf.reassignStep("eni-a", "eni-b", []string{testFloatingIP, "10.0.1.12"}))
+	if err == nil {
+		t.Fatal("step succeeded")
+	}
+	if !err.RolledBack || err.Attempts != stepAttempts {
+		t.Fatalf("got %v after %d attempt(s), want a rollback after %d", err, err.Attempts, stepAttempts)
+	}
+	if holder := cloud.ENIWithIP(testFloatingIP); holder != "eni-a" {
+		t.Fatalf("floating IP holder after rollback: got %s, want eni-a", holder)
+	}
+	if calls := cloud.Calls("ReassignFloatingIPs"); calls != stepAttempts+1 {
+		t.Fatalf("reassignments: got %d, want %d attempts and the rollback", calls, stepAttempts+1)
+	}
+}
+
+func TestReassignStepRollbackFails(t *testing.T) {
+	cloud := newTestCloud(withFloatingIP)
+	lf := newTestFailover(t, cloud, "i-b", nil)
+	injected := errors.New("throttled")
+
+	// The attempts go through and move the floating IP, the rollback call fails
+	lf.switchingOver.Store(true)
+	cloud.FailNext("ReassignFloatingIPs", nil, nil, nil, injected)
+	err := lf.runStep(context.Background(), lf.reassignStep("eni-a", "eni-b", []string{testFloatingIP, "10.0.1.12"}))
+	if err == nil {
+		t.Fatal("step succeeded")
+	}
+	if err.RolledBack || !errors.Is(err, injected) {
+		t.Fatalf("got %v, want the failed rollback", err)
+	}
+	if holder := cloud.ENIWithIP(testFloatingIP); holder != "eni-b" {
+		t.Fatalf("floating IP holder: got %s, want eni-b", holder)
+	}
+}
+
+// managingFloatingIP has the node move the floating IP of withFloatingIP when it promotes
+func managingFloatingIP(config *LeaderConfig) {
+	config.FloatingIPs = []string{testFloatingIP}
+}
+
+func TestExecuteFailoverActions(t *testing.T) {
+	cloud := newTestCloud(withFloatingIP)
+	lf := newTestFailover(t, cloud, "i-b", managingFloatingIP)
+	leadTestEpoch(t, lf)
+
+	// Routes and floating IPs move in parallel
+	const latency = 300 * time.Millisecond
+	cloud.SetLatency("UpdateRouteTables", latency)
+	cloud.SetLatency("ReassignFloatingIPs", latency)
+
+	start := time.Now()
+	if err := lf.executeFailoverActions(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= 2*latency {
+		t.Fatalf("failover took %s, want routes and floating IPs moved in parallel", elapsed)
+	}
+
+	if holder := cloud.ENIWithIP(testENIIP); holder != "eni-b" {
+		t.Fatalf("ENI IP holder: got %s, want eni-b", holder)
+	}
+	if holder := cloud.ENIWithIP(testFloatingIP); holder != "eni-b" {
+		t.Fatalf("floating IP holder: got %s, want eni-b", holder)
+	}
+	if target := cloud.RouteTarget("rtb-1", testDestinationCIDR); target != "eni-b" {
+		t.Fatalf("route target: got %s, want eni-b", target)
+	}
+	if eni, _ := cloud.ENI("eni-b"); eni.Tags[EpochTagKey] != "1" {
+		t.Fatalf("epoch tag: got %q, want 1", eni.Tags[EpochTagKey])
+	}
+
+	// Running the failover again finds every change in place
+	cloud.SetLatency("UpdateRouteTables", 0)
+	cloud.SetLatency("ReassignFloatingIPs", 0)
+	if err := lf.executeFailoverActions(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls := cloud.Calls("TakeOverENI") + cloud.Calls("UpdateRouteTables") + cloud.Calls("ReassignFloatingIPs"); calls != 3 {
+		t.Fatalf("changes made by the second failover: got %d calls, want none", calls-3)
+	}
+}
+
+func TestExecuteFailoverActionsFailedStep(t *testing.T) {
+	cloud := newTestCloud(withFloatingIP)
+	lf := newTestFailover(t, cloud, "i-b", managingFloatingIP)
+	leadTestEpoch(t, lf)
+	injected := errors.New("throttled")
+
+	// A route table that cannot be updated fails the failover, the floating IP still moves
+	cloud.SetError("UpdateRouteTables", injected)
+	err := lf.executeFailoverActions(context.Background())
+	var failoverErr *FailoverError
+	if !errors.As(err, &failoverErr) || len(failoverErr.Steps) != 1 || failoverErr.Steps[0].Action != ActionUpdateRoutes {
+		t.Fatalf("got %v, want the route update to fail", err)
+	}
+	if !errors.Is(err, injected) {
+		t.Fatalf("got %v, want the injected error", err)
+	}
+	if holder := cloud.ENIWithIP(testFloatingIP); holder != "eni-b" {
+		t.Fatalf("floating IP holder: got %s, want eni-b", holder)
+	}
+
+	// The retried failover only updates the route
+	cloud.SetError("UpdateRouteTables", nil)
+	reassigned := cloud.Calls("ReassignFloatingIPs")
+	if err := lf.executeFailoverActions(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if target := cloud.RouteTarget("rtb-1", testDestinationCIDR); target != "eni-b" {
+		t.Fatalf("route target: got %s, want eni-b", target)
+	}
+	if calls := cloud.Calls("ReassignFloatingIPs"); calls != reassigned {
+		t.Fatalf("floating IP reassignments on retry: got %d, want none", calls-reassigned)
+	}
+}
+
+func TestExecuteFailoverActionsOtherVPC(t *testing.T) {
+	cloud := newTestCloud(withFloatingIP, withEIPs, withOtherVPC)
+	lf := newTestFailover(t, cloud, "i-b", managingFloatingIP)
+	leadTestEpoch(t, lf)
+
+	if err := lf.executeFailoverActions(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if eni, _ := cloud.ENI("eni-b"); !slices.Contains(eni.SecondaryIPs, testENIIP) || !slices.Contains(eni.SecondaryIPs, testFloatingIP) {
+		t.Fatalf("eni-b holds %v, want the ENI IP and the floating IP", eni.SecondaryIPs)
+	}
+	for allocationID, privateIP := range map[string]string{"eipalloc-1": testENIIP, "eipalloc-2": testFloatingIP} {
+		if eip, _ := cloud.EIP(allocationID); eip.ENI != "eni-b" || eip.PrivateIP != privateIP {
+			t.Fatalf("EIP %s: got %s on %s, want %s on eni-b", allocationID, eip.PrivateIP, eip.ENI, privateIP)
+		}
+	}
+
+	// The EIPs of the same private IPs in another VPC are neither moved nor managed
+	checkOtherVPC(t, cloud)
+	for _, allocationID := range []string{"eipalloc-8", "eipalloc-9"} {
+		if _, ok := lf.managedEIPs[allocationID]; ok {
+			t.Fatalf("EIP %s of the other VPC is managed", allocationID)
+		}
+	}
+}
+
+func TestResumeInterruptedPromotion(t *testing.T) {
+	cloud := newTestCloud()
+	dir := t.TempDir()
+	configure := func(config *LeaderConfig) {
+		config.StateDir = dir
+		config.Port = freeTCPPort(t)
+		config.PromotionAttempts = 1
+	}
+
+	// The daemon stops while updating the routes, after the ENI IP moved
+	cloud.SetLatency("UpdateRouteTables", time.Minute)
+	lf := newTestFailover(t, cloud, "i-b", configure)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lf.handleRoleRequest(ctx, newRoleRequest(RolePrimary, TriggerHeartbeat, "primary failed", nil))
+	}()
+	for cloud.Calls("UpdateRouteTables") == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_ = lf.journal.Close() // nothing after the stop reaches the journal
+	cancel()
+	<-done
+	_ = lf.Stop()
+	cloud.SetLatency("UpdateRouteTables", 0)
+	if holder := cloud.ENIWithIP(testENIIP); holder != "eni-b" {
+		t.Fatalf("ENI IP holder after the stop: got %s, want eni-b", holder)
+	}
+
+	// Restarted on the same state directory, the node is still elected and resumes
+	lf = newTestFailover(t, cloud, "i-b", configure)
+	if lf.journal.interruptedPromotion() == nil {
+		t.Fatal("restarted node found no interrupted promotion")
+	}
+	lf.checkLeadership(context.Background())
+	request := <-lf.roleCh
+	if request.trigger != TriggerResume {
+		t.Fatalf("trigger after the restart: got %s, want %s", request.trigger, TriggerResume)
+	}
+	lf.handleRoleRequest(context.Background(), request)
+
+	if role := lf.currentRole.Load(); role != RolePrimary {
+		t.Fatalf("role after resuming: got %s, want %s", role, RolePrimary)
+	}
+	if target := cloud.RouteTarget("rtb-1", testDestinationCIDR); target != "eni-b" {
+		t.Fatalf("route target: got %s, want eni-b", target)
+	}
+	if calls := cloud.Calls("TakeOverENI"); calls != 1 {
+		t.Fatalf("ENI IP taken over %d times, want only before the stop", calls)
+	}
+	if lf.journal.interruptedPromotion() != nil {
+		t.Fatal("interrupted promotion still reported after resuming it")
+	}
+
+	entries, err := ReadJournal(JournalFile(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	timelines := BuildTimelines(entries)
+	resumed := timelines[len(timelines)-1]
+	if resumed.Decision.Trigger != TriggerResume || resumed.Result == nil || resumed.Result.Error != "" {
+		t.Fatalf("resumed decision: got %+v with result %+v", resumed.Decision, resumed.Result)
+	}
+	steps := make(map[string]JournalEntry)
+	for _, event := range resumed.Events {
+		if event.Event == JournalEventAction {
+			steps[event.Action] = event
+		}
+	}
+	if step := steps[ActionTakeOverENI]; !step.InPlace {
+		t.Fatalf("take-over on resume: got %+v, want it found in place", step)
+	}
+	if step, ok := steps[ActionUpdateRoutes]; !ok || step.InPlace || step.Error != "" {
+		t.Fatalf("route update on resume: got %+v, want it made", step)
+	}
+}
@@ -0,0 +1,309 @@
+package failover
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// switchoverTimeout bounds a planned switchover, on top of any lease the target has to wait for
+const switchoverTimeout = 30 * time.Second
+
+// switchoverPollInterval is how often a switchover checks whether a role transition has completed
+const switchoverPollInterval = 50 * time.Millisecond
+
+var (
+	ErrSwitchoverInProgress = errors.New("switchover already in progress")
+	ErrSwitchoverNeedsTLS   = errors.New("planned switchovers need mutual TLS between the nodes")
+)
+
+// Switchover implements the FailoverService interface for a secondary taking over: asked for
+// the secondary role, a primary hands over to it. Only peers authenticated by mutual TLS may
+// ask, operators switch over through the control API.
+func (lf *LeaderFailover) Switchover(ctx context.Context, req *FailoverSwitchoverRequest) (*FailoverSwitchoverResponse, error) {
+	response := &FailoverSwitchoverResponse{
+		RequestId: req.RequestId,
+	}
+
+	var err error
+	switch {
+	case lf.tls == nil:
+		err = ErrSwitchoverNeedsTLS
+	case req.Role != RoleStringSecondary:
+		err = fmt.Errorf("a peer can only ask for a handover, not for role %q", req.Role)
+	default:
+		response.PrimaryInstanceId, response.Epoch, err = lf.switchRole(ctx, req.Role, cmp.Or(req.Trigger, TriggerManual))
+	}
+
+	if err != nil {
+		response.ErrorMessage = err.Error()
+		return response, nil
+	}
+
+	response.Success = true
+	return response, nil
+}
+
+// SwitchRole moves the primary role with a planned switchover. Asked for the secondary role,
+// a primary hands over to its secondary; asked for the primary role, a secondary asks its
+// primary to do so. It returns the new primary's instance ID and epoch once the roles flipped.
+func (lf *LeaderFailover) SwitchRole(ctx context.Context, role string) (string, uint64, error) {
+	return lf.switchRole(ctx, role, TriggerManual)
+}
+
+// switchRole runs a planned switchover to role on behalf of trigger
+func (lf *LeaderFailover) switchRole(ctx context.Context, role, trigger string) (string, uint64, error) {
+	lf.logger.Info().
+		Str("current_role", lf.currentRole.Load().String()).
+		Str("target_role", role).
+		Str("trigger", trigger).
+		Msg("Received switchover request")
+
+	ctx, cancel := context.WithTimeout(ctx, lf.switchoverTimeout())
+	defer cancel()
+
+	var (
+		primaryInstanceID string
+		epoch             uint64
+		err               error
+	)
+	switch {
+	case role == lf.currentRole.Load().String():
+		// Nothing to do, report who is primary
+		if lf.currentRole.Load() == RolePrimary {
+			primaryInstanceID = lf.instanceID()
+		}
+		epoch = lf.epochs.current()
+	case role == RoleStringSecondary && lf.currentRole.Load() == RolePrimary:
+		primaryInstanceID, epoch, err = lf.handOver(ctx, trigger)
+	case role == RoleStringPrimary && lf.currentRole.Load() == RoleSecondary:
+		primaryInstanceID, epoch, err = lf.takeOver(ctx, trigger)
+	default:
+		err = fmt.Errorf("cannot switch %s node to role %q", lf.currentRole.Load(), role)
+	}
+
+	if err != nil {
+		lf.logger.Error().Err(err).Str("target_role", role).Msg("Switchover failed")
+		return "", 0, err
+	}
+
+	return primaryInstanceID, epoch, nil
+}
+
+// Promote implements the FailoverService interface. The secondary performs a final sync
+// from the handing over primary, then becomes primary and runs the failover actions. Only
+// the primary may ask, authenticated by mutual TLS.
+func (lf *LeaderFailover) Promote(ctx context.Context, req *FailoverPromoteRequest) (*FailoverPromoteResponse, error) {
+	response := &FailoverPromoteResponse{
+		RequestId: req.RequestId,
+	}
+
+	if lf.tls == nil {
+		response.ErrorMessage = ErrSwitchoverNeedsTLS.Error()
+		response.Epoch = lf.epochs.current()
+		return response, nil
+	}
+
+	if err := lf.promoteForHandover(ctx, req.Epoch, cmp.Or(req.Trigger, TriggerManual)); err != nil {
+		lf.logger.Error().Err(err).Msg("Failed to take over from primary")
+		response.ErrorMessage = err.Error()
+		response.Epoch = lf.epochs.current()
+		return response, nil
+	}
+
+	response.Success = true
+	response.InstanceId = lf.instanceID()
+	response.Epoch = lf.epochs.leader()
+	return response, nil
+}
+
+// promoteForHandover takes over the primary role from a primary that is handing over
+func (lf *LeaderFailover) promoteForHandover(ctx context.Context, primaryEpoch uint64, trigger string) error {
+	if lf.currentRole.Load() != RoleSecondary {
+		return fmt.Errorf("node is %s, not secondary", lf.currentRole.Load())
+	}
+	if lf.unhealthy.Load() {
+		return fmt.Errorf("%w, not eligible for promotion", ErrConduitUnhealthy)
+	}
+	if !lf.switchoverMutex.TryLock() {
+		return ErrSwitchoverInProgress
+	}
+	defer lf.switchoverMutex.Unlock()
+
+	lf.switchoverTrigger.Store(trigger)
+	lf.switchingOver.Store(true)
+	defer lf.switchingOver.Store(false)
+
+	if lf.observeEpoch(primaryEpoch, "promote request") {
+		return fmt.Errorf("%w: primary epoch %d", ErrStaleEpoch, primaryEpoch)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lf.switchoverTimeout())
+	defer cancel()
+
+	lf.logger.Info().Uint64("primary_epoch", primaryEpoch).Msg("Primary is handing over, performing final sync")
+
+	// Take over with the primary's latest NAT table so no connections are dropped. Flows the
+	// primary creates from here on are taken by a second sync right before the takeover.
+	if err := lf.syncFromPrimary(ctx); err != nil {
+		return fmt.Errorf("final sync from primary failed: %w", err)
+	}
+
+	select {
+	case lf.roleCh <- newRoleRequest(RolePrimary, trigger, "planned switchover", nil):
+	case <-ctx.Done():
+		return fmt.Errorf("failed to request primary role: %w", ctx.Err())
+	}
+
+	return lf.waitForRole(ctx, RolePrimary)
+}
+
+// syncBeforeHandover takes the NAT entries the handing over primary created since the final
+// sync. The primary keeps forwarding until the failover actions move its traffic, so this runs
+// after it resigned, right before this node claims the epoch that stops it serving syncs.
+func (lf *LeaderFailover) syncBeforeHandover(ctx context.Context) {
+	if !lf.switchingOver.Load() || lf.currentRole.Load() != RoleSecondary {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lf.config.PromotionTimeout)
+	defer cancel()
+
+	// The final sync succeeded, so a failure here only loses the newest flows
+	if err := lf.syncFromPrimary(ctx); err != nil {
+		lf.logger.Warn().Err(err).Msg("Failed to sync from primary before taking over, newest flows may be dropped")
+	}
+}
+
+// handOver moves the primary role to the registered secondary and confirms the roles flipped.
+// It returns the new primary's instance ID and epoch.
+func (lf *LeaderFailover) handOver(ctx context.Context, trigger string) (string, uint64, error) {
+	if lf.tls == nil {
+		return "", 0, ErrSwitchoverNeedsTLS
+	}
+	if !lf.switchoverMutex.TryLock() {
+		return "", 0, ErrSwitchoverInProgress
+	}
+	defer lf.switchoverMutex.Unlock()
+
+	peerAddr := lf.registeredPeerAddr()
+	if len(lf.peerPaths) > 0 {
+		peerAddr = lf.preferredPeerPath()
+	}
+	if peerAddr == "" {
+		return "", 0, errors.New("no secondary has registered with this primary")
+	}
+
+	// A dedicated client survives the cleanup of the primary role's peer client
+	c, err := lf.dialPeerClient(peerAddr)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() { _ = c.Close() }()
+
+	// Stop campaigning so this node does not win leadership straight back
+	lf.switchoverTrigger.Store(trigger)
+	lf.switchingOver.Store(true)
+	defer lf.switchingOver.Store(false)
+
+	// Release a lease or quorum leadership so the secondary can acquire it
+	if _, ok := lf.elector.(LeaseGuard); ok {
+		if err := lf.elector.Resign(ctx); err != nil {
+			return "", 0, fmt.Errorf("failed to release leadership: %w", err)
+		}
+	}
+
+	lf.logger.Info().Str("peer_addr", peerAddr).Msg("Handing over primary role to secondary")
+
+	promoted, err := rpcResponse(c.FailoverService.Promote(ctx, &FailoverPromoteRequest{
+		RequestId: fmt.Sprintf("promote_%d", time.Now().UnixNano()),
+		Epoch:     lf.epochs.leader(),
+		Trigger:   trigger,
+	}))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to promote secondary: %w", err)
+	}
+	if !promoted.Success {
+		return "", 0, fmt.Errorf("secondary refused promotion: %s", promoted.ErrorMessage)
+	}
+
+	// The secondary's new epoch supersedes ours, which steps this node down
+	lf.observeEpoch(promoted.Epoch, "promote response")
+	if err := lf.waitForRole(ctx, RoleSecondary); err != nil {
+		return "", 0, err
+	}
+
+	health, err := rpcResponse(c.FailoverService.HealthCheck(ctx, &FailoverHealthCheckRequest{
+		RequestId: fmt.Sprintf("switchover_%d", time.Now().UnixNano()),
+		Epoch:     lf.epochs.current(),
+		NodeId:    lf.nodeID(),
+		Port:      uint32(lf.config.Port),
+	}))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to confirm new primary: %w", err)
+	}
+	if health.NodeRole != RoleStringPrimary {
+		return "", 0, fmt.Errorf("new primary reports role %s", health.NodeRole)
+	}
+
+	lf.logger.Info().
+		Str("primary_instance_id", health.InstanceId).
+		Uint64("epoch", health.Epoch).
+		Msg("Switchover complete, now secondary")
+
+	return health.InstanceId, health.Epoch, nil
+}
+
+// takeOver asks the primary to hand over to this node and waits until it has
+func (lf *LeaderFailover) takeOver(ctx context.Context, trigger string) (string, uint64, error) {
+	if lf.tls == nil {
+		return "", 0, ErrSwitchoverNeedsTLS
+	}
+
+	// A dedicated client survives the cleanup of the secondary role's primary client
+	c, err := lf.dialPrimary()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to connect to primary: %w", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	response, err := rpcResponse(c.FailoverService.Switchover(ctx, &FailoverSwitchoverRequest{
+		RequestId: fmt.Sprintf("switchover_%d", time.Now().UnixNano()),
+		Role:      RoleStringSecondary,
+		Trigger:   trigger,
+	}))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to request handover from primary: %w", err)
+	}
+	if !response.Success {
+		return "", 0, fmt.Errorf("primary refused handover: %s", response.ErrorMessage)
+	}
+
+	if err := lf.waitForRole(ctx, RolePrimary); err != nil {
+		return "", 0, err
+	}
+
+	return lf.instanceID(), lf.epochs.leader(), nil
+}
+
+// waitForRole waits for the role management loop to complete a transition to role
+func (lf *LeaderFailover) waitForRole(ctx context.Context, role NodeRole) error {
+	ticker := time.NewTicker(switchoverPollInterval)
+	defer ticker.Stop()
+
+	for lf.currentRole.Load() != role {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for %s role: %w", role, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// switchoverTimeout allows for the lease the new primary may have to wait out
+func (lf *LeaderFailover) switchoverTimeout() time.Duration {
+	return switchoverTimeout + lf.config.LeaseDuration
+}
@@ -0,0 +1,372 @@
+package failover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/loopholelabs/architect-networking/pkg/client"
+)
+
+// fakeConduit serves the NAT state API of a Conduit instance on a unix socket, along with
+// the calls its health probe makes
+type fakeConduit struct {
+	mu     sync.Mutex
+	state  *client.NATState
+	onSet  func() // called after each SetState
+	health conduitHealth
+}
+
+// conduitHealth is what a fakeConduit reports to the health probe
+type conduitHealth struct {
+	router    client.RouterStatus
+	ips       []string
+	stateCode int           // status of reading the NAT state, 200 when 0
+	latency   time.Duration // of the router status and NAT IP calls
+}
+
+// socketDir creates a directory for unix sockets. Their paths are limited to about 100
+// bytes, which t.TempDir can exceed.
+func socketDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "failover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	return dir
+}
+
+// newFakeConduit starts a Conduit API holding state and returns it with its socket multiaddr
+func newFakeConduit(t *testing.T, state *client.NATState) (*fakeConduit, string) {
+	t.Helper()
+
+	socket := filepath.Join(socketDir(t), "conduit.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conduit := &fakeConduit{
+		state: state,
+		health: conduitHealth{
+			router: client.RouterStatus{Enabled: true, InterfacesEnabled: true, OutboundNATEnabled: true},
+			ips:    []string{"203.0.113.1"},
+		},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /transit/state", func(w http.ResponseWriter, _ *http.Request) {
+		conduit.mu.Lock()
+		defer conduit.mu.Unlock()
+		if code := conduit.health.stateCode; code != 0 && code != http.StatusOK {
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(conduit.state)
+	})
+	mux.HandleFunc("GET /transit/router/status", func(w http.ResponseWriter, _ *http.Request) {
+		health := conduit.Health()
+		time.Sleep(health.latency)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(health.router)
+	})
+	mux.HandleFunc("GET /transit/ips", func(w http.ResponseWriter, _ *http.Request) {
+		health := conduit.Health()
+		time.Sleep(health.latency)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(health.ips)
+	})
+	mux.HandleFunc("PUT /transit/state", func(w http.ResponseWriter, r *http.Request) {
+		var state client.NATState
+		if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		conduit.mu.Lock()
+		conduit.state = &state
+		onSet := conduit.onSet
+		conduit.mu.Unlock()
+		if onSet != nil {
+			onSet()
+		}
+	})
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: time.Second}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { _ = server.Close() })
+
+	return conduit, "/unix" + socket
+}
+
+// NATState returns the state last set on the instance
+func (c *fakeConduit) NATState() *client.NATState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// SetNATState replaces the state, as the dataplane does when flows come and go
+func (c *fakeConduit) SetNATState(state *client.NATState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state = state
+}
+
+// Health returns what the instance reports to the health probe
+func (c *fakeConduit) Health() conduitHealth {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.health
+}
+
+// SetHealth changes what the instance reports to the health probe
+func (c *fakeConduit) SetHealth(update func(health *conduitHealth)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	update(&c.health)
+}
+
+// OnSet calls fn after the next SetState
+func (c *fakeConduit) OnSet(fn func()) {
+	var once sync.Once
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onSet = func() { once.Do(fn) }
+}
+
+// switchoverPair is a primary on instance i-a and its secondary on i-b, reaching each other
+// over loopback and sharing a MemoryCloud
+type switchoverPair struct {
+	cloud                    *MemoryCloud
+	primary, secondary       *LeaderFailover
+	primaryNAT, secondaryNAT *fakeConduit
+}
+
+// newSwitchoverPair runs the role management loops of both nodes and waits for i-a to become
+// primary and i-b its secondary. The nodes use mutual TLS, which planned switchovers require,
+// and the primary's dataplane holds one flow. The config of each node is passed to configure,
+// if set, after the pair was filled in.
+func newSwitchoverPair(t *testing.T, configure func(instance string, config *LeaderConfig)) *switchoverPair {
+	t.Helper()
+
+	pair := &switchoverPair{cloud: newTestCloud()}
+	ports := map[string]uint16{"i-a": freeTCPPort(t), "i-b": freeTCPPort(t)}
+	peers := map[string]string{"i-a": "i-b", "i-b": "i-a"}
+
+	var sockets [2]string
+	pair.primaryNAT, sockets[0] = newFakeConduit(t, testNATEntries(testNATEntry(0, "1", 20000)))
+	pair.secondaryNAT, sockets[1] = newFakeConduit(t, testNATEntries())
+
+	ca := newTestCA(t)
+	nodes := make([]*LeaderFailover, 2)
+	for i, instance := range []string{"i-a", "i-b"} {
+		nodes[i] = newTestFailover(t, pair.cloud, instance, func(config *LeaderConfig) {
+			ca.configure(t, config, instance)
+			config.Port = ports[instance]
+			config.PeerAddrs = []string{"/ip4/127.0.0.1/tcp/" + strconv.Itoa(int(ports[peers[instance]]))}
+			config.LocalSocket = sockets[i]
+			config.HeartbeatInterval = time.Second
+			config.SyncInterval = time.Hour // only the switchover syncs
+			if configure != nil {
+				configure(instance, config)
+			}
+		})
+	}
+	pair.primary, pair.secondary = nodes[0], nodes[1]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, lf := range nodes {
+		go lf.roleManagementLoop(ctx)
+	}
+	t.Cleanup(cancel)
+
+	pair.primary.roleCh <- newRoleRequest(RolePrimary, TriggerElection, "test", nil)
+	if err := pair.primary.waitForRole(ctx, RolePrimary); err != nil {
+		t.Fatal(err)
+	}
+	pair.secondary.roleCh <- newRoleRequest(RoleSecondary, TriggerElection, "test", nil)
+	if err := pair.secondary.waitForRole(ctx, RoleSecondary); err != nil {
+		t.Fatal(err)
+	}
+
+	return pair
+}
+
+// requireRoles fails the test unless i-a has role a, i-b has role b and the cloud resources
+// point at the primary's ENI
+func (p *switchoverPair) requireRoles(t *testing.T, a, b NodeRole) {
+	t.Helper()
+
+	if roleA, roleB := p.primary.currentRole.Load(), p.secondary.currentRole.Load(); roleA != a || roleB != b {
+		t.Fatalf("roles: got i-a %s and i-b %s, want %s and %s", roleA, roleB, a, b)
+	}
+	wantENI := "eni-a"
+	if b == RolePrimary {
+		wantENI = "eni-b"
+	}
+	if eni := p.cloud.ENIWithIP(testENIIP); eni != wantENI {
+		t.Fatalf("ENI IP is on %s, want %s", eni, wantENI)
+	}
+	if target := p.cloud.RouteTarget("rtb-1", testDestinationCIDR); target != wantENI {
+		t.Fatalf("route targets %s, want %s", target, wantENI)
+	}
+}
+
+// requireFlows fails the test unless the NAT state holds the outbound entries with the
+// given indexes of testNATEntry
+func requireFlows(t *testing.T, state *client.NATState, indexes ...int) {
+	t.Helper()
+
+	got := make(map[client.NATKey]bool)
+	for _, entry := range state.TCPOutbound {
+		got[entry.Key] = true
+	}
+	for _, i := range indexes {
+		if !got[testNATKey(i)] {
+			t.Fatalf("flow %d is missing from %d synced flows", i, len(state.TCPOutbound))
+		}
+	}
+}
+
+func TestSwitchover(t *testing.T) {
+	tests := []struct {
+		name    string
+		request func(p *switchoverPair) *LeaderFailover // node the switchover is asked of
+		role    string
+	}{
+		{name: "primary hands over", request: func(p *switchoverPair) *LeaderFailover { return p.primary }, role: RoleStringSecondary},
+		{name: "secondary takes over", request: func(p *switchoverPair) *LeaderFailover { return p.secondary }, role: RoleStringPrimary},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pair := newSwitchoverPair(t, nil)
+
+			// A flow the primary creates once the final sync is applied still moves over
+			pair.secondaryNAT.OnSet(func() {
+				pair.primaryNAT.SetNATState(testNATEntries(testNATEntry(0, "1", 20000), testNATEntry(1, "2", 20001)))
+			})
+
+			primary, epoch, err := tt.request(pair).SwitchRole(context.Background(), tt.role)
+			if err != nil {
+				t.Fatalf("switchover failed: %v", err)
+			}
+			if primary != "i-b" || epoch != pair.secondary.epochs.leader() {
+				t.Fatalf("switchover reports primary %s at epoch %d, want i-b at %d", primary, epoch, pair.secondary.epochs.leader())
+			}
+
+			pair.requireRoles(t, RoleSecondary, RolePrimary)
+			requireFlows(t, pair.secondaryNAT.NATState(), 0, 1)
+		})
+	}
+}
+
+func TestSwitchoverRefused(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, p *switchoverPair)
+		want    string
+	}{
+		{
+			name:    "unhealthy secondary",
+			prepare: func(_ *testing.T, p *switchoverPair) { p.secondary.unhealthy.Store(true) },
+			want:    ErrConduitUnhealthy.Error(),
+		},
+		{
+			name: "secondary already switching over",
+			prepare: func(t *testing.T, p *switchoverPair) {
+				p.secondary.switchoverMutex.Lock()
+				t.Cleanup(p.secondary.switchoverMutex.Unlock)
+			},
+			want: ErrSwitchoverInProgress.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pair := newSwitchoverPair(t, nil)
+			tt.prepare(t, pair)
+
+			_, _, err := pair.primary.SwitchRole(context.Background(), RoleStringSecondary)
+			if err == nil || !strings.Contains(err.Error(), "secondary refused promotion") || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("switchover: got %v, want a refusal for %q", err, tt.want)
+			}
+
+			pair.requireRoles(t, RolePrimary, RoleSecondary)
+			if pair.primary.switchingOver.Load() {
+				t.Fatal("primary still pauses campaigning after the refused switchover")
+			}
+		})
+	}
+}
+
+func TestSwitchoverPeerRequests(t *testing.T) {
+	ctx := context.Background()
+
+	// Without mutual TLS anyone reaching the fRPC port could move the primary role
+	lf := newTestFailover(t, newTestCloud(), "i-a", nil)
+	lf.currentRole.Store(RolePrimary)
+	switchover, err := lf.Switchover(ctx, &FailoverSwitchoverRequest{RequestId: "test", Role: RoleStringSecondary})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if switchover.Success || switchover.ErrorMessage != ErrSwitchoverNeedsTLS.Error() {
+		t.Fatalf("switchover without TLS: got success %t with %q, want a refusal", switchover.Success, switchover.ErrorMessage)
+	}
+	lf.currentRole.Store(RoleSecondary)
+	promote, err := lf.Promote(ctx, &FailoverPromoteRequest{RequestId: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if promote.Success || promote.ErrorMessage != ErrSwitchoverNeedsTLS.Error() {
+		t.Fatalf("promote without TLS: got success %t with %q, want a refusal", promote.Success, promote.ErrorMessage)
+	}
+	if _, _, err := lf.SwitchRole(ctx, RoleStringPrimary); !errors.Is(err, ErrSwitchoverNeedsTLS) {
+		t.Fatalf("switch role without TLS: got %v, want %v", err, ErrSwitchoverNeedsTLS)
+	}
+
+	// A peer only asks a primary to hand over, taking over is up to the node's operator
+	pair := newSwitchoverPair(t, nil)
+	switchover, err = pair.secondary.Switchover(ctx, &FailoverSwitchoverRequest{RequestId: "test", Role: RoleStringPrimary})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if switchover.Success {
+		t.Fatal("peer made the secondary take over")
+	}
+	pair.requireRoles(t, RolePrimary, RoleSecondary)
+}
+
+func TestPromoteTimeout(t *testing.T) {
+	pair := newSwitchoverPair(t, nil)
+
+	// Claiming the epoch outlasts the promote request, the secondary's promotion carries on
+	pair.cloud.SetLatency("SetEpochTag", time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	response, err := pair.secondary.Promote(ctx, &FailoverPromoteRequest{RequestId: "test", Epoch: pair.primary.epochs.leader()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Success || !strings.Contains(response.ErrorMessage, "timed out waiting for primary role") {
+		t.Fatalf("promote: got success %t with %q, want a timeout", response.Success, response.ErrorMessage)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := pair.secondary.waitForRole(ctx, RolePrimary); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,209 @@
+package failover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/loopholelabs/architect-networking/pkg/client"
+)
+
+// SyncStateChunk implements the FailoverService interface, serving one page of a chunked resync
+func (lf *LeaderFailover) SyncStateChunk(
+	ctx context.Context,
+	req *FailoverSyncStateChunkRequest,
+) (*FailoverSyncStateChunkResponse, error) {
+	lf.registerPeer(ctx, req.NodeId, req.Port)
+
+	if lf.observeEpoch(req.Epoch, "sync state chunk") {
+		return &FailoverSyncStateChunkResponse{
+			RequestId:    req.RequestId,
+			Success:      false,
+			ErrorMessage: "primary epoch is stale",
+			Epoch:        lf.epochs.current(),
+		}, nil
+	}
+
+	// Loaded once, as a demotion replaces the stream while the request is handled
+	replicator := lf.replicator.Load()
+	if replicator == nil {
+		return &FailoverSyncStateChunkResponse{
+			RequestId:    req.RequestId,
+			Success:      false,
+			ErrorMessage: "node is not primary",
+			Epoch:        lf.epochs.current(),
+		}, nil
+	}
+
+	// A new resync starts from the current state
+	if req.Version == 0 {
+		state, err := lf.fetchLocalState(ctx)
+		if err != nil {
+			lf.logger.Error().Err(err).Msg("Failed to get local NAT state")
+			return &FailoverSyncStateChunkResponse{
+				RequestId:    req.RequestId,
+				Success:      false,
+				ErrorMessage: err.Error(),
+			}, nil
+		}
+		replicator.update(state)
+	}
+
+	limit := lf.config.SyncChunkSize
+	if req.Limit > 0 && int(req.Limit) < limit {
+		limit = int(req.Limit)
+	}
+
+	response, page, err := replicator.chunk(req, limit)
+	if err != nil {
+		return &FailoverSyncStateChunkResponse{
+			RequestId:    req.RequestId,
+			Success:      false,
+			ErrorMessage: err.Error(),
+		}, nil
+	}
+	if page != nil {
+		if err := setSyncChunkPage(response, req, page); err != nil {
+			lf.logger.Warn().Err(err).Msg("Sending resync page in the v1 wire format")
+		}
+	}
+
+	response.RequestId = req.RequestId
+	response.Success = true
+	response.Epoch = lf.epochs.leader()
+
+	return response, nil
+}
+
+// resyncFromPrimary pages the full NAT state from the primary into the mirror and applies
+// it locally. Progress is kept across calls so a dropped connection resumes where it left off.
+// Paging bounds the size of each message, not memory: Conduit only accepts the complete
+// state, so the pages are collected into the mirror and applied with one SetState. Bounding
+// memory waits on Conduit accepting its state in parts.
+func (lf *LeaderFailover) resyncFromPrimary(ctx context.Context, c *Client) error {
+	if lf.mirror.resync != nil {
+		lf.logger.Info().
+			Str("stream_id", lf.mirror.resync.streamID).
+			Uint64("version", lf.mirror.resync.version).
+			Uint32("table", lf.mirror.resync.table).
+			Uint64("cursor", lf.mirror.resync.cursor).
+			Msg("Resuming chunked NAT state resync")
+	} else {
+		lf.logger.Info().Msg("Starting chunked NAT state resync")
+	}
+
+	start := time.Now()
+	chunks := 0
+	for {
+		request := &FailoverSyncStateChunkRequest{
+			RequestId:   fmt.Sprintf("sync_chunk_%d", time.Now().UnixNano()),
+			Epoch:       lf.epochs.current(),
+			Limit:       uint32(lf.config.SyncChunkSize),
+			WireVersion: lf.config.SyncWireVersion,
+			Compress:    lf.config.SyncCompression,
+			NodeId:      lf.nodeID(),
+			Port:        uint32(lf.config.Port),
+		}
+		if r := lf.mirror.resync; r != nil {
+			request.StreamId = r.streamID
+			request.Version = r.version
+			request.Table = r.table
+			request.Cursor = r.cursor
+		}
+
+		response, err := rpcResponse(c.FailoverService.SyncStateChunk(ctx, request))
+		if err != nil {
+			return fmt.Errorf("failed to request sync chunk: %w", err)
+		}
+
+		if !response.Success {
+			return fmt.Errorf("primary returned error: %s", response.ErrorMessage)
+		}
+
+		if response.Epoch < lf.epochs.current() {
+			return fmt.Errorf("%w: primary epoch %d is older than %d", ErrStaleEpoch, response.Epoch, lf.epochs.current())
+		}
+		lf.observeEpoch(response.Epoch, "sync state chunk")
+
+		if response.Restart {
+			lf.logger.Warn().Msg("Primary no longer holds the resync snapshot, restarting resync")
+		}
+
+		state, err := lf.mirror.applyChunk(response)
+		if err != nil {
+			return fmt.Errorf("failed to apply sync chunk: %w", err)
+		}
+		chunks++
+
+		if state == nil {
+			continue
+		}
+
+		lf.logger.Info().
+			Str("stream_id", lf.mirror.streamID).
+			Uint64("version", lf.mirror.version).
+			Int("chunks", chunks).
+			Str("duration", time.Since(start).String()).
+			Msg("Completed chunked NAT state resync")
+
+		if err := lf.applySyncedState(ctx, state); err != nil {
+			lf.mirror.reset()
+			return fmt.Errorf("failed to apply synced state: %w", err)
+		}
+		lf.recordSync(true)
+
+		return nil
+	}
+}
+
+// fetchLocalState reads the NAT state from the local conduit instance, decoding the
+// response as it streams in rather than buffering the whole body first
+func (lf *LeaderFailover) fetchLocalState(ctx context.Context) (*client.NATState, error) {
+	resp, err := lf.localClient.GetState(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API error: %d", resp.StatusCode)
+	}
+
+	var state client.NATState
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to decode state: %w", err)
+	}
+
+	return &state, nil
+}
+
+// setLocalState writes the mirrored NAT state to the local conduit instance, encoding the
+// request body from the mirror as it is sent rather than marshalling it up front
+func (lf *LeaderFailover) setLocalState(ctx context.Context, snapshot *natSnapshot) error {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(snapshot.encode(pw))
+	}()
+	// The encoder reads the mirror, so it must be done before the next sync changes it
+	defer func() {
+		_ = pr.Close()
+		<-done
+	}()
+
+	resp, err := lf.localClient.SetStateWithBody(ctx, "application/json", pr)
+	if err != nil {
+		return fmt.Errorf("failed to set local state: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("local API returned error status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package failover
+
+import (
+	"testing"
+
+	"github.com/loopholelabs/polyglot/v2"
+
+	"github.com/loopholelabs/architect-networking/pkg/client"
+)
+
+// roundTripChunkResponse sends a resync page through its wire encoding
+func roundTripChunkResponse(t *testing.T, response *FailoverSyncStateChunkResponse) *FailoverSyncStateChunkResponse {
+	t.Helper()
+
+	buf := polyglot.NewBuffer()
+	response.Encode(buf)
+
+	decoded := &FailoverSyncStateChunkResponse{}
+	if err := decoded.Decode(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+// resyncPage requests the next page of the mirror's resync on node from the replicator, as
+// resyncFromPrimary and SyncStateChunk do over fRPC, and returns how many entries it held
+func resyncPage(t *testing.T, r *natReplicator, m *natMirror, node string, limit int, wireVersion uint32, compress bool) (*FailoverSyncStateChunkResponse, int) {
+	t.Helper()
+
+	request := &FailoverSyncStateChunkRequest{WireVersion: wireVersion, Compress: compress, NodeId: node}
+	if m.resync != nil {
+		request.StreamId = m.resync.streamID
+		request.Version = m.resync.version
+		request.Table = m.resync.table
+		request.Cursor = m.resync.cursor
+	}
+
+	response, page, err := r.chunk(request, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := 0
+	if page != nil {
+		if err := setSyncChunkPage(response, request, page); err != nil {
+			t.Fatal(err)
+		}
+		for _, table := range natTables(page) {
+			entries += len(*table)
+		}
+		entries += len(page.NATPorts)
+	}
+
+	return roundTripChunkResponse(t, response), entries
+}
+
+func TestChunkedResyncPagesLargeTable(t *testing.T) {
+	const limit = 64
+
+	for _, format := range testWireFormats {
+		t.Run(format.name, func(t *testing.T) {
+			state := testNATState(1000)
+			r := newNATReplicator()
+			r.update(state)
+
+			var m natMirror
+			pages := 0
+			for {
+				response, entries := resyncPage(t, r, &m, "i-b", limit, format.version, format.compress)
+				if entries > limit {
+					t.Fatalf("page %d holds %d entries, limit is %d", pages, entries, limit)
+				}
+				pages++
+
+				synced, err := m.applyChunk(response)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if synced == nil {
+					if pages > 100 {
+						t.Fatal("resync did not complete")
+					}
+					continue
+				}
+
+				if !natSnapshotsEqual(synced, newNATSnapshot(state)) {
+					t.Fatal("resynced state differs from the primary's")
+				}
+				break
+			}
+
+			// 250 entries per table take four pages each, and the bitmaps one more
+			if pages != 4*natTableCount+1 {
+				t.Fatalf("pages: got %d, want %d", pages, 4*natTableCount+1)
+			}
+			if m.streamID != r.streamID || m.version != 1 || m.resync != nil {
+				t.Fatalf("mirror: got stream %s version %d, want %s version 1", m.streamID, m.version, r.streamID)
+			}
+
+			// The secondary continues with deltas from the resynced version
+			if delta, _ := r.since(m.streamID, m.version); delta == nil {
+				t.Fatal("no delta from the resynced version")
+			}
+		})
+	}
+}
+
+func TestChunkedResyncResumesAndRestarts(t *testing.T) {
+	const limit = 100
+
+	state := testNATState(1000)
+	r := newNATReplicator()
+	r.update(state)
+
+	var m natMirror
+	for range 3 {
+		response, _ := resyncPage(t, r, &m, "i-b", limit, WireVersionV2, false)
+		if _, err := m.applyChunk(response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resumeTable, resumeCursor := m.resync.table, m.resync.cursor
+
+	// A dropped connection resumes from the page after the last one applied
+	response, _ := resyncPage(t, r, &m, "i-b", limit, WireVersionV2, false)
+	if response.Table != resumeTable || response.Cursor != resumeCursor || response.Restart {
+		t.Fatalf("resumed page: got table %d cursor %d, want table %d cursor %d", response.Table, response.Cursor, resumeTable, resumeCursor)
+	}
+
+	// A new primary stream no longer holds the pinned state, the resync starts over
+	restarted := newNATReplicator()
+	restarted.update(state)
+	response, _ = resyncPage(t, restarted, &m, "i-b", limit, WireVersionV2, false)
+	if !response.Restart {
+		t.Fatal("page of another stream served without a restart")
+	}
+	if synced, err := m.applyChunk(response); err != nil || synced != nil || m.resync != nil {
+		t.Fatalf("restart: got %v, %v, want the resync dropped", synced, err)
+	}
+
+	for {
+		response, _ := resyncPage(t, restarted, &m, "i-b", limit, WireVersionV2, false)
+		synced, err := m.applyChunk(response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if synced != nil {
+			if !natSnapshotsEqual(synced, newNATSnapshot(state)) {
+				t.Fatal("restarted resync differs from the primary's state")
+			}
+			return
+		}
+	}
+}
+
+func TestChunkedResyncsOfSeveralSecondaries(t *testing.T) {
+	const limit = 100
+
+	state := testNATState(1000)
+	r := newNATReplicator()
+	r.update(state)
+
+	// A second secondary starts its resync while the first is halfway through, after the
+	// primary's state moved on
+	var b, c natMirror
+	for range 10 {
+		response, _ := resyncPage(t, r, &b, "i-b", limit, WireVersionV2, false)
+		if _, err := b.applyChunk(response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.update(testNATState(500))
+
+	mirrors := map[string]*natMirror{"i-b": &b, "i-c": &c}
+	want := map[string]*client.NATState{"i-b": state, "i-c": testNATState(500)}
+	done := make(map[string]bool)
+	for pages := 0; len(done) < len(mirrors); pages++ {
+		if pages > 100 {
+			t.Fatal("resyncs did not complete")
+		}
+		for node, m := range mirrors {
+			if done[node] {
+				continue
+			}
+			response, _ := resyncPage(t, r, m, node, limit, WireVersionV2, false)
+			if response.Restart {
+				t.Fatalf("resync of %s restarted by the other resync", node)
+			}
+			synced, err := m.applyChunk(response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if synced == nil {
+				continue
+			}
+			if !natSnapshotsEqual(synced, newNATSnapshot(want[node])) {
+				t.Fatalf("resynced state of %s differs from the state it started from", node)
+			}
+			done[node] = true
+		}
+	}
+
+	// Moving on to deltas releases only the state pinned for that secondary
+	r.release("i-b", b.streamID, b.version)
+	if _, ok := r.pinned["i-b"]; ok {
+		t.Fatal("state pinned for i-b kept after its release")
+	}
+	if _, ok := r.pinned["i-c"]; !ok {
+		t.Fatal("state pinned for i-c released with i-b's")
+	}
+}
@@ -0,0 +1,296 @@
+package failover
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/loopholelabs/logging/types"
+)
+
+// peerIdentityTimeout bounds how long a new connection waits for the peer to report its identity
+const peerIdentityTimeout = time.Second
+
+var ErrPeerIdentity = errors.New("peer identity mismatch")
+
+// tlsReloader holds the certificate and CA pool for mutual TLS on the fRPC channel,
+// reloading them when the files change so certificates can be rotated without a restart
+type tlsReloader struct {
+	caFile   string
+	certFile string
+	keyFile  string
+	peerSANs []string
+	logger   types.Logger
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	pool *x509.CertPool
+
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+// newTLSReloader loads the configured certificates and starts watching them.
+// It returns nil if mutual TLS is not configured.
+func newTLSReloader(config *LeaderConfig, logger types.Logger) (*tlsReloader, error) {
+	if config.TLSCAFile == "" {
+		return nil, nil //nolint:nilnil // TLS is disabled
+	}
+
+	r := &tlsReloader{
+		caFile:   config.TLSCAFile,
+		certFile: config.TLSCertFile,
+		keyFile:  config.TLSKeyFile,
+		peerSANs: config.TLSPeerSANs,
+		logger:   logger,
+		done:     make(chan struct{}),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate watcher: %w", err)
+	}
+
+	// Watch the directories rather than the files, so replacing a file by rename is seen
+	var dirs []string
+	for _, file := range r.files() {
+		if dir := filepath.Dir(file); !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return nil, fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+	r.watcher = watcher
+
+	go r.watch()
+
+	return r, nil
+}
+
+// LoadClientTLSConfig loads the TLS configuration used by tools connecting to a failover
+// daemon that requires mutual TLS. It returns nil if caFile is empty.
+func LoadClientTLSConfig(caFile, certFile, keyFile string, peerSANs []string) (*tls.Config, error) {
+	if caFile == "" {
+		return nil, nil //nolint:nilnil // TLS is disabled
+	}
+
+	r := &tlsReloader{
+		caFile:   caFile,
+		certFile: certFile,
+		keyFile:  keyFile,
+		peerSANs: peerSANs,
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r.clientConfig(), nil
+}
+
+func (r *tlsReloader) files() []string {
+	return []string{filepath.Clean(r.caFile), filepath.Clean(r.certFile), filepath.Clean(r.keyFile)}
+}
+
+// load reads the certificate, key and CA bundle, replacing the current ones only if all are valid
+func (r *tlsReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate %s: %w", r.certFile, err)
+	}
+
+	caPEM, err := os.ReadFile(r.caFile)
+	if err != nil {
+		return fmt.Errorf("failed to read CA file %s: %w", r.caFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no certificates found in CA file %s", r.caFile)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.pool = pool
+	r.mu.Unlock()
+
+	return nil
+}
+
+// watch reloads the certificates whenever one of the files changes
+func (r *tlsReloader) watch() {
+	files := r.files()
+	for {
+		select {
+		case <-r.done:
+			return
+		case event, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			// Kubernetes secret volumes swap a ..data symlink rather than the files themselves
+			name := filepath.Clean(event.Name)
+			if !slices.Contains(files, name) && !strings.HasPrefix(filepath.Base(name), "..") {
+				continue
+			}
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Rename) {
+				continue
+			}
+
+			if err := r.load(); err != nil {
+				// Files are often written one at a time, keep the old certificates until all are valid
+				r.logger.Warn().Err(err).Str("file", event.Name).Msg("Failed to reload TLS certificates")
+				continue
+			}
+			r.logger.Info().Str("file", event.Name).Msg("Reloaded TLS certificates")
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+			r.logger.Warn().Err(err).Msg("TLS certificate watcher error")
+		}
+	}
+}
+
+// Close stops watching the certificate files
+func (r *tlsReloader) Close() error {
+	if r == nil {
+		return nil
+	}
+	select {
+	case <-r.done:
+		return nil
+	default:
+		close(r.done)
+	}
+	return r.watcher.Close()
+}
+
+// serverConfig returns the TLS configuration for the fRPC server, or nil if TLS is disabled.
+// Clients must present a certificate signed by the CA.
+func (r *tlsReloader) serverConfig() *tls.Config {
+	if r == nil {
+		return nil
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		ClientAuth: tls.RequireAnyClientCert,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.certificate(), nil
+		},
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return r.verifyPeer(cs, x509.ExtKeyUsageClientAuth)
+		},
+	}
+}
+
+// clientConfig returns the TLS configuration for fRPC clients, or nil if TLS is disabled
+func (r *tlsReloader) clientConfig() *tls.Config {
+	if r == nil {
+		return nil
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		// The server certificate is verified against the current CA pool in VerifyConnection,
+		// since peers are identified by SAN rather than by the address dialed
+		InsecureSkipVerify: true, //nolint:gosec // verified in VerifyConnection
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.certificate(), nil
+		},
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return r.verifyPeer(cs, x509.ExtKeyUsageServerAuth)
+		},
+	}
+}
+
+func (r *tlsReloader) certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// verifyPeer checks the peer certificate chains to the CA and carries one of the accepted SANs
+func (r *tlsReloader) verifyPeer(cs tls.ConnectionState, usage x509.ExtKeyUsage) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("peer did not present a certificate")
+	}
+
+	r.mu.RLock()
+	pool := r.pool
+	r.mu.RUnlock()
+
+	leaf := cs.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}); err != nil {
+		return fmt.Errorf("failed to verify peer certificate: %w", err)
+	}
+
+	if len(r.peerSANs) == 0 {
+		return nil
+	}
+	for _, san := range certificateSANs(leaf) {
+		if slices.Contains(r.peerSANs, san) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: certificate for %v does not match any accepted SAN", ErrPeerIdentity, certificateSANs(leaf))
+}
+
+// certificateSANs lists the subject alternative names of a certificate as strings
+func certificateSANs(cert *x509.Certificate) []string {
+	sans := slices.Clone(cert.DNSNames)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
+
+// verifyPeerIdentity checks a newly connected peer reports the configured instance ID
+func (lf *LeaderFailover) verifyPeerIdentity(c *Client) error {
+	if lf.config.PeerInstanceID == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), peerIdentityTimeout)
+	defer cancel()
+
+	response, err := rpcResponse(c.FailoverService.HealthCheck(ctx, &FailoverHealthCheckRequest{
+		RequestId: fmt.Sprintf("identity_%d", time.Now().UnixNano()),
+		Epoch:     lf.epochs.current(),
+		Probe:     true,
+	}))
+	if err != nil {
+		return fmt.Errorf("failed to check peer identity: %w", err)
+	}
+
+	if response.InstanceId != lf.config.PeerInstanceID {
+		return fmt.Errorf("%w: peer reported instance %s, expected %s", ErrPeerIdentity, response.InstanceId, lf.config.PeerInstanceID)
+	}
+
+	return nil
+}
@@ -0,0 +1,325 @@
+package failover
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/loopholelabs/logging"
+)
+
+// testCA is a certificate authority issuing certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newTestCA creates a self-signed certificate authority
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "failover test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue creates a certificate and key for a failover node with the given DNS SAN, usable
+// as both client and server
+func (ca *testCA) issue(t *testing.T, serial int64, san string) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: san},
+		DNSNames:     []string{san},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeTestFile replaces a file by renaming a complete copy over it, as certificate
+// rotation tools do
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	tmp := path + ".new"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestTLSConfig writes a CA bundle and a node certificate into a directory and returns
+// the configuration pointing at them
+func newTestTLSConfig(t *testing.T, ca *testCA, certPEM, keyPEM []byte, peerSANs ...string) *LeaderConfig {
+	t.Helper()
+
+	dir := t.TempDir()
+	config := &LeaderConfig{
+		TLSCAFile:   filepath.Join(dir, "ca.pem"),
+		TLSCertFile: filepath.Join(dir, "cert.pem"),
+		TLSKeyFile:  filepath.Join(dir, "key.pem"),
+		TLSPeerSANs: peerSANs,
+	}
+	writeTestFile(t, config.TLSCAFile, ca.pem)
+	writeTestFile(t, config.TLSCertFile, certPEM)
+	writeTestFile(t, config.TLSKeyFile, keyPEM)
+
+	return config
+}
+
+// configure issues a certificate for san and sets up mutual TLS with it in config
+func (ca *testCA) configure(t *testing.T, config *LeaderConfig, san string) {
+	t.Helper()
+
+	cert, key := ca.issue(t, 100, san)
+	files := newTestTLSConfig(t, ca, cert, key)
+	config.TLSCAFile, config.TLSCertFile, config.TLSKeyFile = files.TLSCAFile, files.TLSCertFile, files.TLSKeyFile
+}
+
+// handshake connects a client and a server over loopback and returns the certificate the
+// client saw, and the errors of both sides
+func handshake(t *testing.T, client, server *tls.Config) (*x509.Certificate, error, error) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		serverErr <- tls.Server(conn, server).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), client)
+	if err != nil {
+		return nil, err, <-serverErr
+	}
+	defer func() { _ = conn.Close() }()
+
+	var seen *x509.Certificate
+	if certs := conn.ConnectionState().PeerCertificates; len(certs) > 0 {
+		seen = certs[0]
+	}
+
+	return seen, nil, <-serverErr
+}
+
+func TestTLSReloadRotatesCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, 10, "node-a")
+	server, err := newTLSReloader(newTestTLSConfig(t, ca, certPEM, keyPEM), logging.Test(t, logging.Zerolog, "server"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = server.Close() })
+
+	clientCert, clientKey := ca.issue(t, 20, "node-b")
+	client, err := newTLSReloader(newTestTLSConfig(t, ca, clientCert, clientKey), logging.Test(t, logging.Zerolog, "client"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	seen, clientErr, serverErr := handshake(t, client.clientConfig(), server.serverConfig())
+	if clientErr != nil || serverErr != nil {
+		t.Fatalf("handshake: client %v, server %v", clientErr, serverErr)
+	}
+	if seen.SerialNumber.Int64() != 10 {
+		t.Fatalf("certificate before rotation: got serial %d, want 10", seen.SerialNumber)
+	}
+
+	// The key is replaced before the certificate, so the first reload sees a mismatched pair
+	rotatedCert, rotatedKey := ca.issue(t, 11, "node-a")
+	writeTestFile(t, server.keyFile, rotatedKey)
+	writeTestFile(t, server.certFile, rotatedCert)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.certificate().Leaf.SerialNumber.Int64() != 11 {
+		if time.Now().After(deadline) {
+			t.Fatal("rotated certificate was not loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	seen, clientErr, serverErr = handshake(t, client.clientConfig(), server.serverConfig())
+	if clientErr != nil || serverErr != nil {
+		t.Fatalf("handshake after rotation: client %v, server %v", clientErr, serverErr)
+	}
+	if seen.SerialNumber.Int64() != 11 {
+		t.Fatalf("certificate after rotation: got serial %d, want 11", seen.SerialNumber)
+	}
+}
+
+func TestTLSReloadKeepsValidCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, 10, "node-a")
+	otherCert, otherKey := ca.issue(t, 11, "node-a")
+
+	tests := []struct {
+		name  string
+		write func(t *testing.T, config *LeaderConfig)
+	}{
+		{
+			name: "half-written certificate",
+			write: func(t *testing.T, config *LeaderConfig) {
+				writeTestFile(t, config.TLSCertFile, otherCert[:len(otherCert)/2])
+			},
+		},
+		{
+			name: "certificate without its key",
+			write: func(t *testing.T, config *LeaderConfig) {
+				writeTestFile(t, config.TLSCertFile, otherCert)
+			},
+		},
+		{
+			name: "empty key",
+			write: func(t *testing.T, config *LeaderConfig) {
+				writeTestFile(t, config.TLSKeyFile, nil)
+			},
+		},
+		{
+			name: "CA bundle without certificates",
+			write: func(t *testing.T, config *LeaderConfig) {
+				writeTestFile(t, config.TLSKeyFile, otherKey)
+				writeTestFile(t, config.TLSCertFile, otherCert)
+				writeTestFile(t, config.TLSCAFile, []byte("not a certificate\n"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newTestTLSConfig(t, ca, certPEM, keyPEM)
+			r := &tlsReloader{
+				caFile:   config.TLSCAFile,
+				certFile: config.TLSCertFile,
+				keyFile:  config.TLSKeyFile,
+			}
+			if err := r.load(); err != nil {
+				t.Fatal(err)
+			}
+			pool := r.pool
+
+			tt.write(t, config)
+			if err := r.load(); err == nil {
+				t.Fatal("loaded invalid certificate files")
+			}
+			if serial := r.certificate().Leaf.SerialNumber.Int64(); serial != 10 || r.pool != pool {
+				t.Fatalf("certificate after a failed reload: got serial %d, want the previous pair", serial)
+			}
+		})
+	}
+}
+
+func TestTLSPeerSANs(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, 10, "node-a")
+
+	tests := []struct {
+		name     string
+		ca       *testCA
+		san      string
+		peerSANs []string
+		wantErr  error
+	}{
+		{name: "accepted SAN", ca: ca, san: "node-b", peerSANs: []string{"node-b"}},
+		{name: "any SAN", ca: ca, san: "node-c"},
+		{name: "other SAN", ca: ca, san: "node-c", peerSANs: []string{"node-b"}, wantErr: ErrPeerIdentity},
+		{name: "other CA", ca: newTestCA(t), san: "node-b", peerSANs: []string{"node-b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := newTLSReloader(newTestTLSConfig(t, ca, serverCert, serverKey, tt.peerSANs...), logging.Test(t, logging.Zerolog, "server"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = server.Close() })
+
+			clientCert, clientKey := tt.ca.issue(t, 20, tt.san)
+			client, err := newTLSReloader(newTestTLSConfig(t, tt.ca, clientCert, clientKey), logging.Test(t, logging.Zerolog, "client"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = client.Close() })
+
+			_, _, serverErr := handshake(t, client.clientConfig(), server.serverConfig())
+			switch {
+			case tt.ca != ca:
+				if serverErr == nil {
+					t.Fatal("accepted a peer certificate from another CA")
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(serverErr, tt.wantErr) {
+					t.Fatalf("handshake: got %v, want %v", serverErr, tt.wantErr)
+				}
+			case serverErr != nil:
+				t.Fatalf("handshake: %v", serverErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	metrics "github.com/hashicorp/go-metrics/compat"
+)
+
+// stateHistorySize is the number of recent state transitions kept for the control API
+const stateHistorySize = 20
+
+// promotionRetryBackoff is the wait before the first retry of failed failover actions,
+// doubling with every further attempt
+const promotionRetryBackoff = time.Second
+
+var (
+	ErrInvalidTransition = errors.New("invalid state transition")
+	ErrTransitionVetoed  = errors.New("transition vetoed")
+)
+
+// NodeState is the position of a node in the role transition state machine. Promotion
+// runs Candidate (checks and pre-promote hooks) then Promoting (epoch claim and failover
+// actions) to Primary; Demoting tears down the current role and sets up the Secondary one.
+// A promotion that cannot complete ends in Failed, from which the node demotes.
+type NodeState int
+
+const (
+	StateUnknown NodeState = iota
+	StateCandidate
+	StatePromoting
+	StatePrimary
+	StateDemoting
+	StateSecondary
+	StateFailed
+)
+
+func (s NodeState) String() string {
+	switch s {
+	case StateCandidate:
+		return "candidate"
+	case StatePromoting:
+		return "promoting"
+	case StatePrimary:
+		return "primary"
+	case StateDemoting:
+		return "demoting"
+	case StateSecondary:
+		return "secondary"
+	case StateFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// stateEdges lists the states each state may move to
+var stateEdges = map[NodeState][]NodeState{
+	StateUnknown:   {StateCandidate, StateDemoting},
+	StateCandidate: {StatePromoting, StateSecondary, StateDemoting},
+	StatePromoting: {StatePrimary, StateFailed},
+	StatePrimary:   {StateDemoting},
+	StateDemoting:  {StateSecondary, StateFailed},
+	StateSecondary: {StateCandidate, StateDemoting},
+	StateFailed:    {StateCandidate, StateDemoting},
+}
+
+// StateTransition records a move between states of the role transition state machine
+type StateTransition struct {
+	Time   time.Time `json:"time"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Reason string    `json:"reason"`
+	Error  string    `json:"error,omitempty"`
+
+	// Annotations added by transition hooks
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// roleRequest asks the role management loop for a role, with what triggered the request
+// and the observations it was based on for the journal
+type roleRequest struct {
+	role     NodeRole
+	trigger  string
+	reason   string
+	inputs   *JournalInputs
+	detected time.Time
+}
+
+// newRoleRequest creates a request for role that was triggered now
+func newRoleRequest(role NodeRole, trigger, reason string, inputs *JournalInputs) roleRequest {
+	return roleRequest{
+		role:     role,
+		trigger:  trigger,
+		reason:   reason,
+		inputs:   inputs,
+		detected: time.Now(),
+	}
+}
+
+// enterState moves the state machine to state and records why. Moves the state machine
+// does not allow are refused and leave the state unchanged.
+func (lf *LeaderFailover) enterState(state NodeState, reason string, cause error, annotations map[string]string) error {
+	lf.stateMutex.Lock()
+	defer lf.stateMutex.Unlock()
+
+	from := lf.state
+	if !slices.Contains(stateEdges[from], state) {
+		return fmt.Errorf("%w from %s to %s", ErrInvalidTransition, from, state)
+	}
+
+	record := StateTransition{
+		Time:        time.Now(),
+		From:        from.String(),
+		To:          state.String(),
+		Reason:      reason,
+		Annotations: annotations,
+	}
+	if cause != nil {
+		record.Error = cause.Error()
+	}
+
+	lf.state = state
+	lf.stateHistory = append(lf.stateHistory, record)
+	if len(lf.stateHistory) > stateHistorySize {
+		lf.stateHistory = slices.Delete(lf.stateHistory, 0, len(lf.stateHistory)-stateHistorySize)
+	}
+
+	logEvent := lf.logger.Info()
+	if cause != nil {
+		logEvent = lf.logger.Warn().Err(cause)
+	}
+	for _, key := range slices.Sorted(maps.Keys(annotations)) {
+		logEvent = logEvent.Str("annotation_"+key, annotations[key])
+	}
+	logEvent.
+		Str("from_state", from.String()).
+		Str("to_state", state.String()).
+		Str("reason", reason).
+		Msg("State transition")
+
+	lf.journal.record(JournalEntry{
+		Time:        record.Time,
+		Event:       JournalEventState,
+		From:        record.From,
+		To:          record.To,
+		Reason:      reason,
+		Annotations: annotations,
+		Error:       record.Error,
+	})
+
+	metrics.IncrCounter([]string{"transition", state.String()}, 1)
+
+	return nil
+}
+
+// currentState returns the state of the role transition state machine
+func (lf *LeaderFailover) currentState() NodeState {
+	lf.stateMutex.Lock()
+	defer lf.stateMutex.Unlock()
+
+	return lf.state
+}
+
+// roleOfState returns the role a node in state holds, RoleUnknown while a transition is
+// under way, after one failed, or before the first one
+func roleOfState(state NodeState) NodeRole {
+	switch state {
+	case StatePrimary:
+		return RolePrimary
+	case StateSecondary:
+		return RoleSecondary
+	default:
+		return RoleUnknown
+	}
+}
+
+// settleRole sets the current role from the state a transition left the state machine in,
+// so a transition that failed part way never leaves the role it tore down in place
+func (lf *LeaderFailover) settleRole() NodeRole {
+	lf.stateMutex.Lock()
+	defer lf.stateMutex.Unlock()
+
+	role := roleOfState(lf.state)
+	lf.currentRole.Store(role)
+	return role
+}
+
+// stateHistorySnapshot returns the recent state transitions, oldest first
+func (lf *LeaderFailover) stateHistorySnapshot() []StateTransition {
+	lf.stateMutex.Lock()
+	defer lf.stateMutex.Unlock()
+
+	return slices.Clone(lf.stateHistory)
+}
+
+// promote runs a promotion through the state machine: pre-promote hooks may veto it and a
+// leadership lease must be held before the current role is torn down, then the epoch is
+// claimed and the failover actions run with retries. It returns the role the node ended
+// up in, which is secondary when the promotion was abandoned or failed.
+func (lf *LeaderFailover) promote(ctx context.Context, reason string) (NodeRole, error) {
+	from := lf.currentState()
+	if err := lf.enterState(StateCandidate, reason, nil, nil); err != nil {
+		return RoleUnknown, err
+	}
+
+	annotations, err := lf.runHooks(ctx, HookPrePromote, from, RolePrimary, reason)
+	if err != nil {
+		return lf.abandonPromotion(ctx, fmt.Errorf("%w: %w", ErrTransitionVetoed, err))
+	}
+
+	// With a lease or quorum based elector, confirm leadership before tearing down the current role
+	if err := lf.acquireLease(ctx); err != nil {
+		return lf.abandonPromotion(ctx, fmt.Errorf("failed to acquire leadership lease: %w", err))
+	}
+
+	// A planned switchover catches up with the primary before its client is torn down
+	lf.syncBeforeHandover(ctx)
+
+	if err := lf.enterState(StatePromoting, reason, nil, annotations); err != nil {
+		return RoleUnknown, err
+	}
+
+	lf.logger.Info().Str("target_role", RolePrimary.String()).Msg("Starting role transition, cleaning up current state")
+	if err := lf.cleanup(); err != nil {
+		lf.logger.Warn().Err(err).Str("target_role", RolePrimary.String()).Msg("Error during role cleanup")
+	}
+
+	lf.logger.Info().Msg("Transitioning to PRIMARY role")
+	if err := lf.becomePrimary(ctx); err != nil {
+		// Stop whatever the primary role had started and leave leadership to the peer
+		_ = lf.enterState(StateFailed, reason, err, nil)
+		if role, demoteErr := lf.demote(ctx, "promotion failed"); demoteErr != nil {
+			return role, errors.Join(err, demoteErr)
+		}
+		return RoleSecondary, fmt.Errorf("promotion failed: %w", err)
+	}
+
+	postAnnotations, err := lf.runHooks(ctx, HookPostPromote, StatePromoting, RolePrimary, reason)
+	if err != nil {
+		lf.logger.Warn().Err(err).Msg("Post-promote hook failed")
+		postAnnotations["hook_error"] = err.Error()
+	}
+	if err := lf.enterState(StatePrimary, reason, nil, postAnnotations); err != nil {
+		return RolePrimary, err
+	}
+
+	return RolePrimary, nil
+}
+
+// abandonPromotion gives up a promotion before the current role was torn down. A secondary
+// stays secondary, any other node demotes.
+func (lf *LeaderFailover) abandonPromotion(ctx context.Context, cause error) (NodeRole, error) {
+	if lf.currentRole.Load() != RoleSecondary {
+		if role, err := lf.demote(ctx, "promotion abandoned: "+cause.Error()); err != nil {
+			return role, errors.Join(cause, err)
+		}
+		return RoleSecondary, cause
+	}
+
+	// Release leadership an authoritative elector may have granted us
+	if _, ok := lf.elector.(LeaseGuard); ok {
+		if err := lf.elector.Resign(ctx); err != nil {
+			lf.logger.Warn().Err(err).Msg("Failed to resign leadership")
+		}
+	}
+	if err := lf.enterState(StateSecondary, "promotion abandoned", cause, nil); err != nil {
+		return RoleSecondary, errors.Join(cause, err)
+	}
+
+	// The liveness loop stops once it requests a promotion, keep watching the primary
+	lf.monitorPrimary(ctx)
+
+	return RoleSecondary, cause
+}
+
+// demote runs a demotion through the state machine: the current role is torn down, the
+// secondary role set up and the post-demote hooks run. It returns the role the node ended
+// up in, RoleUnknown when even the secondary role could not be set up.
+func (lf *LeaderFailover) demote(ctx context.Context, reason string) (NodeRole, error) {
+	from := lf.currentState()
+	if err := lf.enterState(StateDemoting, reason, nil, nil); err != nil {
+		return RoleUnknown, err
+	}
+
+	lf.logger.Info().Str("target_role", RoleSecondary.String()).Msg("Starting role transition, cleaning up current state")
+	if err := lf.cleanup(); err != nil {
+		lf.logger.Warn().Err(err).Str("target_role", RoleSecondary.String()).Msg("Error during role cleanup")
+	}
+
+	lf.logger.Info().Msg("Transitioning to SECONDARY role")
+	if err := lf.becomeSecondary(ctx); err != nil {
+		_ = lf.enterState(StateFailed, reason, err, nil)
+		return RoleUnknown, fmt.Errorf("demotion failed: %w", err)
+	}
+
+	annotations, err := lf.runHooks(ctx, HookPostDemote, from, RoleSecondary, reason)
+	if err != nil {
+		lf.logger.Warn().Err(err).Msg("Post-demote hook failed")
+		annotations["hook_error"] = err.Error()
+	}
+	if err := lf.enterState(StateSecondary, reason, nil, annotations); err != nil {
+		return RoleSecondary, err
+	}
+
+	return RoleSecondary, nil
+}
+
+// runFailoverActions runs the AWS failover actions, retrying failed attempts with backoff
+// until the configured attempts or the promotion timeout run out. Each attempt retries its
+// steps itself and skips those already in place. A superseded epoch is not retried.
+func (lf *LeaderFailover) runFailoverActions(ctx context.Context) error {
+	backoff := promotionRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := lf.executeFailoverActions(ctx)
+		lf.recordFailoverAction(err)
+		if err == nil {
+			return nil
+		}
+		if attempt >= lf.config.PromotionAttempts || errors.Is(err, ErrStaleEpoch) {
+			return fmt.Errorf("failover actions failed after %d attempts: %w", attempt, err)
+		}
+
+		lf.logger.Warn().Err(err).
+			Int("attempt", attempt).
+			Str("backoff", backoff.String()).
+			Msg("Failover actions failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failover actions timed out after %d attempts: %w", attempt, errors.Join(err, ctx.Err()))
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,192 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+)
+
+// transitioning has the node serve the primary role on a free port and give up a promotion
+// after its first attempt at the failover actions
+func transitioning(t *testing.T) func(*LeaderConfig) {
+	port := freeTCPPort(t)
+	return func(config *LeaderConfig) {
+		config.Port = port
+		config.PromotionAttempts = 1
+	}
+}
+
+// requireStates fails the test unless the recorded state transitions visited states in order
+func requireStates(t *testing.T, history []StateTransition, states ...NodeState) {
+	t.Helper()
+
+	var got []string
+	for _, record := range history {
+		got = append(got, record.To)
+	}
+	var want []string
+	for _, state := range states {
+		want = append(want, state.String())
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("states: got %v, want %v", got, want)
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	var ran []string
+	lf := newTestFailover(t, newTestCloud(), "i-b", transitioning(t), func(config *LeaderConfig) {
+		config.Hooks.PostPromote = []TransitionHook{
+			func(_ context.Context, event *TransitionEvent) error {
+				ran = append(ran, "add")
+				event.Annotations["a"] = "1"
+				return nil
+			},
+			func(_ context.Context, event *TransitionEvent) error {
+				ran = append(ran, "clear")
+				event.Annotations = nil
+				return errors.New("first failure")
+			},
+			func(_ context.Context, event *TransitionEvent) error {
+				ran = append(ran, "replace")
+				event.Annotations = map[string]string{"c": "3"}
+				return nil
+			},
+		}
+		config.PostPromoteHooks = []string{
+			"echo b=2; echo not an annotation; echo =no key; echo e=f=g; echo hook=$FAILOVER_HOOK",
+			"echo second failure >&2; exit 3",
+		}
+	})
+
+	annotations, err := lf.runHooks(context.Background(), HookPostPromote, StatePromoting, RolePrimary, "test")
+	if err == nil || !strings.Contains(err.Error(), "first failure") || !strings.Contains(err.Error(), "second failure") {
+		t.Fatalf("error: got %v, want both failures", err)
+	}
+	if strings.Join(ran, ",") != "add,clear,replace" {
+		t.Fatalf("ran %v, want every hook despite the failure", ran)
+	}
+
+	want := map[string]string{"a": "1", "b": "2", "c": "3", "e": "f=g", "hook": HookPostPromote}
+	if !maps.Equal(annotations, want) {
+		t.Fatalf("annotations: got %v, want %v", annotations, want)
+	}
+}
+
+func TestRunHooksPrePromoteVeto(t *testing.T) {
+	var ran []string
+	lf := newTestFailover(t, newTestCloud(), "i-b", transitioning(t), func(config *LeaderConfig) {
+		config.Hooks.PrePromote = []TransitionHook{
+			func(_ context.Context, event *TransitionEvent) error {
+				ran = append(ran, "veto")
+				event.Annotations = nil
+				return errors.New("not today")
+			},
+			func(context.Context, *TransitionEvent) error {
+				ran = append(ran, "after veto")
+				return nil
+			},
+		}
+		config.PrePromoteHooks = []string{"echo ran=true"}
+	})
+
+	annotations, err := lf.runHooks(context.Background(), HookPrePromote, StateSecondary, RolePrimary, "test")
+	if err == nil || !strings.Contains(err.Error(), "not today") {
+		t.Fatalf("error: got %v, want the veto", err)
+	}
+	if strings.Join(ran, ",") != "veto" || annotations == nil || annotations["ran"] != "" {
+		t.Fatalf("ran %v with annotations %v, want hooks after the veto skipped", ran, annotations)
+	}
+}
+
+func TestHookCommandTimeout(t *testing.T) {
+	lf := newTestFailover(t, newTestCloud(), "i-b", transitioning(t), func(config *LeaderConfig) {
+		config.HookTimeout = 500 * time.Millisecond
+		config.PostDemoteHooks = []string{"sleep 3 | cat"} // cat holds the output open
+	})
+
+	start := time.Now()
+	_, err := lf.runHooks(context.Background(), HookPostDemote, StatePrimary, RoleSecondary, "test")
+	if err == nil {
+		t.Fatal("hook outliving its timeout succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("hook timed out after 500ms returned after %s", elapsed)
+	}
+}
+
+func TestPromoteVetoed(t *testing.T) {
+	lf := newTestFailover(t, newTestCloud(), "i-b", transitioning(t), func(config *LeaderConfig) {
+		config.Hooks.PrePromote = []TransitionHook{func(context.Context, *TransitionEvent) error {
+			return errors.New("not today")
+		}}
+	})
+	lf.state = StateSecondary
+	lf.currentRole.Store(RoleSecondary)
+
+	role, err := lf.promote(context.Background(), "test")
+	if role != RoleSecondary || !errors.Is(err, ErrTransitionVetoed) {
+		t.Fatalf("promote: got %s with %v, want a vetoed secondary", role, err)
+	}
+
+	history := lf.stateHistorySnapshot()
+	requireStates(t, history, StateCandidate, StateSecondary)
+	if last := history[len(history)-1]; !strings.Contains(last.Error, "not today") {
+		t.Fatalf("abandoned promotion records %q, want the veto", last.Error)
+	}
+}
+
+func TestPromoteFailedPostPromoteHook(t *testing.T) {
+	cloud := newTestCloud()
+	lf := newTestFailover(t, cloud, "i-b", transitioning(t), func(config *LeaderConfig) {
+		config.Hooks.PostPromote = []TransitionHook{func(_ context.Context, event *TransitionEvent) error {
+			event.Annotations = nil
+			return errors.New("notification failed")
+		}}
+	})
+
+	role, err := lf.promote(context.Background(), "test")
+	if role != RolePrimary || err != nil {
+		t.Fatalf("promote: got %s with %v, want primary despite the hook", role, err)
+	}
+	if eni := cloud.ENIWithIP(testENIIP); eni != "eni-b" {
+		t.Fatalf("ENI IP is on %s, want eni-b", eni)
+	}
+
+	history := lf.stateHistorySnapshot()
+	requireStates(t, history, StateCandidate, StatePromoting, StatePrimary)
+	if hookErr := history[len(history)-1].Annotations["hook_error"]; !strings.Contains(hookErr, "notification failed") {
+		t.Fatalf("primary state records hook error %q, want the failure", hookErr)
+	}
+}
+
+func TestPromoteFailedDemotes(t *testing.T) {
+	cloud := newTestCloud()
+	cloud.SetError("GetEpochTag", errors.New("throttled"))
+	lf := newTestFailover(t, cloud, "i-b", transitioning(t), func(config *LeaderConfig) {
+		config.Hooks.PostDemote = []TransitionHook{func(_ context.Context, event *TransitionEvent) error {
+			event.Annotations = nil
+			return errors.New("notification failed")
+		}}
+	})
+
+	role, err := lf.promote(context.Background(), "test")
+	if role != RoleSecondary || err == nil || !strings.Contains(err.Error(), "throttled") {
+		t.Fatalf("promote: got %s with %v, want a failed promotion leaving a secondary", role, err)
+	}
+
+	history := lf.stateHistorySnapshot()
+	requireStates(t, history, StateCandidate, StatePromoting, StateFailed, StateDemoting, StateSecondary)
+	if failed := history[2]; !strings.Contains(failed.Error, "throttled") {
+		t.Fatalf("failed state records %q, want the cause", failed.Error)
+	}
+	if hookErr := history[4].Annotations["hook_error"]; !strings.Contains(hookErr, "notification failed") {
+		t.Fatalf("secondary state records hook error %q, want the failure", hookErr)
+	}
+	if eni := cloud.ENIWithIP(testENIIP); eni != "eni-a" {
+		t.Fatalf("ENI IP is on %s, want it left on eni-a", eni)
+	}
+}
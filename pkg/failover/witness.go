@@ -0,0 +1,316 @@
+package failover
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/loopholelabs/logging/types"
+)
+
+// Witness is a lightweight tie-breaker that runs neither Conduit nor any AWS
+// operations. With the raft backend it is a voting cluster member; otherwise it
+// receives heartbeats from the primary and must agree before a secondary promotes.
+type Witness struct {
+	config *LeaderConfig
+	logger types.Logger
+
+	// Raft cluster member (raft backend only)
+	elector *RaftElector
+
+	// fRPC server receiving heartbeats and vote requests (heartbeat witness only)
+	server *Server
+
+	// Mutual TLS certificates for the fRPC server, nil when TLS is disabled
+	tls *tlsReloader
+
+	// Highest epoch seen from the primary or a candidate, persisted so a restarted
+	// witness never accepts a lower one (heartbeat witness only)
+	epochs *epochStore
+
+	// When the witness started, it does not vote before it could have seen the primary
+	startedAt time.Time
+
+	mu            sync.Mutex
+	lastHeartbeat time.Time
+	primaryENI    string
+	votedEpoch    uint64
+	votedFor      string
+	votedAt       time.Time
+}
+
+var _ FailoverService = (*Witness)(nil)
+
+// NewWitness creates a witness, joining the raft cluster when the raft backend is configured
+func NewWitness(config *LeaderConfig) (*Witness, error) {
+	config.Mode = ModeWitness
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	w := &Witness{
+		config: config,
+		logger: config.Logger,
+	}
+
+	tlsCerts, err := newTLSReloader(config, config.Logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS configuration: %w", err)
+	}
+	w.tls = tlsCerts
+
+	if config.ElectionBackend == ElectionBackendRaft {
+		elector, err := newRaftElectorFromConfig(config, true, tlsCerts)
+		if err != nil {
+			_ = tlsCerts.Close()
+			return nil, fmt.Errorf("failed to start raft elector: %w", err)
+		}
+		w.elector = elector
+		return w, nil
+	}
+
+	epochs, err := newEpochStore(config.StateDir)
+	if err != nil {
+		_ = tlsCerts.Close()
+		return nil, fmt.Errorf("failed to load epoch: %w", err)
+	}
+	w.epochs = epochs
+	w.startedAt = time.Now()
+
+	return w, nil
+}
+
+// Start runs the witness until the context is cancelled
+func (w *Witness) Start(ctx context.Context) error {
+	if w.elector != nil {
+		return w.runRaft(ctx)
+	}
+
+	w.logger.Info().
+		Uint16("port", w.config.Port).
+		Uint64("epoch", w.epochs.current()).
+		Str("heartbeat_interval", w.config.HeartbeatInterval.String()).
+		Int("heartbeat_miss_threshold", w.config.HeartbeatMissThreshold).
+		Msg("Starting failover witness")
+
+	server, err := NewServer(w, w.tls.serverConfig(), w.logger)
+	if err != nil {
+		return fmt.Errorf("failed to create fRPC server: %w", err)
+	}
+	w.server = server
+
+	serverAddr := fmt.Sprintf(":%d", w.config.Port)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Start(serverAddr)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errCh:
+		return fmt.Errorf("fRPC server failed: %w", err)
+	}
+}
+
+// runRaft takes part in the raft cluster, logging leadership changes
+func (w *Witness) runRaft(ctx context.Context) error {
+	w.logger.Info().
+		Str("node_id", w.config.NodeID).
+		Int("cluster_peers", len(w.config.ClusterPeers)).
+		Msg("Starting failover witness")
+
+	ticker := time.NewTicker(w.config.LeaderCheckInterval)
+	defer ticker.Stop()
+
+	lastLeader := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-w.elector.Changes():
+		case <-ticker.C:
+		}
+
+		leader, err := w.elector.Observe(ctx)
+		if err != nil {
+			leader = ""
+		}
+		if leader != lastLeader {
+			w.logger.Info().
+				Str("old_leader", lastLeader).
+				Str("new_leader", leader).
+				Msg("Cluster leader changed")
+			lastLeader = leader
+		}
+	}
+}
+
+// Stop shuts down the fRPC server or leaves the raft cluster
+func (w *Witness) Stop() error {
+	if err := w.tls.Close(); err != nil {
+		w.logger.Warn().Err(err).Msg("Failed to stop TLS certificate watcher")
+	}
+	if w.elector != nil {
+		return w.elector.Close()
+	}
+	if w.server != nil {
+		return w.server.Shutdown()
+	}
+	return nil
+}
+
+// primaryDownAfter is how long the witness must go without a heartbeat before it agrees the primary is down
+func (w *Witness) primaryDownAfter() time.Duration {
+	return w.config.HeartbeatInterval * time.Duration(w.config.HeartbeatMissThreshold)
+}
+
+// SyncState is not served by the witness, it holds no NAT state
+func (w *Witness) SyncState(_ context.Context, req *FailoverSyncStateRequest) (*FailoverSyncStateResponse, error) {
+	return &FailoverSyncStateResponse{
+		RequestId:    req.RequestId,
+		Success:      false,
+		ErrorMessage: "witness does not hold NAT state",
+	}, nil
+}
+
+// SyncStateChunk is not served by the witness, it holds no NAT state
+func (w *Witness) SyncStateChunk(_ context.Context, req *FailoverSyncStateChunkRequest) (*FailoverSyncStateChunkResponse, error) {
+	return &FailoverSyncStateChunkResponse{
+		RequestId:    req.RequestId,
+		Success:      false,
+		ErrorMessage: "witness does not hold NAT state",
+	}, nil
+}
+
+// HealthCheck reports the witness role and the highest epoch it has seen
+func (w *Witness) HealthCheck(_ context.Context, req *FailoverHealthCheckRequest) (*FailoverHealthCheckResponse, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	response := &FailoverHealthCheckResponse{
+		RequestId:  req.RequestId,
+		Success:    true,
+		NodeRole:   ModeWitness,
+		InstanceId: w.config.NodeID,
+		Epoch:      w.epochs.current(),
+	}
+	if !w.lastHeartbeat.IsZero() {
+		response.LastHeartbeat = w.lastHeartbeat.UnixNano()
+	}
+
+	return response, nil
+}
+
+// Heartbeat records a heartbeat from the primary. Heartbeats from a primary with
+// an older epoch are rejected so the stale primary steps down.
+func (w *Witness) Heartbeat(_ context.Context, req *FailoverHeartbeatRequest) (*FailoverHeartbeatResponse, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	epoch := w.epochs.current()
+	if req.Epoch < epoch {
+		w.logger.Warn().
+			Uint64("epoch", req.Epoch).
+			Uint64("current_epoch", epoch).
+			Msg("Rejected heartbeat from stale primary")
+		return &FailoverHeartbeatResponse{
+			RequestId: req.RequestId,
+			Success:   false,
+			Timestamp: time.Now().UnixNano(),
+			Sequence:  req.Sequence,
+			Epoch:     epoch,
+		}, nil
+	}
+
+	if req.Epoch > epoch || req.PrimaryEni != w.primaryENI {
+		w.logger.Info().
+			Uint64("epoch", req.Epoch).
+			Str("primary_eni", req.PrimaryEni).
+			Msg("Receiving heartbeats from primary")
+	}
+
+	if _, err := w.epochs.observe(req.Epoch); err != nil {
+		w.logger.Error().Err(err).Uint64("epoch", req.Epoch).Msg("Failed to persist observed epoch")
+	}
+	w.primaryENI = req.PrimaryEni
+	w.lastHeartbeat = time.Now()
+
+	return &FailoverHeartbeatResponse{
+		RequestId: req.RequestId,
+		Success:   true,
+		Timestamp: time.Now().UnixNano(),
+		Sequence:  req.Sequence,
+		Epoch:     w.epochs.current(),
+	}, nil
+}
+
+// RequestVote agrees to a promotion only if the witness has also lost contact with
+// the primary, and only for one candidate per epoch at a time. A witness that has
+// not seen a heartbeat since it started waits as long as it would for a primary to
+// miss them before voting, as a primary may be alive that has not reached it yet.
+func (w *Witness) RequestVote(_ context.Context, req *FailoverVoteRequest) (*FailoverVoteResponse, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	epoch := w.epochs.current()
+	response := &FailoverVoteResponse{
+		RequestId: req.RequestId,
+		Epoch:     epoch,
+	}
+	if !w.lastHeartbeat.IsZero() {
+		response.LastHeartbeat = w.lastHeartbeat.UnixNano()
+	}
+
+	switch {
+	case req.Epoch < epoch:
+		response.Reason = fmt.Sprintf("candidate epoch %d is older than %d", req.Epoch, epoch)
+	case w.lastHeartbeat.IsZero() && time.Since(w.startedAt) < w.primaryDownAfter():
+		response.Reason = fmt.Sprintf("witness started %s ago and has not seen a heartbeat yet", time.Since(w.startedAt).Round(time.Millisecond))
+	case !w.lastHeartbeat.IsZero() && time.Since(w.lastHeartbeat) <= w.primaryDownAfter():
+		response.Reason = fmt.Sprintf("primary is reachable from witness, last heartbeat %s ago", time.Since(w.lastHeartbeat).Round(time.Millisecond))
+	case w.votedEpoch == epoch && w.votedFor != "" && w.votedFor != req.CandidateId && time.Since(w.votedAt) < w.config.LeaderCheckInterval:
+		response.Reason = fmt.Sprintf("already voted for %s in epoch %d", w.votedFor, epoch)
+	default:
+		// The candidate's epoch is remembered before the vote counts
+		if _, err := w.epochs.observe(req.Epoch); err != nil {
+			w.logger.Error().Err(err).Uint64("epoch", req.Epoch).Msg("Failed to persist candidate epoch")
+			response.Reason = "failed to persist epoch"
+			break
+		}
+		response.Granted = true
+		response.Epoch = w.epochs.current()
+		w.votedEpoch = response.Epoch
+		w.votedFor = req.CandidateId
+		w.votedAt = time.Now()
+	}
+
+	w.logger.Info().
+		Str("candidate_id", req.CandidateId).
+		Uint64("candidate_epoch", req.Epoch).
+		Uint64("epoch", response.Epoch).
+		Bool("granted", response.Granted).
+		Str("reason", response.Reason).
+		Msg("Handled promotion vote request")
+
+	return response, nil
+}
+
+// Switchover is not served by the witness, it never holds the primary role
+func (w *Witness) Switchover(_ context.Context, req *FailoverSwitchoverRequest) (*FailoverSwitchoverResponse, error) {
+	return &FailoverSwitchoverResponse{
+		RequestId:    req.RequestId,
+		Success:      false,
+		ErrorMessage: "witness cannot take or hand over the primary role",
+	}, nil
+}
+
+// Promote is not served by the witness, it never holds the primary role
+func (w *Witness) Promote(_ context.Context, req *FailoverPromoteRequest) (*FailoverPromoteResponse, error) {
+	return &FailoverPromoteResponse{
+		RequestId:    req.RequestId,
+		Success:      false,
+		ErrorMessage: "witness cannot be promoted",
+	}, nil
+}
@@ -0,0 +1,116 @@
+package failover
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newTestWitness creates a heartbeat witness keeping its epoch in stateDir without starting it
+func newTestWitness(t *testing.T, stateDir string) *Witness {
+	t.Helper()
+
+	w, err := NewWitness(newTestConfig(t, "witness", func(config *LeaderConfig) {
+		config.StateDir = stateDir
+		config.HeartbeatInterval = 10 * time.Millisecond
+		config.HeartbeatMissThreshold = 3
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return w
+}
+
+func TestWitnessVoteWaitsAfterStart(t *testing.T) {
+	ctx := context.Background()
+	w := newTestWitness(t, t.TempDir())
+
+	vote, err := w.RequestVote(ctx, &FailoverVoteRequest{CandidateId: "i-b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vote.Granted {
+		t.Fatal("vote granted before the witness could have seen the primary")
+	}
+
+	time.Sleep(w.primaryDownAfter())
+	vote, err = w.RequestVote(ctx, &FailoverVoteRequest{CandidateId: "i-b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !vote.Granted {
+		t.Fatalf("vote refused once the primary would have missed its heartbeats: %s", vote.Reason)
+	}
+}
+
+func TestWitnessVoteRefusedWhilePrimaryReachable(t *testing.T) {
+	ctx := context.Background()
+	w := newTestWitness(t, t.TempDir())
+
+	if _, err := w.Heartbeat(ctx, &FailoverHeartbeatRequest{Epoch: 1, PrimaryEni: "eni-a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A heartbeat shows the primary is reachable, however recently the witness started
+	vote, err := w.RequestVote(ctx, &FailoverVoteRequest{CandidateId: "i-b", Epoch: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vote.Granted {
+		t.Fatal("vote granted while the primary is reachable")
+	}
+
+	time.Sleep(w.primaryDownAfter())
+	vote, err = w.RequestVote(ctx, &FailoverVoteRequest{CandidateId: "i-b", Epoch: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !vote.Granted {
+		t.Fatalf("vote refused once the primary missed its heartbeats: %s", vote.Reason)
+	}
+
+	vote, err = w.RequestVote(ctx, &FailoverVoteRequest{CandidateId: "i-c", Epoch: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vote.Granted {
+		t.Fatal("vote granted to a second candidate in the same epoch")
+	}
+}
+
+func TestWitnessEpochSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	stateDir := t.TempDir()
+
+	w := newTestWitness(t, stateDir)
+	if _, err := w.Heartbeat(ctx, &FailoverHeartbeatRequest{Epoch: 5, PrimaryEni: "eni-a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := newTestWitness(t, stateDir)
+	health, err := restarted.HealthCheck(ctx, &FailoverHealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.Epoch != 5 {
+		t.Fatalf("epoch after restart: got %d, want 5", health.Epoch)
+	}
+
+	time.Sleep(restarted.primaryDownAfter())
+	vote, err := restarted.RequestVote(ctx, &FailoverVoteRequest{CandidateId: "i-b", Epoch: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vote.Granted {
+		t.Fatal("restarted witness granted a vote for a lower epoch")
+	}
+
+	heartbeat, err := restarted.Heartbeat(ctx, &FailoverHeartbeatRequest{Epoch: 4, PrimaryEni: "eni-b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heartbeat.Success {
+		t.Fatal("restarted witness accepted a heartbeat from a lower epoch")
+	}
+}
@@ -22,7 +22,7 @@ resource "aws_iam_role_policy" "architect_nat" {
   role = aws_iam_role.architect_nat.id
   policy = jsonencode({
     Version = "2012-10-17",
-    Statement = [
+    Statement = concat([
       {
         Effect = "Allow",
         Action = [
@@ -35,8 +35,26 @@ resource "aws_iam_role_policy" "architect_nat" {
           "ec2:Describe*"
         ],
         Resource = "*"
+      },
+      {
+        # Stamp the leadership epoch on the ENIs so a stale primary is fenced off
+        Effect   = "Allow",
+        Action   = ["ec2:CreateTags"],
+        Resource = "arn:aws:ec2:*:*:network-interface/*",
+        Condition = {
+          "ForAllValues:StringEquals" = {
+            "aws:TagKeys" = ["architect-networking:epoch"]
+          }
+        }
       }
-    ]
+      ],
+      # Hold the leadership lease of the 'lease' election backend
+      [for table in compact([var.lease_table_arn]) : {
+        Effect   = "Allow",
+        Action   = ["dynamodb:GetItem", "dynamodb:PutItem"],
+        Resource = table
+      }]
+    )
   })
 }
 
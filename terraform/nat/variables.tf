@@ -87,6 +87,12 @@ variable "conduit_version" {
   type        = string
 }
 
+variable "lease_table_arn" {
+  description = "OPTIONAL ARN of the DynamoDB table holding the failover lease, grants the instances access to it for the 'lease' election backend"
+  type        = string
+  default     = ""
+}
+
 # Optional operational knobs retained
 variable "enable_cloudwatch_agent" {
   description = "Install and configure the CloudWatch agent"